@@ -0,0 +1,255 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"example/hello/internal/storage"
+)
+
+// RollbackRequest is the body of POST /v1/admin/rollback. ExpectedLastBlock must equal
+// the current highest indexed block, so a stale or accidental request cannot wipe data.
+type RollbackRequest struct {
+	ToBlockNumber     *uint64 `json:"toBlockNumber"`
+	ExpectedLastBlock *uint64 `json:"expectedLastBlock"`
+}
+
+// registerAdminRoutes adds destructive endpoints; they exist only when an admin token is set
+func (s *Server) registerAdminRoutes() {
+	if s.opts.AdminToken == "" {
+		return
+	}
+	s.mux.Handle("/v1/admin/rollback", s.requireAdmin(http.HandlerFunc(s.handleAdminRollback)))
+	s.mux.Handle("/v1/admin/reindex", s.requireAdmin(http.HandlerFunc(s.handleAdminReindex)))
+	s.mux.Handle("/v1/admin/incomplete", s.requireAdmin(http.HandlerFunc(s.handleAdminIncomplete)))
+	s.mux.Handle("/v1/admin/import", s.requireAdmin(http.HandlerFunc(s.handleAdminImport)))
+	s.mux.Handle("/v1/admin/snapshot", s.requireAdmin(http.HandlerFunc(s.handleAdminSnapshot)))
+	s.mux.Handle("/v1/admin/dead-letters", s.requireAdmin(http.HandlerFunc(s.handleAdminDeadLetters)))
+	s.mux.Handle("/v1/admin/dead-letters/reprocess", s.requireAdmin(http.HandlerFunc(s.handleAdminReprocess)))
+}
+
+// requireAdmin rejects requests without "Authorization: Bearer <AdminToken>"
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleAdminRollback deletes logs above toBlockNumber after checking expectedLastBlock
+func (s *Server) handleAdminRollback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.routeTimeout("admin", 60*time.Second))
+	defer cancel()
+
+	var req RollbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+		return
+	}
+	if req.ToBlockNumber == nil || req.ExpectedLastBlock == nil {
+		writeError(w, http.StatusBadRequest, "toBlockNumber and expectedLastBlock are required")
+		return
+	}
+	if *req.ToBlockNumber >= *req.ExpectedLastBlock {
+		writeError(w, http.StatusBadRequest, "toBlockNumber must be below expectedLastBlock")
+		return
+	}
+
+	err := s.storage.RollbackIfLastBlock(ctx, *req.ToBlockNumber, *req.ExpectedLastBlock)
+	if errors.Is(err, storage.ErrLastBlockMismatch) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Rollback failed: %v", err))
+		return
+	}
+
+	s.logger.Warn("Admin rollback applied",
+		"toBlock", *req.ToBlockNumber, "previousLastBlock", *req.ExpectedLastBlock)
+	writeJSON(w, r, map[string]uint64{
+		"toBlockNumber":     *req.ToBlockNumber,
+		"previousLastBlock": *req.ExpectedLastBlock,
+	})
+}
+
+// ReprocessRequest is the body of POST /v1/admin/dead-letters/reprocess
+type ReprocessRequest struct {
+	Indices []uint64 `json:"indices"`
+}
+
+// handleAdminDeadLetters pages through logs that failed processing, with their errors.
+// Query: startIndex (default 0), limit (default 100); nextCursor continues the listing.
+func (s *Server) handleAdminDeadLetters(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.routeTimeout("admin", 60*time.Second))
+	defer cancel()
+
+	q := r.URL.Query()
+	startIndex := parseUint64(q.Get("startIndex"), 0)
+	limit := parseInt(q.Get("limit"), 100)
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+
+	letters, err := s.storage.GetDeadLetters(ctx, startIndex, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Query failed: %v", err))
+		return
+	}
+
+	var nextCursor *uint64
+	if len(letters) >= limit {
+		next := letters[len(letters)-1].Entry.Index + 1
+		nextCursor = &next
+	}
+	s.writeList(w, r, letters, len(letters), nextCursor)
+}
+
+// handleAdminReprocess stores the captured entries of the given dead letters. Those
+// that fail again stay dead-lettered and are returned with the new error.
+func (s *Server) handleAdminReprocess(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.routeTimeout("admin", 60*time.Second))
+	defer cancel()
+
+	var req ReprocessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+		return
+	}
+	if len(req.Indices) == 0 {
+		writeError(w, http.StatusBadRequest, "indices is required")
+		return
+	}
+
+	result, err := s.storage.ReprocessDeadLetters(ctx, req.Indices)
+	if errors.Is(err, storage.ErrReadOnly) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Reprocess failed: %v", err))
+		return
+	}
+
+	s.logger.Info("Admin dead-letter reprocess", "stored", len(result.Stored), "failed", len(result.Failed), "missing", len(result.Missing))
+	writeJSON(w, r, result)
+}
+
+// SnapshotRequest is the body of POST /v1/admin/snapshot
+type SnapshotRequest struct {
+	Block *uint64 `json:"block"`
+}
+
+// handleAdminSnapshot writes the index as of a block into SnapshotDir/snapshot_<block>.db
+func (s *Server) handleAdminSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.routeTimeout("admin", 60*time.Second))
+	defer cancel()
+
+	var req SnapshotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+		return
+	}
+	if req.Block == nil {
+		writeError(w, http.StatusBadRequest, "block is required")
+		return
+	}
+
+	if err := os.MkdirAll(s.opts.SnapshotDir, 0755); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create snapshot dir: %v", err))
+		return
+	}
+	path := filepath.Join(s.opts.SnapshotDir, fmt.Sprintf("snapshot_%d.db", *req.Block))
+	info, err := s.storage.Snapshot(ctx, path, *req.Block)
+	if errors.Is(err, storage.ErrSnapshotExists) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	info.Path = path
+
+	s.logger.Info("Admin snapshot written", "block", info.Block, "logs", info.LogCount, "path", path)
+	writeJSON(w, r, info)
+}
+
+// handleAdminReindex rebuilds the secondary indexes from the logs bucket
+func (s *Server) handleAdminReindex(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.routeTimeout("admin", 60*time.Second))
+	defer cancel()
+
+	result, err := s.storage.Reindex(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.logger.Info("Admin reindex complete", "scanned", result.Scanned, "skipped", result.Skipped, "buckets", result.Buckets)
+	writeJSON(w, r, result)
+}
+
+// handleAdminIncomplete pages through entries stored with enriched:false.
+// Query: startIndex (default 0), limit (default 100); nextCursor continues the listing.
+func (s *Server) handleAdminIncomplete(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.routeTimeout("admin", 60*time.Second))
+	defer cancel()
+
+	q := r.URL.Query()
+	startIndex := parseUint64(q.Get("startIndex"), 0)
+	limit := parseInt(q.Get("limit"), 100)
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+
+	logs, err := s.storage.GetIncompleteLogs(ctx, startIndex, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Query failed: %v", err))
+		return
+	}
+
+	var nextCursor *uint64
+	if len(logs) >= limit {
+		next := logs[len(logs)-1].Index + 1
+		nextCursor = &next
+	}
+	s.writeList(w, r, logs, len(logs), nextCursor)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"example/hello/pkg/types"
+)
+
+// postRollback sends a rollback body to the admin route with an optional bearer token
+func postRollback(t *testing.T, s *Server, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/v1/admin/rollback", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminRollbackChecksExpectedLastBlock(t *testing.T) {
+	ctx := context.Background()
+	opts := DefaultOptions()
+	opts.AdminToken = "secret"
+	s, store := newTestServer(t, opts)
+	for i := uint64(0); i < 5; i++ {
+		storeLogs(t, store, &types.LogEntry{Index: i, BlockNumber: 100 + i, Enriched: true})
+	}
+
+	if rec := postRollback(t, s, "wrong", `{"toBlockNumber":101,"expectedLastBlock":104}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("bad token: status %d, want 401", rec.Code)
+	}
+	if rec := postRollback(t, s, "secret", `{"toBlockNumber":0}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("missing expectedLastBlock: status %d, want 400", rec.Code)
+	}
+
+	// A client that last saw block 103 is out of date and must not delete anything
+	if rec := postRollback(t, s, "secret", `{"toBlockNumber":101,"expectedLastBlock":103}`); rec.Code != http.StatusConflict {
+		t.Errorf("stale expectedLastBlock: status %d, want 409: %s", rec.Code, rec.Body)
+	}
+	if n, _ := store.GetTotalCount(ctx); n != 5 {
+		t.Fatalf("%d logs left after rejected rollback, want 5", n)
+	}
+
+	if rec := postRollback(t, s, "secret", `{"toBlockNumber":101,"expectedLastBlock":104}`); rec.Code != http.StatusOK {
+		t.Fatalf("matching rollback: status %d: %s", rec.Code, rec.Body)
+	}
+	if n, _ := store.GetTotalCount(ctx); n != 2 {
+		t.Errorf("%d logs left after rollback to 101, want 2", n)
+	}
+
+	// Without a token the route is not registered at all
+	plain, _ := newTestServer(t, DefaultOptions())
+	if rec := postRollback(t, plain, "", `{"toBlockNumber":0,"expectedLastBlock":1}`); rec.Code != http.StatusNotFound {
+		t.Errorf("admin route without AdminToken: status %d, want 404", rec.Code)
+	}
+}
+
+func TestAdminIncompleteListsOnlyUnenriched(t *testing.T) {
+	opts := DefaultOptions()
+	opts.AdminToken = "secret"
+	s, store := newTestServer(t, opts)
+	auth := []string{"Authorization", "Bearer secret"}
+	for i := uint64(0); i < 8; i++ {
+		storeLogs(t, store, &types.LogEntry{Index: i, BlockNumber: 100 + i, Enriched: i%3 == 0})
+	}
+
+	if rec := get(t, s, "/v1/admin/incomplete"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("without token: status %d, want 401", rec.Code)
+	}
+
+	got, next := getLogs(t, s, "/v1/admin/incomplete?limit=3", auth...)
+	if !slices.Equal(got, []uint64{1, 2, 4}) || next == nil || *next != 5 {
+		t.Fatalf("first page = %v next %v, want [1 2 4] next 5", got, next)
+	}
+	got, next = getLogs(t, s, fmt.Sprintf("/v1/admin/incomplete?limit=3&startIndex=%d", *next), auth...)
+	if !slices.Equal(got, []uint64{5, 7}) || next != nil {
+		t.Errorf("second page = %v next %v, want [5 7] and no cursor", got, next)
+	}
+
+	// An enrichment pass rewriting an entry takes it off the list
+	storeLogs(t, store, &types.LogEntry{Index: 2, BlockNumber: 102, Enriched: true})
+	if got, _ := getLogs(t, s, "/v1/admin/incomplete", auth...); !slices.Equal(got, []uint64{1, 4, 5, 7}) {
+		t.Errorf("after enriching 2 = %v, want [1 4 5 7]", got)
+	}
+}
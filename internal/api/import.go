@@ -0,0 +1,153 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"example/hello/pkg/types"
+)
+
+// maxImportLine bounds a single NDJSON record; archival entries with raw data can be large
+const maxImportLine = 4 << 20
+
+var hashPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{64}$`)
+
+// ImportError reports why one NDJSON line was rejected
+type ImportError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// ImportResult is returned when every line was valid and has been stored
+type ImportResult struct {
+	Imported   int    `json:"imported"`
+	FirstIndex uint64 `json:"firstIndex"`
+	LastIndex  uint64 `json:"lastIndex"`
+}
+
+// handleAdminImport stores NDJSON LogEntry records. Every line is decoded and validated
+// before anything is written; if any line fails, the response is 422 listing each bad
+// line and nothing is imported. Valid input is stored in a single transaction.
+func (s *Server) handleAdminImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.routeTimeout("admin", 60*time.Second))
+	defer cancel()
+
+	maxBytes := s.opts.MaxImportBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultOptions().MaxImportBytes
+	}
+	body := http.MaxBytesReader(w, r.Body, maxBytes)
+
+	var entries []*types.LogEntry
+	var problems []ImportError
+	var lastIndex uint64
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLine)
+	for line := 1; scanner.Scan(); line++ {
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+
+		var entry types.LogEntry
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&entry); err != nil {
+			problems = append(problems, ImportError{Line: line, Message: fmt.Sprintf("invalid JSON: %v", err)})
+			continue
+		}
+		if s.opts.SkipImportValidation {
+			entries = append(entries, &entry)
+			continue
+		}
+
+		msgs := validateImportEntry(&entry)
+		if len(entries) > 0 && entry.Index <= lastIndex {
+			msgs = append(msgs, fmt.Sprintf("index %d is not above the previous line's %d", entry.Index, lastIndex))
+		}
+		for _, msg := range msgs {
+			problems = append(problems, ImportError{Line: line, Message: msg})
+		}
+		if len(msgs) == 0 {
+			entries = append(entries, &entry)
+			lastIndex = entry.Index
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Failed to read body: %v", err))
+		return
+	}
+
+	if len(problems) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(types.ApiResponse{
+			Status: http.StatusUnprocessableEntity,
+			Error:  fmt.Sprintf("%d problems found, nothing imported", len(problems)),
+			Data:   problems,
+		})
+		return
+	}
+	if len(entries) == 0 {
+		writeError(w, http.StatusBadRequest, "No records in body")
+		return
+	}
+
+	if err := s.storage.StoreLogs(ctx, entries); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Import failed, nothing stored: %v", err))
+		return
+	}
+
+	result := ImportResult{
+		Imported:   len(entries),
+		FirstIndex: entries[0].Index,
+		LastIndex:  entries[len(entries)-1].Index,
+	}
+	s.logger.Info("Admin import complete", "imported", result.Imported, "firstIndex", result.FirstIndex, "lastIndex", result.LastIndex)
+	writeJSON(w, r, result)
+}
+
+// validateImportEntry checks the fields every stored entry must have and the format
+// of every hash present
+func validateImportEntry(e *types.LogEntry) []string {
+	var msgs []string
+	if e.BlockNumber == 0 {
+		msgs = append(msgs, "blockNumber is required")
+	}
+	for _, f := range []struct {
+		name, value string
+		required    bool
+	}{
+		{"blockHash", e.BlockHash, true},
+		{"txHash", e.TxHash, true},
+		{"parentHash", e.ParentHash, false},
+	} {
+		switch {
+		case f.value == "" && f.required:
+			msgs = append(msgs, f.name+" is required")
+		case f.value != "" && !hashPattern.MatchString(f.value):
+			msgs = append(msgs, fmt.Sprintf("%s %q is not a 0x-prefixed 32-byte hex hash", f.name, f.value))
+		}
+	}
+	for i, topic := range e.Topics {
+		if !hashPattern.MatchString(topic) {
+			msgs = append(msgs, fmt.Sprintf("topics[%d] %q is not a 0x-prefixed 32-byte hex hash", i, topic))
+		}
+	}
+	if len(e.Topics) > 4 {
+		msgs = append(msgs, fmt.Sprintf("%d topics, a log has at most 4", len(e.Topics)))
+	}
+	return msgs
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// importLine renders one NDJSON record with valid hashes for index and block
+func importLine(index, block uint64) string {
+	return fmt.Sprintf(`{"index":%d,"blockNumber":%d,"blockHash":"0x%064x","txHash":"0x%064x"}`, index, block, block, index)
+}
+
+func TestAdminImportRejectsMixedInputWhole(t *testing.T) {
+	ctx := context.Background()
+	opts := DefaultOptions()
+	opts.AdminToken = "secret"
+	s, store := newTestServer(t, opts)
+
+	post := func(lines ...string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/v1/admin/import", strings.NewReader(strings.Join(lines, "\n")))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		s.handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post(
+		importLine(0, 10),
+		`{"index":1,"blockNumber":11,"blockHash":"0xabc","txHash":"0x`+strings.Repeat("1", 64)+`"}`,
+		importLine(2, 12),
+		"",
+		importLine(2, 12),
+		`{"index":4,"blockNumber":`,
+		`{"index":5,"blockNumber":15,"blockHash":"0x`+strings.Repeat("2", 64)+`"}`,
+		importLine(6, 16),
+	)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("mixed input: status %d, want 422: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Data []ImportError `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	// Line 4 is blank; line 5 repeats index 2
+	wantLines := []int{2, 5, 6, 7}
+	if len(resp.Data) != len(wantLines) {
+		t.Fatalf("problems %+v, want one each on lines %v", resp.Data, wantLines)
+	}
+	for i, p := range resp.Data {
+		if p.Line != wantLines[i] {
+			t.Errorf("problem %d on line %d (%s), want line %d", i, p.Line, p.Message, wantLines[i])
+		}
+	}
+	if n, _ := store.GetTotalCount(ctx); n != 0 {
+		t.Errorf("%d logs stored from a rejected import, want none", n)
+	}
+
+	rec = post(importLine(0, 10), importLine(1, 11), importLine(2, 12))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("valid import: status %d: %s", rec.Code, rec.Body)
+	}
+	if n, _ := store.GetTotalCount(ctx); n != 3 {
+		t.Errorf("%d logs stored from a valid import, want 3", n)
+	}
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example/hello/internal/storage"
+	"example/hello/pkg/types"
+)
+
+// Readiness states reported by /v1/ready
+const (
+	ReadyWarmingUp = "warming up"
+	ReadyOK        = "ready"
+	ReadyFailed    = "warmup failed"
+	ReadyNotReady  = "not ready"
+)
+
+// probePaths stay reachable while the server is warming up
+var probePaths = map[string]bool{
+	"/v1/live":    true,
+	"/v1/ready":   true,
+	"/v1/health":  true,
+	"/v1/version": true,
+	"/health":     true,
+}
+
+// warmupState tracks the outcome of Warmup for /v1/ready and the request gate
+type warmupState struct {
+	ready int32 // 1 once warmup succeeded, read on every request
+	mu    sync.Mutex
+	info  types.ReadyStatus
+}
+
+func (w *warmupState) isReady() bool {
+	return atomic.LoadInt32(&w.ready) == 1
+}
+
+// Warmup prepares storage before the server takes traffic: it pings the database,
+// loads and checks the checkpoint, and reads the log count so the first /v1/logs
+// requests do not pay for it. Until it succeeds, /v1/ready answers 503 and every
+// route but the probes is refused with 503. Without Options.Warmup the server is
+// ready from the start; a failed Warmup takes it out of service either way.
+func (s *Server) Warmup(ctx context.Context) error {
+	start := time.Now()
+	info, err := s.warmup(ctx)
+	info.WarmupSeconds = time.Since(start).Seconds()
+
+	s.warm.mu.Lock()
+	defer s.warm.mu.Unlock()
+	if err != nil {
+		info.Status = ReadyFailed
+		info.Error = err.Error()
+		s.warm.info = info
+		atomic.StoreInt32(&s.warm.ready, 0)
+		s.logger.Error("API warmup failed", "error", err)
+		return err
+	}
+	info.Status = ReadyOK
+	s.warm.info = info
+	atomic.StoreInt32(&s.warm.ready, 1)
+	s.logger.Info("API warmup complete", "totalIndexed", info.TotalIndexed,
+		"checkpointBlock", info.CheckpointBlock, "took", time.Since(start))
+	return nil
+}
+
+func (s *Server) warmup(ctx context.Context) (types.ReadyStatus, error) {
+	var info types.ReadyStatus
+	if err := s.storage.Ping(ctx); err != nil {
+		return info, fmt.Errorf("storage ping: %w", err)
+	}
+
+	checkpoint, err := s.storage.GetCheckpoint(ctx)
+	switch {
+	case errors.Is(err, storage.ErrNoCheckpoint):
+		// Fresh database: the indexer starts from its configured block
+	case err != nil:
+		return info, fmt.Errorf("load checkpoint: %w", err)
+	default:
+		if err := s.checkCheckpoint(ctx, checkpoint); err != nil {
+			return info, err
+		}
+		info.CheckpointBlock = checkpoint.LastProcessedBlock
+	}
+
+	total, err := s.storage.GetTotalCount(ctx)
+	if err != nil {
+		return info, fmt.Errorf("count logs: %w", err)
+	}
+	info.TotalIndexed = total
+	return info, nil
+}
+
+// checkCheckpoint rejects a checkpoint whose block hash disagrees with the hash stored
+// for the same block, which means the checkpoint and the logs come from different forks
+func (s *Server) checkCheckpoint(ctx context.Context, cp *types.CheckpointData) error {
+	if cp.LastBlockHash == "" || cp.LastProcessedBlock == 0 {
+		return nil
+	}
+	stored, err := s.storage.GetBlockHash(ctx, cp.LastProcessedBlock)
+	if err != nil {
+		return nil // no hash recorded for the block, nothing to compare
+	}
+	if !strings.EqualFold(stored, cp.LastBlockHash) {
+		return fmt.Errorf("checkpoint block %d has hash %s but storage has %s",
+			cp.LastProcessedBlock, cp.LastBlockHash, stored)
+	}
+	return nil
+}
+
+// handleLive answers 200 whenever the process can serve a request. It touches neither
+// storage nor RPC, so a liveness probe never restarts a pod that is only lagging.
+func (s *Server) handleLive(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, map[string]interface{}{
+		"status":    "alive",
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// handleReady answers 200 when the server should take traffic: warmup has succeeded,
+// storage answers a ping, the indexer can reach its RPC node and the head lag is within
+// HeadLagThreshold. Otherwise it answers 503; the body lists each check.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	s.warm.mu.Lock()
+	info := s.warm.info
+	s.warm.mu.Unlock()
+
+	if s.warm.isReady() {
+		ctx, cancel := context.WithTimeout(r.Context(), s.routeTimeout("health", 5*time.Second))
+		defer cancel()
+		s.checkReadiness(ctx, &info)
+	} else if info.Status == "" {
+		info.Status = ReadyWarmingUp
+	}
+
+	if info.Status != ReadyOK {
+		w.Header().Set("Retry-After", "1")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(&info)
+		return
+	}
+	writeJSON(w, r, &info)
+}
+
+// checkReadiness runs the per-request readiness checks, marking info not ready when
+// any of them fails
+func (s *Server) checkReadiness(ctx context.Context, info *types.ReadyStatus) {
+	info.HeadLagThreshold = s.opts.HeadLagThreshold
+	check := func(name string, err error) {
+		c := types.ReadyCheck{Name: name, OK: err == nil}
+		if err != nil {
+			c.Error = err.Error()
+			info.Status = ReadyNotReady
+		}
+		info.Checks = append(info.Checks, c)
+	}
+
+	check("storage", s.storage.Ping(ctx))
+
+	stats, err := s.indexer.GetStats(ctx)
+	if err == nil && stats.HeadBlock == 0 {
+		err = errors.New("no head block from RPC")
+	}
+	check("rpc", err)
+	if err != nil {
+		return // the lag is unknown without stats
+	}
+
+	info.HeadLag = stats.HeadLag
+	if stats.HeadLag > s.opts.HeadLagThreshold {
+		err = fmt.Errorf("head lag %d blocks above threshold %d", stats.HeadLag, s.opts.HeadLagThreshold)
+	}
+	check("lag", err)
+}
+
+// gateWarmup refuses everything but the probes until warmup has succeeded
+func (s *Server) gateWarmup(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.warm.isReady() && !probePaths[r.URL.Path] {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusServiceUnavailable, "Server is warming up")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"example/hello/internal/storage"
+	"example/hello/pkg/types"
+)
+
+// stalledStorage holds Ping until release is closed, as a database still being opened
+type stalledStorage struct {
+	storage.Storage
+	release chan struct{}
+}
+
+func (s *stalledStorage) Ping(ctx context.Context) error {
+	select {
+	case <-s.release:
+		return s.Storage.Ping(ctx)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestReadyOnlyAfterWarmup(t *testing.T) {
+	_, store := newTestServer(t, DefaultOptions())
+	storeLogs(t, store, &types.LogEntry{Index: 0, BlockNumber: 10}, &types.LogEntry{Index: 1, BlockNumber: 11})
+	stalled := &stalledStorage{Storage: store, release: make(chan struct{})}
+
+	opts := DefaultOptions()
+	opts.Warmup = true
+	idx := &fakeIndexer{stats: types.IndexerStats{HeadBlock: 11}}
+	s := NewServerWithOptions(idx, stalled, slog.New(slog.NewTextHandler(io.Discard, nil)), ":0", opts)
+
+	done := make(chan error, 1)
+	go func() { done <- s.Warmup(context.Background()) }()
+
+	rec := get(t, s, "/v1/ready")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("/v1/ready during warmup = %d (Retry-After %q), want 503 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if code := get(t, s, "/v1/logs").Code; code != http.StatusServiceUnavailable {
+		t.Errorf("/v1/logs during warmup = %d, want 503", code)
+	}
+	if code := get(t, s, "/v1/version").Code; code != http.StatusOK {
+		t.Errorf("/v1/version during warmup = %d, want the probe served", code)
+	}
+	if code := get(t, s, "/metrics").Code; code != http.StatusServiceUnavailable {
+		t.Errorf("/metrics during warmup = %d, want 503 like any non-probe path", code)
+	}
+
+	close(stalled.release)
+	if err := <-done; err != nil {
+		t.Fatalf("warmup: %v", err)
+	}
+	var status types.ReadyStatus
+	decode(t, get(t, s, "/v1/ready"), &status)
+	if status.Status != ReadyOK || status.TotalIndexed != 2 {
+		t.Errorf("/v1/ready after warmup: %+v, want ready with 2 logs counted", status)
+	}
+	if code := get(t, s, "/v1/logs").Code; code != http.StatusOK {
+		t.Errorf("/v1/logs after warmup = %d, want 200", code)
+	}
+	// Metrics are scraped from the metrics listener, behind METRICS_TOKEN, never the API port
+	if code := get(t, s, "/metrics").Code; code != http.StatusNotFound {
+		t.Errorf("/metrics on the API after warmup = %d, want 404", code)
+	}
+}
+
+func TestWarmupFailsOnForkedCheckpoint(t *testing.T) {
+	_, store := newTestServer(t, DefaultOptions())
+	ctx := context.Background()
+	if err := store.StoreBlockHash(ctx, 20, "0xaaaa"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveCheckpoint(ctx, &types.CheckpointData{LastProcessedBlock: 20, LastBlockHash: "0xbbbb"}); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultOptions()
+	opts.Warmup = true
+	s := NewServerWithOptions(&fakeIndexer{stats: types.IndexerStats{HeadBlock: 20}}, store,
+		slog.New(slog.NewTextHandler(io.Discard, nil)), ":0", opts)
+	if err := s.Warmup(ctx); err == nil {
+		t.Fatal("warmup accepted a checkpoint whose hash disagrees with storage")
+	}
+	if rec := get(t, s, "/v1/ready"); rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), ReadyFailed) {
+		t.Errorf("/v1/ready after a failed warmup = %d %s, want 503 %q", rec.Code, rec.Body, ReadyFailed)
+	}
+}
+
+// downStorage fails Ping, as a database whose file has gone away
+type downStorage struct {
+	storage.Storage
+}
+
+func (downStorage) Ping(ctx context.Context) error {
+	return errors.New("database not open")
+}
+
+func TestLiveAndReadyUnderStates(t *testing.T) {
+	_, store := newTestServer(t, DefaultOptions())
+	for _, tc := range []struct {
+		name   string
+		stats  types.IndexerStats
+		down   bool
+		ready  int
+		failed string // the check /v1/ready reports failed
+	}{
+		{"caught up", types.IndexerStats{HeadBlock: 1000, HeadLag: 3}, false, http.StatusOK, ""},
+		{"at the threshold", types.IndexerStats{HeadBlock: 1000, HeadLag: 128}, false, http.StatusOK, ""},
+		{"lagging", types.IndexerStats{HeadBlock: 1000, HeadLag: 500}, false, http.StatusServiceUnavailable, "lag"},
+		{"RPC unreachable", types.IndexerStats{}, false, http.StatusServiceUnavailable, "rpc"},
+		{"storage down", types.IndexerStats{HeadBlock: 1000}, true, http.StatusServiceUnavailable, "storage"},
+	} {
+		var st storage.Storage = store
+		if tc.down {
+			st = downStorage{store}
+		}
+		s := NewServerWithOptions(&fakeIndexer{stats: tc.stats}, st,
+			slog.New(slog.NewTextHandler(io.Discard, nil)), ":0", DefaultOptions())
+
+		// Liveness does no I/O, so a lagging or disconnected pod is not restarted
+		if code := get(t, s, "/v1/live").Code; code != http.StatusOK {
+			t.Errorf("%s: /v1/live = %d, want 200", tc.name, code)
+		}
+
+		rec := get(t, s, "/v1/ready")
+		if rec.Code != tc.ready {
+			t.Errorf("%s: /v1/ready = %d, want %d: %s", tc.name, rec.Code, tc.ready, rec.Body)
+			continue
+		}
+		var status types.ReadyStatus
+		if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+			t.Fatal(err)
+		}
+		var failed []string
+		for _, c := range status.Checks {
+			if !c.OK {
+				failed = append(failed, c.Name)
+			}
+		}
+		if got := strings.Join(failed, ","); got != tc.failed {
+			t.Errorf("%s: failed checks %q, want %q", tc.name, got, tc.failed)
+		}
+	}
+}
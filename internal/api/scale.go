@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"example/hello/pkg/types"
+)
+
+// Scale recommendations served at /v1/scale-signal
+const (
+	ScaleUp   = "scale_up"
+	ScaleKeep = "steady"
+	ScaleDown = "scale_down"
+)
+
+// maxScaleSamples bounds the samples kept however often the endpoint is polled
+const maxScaleSamples = 512
+
+type scaleSample struct {
+	at        time.Time
+	lag       uint64
+	processed int64
+}
+
+// scaleTracker keeps the head lag and processed count seen by each /v1/scale-signal
+// request over a sliding window, so the trend follows the controller's polling
+type scaleTracker struct {
+	window  time.Duration
+	samples []scaleSample
+	mu      sync.Mutex
+}
+
+func newScaleTracker(window time.Duration) *scaleTracker {
+	return &scaleTracker{window: window}
+}
+
+// observe records a sample and returns the oldest one still in the window along with
+// the number of samples kept
+func (t *scaleTracker) observe(sample scaleSample) (scaleSample, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.samples = append(t.samples, sample)
+	drop := 0
+	for drop < len(t.samples)-1 && (sample.at.Sub(t.samples[drop].at) > t.window || len(t.samples)-drop > maxScaleSamples) {
+		drop++
+	}
+	t.samples = append(t.samples[:0], t.samples[drop:]...)
+	return t.samples[0], len(t.samples)
+}
+
+// recommendScale maps the numbers of sig to a recommendation and the reason for it.
+// Above the lag threshold it scales up unless the lag is already shrinking; it scales
+// down only when the lag is at or below ScaleDownLag, not growing, and no backfill is
+// running. Until a second sample gives a trend, only the lag itself is considered.
+func recommendScale(sig *types.ScaleSignal) (string, string) {
+	lagging := sig.HeadLag > sig.HeadLagThreshold
+	if sig.Samples < 2 {
+		if lagging {
+			return ScaleUp, "lagging; no trend yet"
+		}
+		return ScaleKeep, "within lag threshold; no trend yet"
+	}
+
+	backfilling := sig.BackfillProgress > 0 && sig.BackfillProgress < 1
+	switch {
+	case lagging && sig.LagTrend < 0 && sig.Throughput > 0:
+		return ScaleKeep, "lagging but catching up"
+	case lagging && sig.Throughput == 0:
+		return ScaleUp, "lagging with no progress"
+	case lagging:
+		return ScaleUp, "lagging and not catching up"
+	case backfilling:
+		return ScaleKeep, "backfill in progress"
+	case sig.HeadLag <= sig.ScaleDownLag && sig.LagTrend <= 0:
+		return ScaleDown, "keeping up with head"
+	default:
+		return ScaleKeep, "within lag threshold"
+	}
+}
+
+// handleScaleSignal returns a scaling recommendation for an autoscaler, derived from the
+// head lag, how it moved since the oldest sample in the window, and the throughput
+func (s *Server) handleScaleSignal(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.routeTimeout("status", 5*time.Second))
+	defer cancel()
+
+	stats, err := s.indexer.GetStats(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to get stats")
+		return
+	}
+
+	now := scaleSample{at: time.Now(), lag: stats.HeadLag, processed: stats.Processed}
+	oldest, n := s.scale.observe(now)
+
+	signal := &types.ScaleSignal{
+		HeadLag:          stats.HeadLag,
+		HeadLagThreshold: s.opts.HeadLagThreshold,
+		ScaleDownLag:     s.opts.ScaleDownLag,
+		BackfillProgress: stats.BackfillProgress,
+		Samples:          n,
+	}
+	if span := now.at.Sub(oldest.at).Seconds(); span > 0 {
+		signal.WindowSeconds = span
+		signal.LagTrend = (float64(now.lag) - float64(oldest.lag)) / span * 60
+		signal.Throughput = float64(now.processed-oldest.processed) / span
+	}
+	signal.Recommendation, signal.Reason = recommendScale(signal)
+
+	writeJSON(w, r, signal)
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"example/hello/pkg/types"
+)
+
+func TestRecommendScale(t *testing.T) {
+	base := types.ScaleSignal{HeadLagThreshold: 100, ScaleDownLag: 8, Samples: 5}
+	for _, tc := range []struct {
+		name string
+		edit func(s *types.ScaleSignal)
+		want string
+	}{
+		{"lagging with no trend yet", func(s *types.ScaleSignal) { s.HeadLag, s.Samples = 500, 1 }, ScaleUp},
+		{"caught up with no trend yet", func(s *types.ScaleSignal) { s.HeadLag, s.Samples = 2, 1 }, ScaleKeep},
+		{"lagging and growing", func(s *types.ScaleSignal) { s.HeadLag, s.LagTrend, s.Throughput = 500, 30, 40 }, ScaleUp},
+		{"lagging and stalled", func(s *types.ScaleSignal) { s.HeadLag, s.LagTrend = 500, -5 }, ScaleUp},
+		{"lagging but catching up", func(s *types.ScaleSignal) { s.HeadLag, s.LagTrend, s.Throughput = 500, -20, 40 }, ScaleKeep},
+		{"backfill running", func(s *types.ScaleSignal) { s.HeadLag, s.BackfillProgress, s.Throughput = 2, 0.4, 900 }, ScaleKeep},
+		{"keeping up", func(s *types.ScaleSignal) { s.HeadLag, s.Throughput = 3, 40 }, ScaleDown},
+		{"keeping up with lag growing", func(s *types.ScaleSignal) { s.HeadLag, s.LagTrend = 3, 2 }, ScaleKeep},
+		{"between scale-down lag and threshold", func(s *types.ScaleSignal) { s.HeadLag = 50 }, ScaleKeep},
+		{"backfill finished", func(s *types.ScaleSignal) { s.HeadLag, s.BackfillProgress = 1, 1 }, ScaleDown},
+	} {
+		sig := base
+		tc.edit(&sig)
+		if got, reason := recommendScale(&sig); got != tc.want {
+			t.Errorf("%s: %s (%s), want %s", tc.name, got, reason, tc.want)
+		}
+	}
+}
+
+func TestScaleTrackerWindow(t *testing.T) {
+	tr := newScaleTracker(time.Minute)
+	start := time.Now()
+	tr.observe(scaleSample{at: start, lag: 10})
+	tr.observe(scaleSample{at: start.Add(30 * time.Second), lag: 20})
+	oldest, n := tr.observe(scaleSample{at: start.Add(90 * time.Second), lag: 40})
+	if n != 2 || oldest.lag != 20 {
+		t.Errorf("oldest sample in a 1m window has lag %d of %d samples, want 20 of 2", oldest.lag, n)
+	}
+}
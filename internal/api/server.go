@@ -1,38 +1,143 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"math"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"example/hello/internal/indexer"
+	"example/hello/internal/metrics"
 	"example/hello/internal/storage"
+	"example/hello/internal/version"
 	"example/hello/pkg/types"
 
 	"github.com/gorilla/websocket"
 )
 
+// Options tunes optional API behaviour
+type Options struct {
+	// HeadLagThreshold is the head lag in blocks above which health reports "lagging"
+	HeadLagThreshold uint64
+	// StatusStreamInterval is how often /v1/status/ws pushes a stats frame
+	StatusStreamInterval time.Duration
+	// LegacyListArrays returns list endpoints as bare JSON arrays instead of an ApiResponse envelope
+	LegacyListArrays bool
+	// RequestTimeout overrides the built-in per-route timeouts for every route when non-zero
+	RequestTimeout time.Duration
+	// RouteTimeouts overrides the timeout of individual routes by name (health, status, range, logs, log, batches, admin)
+	RouteTimeouts map[string]time.Duration
+	// MaxWebSocketConns caps concurrent WebSocket clients across /v1/ws and /v1/status/ws; 0 is unlimited
+	MaxWebSocketConns int
+	// KeyStyle is the JSON key style used when a request does not negotiate one
+	KeyStyle types.KeyStyle
+	// PingInterval is how often /v1/ws sends a ping; keep it below any proxy idle timeout
+	PingInterval time.Duration
+	// MaxMissedPongs closes a /v1/ws connection after this many pings go unanswered
+	MaxMissedPongs int
+	// SessionTTL is how long a WebSocket resume token stays valid after its last activity
+	SessionTTL time.Duration
+	// DrainTimeout bounds how long shutdown waits for WebSocket clients to receive
+	// buffered entries and a close frame before the listener is shut down
+	DrainTimeout time.Duration
+	// Metrics receives API gauges when set
+	Metrics *metrics.Metrics
+	// AdminToken enables the /v1/admin routes, guarded by this bearer token; empty disables them
+	AdminToken string
+	// MaxImportBytes caps the body of POST /v1/admin/import
+	MaxImportBytes int64
+	// SkipImportValidation stores imported records after JSON decoding only, without
+	// the required-field, hash-format and monotonic-index checks
+	SkipImportValidation bool
+	// SnapshotDir is where POST /v1/admin/snapshot writes snapshot databases
+	SnapshotDir string
+	// ScaleWindow is how far back /v1/scale-signal looks to derive the lag trend and throughput
+	ScaleWindow time.Duration
+	// ScaleDownLag is the head lag in blocks at or below which /v1/scale-signal may recommend scaling down
+	ScaleDownLag uint64
+	// Warmup keeps the server not ready, answering 503 on all but the probe routes, until
+	// Warmup has checked storage. StartWithContext runs it once the listener is up.
+	Warmup bool
+}
+
+// DefaultOptions returns the options used by NewServer
+func DefaultOptions() Options {
+	return Options{
+		HeadLagThreshold:     128,
+		StatusStreamInterval: 5 * time.Second,
+		MaxWebSocketConns:    1000,
+		DrainTimeout:         5 * time.Second,
+		SessionTTL:           10 * time.Minute,
+		PingInterval:         30 * time.Second,
+		MaxMissedPongs:       2,
+		MaxImportBytes:       64 << 20,
+		SnapshotDir:          "data/snapshots",
+		ScaleWindow:          5 * time.Minute,
+		ScaleDownLag:         8,
+	}
+}
+
+// Indexer is what the server reads from the indexer: its stats and the live log feed
+type Indexer interface {
+	GetStats(ctx context.Context) (*types.IndexerStats, error)
+	GetLiveChannel() <-chan *types.LogEntry
+}
+
 // Server handles HTTP API endpoints
 type Server struct {
-	indexer *indexer.Indexer
+	indexer Indexer
 	storage storage.Storage
 	logger  *slog.Logger
 	addr    string
+	opts    Options
 	mux     *http.ServeMux
+	wsConns int64 // open WebSocket connections, bounded by MaxWebSocketConns
+
+	sessions     *sessionStore  // WebSocket resume state, keyed by resume token
+	scale        *scaleTracker  // samples behind /v1/scale-signal
+	warm         warmupState    // readiness reported by /v1/ready
+	wsWG         sync.WaitGroup // open WebSocket handlers, waited on during shutdown
+	shutdown     chan struct{}  // closed when shutdown begins so WebSocket handlers can drain
+	shutdownOnce sync.Once
 }
 
 // NewServer creates a new API server
-func NewServer(idx *indexer.Indexer, store storage.Storage, logger *slog.Logger, addr string) *Server {
+func NewServer(idx Indexer, store storage.Storage, logger *slog.Logger, addr string) *Server {
+	return NewServerWithOptions(idx, store, logger, addr, DefaultOptions())
+}
+
+// NewServerWithOptions creates a new API server with optional behaviour configured
+func NewServerWithOptions(idx Indexer, store storage.Storage, logger *slog.Logger, addr string, opts Options) *Server {
 	s := &Server{
-		indexer: idx,
-		storage: store,
-		logger:  logger,
-		addr:    addr,
-		mux:     http.NewServeMux(),
+		indexer:  idx,
+		storage:  store,
+		logger:   logger,
+		addr:     addr,
+		opts:     opts,
+		mux:      http.NewServeMux(),
+		shutdown: make(chan struct{}),
+	}
+	ttl := opts.SessionTTL
+	if ttl <= 0 {
+		ttl = DefaultOptions().SessionTTL
+	}
+	s.sessions = newSessionStore(ttl)
+	window := opts.ScaleWindow
+	if window <= 0 {
+		window = DefaultOptions().ScaleWindow
+	}
+	s.scale = newScaleTracker(window)
+	if !opts.Warmup {
+		s.warm.ready = 1
+		s.warm.info.Status = ReadyOK
 	}
 	s.registerRoutes()
 	return s
@@ -43,18 +148,38 @@ func (s *Server) registerRoutes() {
 	// Health check
 	s.mux.HandleFunc("/v1/health", s.handleHealth)
 
+	// Kubernetes probes: liveness never fails while the process serves, readiness does
+	s.mux.HandleFunc("/v1/live", s.handleLive)
+	s.mux.HandleFunc("/v1/ready", s.handleReady)
+
 	// Status/stats
 	s.mux.HandleFunc("/v1/status", s.handleStatus)
 
+	// Build and schema version
+	s.mux.HandleFunc("/v1/version", s.handleVersion)
+
+	// Autoscaling recommendation
+	s.mux.HandleFunc("/v1/scale-signal", s.handleScaleSignal)
+
+	// Coverage window
+	s.mux.HandleFunc("/v1/range", s.handleRange)
+
 	// Logs endpoints
 	s.mux.HandleFunc("/v1/logs", s.handleGetLogs)
+	s.mux.HandleFunc("/v1/logs/count", s.handleCountLogs)
+	s.mux.HandleFunc("/v1/logs/by-position", s.handleLogByPosition)
 	s.mux.HandleFunc("/v1/logs/", s.handleLogQuery)
 
+	// Bulk indexer batch analytics
+	s.mux.HandleFunc("/v1/batches", s.handleBatches)
+	s.mux.HandleFunc("/v1/analytics/daily", s.handleDailyStats)
+
+	// Destructive operations, only with an admin token
+	s.registerAdminRoutes()
+
 	// WebSocket for live updates
 	s.mux.HandleFunc("/v1/ws", s.handleWebSocket)
-
-	// Prometheus metrics
-	s.mux.HandleFunc("/metrics", s.handleMetrics)
+	s.mux.HandleFunc("/v1/status/ws", s.handleStatusStream)
 
 	// Legacy compatibility
 	s.mux.HandleFunc("/health", s.handleHealth)
@@ -63,7 +188,7 @@ func (s *Server) registerRoutes() {
 
 // handleHealth returns health status
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), s.routeTimeout("health", 5*time.Second))
 	defer cancel()
 
 	stats, err := s.indexer.GetStats(ctx)
@@ -73,7 +198,7 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	status := "healthy"
-	if stats.HeadLag > 128 {
+	if stats.HeadLag > s.opts.HeadLagThreshold {
 		status = "lagging"
 	}
 
@@ -83,14 +208,15 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 		LastBlockIndexed: stats.LastBlockNumber,
 		TotalIndexed:     stats.TotalIndexed,
 		HeadLag:          stats.HeadLag,
+		HeadLagThreshold: s.opts.HeadLagThreshold,
 	}
 
-	writeJSON(w, health)
+	writeJSON(w, r, health)
 }
 
 // handleStatus returns detailed indexer status
 func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), s.routeTimeout("status", 5*time.Second))
 	defer cancel()
 
 	stats, err := s.indexer.GetStats(ctx)
@@ -99,39 +225,113 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeJSON(w, stats)
+	writeJSON(w, r, stats)
+}
+
+// handleVersion reports the running build and the storage schema it reads
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, version.Get(storage.SchemaVersion))
+}
+
+// handleRange returns the first and last indexed block and index
+func (s *Server) handleRange(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.routeTimeout("range", 5*time.Second))
+	defer cancel()
+
+	rng, err := s.storage.GetIndexRange(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get index range: %v", err))
+		return
+	}
+
+	writeJSON(w, r, rng)
 }
 
 // handleGetLogs retrieves logs by query parameters
 func (s *Server) handleGetLogs(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), s.routeTimeout("logs", 10*time.Second))
 	defer cancel()
 
 	q := r.URL.Query()
 	startIndex := parseUint64(q.Get("startIndex"), 0)
 	endIndex := parseUint64(q.Get("endIndex"), 0)
 	blockNumber := parseUint64(q.Get("blockNumber"), 0)
+	txIndexFrom, txIndexTo := q.Get("txIndexFrom"), q.Get("txIndexTo")
 	txHash := q.Get("txHash")
+	eventName := q.Get("event")
+	topic := q.Get("topic")
+	state := q.Get("state")
 	limit := parseInt(q.Get("limit"), 100)
+	if state != "" && state != "pending" && state != "confirmed" {
+		writeError(w, http.StatusBadRequest, "state must be pending or confirmed")
+		return
+	}
+	offset := 0
+	if v := q.Get("offset"); v != "" {
+		n, perr := strconv.Atoi(v)
+		if perr != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "offset must be a non-negative integer")
+			return
+		}
+		offset = n
+	}
+	cursor := q.Get("cursor")
+	if cursor != "" && (offset > 0 || q.Has("startIndex")) {
+		writeError(w, http.StatusBadRequest, "cursor cannot be combined with offset or startIndex")
+		return
+	}
+	var minConfirmations uint64
+	if v := q.Get("minConfirmations"); v != "" {
+		n, perr := strconv.ParseUint(v, 10, 64)
+		if perr != nil {
+			writeError(w, http.StatusBadRequest, "minConfirmations must be a non-negative integer")
+			return
+		}
+		minConfirmations = n
+	}
 
 	var logs []*types.LogEntry
+	var nextCursor *uint64
 	var err error
 
+	if (txIndexFrom != "" || txIndexTo != "") && blockNumber == 0 {
+		writeError(w, http.StatusBadRequest, "txIndexFrom and txIndexTo need a blockNumber")
+		return
+	}
+
 	switch {
+	case blockNumber > 0 && (txIndexFrom != "" || txIndexTo != ""):
+		fromTx := parseUint64(txIndexFrom, 0)
+		toTx := parseUint64(txIndexTo, math.MaxUint64)
+		if fromTx > toTx {
+			writeError(w, http.StatusBadRequest, "txIndexFrom must not exceed txIndexTo")
+			return
+		}
+		logs, err = s.storage.GetLogsByTxIndexRange(ctx, blockNumber, fromTx, toTx)
 	case blockNumber > 0:
 		logs, err = s.storage.GetLogsByBlockNumber(ctx, blockNumber)
 	case txHash != "":
 		logs, err = s.storage.GetLogsByTxHash(ctx, txHash)
-	default:
-		if startIndex == 0 && endIndex == 0 && limit > 0 {
-			// Get latest N logs
-			total, _ := s.storage.GetTotalCount(ctx)
-			if total > 0 {
-				startIndex = total - uint64(limit)
-				endIndex = total - 1
-			}
+	case cursor != "":
+		from, perr := strconv.ParseUint(cursor, 10, 64)
+		if perr != nil {
+			writeError(w, http.StatusBadRequest, "cursor must be a non-negative integer")
+			return
 		}
-		logs, err = s.storage.GetLogsByRange(ctx, startIndex, endIndex, limit)
+		if endIndex > 0 {
+			// Continues a bounded range page: stop at its endIndex as that page did
+			logs, err = s.storage.GetLogsByRange(ctx, from, endIndex, 0, storage.PageProbe(limit))
+			logs, nextCursor = storage.SplitPage(logs, limit)
+		} else {
+			logs, nextCursor, err = s.storage.GetLogsAfter(ctx, from, limit)
+		}
+	case startIndex == 0 && endIndex == 0 && offset == 0 && limit > 0:
+		logs, err = s.latestLogs(ctx, limit)
+	default:
+		// The probe stops at endIndex too, so no cursor is returned once the range is used up;
+		// a cursor that is returned continues the range with ?cursor=N&endIndex=E
+		logs, err = s.storage.GetLogsByRange(ctx, startIndex, endIndex, offset, storage.PageProbe(limit))
+		logs, nextCursor = storage.SplitPage(logs, limit)
 	}
 
 	if err != nil && err.Error() != "not found" {
@@ -139,38 +339,184 @@ func (s *Server) handleGetLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if eventName != "" {
+		logs = filterByEventName(logs, eventName)
+	}
+	if topic != "" {
+		logs = filterByTopic(logs, strings.Split(topic, ","))
+	}
+	if state != "" {
+		logs = filterByState(logs, state == "pending")
+	}
+	if minConfirmations > 0 {
+		stats, serr := s.indexer.GetStats(ctx)
+		if serr != nil || stats.HeadBlock == 0 {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusServiceUnavailable, "Head block unknown, cannot apply minConfirmations")
+			return
+		}
+		logs = filterByConfirmations(logs, stats.HeadBlock, minConfirmations)
+	}
+
 	if logs == nil {
 		logs = make([]*types.LogEntry, 0)
 	}
 
-	writeJSON(w, logs)
+	if wantsCSV(r) {
+		writeCSV(w, logs, nextCursor)
+		return
+	}
+
+	s.writeList(w, r, logs, len(logs), nextCursor)
+}
+
+// latestLogs returns the last limit logs by index. The window ends at the last stored
+// index rather than at the log count, which indices exceed when they start above 0
+// (-index-base) or have gaps (MonotonicIndices after a rollback), and is widened until
+// it holds limit logs or reaches the first index.
+func (s *Server) latestLogs(ctx context.Context, limit int) ([]*types.LogEntry, error) {
+	rng, err := s.storage.GetIndexRange(ctx)
+	if err != nil || rng.TotalCount == 0 {
+		return nil, err
+	}
+	for span := uint64(limit); ; span *= 2 {
+		start := rng.FirstIndex
+		if rng.LastIndex-rng.FirstIndex >= span {
+			start = rng.LastIndex - span + 1
+		}
+		logs, err := s.storage.GetLogsByRange(ctx, start, rng.LastIndex, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(logs) >= limit || start == rng.FirstIndex {
+			return logs[max(len(logs)-limit, 0):], nil
+		}
+	}
 }
 
 // handleLogQuery handles queries for specific log indices or ranges
 func (s *Server) handleLogQuery(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), s.routeTimeout("log", 5*time.Second))
 	defer cancel()
 
-	// Extract index from path: /v1/logs/{index}
+	// Extract index from path: /v1/logs/{index} or /v1/logs/{blockNumber}:{logIndex}
 	indexStr := r.URL.Path[len("/v1/logs/"):]
 	if indexStr == "" {
 		http.Redirect(w, r, "/v1/logs", http.StatusMovedPermanently)
 		return
 	}
 
-	index, err := strconv.ParseUint(indexStr, 10, 64)
+	var log *types.LogEntry
+	var err error
+	if blockStr, logIndexStr, ok := strings.Cut(indexStr, ":"); ok {
+		blockNumber, errB := strconv.ParseUint(blockStr, 10, 64)
+		logIndex, errL := strconv.ParseUint(logIndexStr, 10, 64)
+		if errB != nil || errL != nil {
+			writeError(w, http.StatusBadRequest, "Invalid position, want blockNumber:logIndex")
+			return
+		}
+		log, err = s.storage.GetLogByPosition(ctx, blockNumber, logIndex)
+	} else {
+		index, perr := strconv.ParseUint(indexStr, 10, 64)
+		if perr != nil {
+			writeError(w, http.StatusBadRequest, "Invalid index")
+			return
+		}
+		log, err = s.storage.GetLog(ctx, index)
+	}
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "Invalid index")
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Log not found: %v", err))
+		return
+	}
+
+	writeJSON(w, r, log)
+}
+
+// handleLogByPosition looks a log up by ?block=N&logIndex=M, its chain position, for
+// clients that know a log from another source rather than by our index
+func (s *Server) handleLogByPosition(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.routeTimeout("log", 5*time.Second))
+	defer cancel()
+
+	q := r.URL.Query()
+	blockNumber, errB := strconv.ParseUint(q.Get("block"), 10, 64)
+	logIndex, errL := strconv.ParseUint(q.Get("logIndex"), 10, 64)
+	if errB != nil || errL != nil {
+		writeError(w, http.StatusBadRequest, "block and logIndex are required non-negative integers")
 		return
 	}
 
-	log, err := s.storage.GetLog(ctx, index)
+	log, err := s.storage.GetLogByPosition(ctx, blockNumber, logIndex)
 	if err != nil {
 		writeError(w, http.StatusNotFound, fmt.Sprintf("Log not found: %v", err))
 		return
 	}
 
-	writeJSON(w, log)
+	writeJSON(w, r, log)
+}
+
+// handleCountLogs counts logs in an index range without fetching them
+func (s *Server) handleCountLogs(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.routeTimeout("count", 10*time.Second))
+	defer cancel()
+
+	q := r.URL.Query()
+	startIndex := parseUint64(q.Get("startIndex"), 0)
+	endIndex := parseUint64(q.Get("endIndex"), 0)
+	if endIndex > 0 && endIndex < startIndex {
+		writeError(w, http.StatusBadRequest, "endIndex must not be below startIndex")
+		return
+	}
+
+	count, err := s.storage.CountRange(ctx, startIndex, endIndex)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to count logs: %v", err))
+		return
+	}
+
+	writeJSON(w, r, &types.RangeCount{StartIndex: startIndex, EndIndex: endIndex, Count: count})
+}
+
+// handleBatches returns the per-batch analytics stored by the bulk indexer
+func (s *Server) handleBatches(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.routeTimeout("batches", 10*time.Second))
+	defer cancel()
+
+	batches, err := s.storage.GetBatchInfo(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get batch info: %v", err))
+		return
+	}
+
+	if batches == nil {
+		batches = make([]*types.BatchInfo, 0)
+	}
+
+	s.writeList(w, r, batches, len(batches), nil)
+}
+
+// handleDailyStats returns per-day log counts and gas sums from the daily aggregates,
+// optionally limited to ?from=YYYY-MM-DD&to=YYYY-MM-DD
+func (s *Server) handleDailyStats(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.routeTimeout("daily", 10*time.Second))
+	defer cancel()
+
+	q := r.URL.Query()
+	from, to := q.Get("from"), q.Get("to")
+	for _, day := range []string{from, to} {
+		if _, err := time.Parse(storage.DayLayout, day); day != "" && err != nil {
+			writeError(w, http.StatusBadRequest, "from and to must be YYYY-MM-DD")
+			return
+		}
+	}
+
+	stats, err := s.storage.GetDailyStats(ctx, from, to)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get daily stats: %v", err))
+		return
+	}
+
+	s.writeList(w, r, stats, len(stats), nil)
 }
 
 // handleWebSocket upgrades to WebSocket and streams live logs
@@ -179,6 +525,32 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		CheckOrigin: func(r *http.Request) bool { return true },
 	}
 
+	// Resolve the session before upgrading so a bad token is a plain HTTP error.
+	// Sessions do not survive a restart, so a client that sends its own fromIndex
+	// alongside a stale token starts a new session there instead of failing.
+	q := r.URL.Query()
+	fromIndex, parseErr := strconv.ParseUint(q.Get("fromIndex"), 10, 64)
+	var session *wsSession
+	if token := q.Get("resume"); token != "" {
+		session, _ = s.sessions.get(token)
+	}
+	if session == nil {
+		if q.Get("resume") != "" && parseErr != nil {
+			writeError(w, http.StatusGone, "Unknown or expired resume token")
+			return
+		}
+		var err error
+		if session, err = s.sessions.create(fromIndex, parseErr == nil); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to create session")
+			return
+		}
+	}
+
+	if !s.acquireWebSocket(w) {
+		return
+	}
+	defer s.releaseWebSocket()
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		s.logger.Error("WebSocket upgrade failed", "err", err)
@@ -188,27 +560,110 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 
 	// Send welcome message
 	conn.WriteJSON(map[string]interface{}{
-		"type":    "welcome",
-		"message": "Connected to live log stream",
+		"type":        "welcome",
+		"message":     "Connected to live log stream",
+		"resumeToken": session.token,
 	})
 
+	pingInterval := s.opts.PingInterval
+	if pingInterval <= 0 {
+		pingInterval = DefaultOptions().PingInterval
+	}
+	maxMissed := s.opts.MaxMissedPongs
+	if maxMissed <= 0 {
+		maxMissed = DefaultOptions().MaxMissedPongs
+	}
+
+	// Any client frame, pongs included, proves the connection alive; the read
+	// deadline expires after maxMissed ping intervals of silence
+	liveness := time.Duration(maxMissed)*pingInterval + pingInterval/2
+	conn.SetReadDeadline(time.Now().Add(liveness))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(liveness))
+	})
+
+	// Client messages: {"type":"ack","index":N} confirms everything up to N
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		for {
+			var msg struct {
+				Type  string `json:"type"`
+				Index uint64 `json:"index"`
+			}
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			conn.SetReadDeadline(time.Now().Add(liveness))
+			if msg.Type == "ack" {
+				s.sessions.ack(session, msg.Index)
+			}
+		}
+	}()
+
+	// next is the lowest index not yet delivered on this connection; it is only
+	// meaningful once tracking is set by a replay or the first delivered entry
+	var next uint64
+	var tracking bool
+	send := func(entry *types.LogEntry) error {
+		if tracking && entry.Index < next {
+			return nil // already delivered by the replay
+		}
+		if err := conn.WriteJSON(map[string]interface{}{
+			"type": "log",
+			"data": entry,
+		}); err != nil {
+			return err
+		}
+		s.sessions.sent(session, entry.Index)
+		next = entry.Index + 1
+		tracking = true
+		return nil
+	}
+
+	// The live channel only carries entries committed after this point, so anything
+	// stored between the replay finishing (or the server restarting) and the first
+	// live event would be skipped. A live entry ahead of next triggers another replay
+	// from storage to close the gap before it is sent.
+	sendLive := func(entry *types.LogEntry) error {
+		if tracking && entry.Index > next {
+			if err := s.replayLogs(r.Context(), next, send); err != nil {
+				s.logger.Warn("WebSocket gap replay failed", "from", next, "to", entry.Index, "err", err)
+			}
+		}
+		return send(entry)
+	}
+
+	if from, ok := s.sessions.resumeFrom(session); ok {
+		next, tracking = from, true
+		if err := s.replayLogs(r.Context(), from, send); err != nil {
+			s.logger.Warn("WebSocket replay failed", "from", from, "err", err)
+			return
+		}
+	}
+
 	liveCh := s.indexer.GetLiveChannel()
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(pingInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-r.Context().Done():
 			return
+		case <-readDone:
+			return
+		case <-s.shutdown:
+			s.drainWebSocket(conn, liveCh, sendLive)
+			return
 		case entry := <-liveCh:
-			if err := conn.WriteJSON(map[string]interface{}{
-				"type": "log",
-				"data": entry,
-			}); err != nil {
+			if err := sendLive(entry); err != nil {
 				return
 			}
 		case <-ticker.C:
-			// Ping to keep connection alive
+			// Control ping for liveness, plus the JSON ping older clients watch for
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second)); err != nil {
+				return
+			}
 			if err := conn.WriteJSON(map[string]interface{}{
 				"type": "ping",
 			}); err != nil {
@@ -218,22 +673,328 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleMetrics serves Prometheus metrics in text format
-func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
-	// This would be handled by Prometheus client library
-	// For now, we'll return a simple response
-	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("# HELP eth_indexer_logs_indexed_total Total number of logs indexed\n"))
-	w.Write([]byte("# TYPE eth_indexer_logs_indexed_total counter\n"))
+// replayLogs sends stored entries from index from onward, page by page, until caught up
+func (s *Server) replayLogs(ctx context.Context, from uint64, send func(*types.LogEntry) error) error {
+	const pageSize = 500
+	for {
+		page, err := s.storage.GetLogsByRange(ctx, from, 0, 0, pageSize)
+		if err != nil {
+			return err
+		}
+		for _, entry := range page {
+			if err := send(entry); err != nil {
+				return err
+			}
+			from = entry.Index + 1
+		}
+		if len(page) < pageSize {
+			return nil
+		}
+	}
+}
+
+// handleStatusStream upgrades to WebSocket and pushes indexer stats periodically
+func (s *Server) handleStatusStream(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+
+	if !s.acquireWebSocket(w) {
+		return
+	}
+	defer s.releaseWebSocket()
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.logger.Error("WebSocket upgrade failed", "err", err)
+		return
+	}
+	defer conn.Close()
+
+	interval := s.opts.StatusStreamInterval
+	if interval <= 0 {
+		interval = DefaultOptions().StatusStreamInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		stats, err := s.indexer.GetStats(ctx)
+		cancel()
+
+		frame := map[string]interface{}{"type": "status", "data": stats}
+		if err != nil {
+			frame = map[string]interface{}{"type": "error", "message": "Failed to get stats"}
+		}
+		if err := conn.WriteJSON(frame); err != nil {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.shutdown:
+			closeWebSocket(conn)
+			return
+		case <-ticker.C:
+		}
+	}
 }
 
 // Helper functions
 
-func writeJSON(w http.ResponseWriter, v interface{}) {
+// acquireWebSocket reserves a connection slot before upgrading, answering 503 when
+// the cap is reached so rejected clients never allocate connection buffers
+func (s *Server) acquireWebSocket(w http.ResponseWriter) bool {
+	select {
+	case <-s.shutdown:
+		writeError(w, http.StatusServiceUnavailable, "Server is shutting down")
+		return false
+	default:
+	}
+
+	n := atomic.AddInt64(&s.wsConns, 1)
+	if max := s.opts.MaxWebSocketConns; max > 0 && n > int64(max) {
+		atomic.AddInt64(&s.wsConns, -1)
+		w.Header().Set("Retry-After", "5")
+		writeError(w, http.StatusServiceUnavailable, "Too many WebSocket connections")
+		return false
+	}
+	if s.opts.Metrics != nil {
+		s.opts.Metrics.WebSocketConnections.Inc()
+	}
+	s.wsWG.Add(1)
+	return true
+}
+
+// releaseWebSocket frees a slot taken by acquireWebSocket
+func (s *Server) releaseWebSocket() {
+	atomic.AddInt64(&s.wsConns, -1)
+	if s.opts.Metrics != nil {
+		s.opts.Metrics.WebSocketConnections.Dec()
+	}
+	s.wsWG.Done()
+}
+
+// drainWebSocket forwards live entries already buffered in liveCh, then sends a close
+// frame. Entries arriving after the buffer empties belong to the next connection.
+func (s *Server) drainWebSocket(conn *websocket.Conn, liveCh <-chan *types.LogEntry, send func(*types.LogEntry) error) {
+	for {
+		select {
+		case entry, ok := <-liveCh:
+			if !ok {
+				closeWebSocket(conn)
+				return
+			}
+			if err := send(entry); err != nil {
+				return
+			}
+		default:
+			closeWebSocket(conn)
+			return
+		}
+	}
+}
+
+// closeWebSocket sends a "going away" close frame so clients know to reconnect
+func closeWebSocket(conn *websocket.Conn) {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
+
+// beginShutdown signals WebSocket handlers to drain and waits for them, bounded by
+// DrainTimeout. http.Server.Shutdown does not track hijacked connections itself.
+func (s *Server) beginShutdown() {
+	s.shutdownOnce.Do(func() { close(s.shutdown) })
+
+	done := make(chan struct{})
+	go func() {
+		s.wsWG.Wait()
+		close(done)
+	}()
+
+	timeout := s.opts.DrainTimeout
+	if timeout <= 0 {
+		timeout = DefaultOptions().DrainTimeout
+	}
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		s.logger.Warn("WebSocket drain timed out", "open", atomic.LoadInt64(&s.wsConns))
+	}
+}
+
+// routeTimeout resolves a route's request timeout: a per-route override wins, then
+// the global RequestTimeout, then the route's built-in default
+func (s *Server) routeTimeout(route string, def time.Duration) time.Duration {
+	if d, ok := s.opts.RouteTimeouts[route]; ok && d > 0 {
+		return d
+	}
+	if s.opts.RequestTimeout > 0 {
+		return s.opts.RequestTimeout
+	}
+	return def
+}
+
+// writeTimeout keeps the server write deadline above the longest configured route
+// timeout, otherwise a slow query would be cut off before its context expires
+func (s *Server) writeTimeout() time.Duration {
+	longest := 10 * time.Second
+	if s.opts.RequestTimeout > longest {
+		longest = s.opts.RequestTimeout
+	}
+	for _, d := range s.opts.RouteTimeouts {
+		if d > longest {
+			longest = d
+		}
+	}
+	return longest + time.Second
+}
+
+// filterByEventName keeps entries whose resolved event name (or raw topic0 fallback) matches
+func filterByEventName(logs []*types.LogEntry, name string) []*types.LogEntry {
+	filtered := make([]*types.LogEntry, 0, len(logs))
+	for _, entry := range logs {
+		if strings.EqualFold(entry.EventName, name) {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
+
+// filterByConfirmations keeps entries at least min blocks below head, the same depth
+// CONFIRMATIONS uses: with head 100 and min 6, blocks up to 94 are kept
+func filterByConfirmations(logs []*types.LogEntry, head, min uint64) []*types.LogEntry {
+	if min > head {
+		return make([]*types.LogEntry, 0)
+	}
+	filtered := make([]*types.LogEntry, 0, len(logs))
+	for _, entry := range logs {
+		if entry.BlockNumber <= head-min {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
+
+// filterByTopic keeps entries whose topic0 is one of topics, compared case-insensitively
+func filterByTopic(logs []*types.LogEntry, topics []string) []*types.LogEntry {
+	filtered := make([]*types.LogEntry, 0, len(logs))
+	for _, entry := range logs {
+		topic0 := entry.Topic0()
+		for _, t := range topics {
+			if t = strings.TrimSpace(t); t != "" && strings.EqualFold(topic0, t) {
+				filtered = append(filtered, entry)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// filterByState keeps pending entries, or confirmed ones when pending is false
+func filterByState(logs []*types.LogEntry, pending bool) []*types.LogEntry {
+	filtered := make([]*types.LogEntry, 0, len(logs))
+	for _, entry := range logs {
+		if entry.Pending == pending {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
+
+// writeList wraps list results in an ApiResponse envelope, or writes the bare
+// array when LegacyListArrays is set for clients predating the envelope
+func (s *Server) writeList(w http.ResponseWriter, r *http.Request, items interface{}, count int, nextCursor *uint64) {
+	if s.opts.LegacyListArrays {
+		writeJSON(w, r, items)
+		return
+	}
+	writeJSON(w, r, types.ApiResponse{
+		Status:     http.StatusOK,
+		Data:       items,
+		Count:      &count,
+		NextCursor: nextCursor,
+	})
+}
+
+// wantsCSV reports whether the client asked for CSV, via ?format=csv or an Accept header
+func wantsCSV(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return strings.EqualFold(format, "csv")
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(part, ";")
+		if strings.EqualFold(strings.TrimSpace(mediaType), "text/csv") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCSV streams logs as CSV with a header row. There is no envelope, so the
+// pagination cursor travels in the X-Next-Cursor header instead.
+func writeCSV(w http.ResponseWriter, logs []*types.LogEntry, nextCursor *uint64) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if nextCursor != nil {
+		w.Header().Set("X-Next-Cursor", strconv.FormatUint(*nextCursor, 10))
+	}
+	// Headers are already sent, so a failed write can only be dropped
+	types.WriteCSV(w, logs)
+}
+
+// writeJSON encodes v compactly, or indented when the request carries ?pretty=true.
+// Clients may ask for compact LogEntry keys with ?keys=short or an X-Key-Style header.
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	data, err := json.Marshal(v)
+	if err == nil {
+		data, err = types.ApplyKeyStyle(data, requestKeyStyle(r))
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to encode response: %v", err))
+		return
+	}
+
+	if pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty")); pretty {
+		var buf bytes.Buffer
+		if json.Indent(&buf, data, "", "  ") == nil {
+			data = buf.Bytes()
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
-	json.NewEncoder(w).Encode(v)
+	w.Write(append(data, '\n'))
+}
+
+// handler applies the configured default key style to requests that do not pick one
+// and holds back non-probe routes during warmup
+func (s *Server) handler() http.Handler {
+	gated := s.gateWarmup(s.mux)
+	if s.opts.KeyStyle == types.KeyStyleDefault {
+		return gated
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("keys") == "" && r.Header.Get("X-Key-Style") == "" {
+			r.Header.Set("X-Key-Style", string(s.opts.KeyStyle))
+		}
+		gated.ServeHTTP(w, r)
+	})
+}
+
+// requestKeyStyle reads the negotiated key style, ignoring unknown values
+func requestKeyStyle(r *http.Request) types.KeyStyle {
+	name := r.URL.Query().Get("keys")
+	if name == "" {
+		name = r.Header.Get("X-Key-Style")
+	}
+	style, err := types.ParseKeyStyle(name)
+	if err != nil {
+		return types.KeyStyleDefault
+	}
+	return style
 }
 
 func writeError(w http.ResponseWriter, statusCode int, message string) {
@@ -272,35 +1033,53 @@ func parseInt(s string, defaultVal int) int {
 func (s *Server) Start() error {
 	server := &http.Server{
 		Addr:         s.addr,
-		Handler:      s.mux,
+		Handler:      s.handler(),
 		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		WriteTimeout: s.writeTimeout(),
 		IdleTimeout:  60 * time.Second,
 	}
 
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	if s.opts.Warmup {
+		go s.Warmup(context.Background())
+	}
+
 	s.logger.Info("API server starting", "addr", s.addr)
-	return server.ListenAndServe()
+	return server.Serve(ln)
 }
 
 // StartWithContext starts the server and handles graceful shutdown
 func (s *Server) StartWithContext(ctx context.Context) error {
 	server := &http.Server{
 		Addr:         s.addr,
-		Handler:      s.mux,
+		Handler:      s.handler(),
 		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		WriteTimeout: s.writeTimeout(),
 		IdleTimeout:  60 * time.Second,
 	}
 
 	go func() {
 		<-ctx.Done()
+		s.beginShutdown()
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		server.Shutdown(shutdownCtx)
 	}()
 
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	if s.opts.Warmup {
+		// The listener is bound first so /v1/ready can report the warmup in progress
+		go s.Warmup(ctx)
+	}
+
 	s.logger.Info("API server starting", "addr", s.addr)
-	err := server.ListenAndServe()
+	err = server.Serve(ln)
 	if err != http.ErrServerClosed {
 		return err
 	}
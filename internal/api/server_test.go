@@ -0,0 +1,1020 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example/hello/internal/metrics"
+	"example/hello/internal/storage"
+	"example/hello/internal/version"
+	"example/hello/pkg/types"
+
+	bolt "github.com/boltdb/bolt"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeIndexer reports fixed stats and feeds live logs from a channel the test owns
+type fakeIndexer struct {
+	mu    sync.Mutex
+	stats types.IndexerStats
+	live  chan *types.LogEntry
+}
+
+func (f *fakeIndexer) GetStats(ctx context.Context) (*types.IndexerStats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stats := f.stats
+	return &stats, nil
+}
+
+func (f *fakeIndexer) GetLiveChannel() <-chan *types.LogEntry {
+	return f.live
+}
+
+// newTestServer serves a fresh store in the test's temp dir with opts
+func newTestServer(t *testing.T, opts Options) (*Server, *storage.BoltStorage) {
+	t.Helper()
+	store, err := storage.NewBoltStorage(filepath.Join(t.TempDir(), "api.db"))
+	if err != nil {
+		t.Fatalf("open storage: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	idx := &fakeIndexer{live: make(chan *types.LogEntry)}
+	return NewServerWithOptions(idx, store, slog.New(slog.NewTextHandler(io.Discard, nil)), ":0", opts), store
+}
+
+// storeLogs stores entries, failing the test on the first error
+func storeLogs(t *testing.T, store storage.Storage, entries ...*types.LogEntry) {
+	t.Helper()
+	for _, e := range entries {
+		if err := store.StoreLog(context.Background(), e); err != nil {
+			t.Fatalf("store %d: %v", e.Index, err)
+		}
+	}
+}
+
+// get serves a GET of target through the server's full handler chain
+func get(t *testing.T, s *Server, target string, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	s.handler().ServeHTTP(rec, req)
+	return rec
+}
+
+// decode unmarshals a 200 response body into v
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+}
+
+func TestRangeReportsCoverage(t *testing.T) {
+	s, store := newTestServer(t, DefaultOptions())
+	ctx := context.Background()
+
+	var empty types.IndexRange
+	decode(t, get(t, s, "/v1/range"), &empty)
+	if empty != (types.IndexRange{}) {
+		t.Errorf("empty index range = %+v, want zeroes", empty)
+	}
+
+	for i := uint64(0); i < 6; i++ {
+		storeLogs(t, store, &types.LogEntry{Index: 10 + i, BlockNumber: 200 + i/2, Enriched: true})
+	}
+	var fromLogs types.IndexRange
+	decode(t, get(t, s, "/v1/range"), &fromLogs)
+	want := types.IndexRange{FirstBlock: 200, LastBlock: 202, FirstIndex: 10, LastIndex: 15, TotalCount: 6}
+	if fromLogs != want {
+		t.Errorf("range from logs = %+v, want %+v", fromLogs, want)
+	}
+
+	// Block bounds come from the blockmap once it is populated
+	for _, n := range []uint64{199, 203} {
+		if err := store.StoreBlockHash(ctx, n, "0xhash"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var fromBlockMap types.IndexRange
+	decode(t, get(t, s, "/v1/range"), &fromBlockMap)
+	want.FirstBlock, want.LastBlock = 199, 203
+	if fromBlockMap != want {
+		t.Errorf("range from blockmap = %+v, want %+v", fromBlockMap, want)
+	}
+}
+
+func TestPrettyJSON(t *testing.T) {
+	s, store := newTestServer(t, DefaultOptions())
+	storeLogs(t, store, &types.LogEntry{Index: 0, BlockNumber: 1, Enriched: true})
+
+	for target, wantIndented := range map[string]bool{
+		"/v1/range":              false,
+		"/v1/range?pretty=true":  true,
+		"/v1/range?pretty=false": false,
+		"/v1/logs?pretty=1":      true,
+	} {
+		rec := get(t, s, target)
+		var v interface{}
+		decode(t, rec, &v)
+		if indented := bytes.Contains(rec.Body.Bytes(), []byte("\n  \"")); indented != wantIndented {
+			t.Errorf("%s indented = %v, want %v:\n%s", target, indented, wantIndented, rec.Body)
+		}
+	}
+}
+
+func TestHealthHeadLagThreshold(t *testing.T) {
+	for _, tc := range []struct {
+		threshold, lag uint64
+		want           string
+	}{
+		{128, 100, "healthy"},
+		{128, 128, "healthy"},
+		{128, 129, "lagging"},
+		{10, 11, "lagging"},
+		{1000, 500, "healthy"},
+	} {
+		opts := DefaultOptions()
+		opts.HeadLagThreshold = tc.threshold
+		s, _ := newTestServer(t, opts)
+		s.indexer.(*fakeIndexer).stats.HeadLag = tc.lag
+
+		var health types.HealthStatus
+		decode(t, get(t, s, "/v1/health"), &health)
+		if health.Status != tc.want || health.HeadLagThreshold != tc.threshold {
+			t.Errorf("lag %d, threshold %d: status %q reporting threshold %d, want %q",
+				tc.lag, tc.threshold, health.Status, health.HeadLagThreshold, tc.want)
+		}
+	}
+}
+
+// logsPage is a /v1/logs list response
+type logsPage struct {
+	Data       []*types.LogEntry `json:"data"`
+	Count      *int              `json:"count"`
+	NextCursor *uint64           `json:"nextCursor"`
+}
+
+// getLogs fetches target and returns the indices listed and the page's cursor
+func getLogs(t *testing.T, s *Server, target string, header ...string) ([]uint64, *uint64) {
+	t.Helper()
+	var page logsPage
+	decode(t, get(t, s, target, header...), &page)
+	if page.Count == nil || *page.Count != len(page.Data) {
+		t.Errorf("%s: count %v for %d entries", target, page.Count, len(page.Data))
+	}
+	out := make([]uint64, len(page.Data))
+	for i, e := range page.Data {
+		out[i] = e.Index
+	}
+	return out, page.NextCursor
+}
+
+func TestLogsFilterByEventName(t *testing.T) {
+	// An event the ABI did not name is stored under its raw topic0
+	const unnamed = "0x8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925"
+	s, store := newTestServer(t, DefaultOptions())
+	storeLogs(t, store,
+		&types.LogEntry{Index: 0, BlockNumber: 1, EventName: "Transfer", Enriched: true},
+		&types.LogEntry{Index: 1, BlockNumber: 1, EventName: "Approval", Enriched: true},
+		&types.LogEntry{Index: 2, BlockNumber: 2, EventName: "Transfer", Enriched: true},
+		&types.LogEntry{Index: 3, BlockNumber: 2, EventName: unnamed, Enriched: true},
+	)
+
+	for event, want := range map[string][]uint64{
+		"Transfer": {0, 2},
+		"transfer": {0, 2},
+		"Approval": {1},
+		unnamed:    {3},
+	} {
+		target := "/v1/logs?startIndex=0&endIndex=3&event=" + event
+		if got, _ := getLogs(t, s, target); !slices.Equal(got, want) {
+			t.Errorf("%s = %v, want %v", target, got, want)
+		}
+	}
+}
+
+func TestLogsPendingPromotionAndRemoval(t *testing.T) {
+	ctx := context.Background()
+	s, store := newTestServer(t, DefaultOptions())
+	for i := uint64(0); i < 5; i++ {
+		storeLogs(t, store, &types.LogEntry{Index: i, BlockNumber: 100 + i, Enriched: true, Pending: i >= 2})
+	}
+	check := func(state string, want []uint64) {
+		t.Helper()
+		target := "/v1/logs?startIndex=0&endIndex=4&state=" + state
+		if got, _ := getLogs(t, s, target); !slices.Equal(got, want) {
+			t.Errorf("%s = %v, want %v", target, got, want)
+		}
+	}
+	check("pending", []uint64{2, 3, 4})
+	check("confirmed", []uint64{0, 1})
+
+	// Block 102 reaches the confirmation depth
+	if n, err := store.PromotePending(ctx, 102); err != nil || n != 1 {
+		t.Fatalf("promoted %d through block 102 (%v), want 1", n, err)
+	}
+	check("pending", []uint64{3, 4})
+	check("confirmed", []uint64{0, 1, 2})
+
+	// Block 104 is reorged out before it is confirmed
+	if err := store.Rollback(ctx, 103); err != nil {
+		t.Fatal(err)
+	}
+	check("pending", []uint64{3})
+	check("confirmed", []uint64{0, 1, 2})
+
+	if rec := get(t, s, "/v1/logs?state=final"); rec.Code != http.StatusBadRequest {
+		t.Errorf("state=final: status %d, want 400", rec.Code)
+	}
+}
+
+func TestLogsMinConfirmations(t *testing.T) {
+	_, store := newTestServer(t, DefaultOptions())
+	for i := uint64(0); i < 6; i++ {
+		storeLogs(t, store, &types.LogEntry{Index: i, BlockNumber: 90 + 2*i, Enriched: true})
+	}
+	idx := &fakeIndexer{stats: types.IndexerStats{HeadBlock: 100}}
+	s := NewServerWithOptions(idx, store, slog.New(slog.NewTextHandler(io.Discard, nil)), ":0", DefaultOptions())
+
+	// Blocks 90, 92, ..., 100 under head 100
+	for depth, want := range map[string][]uint64{
+		"0":   {0, 1, 2, 3, 4, 5},
+		"1":   {0, 1, 2, 3, 4},
+		"6":   {0, 1, 2},
+		"10":  {0},
+		"11":  {},
+		"500": {},
+	} {
+		target := "/v1/logs?startIndex=0&endIndex=5&minConfirmations=" + depth
+		if got, _ := getLogs(t, s, target); !slices.Equal(got, want) {
+			t.Errorf("minConfirmations=%s under head 100 = %v, want %v", depth, got, want)
+		}
+	}
+	for _, depth := range []string{"-1", "six"} {
+		if rec := get(t, s, "/v1/logs?startIndex=0&endIndex=5&minConfirmations="+depth); rec.Code != http.StatusBadRequest {
+			t.Errorf("minConfirmations=%s: status %d, want 400", depth, rec.Code)
+		}
+	}
+
+	idx.mu.Lock()
+	idx.stats.HeadBlock = 0
+	idx.mu.Unlock()
+	if rec := get(t, s, "/v1/logs?startIndex=0&endIndex=5&minConfirmations=6"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("unknown head: status %d, want 503", rec.Code)
+	}
+}
+
+func TestLatestLogsOverBasedAndGappedIndices(t *testing.T) {
+	// Indexed with -index-base 1000: the count is far below the indices
+	based, store := newTestServer(t, DefaultOptions())
+	for i := uint64(0); i < 10; i++ {
+		storeLogs(t, store, &types.LogEntry{Index: 1000 + i, BlockNumber: 50 + i, Enriched: true})
+	}
+	if got, next := getLogs(t, based, "/v1/logs?limit=3"); !slices.Equal(got, []uint64{1007, 1008, 1009}) || next != nil {
+		t.Errorf("latest 3 of 1000-1009 = %v (next %v), want [1007 1008 1009]", got, next)
+	}
+	if got, _ := getLogs(t, based, "/v1/logs?limit=50"); len(got) != 10 || got[0] != 1000 {
+		t.Errorf("latest 50 of 10 logs = %v, want all from 1000", got)
+	}
+
+	// Under MonotonicIndices a rollback abandons 5-9 and the re-indexed logs get 10-12
+	ctx := context.Background()
+	mono, err := storage.NewBoltStorageWithOptions(filepath.Join(t.TempDir(), "mono.db"), storage.Options{MonotonicIndices: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mono.Close()
+	for i := uint64(0); i < 10; i++ {
+		storeLogs(t, mono, &types.LogEntry{Index: i, BlockNumber: 100 + i, Enriched: true})
+	}
+	if err := mono.Rollback(ctx, 104); err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 3; i++ {
+		storeLogs(t, mono, &types.LogEntry{Index: 10 + i, BlockNumber: 105 + i, LogIndex: 1, Enriched: true})
+	}
+	gapped := NewServerWithOptions(&fakeIndexer{}, mono, slog.New(slog.NewTextHandler(io.Discard, nil)), ":0", DefaultOptions())
+	if got, _ := getLogs(t, gapped, "/v1/logs?limit=5"); !slices.Equal(got, []uint64{3, 4, 10, 11, 12}) {
+		t.Errorf("latest 5 across the gap = %v, want [3 4 10 11 12]", got)
+	}
+}
+
+func TestLogsPagingAcrossIndexGaps(t *testing.T) {
+	s, store := newTestServer(t, DefaultOptions())
+	for _, i := range []uint64{2, 3, 7, 8, 9, 15, 16} {
+		storeLogs(t, store, &types.LogEntry{Index: i, BlockNumber: i, Enriched: true})
+	}
+
+	if got, next := getLogs(t, s, "/v1/logs?startIndex=3&offset=2&limit=2"); !slices.Equal(got, []uint64{8, 9}) || next == nil || *next != 15 {
+		t.Errorf("offset page = %v next %v, want [8 9] next 15", got, next)
+	}
+
+	// cursor alone walks every entry, each cursor landing past a gap on the next stored index
+	var got []uint64
+	target := "/v1/logs?cursor=0&limit=3"
+	for {
+		page, next := getLogs(t, s, target)
+		got = append(got, page...)
+		if next == nil {
+			break
+		}
+		target = fmt.Sprintf("/v1/logs?cursor=%d&limit=3", *next)
+	}
+	if !slices.Equal(got, []uint64{2, 3, 7, 8, 9, 15, 16}) {
+		t.Errorf("cursor walk = %v, want every entry", got)
+	}
+
+	// A bounded page's cursor continues the range with endIndex and stops at it
+	page, next := getLogs(t, s, "/v1/logs?startIndex=2&endIndex=9&limit=2")
+	if !slices.Equal(page, []uint64{2, 3}) || next == nil || *next != 7 {
+		t.Fatalf("bounded page = %v next %v, want [2 3] next 7", page, next)
+	}
+	page, next = getLogs(t, s, fmt.Sprintf("/v1/logs?cursor=%d&endIndex=9&limit=2", *next))
+	if !slices.Equal(page, []uint64{7, 8}) || next == nil || *next != 9 {
+		t.Fatalf("second bounded page = %v next %v, want [7 8] next 9", page, next)
+	}
+	page, next = getLogs(t, s, fmt.Sprintf("/v1/logs?cursor=%d&endIndex=9&limit=2", *next))
+	if !slices.Equal(page, []uint64{9}) || next != nil {
+		t.Errorf("last bounded page = %v next %v, want [9] and no cursor past endIndex", page, next)
+	}
+
+	for _, q := range []string{"cursor=2&offset=1", "cursor=2&startIndex=2", "cursor=x"} {
+		if rec := get(t, s, "/v1/logs?"+q); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", q, rec.Code)
+		}
+	}
+}
+
+func TestCountLogsEndpoint(t *testing.T) {
+	s, store := newTestServer(t, DefaultOptions())
+	for _, i := range []uint64{3, 4, 5, 9, 10} {
+		storeLogs(t, store, &types.LogEntry{Index: i, BlockNumber: i, Enriched: true})
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  types.RangeCount
+	}{
+		{"", types.RangeCount{Count: 5}},
+		{"?startIndex=4", types.RangeCount{StartIndex: 4, Count: 4}},
+		{"?startIndex=4&endIndex=9", types.RangeCount{StartIndex: 4, EndIndex: 9, Count: 3}},
+		{"?startIndex=6&endIndex=8", types.RangeCount{StartIndex: 6, EndIndex: 8}},
+		{"?startIndex=5&endIndex=5", types.RangeCount{StartIndex: 5, EndIndex: 5, Count: 1}},
+	} {
+		var got types.RangeCount
+		decode(t, get(t, s, "/v1/logs/count"+tc.query), &got)
+		if got != tc.want {
+			t.Errorf("count%s = %+v, want %+v", tc.query, got, tc.want)
+		}
+	}
+
+	if rec := get(t, s, "/v1/logs/count?startIndex=9&endIndex=4"); rec.Code != http.StatusBadRequest {
+		t.Errorf("endIndex below startIndex: status %d, want 400", rec.Code)
+	}
+}
+
+func TestLogByPositionEndpoint(t *testing.T) {
+	s, store := newTestServer(t, DefaultOptions())
+	storeLogs(t, store,
+		&types.LogEntry{Index: 0, BlockNumber: 7, LogIndex: 1, Enriched: true},
+		&types.LogEntry{Index: 1, BlockNumber: 7, LogIndex: 2, Enriched: true},
+	)
+
+	var entry types.LogEntry
+	decode(t, get(t, s, "/v1/logs/by-position?block=7&logIndex=2"), &entry)
+	if entry.Index != 1 {
+		t.Errorf("block 7 log 2 resolved to index %d, want 1", entry.Index)
+	}
+	for target, want := range map[string]int{
+		"/v1/logs/by-position?block=7&logIndex=3":  http.StatusNotFound,
+		"/v1/logs/by-position?block=7":             http.StatusBadRequest,
+		"/v1/logs/by-position?block=-1&logIndex=0": http.StatusBadRequest,
+	} {
+		if rec := get(t, s, target); rec.Code != want {
+			t.Errorf("%s: status %d, want %d", target, rec.Code, want)
+		}
+	}
+}
+
+func TestLogsFilterByTxIndexRange(t *testing.T) {
+	s, store := newTestServer(t, DefaultOptions())
+	tx := func(n uint64) *uint64 { return &n }
+	storeLogs(t, store,
+		&types.LogEntry{Index: 0, BlockNumber: 50, TxIndex: tx(9), LogIndex: 30, Enriched: true},
+		&types.LogEntry{Index: 1, BlockNumber: 50, TxIndex: tx(2), LogIndex: 4, Enriched: true},
+		&types.LogEntry{Index: 2, BlockNumber: 50, TxIndex: tx(5), LogIndex: 12, Enriched: true},
+		&types.LogEntry{Index: 3, BlockNumber: 50, TxIndex: tx(2), LogIndex: 3, Enriched: true},
+		&types.LogEntry{Index: 4, BlockNumber: 51, TxIndex: tx(3), LogIndex: 0, Enriched: true},
+		// Stored before txIndex was recorded: one with its raw log, one without
+		&types.LogEntry{Index: 5, BlockNumber: 50, RawLog: &types.RawLog{TxIndex: 4}, LogIndex: 8, Enriched: true},
+		&types.LogEntry{Index: 6, BlockNumber: 50, LogIndex: 9, Enriched: true},
+	)
+
+	for target, want := range map[string][]uint64{
+		"/v1/logs?blockNumber=50&txIndexFrom=2&txIndexTo=5": {3, 1, 5, 2},
+		"/v1/logs?blockNumber=50&txIndexFrom=5":             {2, 0},
+		"/v1/logs?blockNumber=50&txIndexTo=2":               {3, 1},
+		"/v1/logs?blockNumber=50&txIndexFrom=6&txIndexTo=8": {},
+	} {
+		if got, _ := getLogs(t, s, target); !slices.Equal(got, want) {
+			t.Errorf("%s listed %v, want %v", target, got, want)
+		}
+	}
+	for _, target := range []string{
+		"/v1/logs?txIndexFrom=2",
+		"/v1/logs?blockNumber=50&txIndexFrom=5&txIndexTo=2",
+	} {
+		if rec := get(t, s, target); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", target, rec.Code)
+		}
+	}
+}
+
+// dialWebSocket connects to path on a live test server for s
+func dialWebSocket(t *testing.T, s *Server, path string) *websocket.Conn {
+	t.Helper()
+	ts := httptest.NewServer(s.handler())
+	t.Cleanup(ts.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+path, nil)
+	if err != nil {
+		t.Fatalf("dial %s: %v", path, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestStatusStreamPushesFrames(t *testing.T) {
+	opts := DefaultOptions()
+	opts.StatusStreamInterval = 20 * time.Millisecond
+	s, _ := newTestServer(t, opts)
+	idx := s.indexer.(*fakeIndexer)
+	idx.stats.TotalIndexed = 1
+
+	conn := dialWebSocket(t, s, "/v1/status/ws")
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var frame struct {
+		Type string             `json:"type"`
+		Data types.IndexerStats `json:"data"`
+	}
+	var seen []uint64
+	for len(seen) < 3 {
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("after %d frames: %v", len(seen), err)
+		}
+		if frame.Type != "status" {
+			t.Fatalf("frame type %q, want status", frame.Type)
+		}
+		seen = append(seen, frame.Data.TotalIndexed)
+
+		// Later frames reflect the indexer's current stats
+		idx.mu.Lock()
+		idx.stats.TotalIndexed++
+		idx.mu.Unlock()
+	}
+	if seen[0] != 1 || seen[2] <= seen[0] {
+		t.Errorf("frames reported totals %v, want 1 first and later frames to follow the stats", seen)
+	}
+}
+
+func TestListEnvelopeAndLegacyArrays(t *testing.T) {
+	entries := []*types.LogEntry{
+		{Index: 0, BlockNumber: 1, Enriched: true},
+		{Index: 1, BlockNumber: 2, Enriched: true},
+	}
+
+	s, store := newTestServer(t, DefaultOptions())
+	storeLogs(t, store, entries...)
+	var envelope struct {
+		Status int               `json:"status"`
+		Data   []*types.LogEntry `json:"data"`
+		Count  *int              `json:"count"`
+	}
+	decode(t, get(t, s, "/v1/logs?startIndex=0&endIndex=1"), &envelope)
+	if envelope.Status != http.StatusOK || len(envelope.Data) != 2 || envelope.Count == nil || *envelope.Count != 2 {
+		t.Errorf("envelope = status %d, %d entries, count %v; want 200, 2, 2",
+			envelope.Status, len(envelope.Data), envelope.Count)
+	}
+
+	opts := DefaultOptions()
+	opts.LegacyListArrays = true
+	legacy, store := newTestServer(t, opts)
+	storeLogs(t, store, entries...)
+	var bare []*types.LogEntry
+	decode(t, get(t, legacy, "/v1/logs?startIndex=0&endIndex=1"), &bare)
+	if len(bare) != 2 {
+		t.Errorf("legacy response held %d entries, want a bare array of 2", len(bare))
+	}
+
+	// Errors keep the envelope either way
+	rec := get(t, legacy, "/v1/logs/x")
+	var apiErr types.ApiResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &apiErr); rec.Code == http.StatusOK || err != nil || apiErr.Error == "" {
+		t.Errorf("bad request = %d %s, want an ApiResponse error", rec.Code, rec.Body)
+	}
+}
+
+// slowStorage answers GetIndexRange after delay, or with the context's error first
+type slowStorage struct {
+	storage.Storage
+	delay time.Duration
+}
+
+func (s *slowStorage) GetIndexRange(ctx context.Context) (*types.IndexRange, error) {
+	select {
+	case <-time.After(s.delay):
+		return s.Storage.GetIndexRange(ctx)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestRouteTimeoutLetsSlowQueryFinish(t *testing.T) {
+	_, store := newTestServer(t, DefaultOptions())
+	slow := &slowStorage{Storage: store, delay: 50 * time.Millisecond}
+	serve := func(opts Options) int {
+		s := NewServerWithOptions(&fakeIndexer{}, slow, slog.New(slog.NewTextHandler(io.Discard, nil)), ":0", opts)
+		return get(t, s, "/v1/range").Code
+	}
+
+	tight := DefaultOptions()
+	tight.RequestTimeout = 10 * time.Millisecond
+	if code := serve(tight); code != http.StatusInternalServerError {
+		t.Errorf("10ms timeout on a 50ms query = %d, want 500", code)
+	}
+
+	// A per-route override wins over the global timeout
+	tight.RouteTimeouts = map[string]time.Duration{"range": time.Second}
+	if code := serve(tight); code != http.StatusOK {
+		t.Errorf("1s range timeout on a 50ms query = %d, want 200", code)
+	}
+
+	loose := DefaultOptions()
+	loose.RequestTimeout = time.Second
+	if code := serve(loose); code != http.StatusOK {
+		t.Errorf("1s timeout on a 50ms query = %d, want 200", code)
+	}
+}
+
+func TestKeyStyleNegotiation(t *testing.T) {
+	s, store := newTestServer(t, DefaultOptions())
+	storeLogs(t, store, &types.LogEntry{Index: 0, BlockNumber: 12, Enriched: true})
+
+	for _, tc := range []struct {
+		target, header, want string
+	}{
+		{"/v1/logs/0", "", `"blockNumber":12`},
+		{"/v1/logs/0?keys=short", "", `"bn":12`},
+		{"/v1/logs/0", "snake", `"block_number":12`},
+		{"/v1/logs/0?keys=short", "snake", `"bn":12`},
+	} {
+		rec := get(t, s, tc.target, "X-Key-Style", tc.header)
+		if !strings.Contains(rec.Body.String(), tc.want) {
+			t.Errorf("%s with X-Key-Style %q: want %s in %s", tc.target, tc.header, tc.want, rec.Body)
+		}
+	}
+}
+
+func TestBatchesReadBack(t *testing.T) {
+	// The bulk indexer's output: batch analytics keyed batch_<id>
+	path := filepath.Join(t.TempDir(), "bulk.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := []types.BatchInfo{
+		{BatchID: 10, StartBlock: 5000, EndBlock: 5499, StartIndex: 90, LogCount: 7, ProcessingTimeMs: 1200, GasAnalyzed: 147_000},
+		{BatchID: 2, StartBlock: 1000, EndBlock: 1499, StartIndex: 10, LogCount: 3, ProcessingTimeMs: 300, GasAnalyzed: 63_000},
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(storage.BucketBatchInfo))
+		if err != nil {
+			return err
+		}
+		for _, batch := range stored {
+			data, _ := json.Marshal(batch)
+			if err := b.Put([]byte(fmt.Sprintf("batch_%d", batch.BatchID)), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := storage.NewBoltStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	s := NewServerWithOptions(&fakeIndexer{}, store, slog.New(slog.NewTextHandler(io.Discard, nil)), ":0", DefaultOptions())
+
+	var page struct {
+		Data []types.BatchInfo `json:"data"`
+	}
+	decode(t, get(t, s, "/v1/batches"), &page)
+	if len(page.Data) != 2 || page.Data[0] != stored[1] || page.Data[1] != stored[0] {
+		t.Errorf("batches = %+v, want %+v in batch order", page.Data, []types.BatchInfo{stored[1], stored[0]})
+	}
+
+	// A DB without batch analytics lists none
+	empty, _ := newTestServer(t, DefaultOptions())
+	var none struct {
+		Data  []types.BatchInfo `json:"data"`
+		Count int               `json:"count"`
+	}
+	decode(t, get(t, empty, "/v1/batches"), &none)
+	if none.Count != 0 || none.Data == nil {
+		t.Errorf("empty batches = %+v, want an empty list", none)
+	}
+}
+
+func TestVersionReportsBuildInfo(t *testing.T) {
+	s, _ := newTestServer(t, DefaultOptions())
+
+	var defaults version.Info
+	decode(t, get(t, s, "/v1/version"), &defaults)
+	if defaults.Version != "dev" || defaults.Commit != "unknown" {
+		t.Errorf("unset build = %s@%s, want dev@unknown", defaults.Version, defaults.Commit)
+	}
+
+	// What -ldflags "-X example/hello/internal/version.Version=..." does at link time
+	oldVersion, oldCommit := version.Version, version.Commit
+	version.Version, version.Commit = "v1.4.0", "abc1234"
+	t.Cleanup(func() { version.Version, version.Commit = oldVersion, oldCommit })
+
+	var got version.Info
+	decode(t, get(t, s, "/v1/version"), &got)
+	want := version.Info{Version: "v1.4.0", Commit: "abc1234", GoVersion: runtime.Version(), SchemaVersion: storage.SchemaVersion}
+	if got != want {
+		t.Errorf("version = %+v, want %+v", got, want)
+	}
+}
+
+func TestWebSocketConnectionCap(t *testing.T) {
+	opts := DefaultOptions()
+	opts.MaxWebSocketConns = 2
+	// An unregistered gauge, so the test does not touch the default registry
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_websocket_connections"})
+	opts.Metrics = &metrics.Metrics{WebSocketConnections: gauge}
+	s, _ := newTestServer(t, opts)
+
+	ts := httptest.NewServer(s.handler())
+	t.Cleanup(ts.Close)
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/v1/ws"
+	dial := func() (*websocket.Conn, *http.Response, error) {
+		conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+		if conn != nil {
+			t.Cleanup(func() { conn.Close() })
+		}
+		return conn, resp, err
+	}
+
+	first, _, err := dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := dial(); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.ToFloat64(gauge); n != 2 {
+		t.Errorf("gauge = %v with 2 clients, want 2", n)
+	}
+
+	_, resp, err := dial()
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("third connection over a cap of 2: %v, want 503", err)
+	}
+	if n := testutil.ToFloat64(gauge); n != 2 {
+		t.Errorf("gauge = %v after a refused upgrade, want 2", n)
+	}
+
+	// Closing a client frees its slot once the server notices
+	first.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(gauge) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("gauge stuck at %v after a client closed, want 1", testutil.ToFloat64(gauge))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, _, err := dial(); err != nil {
+		t.Errorf("reconnect after a slot freed: %v", err)
+	}
+}
+
+func TestShutdownDrainsBufferedLiveEntries(t *testing.T) {
+	s, _ := newTestServer(t, DefaultOptions())
+	live := make(chan *types.LogEntry, 4)
+	s.indexer.(*fakeIndexer).live = live
+
+	conn := dialWebSocket(t, s, "/v1/ws")
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var frame struct {
+		Type string          `json:"type"`
+		Data *types.LogEntry `json:"data"`
+	}
+	if err := conn.ReadJSON(&frame); err != nil || frame.Type != "welcome" {
+		t.Fatalf("first frame %q: %v, want welcome", frame.Type, err)
+	}
+
+	// Entries still buffered when shutdown starts must reach the client first
+	for i := uint64(0); i < 3; i++ {
+		live <- &types.LogEntry{Index: i, BlockNumber: 10 + i}
+	}
+	s.beginShutdown()
+
+	var got []uint64
+	for {
+		frame.Data = nil
+		err := conn.ReadJSON(&frame)
+		if websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("after %v: %v, want a going-away close frame", got, err)
+		}
+		if frame.Type == "log" {
+			got = append(got, frame.Data.Index)
+		}
+	}
+	if !slices.Equal(got, []uint64{0, 1, 2}) {
+		t.Errorf("delivered %v before closing, want [0 1 2]", got)
+	}
+
+	ts := httptest.NewServer(s.handler())
+	t.Cleanup(ts.Close)
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/v1/ws", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("dial during shutdown: %v, want 503", err)
+	}
+}
+
+func TestWebSocketResumesAfterLastAck(t *testing.T) {
+	s, store := newTestServer(t, DefaultOptions())
+	for i := uint64(0); i < 6; i++ {
+		storeLogs(t, store, &types.LogEntry{Index: i, BlockNumber: 50 + i, Enriched: true})
+	}
+	ts := httptest.NewServer(s.handler())
+	t.Cleanup(ts.Close)
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/v1/ws"
+
+	type frame struct {
+		Type        string          `json:"type"`
+		ResumeToken string          `json:"resumeToken"`
+		Data        *types.LogEntry `json:"data"`
+	}
+	// connect returns the welcome frame and the indices of the next n log frames
+	connect := func(query string, n int) (*websocket.Conn, frame, []uint64) {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL+query, nil)
+		if err != nil {
+			t.Fatalf("dial %s: %v", query, err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var welcome frame
+		if err := conn.ReadJSON(&welcome); err != nil || welcome.Type != "welcome" {
+			t.Fatalf("welcome frame %+v: %v", welcome, err)
+		}
+		var got []uint64
+		for len(got) < n {
+			var f frame
+			if err := conn.ReadJSON(&f); err != nil {
+				t.Fatalf("after %v: %v", got, err)
+			}
+			if f.Type == "log" {
+				got = append(got, f.Data.Index)
+			}
+		}
+		return conn, welcome, got
+	}
+
+	conn, welcome, got := connect("?fromIndex=0", 6)
+	if !slices.Equal(got, []uint64{0, 1, 2, 3, 4, 5}) {
+		t.Fatalf("first connection replayed %v, want 0-5", got)
+	}
+	// The client processed up to 2 when it dropped; 3-5 were sent but never acked
+	if err := conn.WriteJSON(map[string]interface{}{"type": "ack", "index": 2}); err != nil {
+		t.Fatal(err)
+	}
+	sess, ok := s.sessions.get(welcome.ResumeToken)
+	if !ok {
+		t.Fatal("session for the resume token not found")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for next, _ := s.sessions.resumeFrom(sess); next != 3; next, _ = s.sessions.resumeFrom(sess) {
+		if time.Now().After(deadline) {
+			t.Fatalf("resume point %d after ack 2, want 3", next)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	conn.Close()
+
+	_, again, got := connect("?resume="+welcome.ResumeToken, 3)
+	if !slices.Equal(got, []uint64{3, 4, 5}) {
+		t.Errorf("resumed connection replayed %v, want [3 4 5]", got)
+	}
+	if again.ResumeToken != welcome.ResumeToken {
+		t.Errorf("resume issued token %s, want the same session %s", again.ResumeToken, welcome.ResumeToken)
+	}
+
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL+"?resume=feedface", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusGone {
+		t.Errorf("unknown token: %v, want 410", err)
+	}
+}
+
+func TestWebSocketResumeClosesRestartGap(t *testing.T) {
+	// A restarted server: the client's token is gone, but it knows it processed up to 1
+	s, store := newTestServer(t, DefaultOptions())
+	live := make(chan *types.LogEntry, 1)
+	s.indexer.(*fakeIndexer).live = live
+	for i := uint64(0); i < 5; i++ {
+		storeLogs(t, store, &types.LogEntry{Index: i, BlockNumber: 50 + i, Enriched: true})
+	}
+
+	conn := dialWebSocket(t, s, "/v1/ws?resume=feedface&fromIndex=2")
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var frame struct {
+		Type string          `json:"type"`
+		Data *types.LogEntry `json:"data"`
+	}
+	if err := conn.ReadJSON(&frame); err != nil || frame.Type != "welcome" {
+		t.Fatalf("first frame %q: %v, want welcome for a stale token with fromIndex", frame.Type, err)
+	}
+	read := func(n int) []uint64 {
+		t.Helper()
+		var got []uint64
+		for len(got) < n {
+			frame.Data = nil
+			if err := conn.ReadJSON(&frame); err != nil {
+				t.Fatalf("after %v: %v", got, err)
+			}
+			if frame.Type == "log" {
+				got = append(got, frame.Data.Index)
+			}
+		}
+		return got
+	}
+	if got := read(3); !slices.Equal(got, []uint64{2, 3, 4}) {
+		t.Fatalf("replayed %v, want [2 3 4]", got)
+	}
+
+	// 5 and 6 are committed without a live event reaching this connection; the first
+	// live entry after them must not skip them
+	storeLogs(t, store,
+		&types.LogEntry{Index: 5, BlockNumber: 55, Enriched: true},
+		&types.LogEntry{Index: 6, BlockNumber: 56, Enriched: true},
+		&types.LogEntry{Index: 7, BlockNumber: 57, Enriched: true},
+	)
+	live <- &types.LogEntry{Index: 7, BlockNumber: 57, Enriched: true}
+	if got := read(3); !slices.Equal(got, []uint64{5, 6, 7}) {
+		t.Errorf("after the gap delivered %v, want [5 6 7]", got)
+	}
+}
+
+func TestServerDefaultKeyStyle(t *testing.T) {
+	opts := DefaultOptions()
+	opts.KeyStyle = types.KeyStyleSnake
+	s, store := newTestServer(t, opts)
+	storeLogs(t, store, &types.LogEntry{Index: 0, BlockNumber: 12, TxHash: "0xt", Enriched: true})
+
+	for target, want := range map[string]string{
+		"/v1/logs/0":                       `"tx_hash":"0xt"`,
+		"/v1/logs?startIndex=0&endIndex=1": `"block_number":12`,
+		"/v1/range":                        `"first_block":12`,
+		"/v1/logs/0?keys=short":            `"bn":12`,
+	} {
+		if body := get(t, s, target).Body.String(); !strings.Contains(body, want) {
+			t.Errorf("%s with snake_case configured: want %s in %s", target, want, body)
+		}
+	}
+}
+
+func TestWebSocketPingInterval(t *testing.T) {
+	opts := DefaultOptions()
+	opts.PingInterval = 40 * time.Millisecond
+	opts.MaxMissedPongs = 2
+	s, _ := newTestServer(t, opts)
+
+	// readPings reads until n control pings arrived or the connection failed,
+	// answering each with a pong only when pong is set
+	readPings := func(pong bool, n int) ([]time.Time, error) {
+		conn := dialWebSocket(t, s, "/v1/ws")
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var pings []time.Time
+		conn.SetPingHandler(func(data string) error {
+			pings = append(pings, time.Now())
+			if pong {
+				return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+			}
+			return nil
+		})
+		for len(pings) < n {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return pings, err
+			}
+		}
+		return pings, nil
+	}
+
+	pings, err := readPings(true, 5)
+	if err != nil {
+		t.Fatalf("connection answering pongs dropped after %d pings: %v", len(pings), err)
+	}
+	for i := 1; i < len(pings); i++ {
+		if gap := pings[i].Sub(pings[i-1]); gap < 30*time.Millisecond || gap > time.Second {
+			t.Errorf("ping %d came %v after the previous one, want about 40ms", i, gap)
+		}
+	}
+
+	// A client that never pongs is closed after MaxMissedPongs intervals
+	start := time.Now()
+	pings, err = readPings(false, 100)
+	if err == nil {
+		t.Fatal("silent client was never disconnected")
+	}
+	if len(pings) < 2 || time.Since(start) > 2*time.Second {
+		t.Errorf("silent client closed after %d pings and %v, want about 2 pings and 100ms", len(pings), time.Since(start))
+	}
+}
+
+func TestLogsCSVNegotiation(t *testing.T) {
+	s, store := newTestServer(t, DefaultOptions())
+	price, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	storeLogs(t, store,
+		&types.LogEntry{Index: 0, BlockNumber: 12, TxHash: "0xAbC", Topics: []string{"0xt0", "0xt1"},
+			GasUsed: 21_000, GasPrice: types.NewBigInt(price), EventName: "Transfer", Enriched: true},
+		&types.LogEntry{Index: 1, BlockNumber: 13, LogIndex: 2, Enriched: true},
+	)
+
+	for _, tc := range []struct {
+		target, accept string
+		csv            bool
+	}{
+		{"/v1/logs?startIndex=0&endIndex=1", "", false},
+		{"/v1/logs?startIndex=0&endIndex=1&format=csv", "", true},
+		{"/v1/logs?startIndex=0&endIndex=1", "application/json;q=0.5, text/csv", true},
+		{"/v1/logs?startIndex=0&endIndex=1&format=json", "text/csv", false},
+	} {
+		rec := get(t, s, tc.target, "Accept", tc.accept)
+		isCSV := strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv")
+		if isCSV != tc.csv {
+			t.Errorf("%s Accept %q: Content-Type %s, want CSV %v", tc.target, tc.accept, rec.Header().Get("Content-Type"), tc.csv)
+			continue
+		}
+		if !isCSV {
+			continue
+		}
+		rows, err := csv.NewReader(rec.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("%s: %v", tc.target, err)
+		}
+		if len(rows) != 3 || !slices.Equal(rows[0], types.CSVHeader) {
+			t.Fatalf("%s: %d rows with header %v, want a header and 2 rows", tc.target, len(rows), rows[0])
+		}
+		col := func(row int, name string) string { return rows[row][slices.Index(types.CSVHeader, name)] }
+		for name, want := range map[string]string{
+			"index": "0", "blockNumber": "12", "txHash": "0xAbC", "gasUsed": "21000",
+			"gasPrice": price.String(), "topic1": "0xt1", "topic2": "", "eventName": "Transfer",
+		} {
+			if got := col(1, name); got != want {
+				t.Errorf("%s: %s = %q, want %q", tc.target, name, got, want)
+			}
+		}
+		if got := col(2, "gasPrice"); got != "" {
+			t.Errorf("%s: unset gasPrice = %q, want an empty cell", tc.target, got)
+		}
+	}
+
+	rec := get(t, s, "/v1/logs?startIndex=0&endIndex=1&limit=1&format=csv")
+	if cursor := rec.Header().Get("X-Next-Cursor"); cursor != "1" {
+		t.Errorf("X-Next-Cursor = %q on a one-row CSV page, want 1", cursor)
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// wsSession is the delivery state of one logical WebSocket subscriber. It outlives
+// the connection so a client reconnecting with its resume token continues after its
+// last acknowledged index.
+type wsSession struct {
+	token     string
+	next      uint64 // index to resume from: one past the last ack, or the first index sent
+	hasNext   bool
+	updatedAt time.Time
+}
+
+// sessionStore keeps wsSessions in memory, expiring them after ttl of inactivity
+type sessionStore struct {
+	sessions map[string]*wsSession
+	ttl      time.Duration
+	mu       sync.Mutex
+}
+
+func newSessionStore(ttl time.Duration) *sessionStore {
+	return &sessionStore{
+		sessions: make(map[string]*wsSession),
+		ttl:      ttl,
+	}
+}
+
+// create starts a session, optionally pinned to a start index
+func (st *sessionStore) create(from uint64, hasFrom bool) (*wsSession, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.pruneLocked()
+	sess := &wsSession{token: hex.EncodeToString(buf), next: from, hasNext: hasFrom, updatedAt: time.Now()}
+	st.sessions[sess.token] = sess
+	return sess, nil
+}
+
+// get returns a live session by token, or false when unknown or expired
+func (st *sessionStore) get(token string) (*wsSession, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.pruneLocked()
+	sess, ok := st.sessions[token]
+	if ok {
+		sess.updatedAt = time.Now()
+	}
+	return sess, ok
+}
+
+// resumeFrom returns the index a reconnecting client should be replayed from
+func (st *sessionStore) resumeFrom(sess *wsSession) (uint64, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return sess.next, sess.hasNext
+}
+
+// sent records the first index delivered so an un-acked session resumes from there
+func (st *sessionStore) sent(sess *wsSession, index uint64) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if !sess.hasNext {
+		sess.next, sess.hasNext = index, true
+	}
+	sess.updatedAt = time.Now()
+}
+
+// ack advances the resume point past index; acks never move it backwards
+func (st *sessionStore) ack(sess *wsSession, index uint64) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if !sess.hasNext || index+1 > sess.next {
+		sess.next, sess.hasNext = index+1, true
+	}
+	sess.updatedAt = time.Now()
+}
+
+func (st *sessionStore) pruneLocked() {
+	cutoff := time.Now().Add(-st.ttl)
+	for token, sess := range st.sessions {
+		if sess.updatedAt.Before(cutoff) {
+			delete(st.sessions, token)
+		}
+	}
+}
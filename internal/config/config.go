@@ -2,9 +2,14 @@ package config
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 )
 
 // Config holds all configuration for the indexer service
@@ -15,12 +20,25 @@ type Config struct {
 	RPCMaxRetry int
 
 	// Contract
-	ContractAddr string
-	EventTopic   string
+	ContractAddr  string
+	ContractsFile string // addresses to index instead of ContractAddr, one per line or a JSON list
+	Factory       string // factory whose creation events add child contracts to the indexed set
+	FactoryTopic  string // topic0 of the factory's creation event
+	FactoryChild  string // where the creation event holds the child: topic1-topic3 or dataN
+	EventTopic    string // comma-separated topic0 hashes, any of which matches; empty indexes every event
+	ABIPath       string
 
 	// Storage
-	DBPath      string
-	StorageType string // "bolt" or "postgres"
+	DBPath           string
+	StorageType      string // "bolt" or "postgres"
+	NaturalKeys      bool
+	UpsertPolicy     string // "overwrite", "skip" or "error"
+	CompositeKeys    bool
+	MonotonicIndices bool // never reuse indices freed by a rollback
+	StoreRawLogs     bool
+	CompactInterval  time.Duration // 0 disables scheduled compaction
+	CompactWindow    string        // UTC "HH:MM-HH:MM" when compaction may run, empty for any time
+	ShardManifest    string        // serve a sharded backfill read-only instead of DBPath
 
 	// Postgres (optional)
 	PostgresURL string
@@ -31,17 +49,40 @@ type Config struct {
 	EndBlock           uint64
 	MaxBlockRange      uint64
 	RollbackWindow     uint64
+	Confirmations      uint64 // head logs stay pending until this deep, 0 stores them confirmed
 	Backfill           bool
 	CheckpointInterval time.Duration
 
 	// API
-	APIPort        string
-	APIAddr        string
-	APIReadTimeout time.Duration
+	APIPort              string
+	APIAddr              string
+	APIReadTimeout       time.Duration
+	StatusStreamInterval time.Duration
+	APILegacyArrays      bool
+	APIKeyStyle          string // "", "short" or "snake"
+	APIRequestTimeout    time.Duration
+	APIRouteTimeouts     string // e.g. "logs=30s,health=2s"
+	AdminToken           string
+	ImportValidation     bool // validate /v1/admin/import records before storing any
+	SnapshotDir          string
+	MaxWebSocketConns    int
+	WSPingInterval       time.Duration
+	WSMaxMissedPongs     int
+	APIWarmup            bool // hold back non-probe routes until storage is checked, see /v1/ready
+
+	// Health
+	HeadLagThreshold uint64
+	MaxHeadSkew      time.Duration // head block age beyond which the RPC head is reported stale, 0 disables
+	ScaleWindow      time.Duration // lookback of the /v1/scale-signal lag trend
+	ScaleDownLag     uint64        // head lag at or below which /v1/scale-signal may say scale_down
 
 	// Metrics
-	MetricsPort string
-	MetricsAddr string
+	MetricsPort     string
+	MetricsAddr     string
+	MetricsToken    string
+	MetricsExporter string // "prometheus", "otlp" or "both"
+	OTLPEndpoint    string
+	OTLPInterval    time.Duration
 
 	// Logging
 	LogLevel string
@@ -62,11 +103,24 @@ func LoadConfig() *Config {
 
 	// Contract
 	flag.StringVar(&cfg.ContractAddr, "contract", os.Getenv("CONTRACT_ADDR"), "Contract address to index (env: CONTRACT_ADDR)")
-	flag.StringVar(&cfg.EventTopic, "topic", os.Getenv("EVENT_TOPIC"), "Event topic hash to filter (env: EVENT_TOPIC)")
+	flag.StringVar(&cfg.ContractsFile, "contracts-file", os.Getenv("CONTRACTS_FILE"), "File of contract addresses to index instead of -contract: one per line (# comments) or a JSON list (env: CONTRACTS_FILE)")
+	flag.StringVar(&cfg.Factory, "factory", os.Getenv("FACTORY_ADDR"), "Factory contract whose creation events add child contracts to index; discovered children are kept in storage (env: FACTORY_ADDR)")
+	flag.StringVar(&cfg.FactoryTopic, "factory-topic", os.Getenv("FACTORY_TOPIC"), "topic0 of the factory's creation event, e.g. PoolCreated (env: FACTORY_TOPIC)")
+	flag.StringVar(&cfg.FactoryChild, "factory-child", getEnvOrDefault("FACTORY_CHILD", "data0"), "Where the creation event holds the child address: topic1-topic3 or dataN (env: FACTORY_CHILD)")
+	flag.StringVar(&cfg.EventTopic, "topic", os.Getenv("EVENT_TOPIC"), "Comma-separated event topic hashes; a log matching any of them is indexed, empty indexes every event of the contracts (env: EVENT_TOPIC)")
+	flag.StringVar(&cfg.ABIPath, "abi", os.Getenv("ABI_PATH"), "ABI JSON for resolving event names, or fromBlock:path,... when a proxy's implementation changes (env: ABI_PATH)")
 
 	// Storage
 	flag.StringVar(&cfg.DBPath, "db", getEnvOrDefault("DB_PATH", "data/indexer.db"), "BoltDB path (env: DB_PATH)")
 	flag.StringVar(&cfg.StorageType, "storage-type", "bolt", "Storage backend: bolt or postgres")
+	flag.BoolVar(&cfg.NaturalKeys, "natural-keys", getEnvOrDefaultBool("NATURAL_KEYS", false), "Deduplicate logs by (blockNumber, logIndex) (env: NATURAL_KEYS)")
+	flag.StringVar(&cfg.UpsertPolicy, "upsert-policy", getEnvOrDefault("UPSERT_POLICY", "overwrite"), "Natural-key conflict policy: overwrite, skip or error (env: UPSERT_POLICY)")
+	flag.BoolVar(&cfg.CompositeKeys, "composite-keys", getEnvOrDefaultBool("COMPOSITE_KEYS", false), "Key logs by blockNumber|logIndex so multiple event types interleave in chain order (env: COMPOSITE_KEYS)")
+	flag.BoolVar(&cfg.MonotonicIndices, "monotonic-indices", getEnvOrDefaultBool("MONOTONIC_INDICES", false), "Never reuse indices freed by a reorg rollback; re-indexed logs get fresh indices, leaving gaps (env: MONOTONIC_INDICES)")
+	flag.BoolVar(&cfg.StoreRawLogs, "store-raw", getEnvOrDefaultBool("STORE_RAW", false), "Archival mode: keep the complete raw log on every entry (env: STORE_RAW)")
+	flag.DurationVar(&cfg.CompactInterval, "compact-interval", getEnvOrDefaultDuration("COMPACT_INTERVAL", 0), "Interval between background DB compactions, 0 disables (env: COMPACT_INTERVAL)")
+	flag.StringVar(&cfg.CompactWindow, "compact-window", os.Getenv("COMPACT_WINDOW"), "UTC time window for compaction, e.g. 02:00-05:00 (env: COMPACT_WINDOW)")
+	flag.StringVar(&cfg.ShardManifest, "shard-manifest", os.Getenv("SHARD_MANIFEST"), "Serve a sharded bulk backfill (manifest file or shard dir) read-only instead of -db (env: SHARD_MANIFEST)")
 	flag.StringVar(&cfg.PostgresURL, "postgres-url", os.Getenv("POSTGRES_URL"), "Postgres connection URL (env: POSTGRES_URL)")
 
 	// Indexing
@@ -75,6 +129,7 @@ func LoadConfig() *Config {
 	flag.Uint64Var(&cfg.EndBlock, "end", getEnvOrDefaultUint64("END_BLOCK", 0), "End block for backfill (env: END_BLOCK)")
 	flag.Uint64Var(&cfg.MaxBlockRange, "max-range", getEnvOrDefaultUint64("MAX_BLOCK_RANGE", 500), "Max blocks per RPC filter (env: MAX_BLOCK_RANGE)")
 	flag.Uint64Var(&cfg.RollbackWindow, "rollback-window", getEnvOrDefaultUint64("ROLLBACK_WINDOW", 128), "Blocks to revalidate on reorg (env: ROLLBACK_WINDOW)")
+	flag.Uint64Var(&cfg.Confirmations, "confirmations", getEnvOrDefaultUint64("CONFIRMATIONS", 0), "Blocks a head log stays pending (?state=pending) before it is promoted to confirmed, 0 stores logs confirmed (env: CONFIRMATIONS)")
 	flag.BoolVar(&cfg.Backfill, "backfill", getEnvOrDefaultBool("BACKFILL", true), "Run historical backfill (env: BACKFILL)")
 	flag.DurationVar(&cfg.CheckpointInterval, "checkpoint-interval", 30*time.Second, "Checkpoint persistence interval")
 
@@ -82,10 +137,32 @@ func LoadConfig() *Config {
 	flag.StringVar(&cfg.APIPort, "api-port", getEnvOrDefault("API_PORT", "8080"), "HTTP API port (env: API_PORT)")
 	flag.StringVar(&cfg.APIAddr, "api-addr", getEnvOrDefault("API_ADDR", ":8080"), "HTTP API listen address (env: API_ADDR)")
 	flag.DurationVar(&cfg.APIReadTimeout, "api-read-timeout", 10*time.Second, "API read timeout")
+	flag.DurationVar(&cfg.APIRequestTimeout, "api-request-timeout", 0, "Timeout for every API route, 0 keeps per-route defaults")
+	flag.StringVar(&cfg.APIRouteTimeouts, "api-route-timeouts", os.Getenv("API_ROUTE_TIMEOUTS"), "Per-route timeout overrides, e.g. logs=30s,health=2s (env: API_ROUTE_TIMEOUTS)")
+	flag.StringVar(&cfg.APIKeyStyle, "api-key-style", os.Getenv("API_KEY_STYLE"), "Default JSON key style: empty for camelCase, short or snake (env: API_KEY_STYLE)")
+	flag.BoolVar(&cfg.APILegacyArrays, "api-legacy-arrays", getEnvOrDefaultBool("API_LEGACY_ARRAYS", false), "Return list endpoints as bare JSON arrays (env: API_LEGACY_ARRAYS)")
+	flag.IntVar(&cfg.MaxWebSocketConns, "max-ws-conns", getEnvOrDefaultInt("MAX_WS_CONNS", 1000), "Concurrent WebSocket clients before upgrades get 503, 0 is unlimited (env: MAX_WS_CONNS)")
+	flag.DurationVar(&cfg.WSPingInterval, "ws-ping-interval", getEnvOrDefaultDuration("WS_PING_INTERVAL", 30*time.Second), "Interval between WebSocket pings (env: WS_PING_INTERVAL)")
+	flag.IntVar(&cfg.WSMaxMissedPongs, "ws-max-missed-pongs", getEnvOrDefaultInt("WS_MAX_MISSED_PONGS", 2), "Unanswered pings before a WebSocket is closed (env: WS_MAX_MISSED_PONGS)")
+	flag.StringVar(&cfg.AdminToken, "admin-token", os.Getenv("ADMIN_TOKEN"), "Bearer token enabling /v1/admin routes, empty disables them (env: ADMIN_TOKEN)")
+	flag.BoolVar(&cfg.ImportValidation, "import-validation", getEnvOrDefaultBool("IMPORT_VALIDATION", true), "Reject /v1/admin/import bodies with missing fields, malformed hashes or non-increasing indices (env: IMPORT_VALIDATION)")
+	flag.StringVar(&cfg.SnapshotDir, "snapshot-dir", getEnvOrDefault("SNAPSHOT_DIR", "data/snapshots"), "Directory for POST /v1/admin/snapshot databases (env: SNAPSHOT_DIR)")
+	flag.BoolVar(&cfg.APIWarmup, "api-warmup", getEnvOrDefaultBool("API_WARMUP", false), "Answer 503 on all but the probe routes until storage is pinged, the checkpoint checked and the log count loaded (env: API_WARMUP)")
+	flag.DurationVar(&cfg.StatusStreamInterval, "status-stream-interval", 5*time.Second, "Interval between stats frames on /v1/status/ws")
+
+	// Health
+	flag.Uint64Var(&cfg.HeadLagThreshold, "head-lag-threshold", getEnvOrDefaultUint64("HEAD_LAG_THRESHOLD", 128), "Head lag in blocks above which health reports lagging (env: HEAD_LAG_THRESHOLD)")
+	flag.DurationVar(&cfg.MaxHeadSkew, "max-head-skew", getEnvOrDefaultDuration("MAX_HEAD_SKEW", 2*time.Minute), "Head block age beyond which status reports headStale and eth_indexer_head_stale is set, 0 disables (env: MAX_HEAD_SKEW)")
+	flag.DurationVar(&cfg.ScaleWindow, "scale-window", getEnvOrDefaultDuration("SCALE_WINDOW", 5*time.Minute), "Lookback over which /v1/scale-signal derives the lag trend and throughput (env: SCALE_WINDOW)")
+	flag.Uint64Var(&cfg.ScaleDownLag, "scale-down-lag", getEnvOrDefaultUint64("SCALE_DOWN_LAG", 8), "Head lag in blocks at or below which /v1/scale-signal may recommend scale_down (env: SCALE_DOWN_LAG)")
 
 	// Metrics
 	flag.StringVar(&cfg.MetricsPort, "metrics-port", getEnvOrDefault("METRICS_PORT", "9090"), "Prometheus metrics port (env: METRICS_PORT)")
 	flag.StringVar(&cfg.MetricsAddr, "metrics-addr", getEnvOrDefault("METRICS_ADDR", ":9090"), "Prometheus listen address (env: METRICS_ADDR)")
+	flag.StringVar(&cfg.MetricsToken, "metrics-token", os.Getenv("METRICS_TOKEN"), "Bearer token required to scrape metrics, empty disables auth (env: METRICS_TOKEN)")
+	flag.StringVar(&cfg.MetricsExporter, "metrics-exporter", getEnvOrDefault("METRICS_EXPORTER", "prometheus"), "Metrics delivery: prometheus (scrape), otlp (push) or both (env: METRICS_EXPORTER)")
+	flag.StringVar(&cfg.OTLPEndpoint, "otlp-endpoint", os.Getenv("OTLP_ENDPOINT"), "OTLP/HTTP collector URL, e.g. http://collector:4318 (env: OTLP_ENDPOINT)")
+	flag.DurationVar(&cfg.OTLPInterval, "otlp-interval", getEnvOrDefaultDuration("OTLP_INTERVAL", 15*time.Second), "Interval between OTLP metric pushes (env: OTLP_INTERVAL)")
 
 	// Logging
 	flag.StringVar(&cfg.LogLevel, "log-level", getEnvOrDefault("LOG_LEVEL", "info"), "Log level: debug, info, warn, error (env: LOG_LEVEL)")
@@ -96,9 +173,34 @@ func LoadConfig() *Config {
 
 	flag.Parse()
 
+	// A local node over IPC has no provider rate limit, so default to more workers
+	if IsIPCPath(cfg.RPC) && !flagSet("workers") && os.Getenv("WORKERS") == "" {
+		cfg.Workers *= IPCWorkerMultiplier
+	}
+
 	return cfg
 }
 
+// IPCWorkerMultiplier scales the default worker count when dialing over IPC
+const IPCWorkerMultiplier = 4
+
+// IsIPCPath reports whether an RPC endpoint is a local IPC socket path: no URL
+// scheme and a .ipc suffix (e.g. /data/geth/geth.ipc)
+func IsIPCPath(endpoint string) bool {
+	return !strings.Contains(endpoint, "://") && strings.HasSuffix(endpoint, ".ipc")
+}
+
+// flagSet reports whether a flag was given explicitly on the command line
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
 // Helper functions
 func getEnvOrDefault(key, defaultVal string) string {
 	if val := os.Getenv(key); val != "" {
@@ -125,6 +227,15 @@ func getEnvOrDefaultUint64(key string, defaultVal uint64) uint64 {
 	return defaultVal
 }
 
+func getEnvOrDefaultDuration(key string, defaultVal time.Duration) time.Duration {
+	if val := os.Getenv(key); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			return d
+		}
+	}
+	return defaultVal
+}
+
 func getEnvOrDefaultBool(key string, defaultVal bool) bool {
 	if val := os.Getenv(key); val != "" {
 		if b, err := strconv.ParseBool(val); err == nil {
@@ -139,15 +250,90 @@ func (c *Config) Validate() error {
 	if c.RPC == "" {
 		return &ValidationError{Field: "rpc", Message: "RPC endpoint is required"}
 	}
-	if c.ContractAddr == "" {
-		return &ValidationError{Field: "contract", Message: "contract address is required"}
+	if c.ContractAddr == "" && c.ContractsFile == "" && c.Factory == "" {
+		return &ValidationError{Field: "contract", Message: "contract address, contracts file or factory is required"}
+	}
+	if c.Factory != "" && c.FactoryTopic == "" {
+		return &ValidationError{Field: "factory-topic", Message: "required with factory"}
+	}
+	if _, err := c.EventTopics(); err != nil {
+		return &ValidationError{Field: "topic", Message: err.Error()}
 	}
-	if c.EventTopic == "" {
-		return &ValidationError{Field: "topic", Message: "event topic is required"}
+	if _, err := c.ParseRouteTimeouts(); err != nil {
+		return &ValidationError{Field: "api-route-timeouts", Message: err.Error()}
+	}
+	switch c.MetricsExporter {
+	case "prometheus":
+	case "otlp", "both":
+		if c.OTLPEndpoint == "" {
+			return &ValidationError{Field: "otlp-endpoint", Message: "required when metrics-exporter is otlp or both"}
+		}
+	default:
+		return &ValidationError{Field: "metrics-exporter", Message: "must be prometheus, otlp or both"}
+	}
+	if c.CompactWindow != "" {
+		if _, _, ok := strings.Cut(c.CompactWindow, "-"); !ok {
+			return &ValidationError{Field: "compact-window", Message: "must look like HH:MM-HH:MM"}
+		}
+	}
+	switch c.APIKeyStyle {
+	case "", "short", "snake":
+	default:
+		return &ValidationError{Field: "api-key-style", Message: "must be empty, short or snake"}
+	}
+	switch c.UpsertPolicy {
+	case "overwrite", "skip", "error":
+	default:
+		return &ValidationError{Field: "upsert-policy", Message: "must be overwrite, skip or error"}
+	}
+	if c.MaxHeadSkew < 0 {
+		return &ValidationError{Field: "max-head-skew", Message: "must not be negative"}
+	}
+	if c.ScaleDownLag > c.HeadLagThreshold {
+		return &ValidationError{Field: "scale-down-lag", Message: "must not exceed head-lag-threshold"}
 	}
 	return nil
 }
 
+// ParseRouteTimeouts parses APIRouteTimeouts ("route=duration,...") into a map
+func (c *Config) ParseRouteTimeouts() (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	if c.APIRouteTimeouts == "" {
+		return timeouts, nil
+	}
+	for _, pair := range strings.Split(c.APIRouteTimeouts, ",") {
+		route, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || route == "" {
+			return nil, fmt.Errorf("invalid route timeout %q, want route=duration", pair)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout for route %s: %v", route, err)
+		}
+		timeouts[route] = d
+	}
+	return timeouts, nil
+}
+
+// EventTopics parses EventTopic into the topic0 values of the eth_getLogs filter, which
+// matches a log with any of them. Empty means every event of the contracts: the filter
+// then has no Topics at all.
+func (c *Config) EventTopics() ([]common.Hash, error) {
+	var topics []common.Hash
+	for _, part := range strings.Split(c.EventTopic, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		b, err := hexutil.Decode(part)
+		if err != nil || len(b) != common.HashLength {
+			return nil, fmt.Errorf("invalid topic %q: want a 0x-prefixed 32-byte hash", part)
+		}
+		topics = append(topics, common.BytesToHash(b))
+	}
+	return topics, nil
+}
+
 // ValidationError represents a configuration validation error
 type ValidationError struct {
 	Field   string
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestParseRouteTimeouts(t *testing.T) {
+	c := &Config{APIRouteTimeouts: "logs=30s, health=2s"}
+	got, err := c.ParseRouteTimeouts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["logs"] != 30*time.Second || got["health"] != 2*time.Second {
+		t.Errorf("parsed %v, want logs=30s health=2s", got)
+	}
+
+	for _, bad := range []string{"logs", "=5s", "logs=fast"} {
+		c.APIRouteTimeouts = bad
+		if _, err := c.ParseRouteTimeouts(); err == nil {
+			t.Errorf("%q parsed without error", bad)
+		}
+	}
+}
+
+func TestEventTopics(t *testing.T) {
+	transfer := common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+	approval := common.HexToHash("0x8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925")
+	c := &Config{EventTopic: transfer.Hex() + ", " + approval.Hex() + ","}
+	if got, err := c.EventTopics(); err != nil || !slices.Equal(got, []common.Hash{transfer, approval}) {
+		t.Errorf("EventTopics() = %v, %v; want Transfer and Approval", got, err)
+	}
+
+	// Empty means every event: no topic0 in the filter at all
+	c.EventTopic = " "
+	if got, err := c.EventTopics(); err != nil || len(got) != 0 {
+		t.Errorf("blank EVENT_TOPIC = %v, %v; want no topics", got, err)
+	}
+
+	for _, bad := range []string{"ddf252ad", transfer.Hex()[:40], transfer.Hex() + ",0xzz"} {
+		c.EventTopic = bad
+		if _, err := c.EventTopics(); err == nil {
+			t.Errorf("%q parsed without error", bad)
+		}
+	}
+}
+
+func TestIsIPCPath(t *testing.T) {
+	for endpoint, want := range map[string]bool{
+		"/var/lib/geth/geth.ipc":          true,
+		"geth.ipc":                        true,
+		"https://rpc.example.org":         false,
+		"ws://localhost:8546":             false,
+		"file:///var/lib/geth/geth.ipc":   false,
+		"/var/lib/geth/geth.ipc.disabled": false,
+	} {
+		if got := IsIPCPath(endpoint); got != want {
+			t.Errorf("IsIPCPath(%q) = %v, want %v", endpoint, got, want)
+		}
+	}
+}
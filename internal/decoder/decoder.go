@@ -0,0 +1,49 @@
+package decoder
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// EventRegistry resolves topic0 hashes to human-readable event names
+type EventRegistry struct {
+	names map[common.Hash]string
+}
+
+// NewEventRegistry indexes every event of a contract ABI by its topic0
+func NewEventRegistry(contractABI abi.ABI) *EventRegistry {
+	r := &EventRegistry{names: make(map[common.Hash]string, len(contractABI.Events))}
+	for _, event := range contractABI.Events {
+		r.names[event.ID] = event.RawName
+	}
+	return r
+}
+
+// LoadEventRegistry reads a JSON ABI file and builds a registry from it
+func LoadEventRegistry(path string) (*EventRegistry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open abi: %w", err)
+	}
+	defer f.Close()
+
+	contractABI, err := abi.JSON(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse abi %s: %w", path, err)
+	}
+	return NewEventRegistry(contractABI), nil
+}
+
+// Name returns the event name for topic0, falling back to the raw topic0 hex when
+// the ABI does not define it. A nil registry always falls back.
+func (r *EventRegistry) Name(topic0 common.Hash) string {
+	if r != nil {
+		if name, ok := r.names[topic0]; ok {
+			return name
+		}
+	}
+	return topic0.Hex()
+}
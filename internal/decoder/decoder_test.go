@@ -0,0 +1,40 @@
+package decoder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const erc20ABI = `[{"type":"event","name":"Transfer","anonymous":false,"inputs":[
+	{"name":"from","type":"address","indexed":true},
+	{"name":"to","type":"address","indexed":true},
+	{"name":"value","type":"uint256","indexed":false}]}]`
+
+// transferTopic is keccak256("Transfer(address,address,uint256)")
+var transferTopic = common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+
+func TestEventRegistryName(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "erc20.json")
+	if err := os.WriteFile(path, []byte(erc20ABI), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := LoadEventRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name := r.Name(transferTopic); name != "Transfer" {
+		t.Errorf("Name(Transfer topic) = %q, want Transfer", name)
+	}
+	unknown := common.HexToHash("0x01")
+	if name := r.Name(unknown); name != unknown.Hex() {
+		t.Errorf("Name(unknown topic) = %q, want the raw topic0 %s", name, unknown.Hex())
+	}
+	var none *EventRegistry
+	if name := none.Name(transferTopic); name != transferTopic.Hex() {
+		t.Errorf("nil registry Name = %q, want the raw topic0", name)
+	}
+}
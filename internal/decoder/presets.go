@@ -0,0 +1,169 @@
+package decoder
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// presetABIs are the Transfer and Approval events of the common token standards.
+// ERC-20 and ERC-721 share the Transfer and Approval signatures, hence topic0; they
+// differ in which parameters are indexed, so a log only decodes under its own preset.
+var presetABIs = map[string]string{
+	"erc20": `[
+		{"type":"event","name":"Transfer","anonymous":false,"inputs":[
+			{"name":"from","type":"address","indexed":true},
+			{"name":"to","type":"address","indexed":true},
+			{"name":"value","type":"uint256","indexed":false}]},
+		{"type":"event","name":"Approval","anonymous":false,"inputs":[
+			{"name":"owner","type":"address","indexed":true},
+			{"name":"spender","type":"address","indexed":true},
+			{"name":"value","type":"uint256","indexed":false}]}
+	]`,
+	"erc721": `[
+		{"type":"event","name":"Transfer","anonymous":false,"inputs":[
+			{"name":"from","type":"address","indexed":true},
+			{"name":"to","type":"address","indexed":true},
+			{"name":"tokenId","type":"uint256","indexed":true}]},
+		{"type":"event","name":"Approval","anonymous":false,"inputs":[
+			{"name":"owner","type":"address","indexed":true},
+			{"name":"approved","type":"address","indexed":true},
+			{"name":"tokenId","type":"uint256","indexed":true}]},
+		{"type":"event","name":"ApprovalForAll","anonymous":false,"inputs":[
+			{"name":"owner","type":"address","indexed":true},
+			{"name":"operator","type":"address","indexed":true},
+			{"name":"approved","type":"bool","indexed":false}]}
+	]`,
+	"erc1155": `[
+		{"type":"event","name":"TransferSingle","anonymous":false,"inputs":[
+			{"name":"operator","type":"address","indexed":true},
+			{"name":"from","type":"address","indexed":true},
+			{"name":"to","type":"address","indexed":true},
+			{"name":"id","type":"uint256","indexed":false},
+			{"name":"value","type":"uint256","indexed":false}]},
+		{"type":"event","name":"TransferBatch","anonymous":false,"inputs":[
+			{"name":"operator","type":"address","indexed":true},
+			{"name":"from","type":"address","indexed":true},
+			{"name":"to","type":"address","indexed":true},
+			{"name":"ids","type":"uint256[]","indexed":false},
+			{"name":"values","type":"uint256[]","indexed":false}]},
+		{"type":"event","name":"ApprovalForAll","anonymous":false,"inputs":[
+			{"name":"account","type":"address","indexed":true},
+			{"name":"operator","type":"address","indexed":true},
+			{"name":"approved","type":"bool","indexed":false}]}
+	]`,
+}
+
+// Parameter names mapped onto TokenFields, in order of preference
+var (
+	fromParams    = []string{"from", "owner", "account"}
+	toParams      = []string{"to", "spender", "approved", "operator"}
+	valueParams   = []string{"value"}
+	tokenIDParams = []string{"tokenId", "id"}
+)
+
+// Preset is a built-in decoder for the Transfer and Approval events of a token standard
+type Preset struct {
+	Name   string
+	ABI    abi.ABI
+	Topics []common.Hash // topic0 of every event the preset decodes
+}
+
+// TokenFields are the token movement details a preset extracts from a log. Fields an
+// event does not carry are left nil: Value for ERC-721, and Value and TokenID for
+// ERC-1155 TransferBatch, whose ids and amounts are lists.
+type TokenFields struct {
+	From    common.Address
+	To      common.Address
+	Value   *big.Int
+	TokenID *big.Int
+}
+
+// PresetNames lists the built-in presets
+func PresetNames() []string {
+	names := make([]string, 0, len(presetABIs))
+	for name := range presetABIs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadPreset returns the built-in preset called name (erc20, erc721 or erc1155)
+func LoadPreset(name string) (*Preset, error) {
+	spec, ok := presetABIs[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown preset %q (want %s)", name, strings.Join(PresetNames(), ", "))
+	}
+	contractABI, err := abi.JSON(strings.NewReader(spec))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse preset %s: %w", name, err)
+	}
+	p := &Preset{Name: strings.ToLower(name), ABI: contractABI}
+	for _, event := range contractABI.Events {
+		p.Topics = append(p.Topics, event.ID)
+	}
+	sort.Slice(p.Topics, func(i, j int) bool { return p.Topics[i].Hex() < p.Topics[j].Hex() })
+	return p, nil
+}
+
+// Registry resolves the preset's events by name
+func (p *Preset) Registry() *EventRegistry {
+	return NewEventRegistry(p.ABI)
+}
+
+// Decode extracts the token fields of l. It fails for an event the preset does not
+// define, or one whose topic count does not match, e.g. an ERC-721 Transfer under
+// the erc20 preset.
+func (p *Preset) Decode(l types.Log) (*TokenFields, error) {
+	if len(l.Topics) == 0 {
+		return nil, fmt.Errorf("anonymous log")
+	}
+	event, err := p.ABI.EventByID(l.Topics[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s preset does not define topic0 %s", p.Name, l.Topics[0].Hex())
+	}
+
+	var indexed abi.Arguments
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	if len(l.Topics) != len(indexed)+1 {
+		return nil, fmt.Errorf("%s has %d topics, %s %s expects %d", event.RawName, len(l.Topics), p.Name, event.RawName, len(indexed)+1)
+	}
+
+	values := make(map[string]interface{})
+	if err := abi.ParseTopicsIntoMap(values, indexed, l.Topics[1:]); err != nil {
+		return nil, fmt.Errorf("failed to decode %s topics: %w", event.RawName, err)
+	}
+	if err := event.Inputs.NonIndexed().UnpackIntoMap(values, l.Data); err != nil {
+		return nil, fmt.Errorf("failed to decode %s data: %w", event.RawName, err)
+	}
+
+	fields := &TokenFields{}
+	fields.From, _ = pick[common.Address](values, fromParams)
+	fields.To, _ = pick[common.Address](values, toParams)
+	fields.Value, _ = pick[*big.Int](values, valueParams)
+	fields.TokenID, _ = pick[*big.Int](values, tokenIDParams)
+	return fields, nil
+}
+
+// pick returns the first of names present in values with type T. The type check
+// matters where names are reused: "approved" is an address in ERC-721 Approval but a
+// bool in ApprovalForAll.
+func pick[T any](values map[string]interface{}, names []string) (T, bool) {
+	for _, name := range names {
+		if v, ok := values[name].(T); ok {
+			return v, true
+		}
+	}
+	var zero T
+	return zero, false
+}
@@ -0,0 +1,96 @@
+package decoder
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// transferSingleTopic is keccak256("TransferSingle(address,address,address,uint256,uint256)")
+var transferSingleTopic = common.HexToHash("0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62")
+
+func addressTopic(hex string) common.Hash {
+	return common.BytesToHash(common.HexToAddress(hex).Bytes())
+}
+
+func word(n int64) []byte {
+	return common.BigToHash(big.NewInt(n)).Bytes()
+}
+
+func TestPresetsDecodeTransfer(t *testing.T) {
+	from, to := "0x28C6c06298d514Db089934071355E5743bf21d60", "0x3cD751E6b0078Be393132286c442345e5DC49699"
+	operator := "0x1E0049783F008A0085193E00003D00cd54003c71"
+
+	// Transfers as emitted on mainnet by USDC, BAYC and an ERC-1155 collection
+	erc20 := types.Log{
+		Address: common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"),
+		Topics:  []common.Hash{transferTopic, addressTopic(from), addressTopic(to)},
+		Data:    word(2_500_000_000), // 2,500 USDC
+	}
+	erc721 := types.Log{
+		Address: common.HexToAddress("0xBC4CA0EdA7647A8aB7C2061c2E118A18a936f13D"),
+		Topics:  []common.Hash{transferTopic, addressTopic(from), addressTopic(to), common.BigToHash(big.NewInt(8817))},
+	}
+	erc1155 := types.Log{
+		Address: common.HexToAddress("0x495f947276749Ce646f68AC8c248420045cb7b5e"),
+		Topics:  []common.Hash{transferSingleTopic, addressTopic(operator), addressTopic(from), addressTopic(to)},
+		Data:    append(word(42), word(3)...),
+	}
+
+	for _, tc := range []struct {
+		preset  string
+		log     types.Log
+		value   int64 // -1 when the event carries no value
+		tokenID int64 // -1 when the event carries no token id
+	}{
+		{"erc20", erc20, 2_500_000_000, -1},
+		{"erc721", erc721, -1, 8817},
+		{"erc1155", erc1155, 3, 42},
+	} {
+		p, err := LoadPreset(tc.preset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, topic := range p.Topics {
+			found = found || topic == tc.log.Topics[0]
+		}
+		if !found {
+			t.Errorf("%s: preset topics %v miss the Transfer topic0", tc.preset, p.Topics)
+		}
+
+		f, err := p.Decode(tc.log)
+		if err != nil {
+			t.Errorf("%s: %v", tc.preset, err)
+			continue
+		}
+		if f.From != common.HexToAddress(from) || f.To != common.HexToAddress(to) {
+			t.Errorf("%s: from %s to %s, want %s to %s", tc.preset, f.From.Hex(), f.To.Hex(), from, to)
+		}
+		if got := bigOr(f.Value); got != tc.value {
+			t.Errorf("%s: value %d, want %d", tc.preset, got, tc.value)
+		}
+		if got := bigOr(f.TokenID); got != tc.tokenID {
+			t.Errorf("%s: tokenId %d, want %d", tc.preset, got, tc.tokenID)
+		}
+	}
+
+	// ERC-20 and ERC-721 share topic0; the topic count keeps them apart
+	p20, _ := LoadPreset("erc20")
+	if _, err := p20.Decode(erc721); err == nil {
+		t.Error("an ERC-721 Transfer decoded under the erc20 preset")
+	}
+	if _, err := LoadPreset("erc777"); err == nil {
+		t.Error("LoadPreset accepted an unknown standard")
+	}
+}
+
+// bigOr returns n as an int64, or -1 when it is nil
+func bigOr(n *big.Int) int64 {
+	if n == nil {
+		return -1
+	}
+	return n.Int64()
+}
@@ -0,0 +1,86 @@
+package decoder
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Schedule picks the event registry in force at a block. Upgradeable proxies emit
+// events defined by whichever implementation they point at, so each registry
+// applies from its block until the next entry takes over.
+type Schedule struct {
+	entries []scheduleEntry // sorted by fromBlock
+}
+
+type scheduleEntry struct {
+	fromBlock uint64
+	registry  *EventRegistry
+}
+
+// NewSchedule builds a schedule from registries keyed by the block they apply from
+func NewSchedule(byBlock map[uint64]*EventRegistry) *Schedule {
+	s := &Schedule{}
+	for from, r := range byBlock {
+		s.entries = append(s.entries, scheduleEntry{fromBlock: from, registry: r})
+	}
+	sort.Slice(s.entries, func(i, j int) bool { return s.entries[i].fromBlock < s.entries[j].fromBlock })
+	return s
+}
+
+// LoadSchedule parses an ABI spec: either a single ABI path used for every block, or
+// a comma-separated list of fromBlock:path pairs, e.g. "0:v1.json,15000000:v2.json".
+// The ABI is independent of the indexed address, so proxies decode with their
+// implementation's ABI.
+func LoadSchedule(spec string) (*Schedule, error) {
+	byBlock := make(map[uint64]*EventRegistry)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var from uint64
+		path := part
+		// A non-numeric prefix is part of the path (e.g. a Windows drive letter)
+		if block, rest, ok := strings.Cut(part, ":"); ok {
+			if n, err := strconv.ParseUint(block, 10, 64); err == nil {
+				from, path = n, rest
+			}
+		}
+		if _, dup := byBlock[from]; dup {
+			return nil, fmt.Errorf("abi schedule has two entries from block %d", from)
+		}
+
+		r, err := LoadEventRegistry(path)
+		if err != nil {
+			return nil, err
+		}
+		byBlock[from] = r
+	}
+	if len(byBlock) == 0 {
+		return nil, fmt.Errorf("empty abi spec")
+	}
+	return NewSchedule(byBlock), nil
+}
+
+// At returns the registry in force at block, or nil before the first entry
+func (s *Schedule) At(block uint64) *EventRegistry {
+	if s == nil {
+		return nil
+	}
+	i := sort.Search(len(s.entries), func(i int) bool { return s.entries[i].fromBlock > block })
+	if i == 0 {
+		return nil
+	}
+	return s.entries[i-1].registry
+}
+
+// Name resolves topic0 with the registry in force at block, falling back to the raw
+// topic0 hex like EventRegistry.Name. A nil schedule always falls back.
+func (s *Schedule) Name(block uint64, topic0 common.Hash) string {
+	return s.At(block).Name(topic0)
+}
@@ -0,0 +1,67 @@
+package decoder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// erc20ApprovalABI is an implementation upgrade that adds Approval
+const erc20ApprovalABI = `[{"type":"event","name":"Transfer","anonymous":false,"inputs":[
+	{"name":"from","type":"address","indexed":true},
+	{"name":"to","type":"address","indexed":true},
+	{"name":"value","type":"uint256","indexed":false}]},
+	{"type":"event","name":"Approval","anonymous":false,"inputs":[
+	{"name":"owner","type":"address","indexed":true},
+	{"name":"spender","type":"address","indexed":true},
+	{"name":"value","type":"uint256","indexed":false}]}]`
+
+// approvalTopic is keccak256("Approval(address,address,uint256)")
+var approvalTopic = common.HexToHash("0x8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925")
+
+func TestScheduleSwitchesABIAtBlock(t *testing.T) {
+	dir := t.TempDir()
+	v1, v2 := filepath.Join(dir, "v1.json"), filepath.Join(dir, "v2.json")
+	for path, abi := range map[string]string{v1: erc20ABI, v2: erc20ApprovalABI} {
+		if err := os.WriteFile(path, []byte(abi), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := LoadSchedule("1000:" + v2 + ", 10:" + v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		block uint64
+		topic common.Hash
+		want  string
+	}{
+		{9, transferTopic, transferTopic.Hex()}, // before the proxy existed
+		{10, transferTopic, "Transfer"},
+		{999, approvalTopic, approvalTopic.Hex()},
+		{999, transferTopic, "Transfer"},
+		{1000, approvalTopic, "Approval"},
+		{5000, transferTopic, "Transfer"},
+	} {
+		if got := s.Name(tc.block, tc.topic); got != tc.want {
+			t.Errorf("block %d topic %s = %q, want %q", tc.block, tc.topic.Hex()[:10], got, tc.want)
+		}
+	}
+
+	// A plain path applies from genesis
+	single, err := LoadSchedule(v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := single.Name(0, approvalTopic); got != "Approval" {
+		t.Errorf("single ABI at block 0 = %q, want Approval", got)
+	}
+
+	if _, err := LoadSchedule("5:" + v1 + ",5:" + v2); err == nil || !strings.Contains(err.Error(), "block 5") {
+		t.Errorf("two ABIs from block 5: %v, want a duplicate error", err)
+	}
+}
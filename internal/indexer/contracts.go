@@ -0,0 +1,212 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ContractSet is the list of contract addresses whose logs are indexed, shared by every
+// eth_getLogs filter. When loaded from a file it can be reloaded while the indexer runs,
+// so contracts appended to the file are picked up by the next query. Addresses added
+// with Add, e.g. children found by a FactoryWatch, survive reloads.
+type ContractSet struct {
+	path  string
+	addrs []common.Address
+	added map[common.Address]bool
+	mu    sync.RWMutex
+}
+
+// NewContractSet creates a fixed set of addresses
+func NewContractSet(addrs ...common.Address) *ContractSet {
+	return &ContractSet{addrs: dedupeAddresses(addrs)}
+}
+
+// LoadContractSet reads the addresses in path, see ParseContracts
+func LoadContractSet(path string) (*ContractSet, error) {
+	addrs, err := readContracts(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ContractSet{path: path, addrs: addrs}, nil
+}
+
+// ParseContracts reads a contracts file: either a JSON array of address strings or one
+// address per line, where blank lines and lines starting with # are ignored.
+// Duplicates are dropped, keeping the first occurrence.
+func ParseContracts(data []byte) ([]common.Address, error) {
+	var fields []string
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &fields); err != nil {
+			return nil, fmt.Errorf("invalid JSON address list: %w", err)
+		}
+	} else {
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			fields = append(fields, line)
+		}
+	}
+
+	addrs := make([]common.Address, 0, len(fields))
+	for i, field := range fields {
+		field = strings.TrimSpace(field)
+		if !common.IsHexAddress(field) {
+			return nil, fmt.Errorf("entry %d: %q is not an address", i+1, field)
+		}
+		addrs = append(addrs, common.HexToAddress(field))
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses")
+	}
+	return dedupeAddresses(addrs), nil
+}
+
+func readContracts(path string) ([]common.Address, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := ParseContracts(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return addrs, nil
+}
+
+func dedupeAddresses(addrs []common.Address) []common.Address {
+	seen := make(map[common.Address]bool, len(addrs))
+	out := addrs[:0:0]
+	for _, addr := range addrs {
+		if !seen[addr] {
+			seen[addr] = true
+			out = append(out, addr)
+		}
+	}
+	return out
+}
+
+// Addresses returns a copy of the current addresses, for an eth_getLogs filter
+func (c *ContractSet) Addresses() []common.Address {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]common.Address(nil), c.addrs...)
+}
+
+// Contains reports whether addr is in the set
+func (c *ContractSet) Contains(addr common.Address) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return containsAddress(c.addrs, addr)
+}
+
+// Len returns the number of addresses
+func (c *ContractSet) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.addrs)
+}
+
+// Add appends the addresses not already in the set and returns those
+func (c *ContractSet) Add(addrs ...common.Address) []common.Address {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var fresh []common.Address
+	for _, addr := range addrs {
+		if containsAddress(c.addrs, addr) {
+			continue
+		}
+		if c.added == nil {
+			c.added = make(map[common.Address]bool)
+		}
+		c.added[addr] = true
+		c.addrs = append(c.addrs, addr)
+		fresh = append(fresh, addr)
+	}
+	return fresh
+}
+
+func containsAddress(addrs []common.Address, addr common.Address) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload re-reads the file the set was loaded from and returns the addresses that were
+// added and removed. A file that cannot be read or parsed, including an empty one caught
+// mid-rewrite, leaves the set unchanged.
+func (c *ContractSet) Reload() (added, removed []common.Address, err error) {
+	if c.path == "" {
+		return nil, nil, nil
+	}
+	addrs, err := readContracts(c.path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for addr := range c.added {
+		if !containsAddress(addrs, addr) {
+			addrs = append(addrs, addr)
+		}
+	}
+	old := make(map[common.Address]bool, len(c.addrs))
+	for _, addr := range c.addrs {
+		old[addr] = true
+	}
+	for _, addr := range addrs {
+		if !old[addr] {
+			added = append(added, addr)
+		}
+		delete(old, addr)
+	}
+	for _, addr := range c.addrs {
+		if old[addr] {
+			removed = append(removed, addr)
+		}
+	}
+	c.addrs = addrs
+	return added, removed, nil
+}
+
+// Watch reloads the set every interval until ctx is done, logging changes and failed
+// reloads. It returns at once for a set not loaded from a file or a zero interval.
+func (c *ContractSet) Watch(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	if c.path == "" || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			added, removed, err := c.Reload()
+			if err != nil {
+				logger.Warn("Contracts file reload failed, keeping the current set", "path", c.path, "error", err)
+				continue
+			}
+			if len(added) > 0 || len(removed) > 0 {
+				logger.Info("Contracts file reloaded", "path", c.path,
+					"added", len(added), "removed", len(removed), "total", c.Len())
+			}
+		}
+	}
+}
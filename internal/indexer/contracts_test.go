@@ -0,0 +1,90 @@
+package indexer
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestContractSetReloadPicksUpAppendedAddress(t *testing.T) {
+	pool1 := common.HexToAddress("0x88e6A0c2dDD26FEEb64F039a2c41296FcB3f5640")
+	pool2 := common.HexToAddress("0x8ad599c3A0ff1De082011EFDDc58f1908eb6e6D8")
+	pool3 := common.HexToAddress("0x4e68Ccd3E89f51C3074ca5072bbAC773960dFa36")
+
+	path := filepath.Join(t.TempDir(), "pools.txt")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("# factory pools\n" + pool1.Hex() + "\n\n" + pool2.Hex() + "\n" + pool1.Hex() + "\n")
+
+	set, err := LoadContractSet(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := set.Addresses(); !slices.Equal(got, []common.Address{pool1, pool2}) {
+		t.Fatalf("loaded %v, want pool1 and pool2 once each", got)
+	}
+
+	// A pool deployed since is appended; the next query's filter includes it
+	write("# factory pools\n" + pool1.Hex() + "\n\n" + pool2.Hex() + "\n" + pool3.Hex() + "\n")
+	added, removed, err := set.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(added, []common.Address{pool3}) || len(removed) != 0 {
+		t.Errorf("reload added %v removed %v, want pool3 added", added, removed)
+	}
+	if got := set.Addresses(); !slices.Equal(got, []common.Address{pool1, pool2, pool3}) || !set.Contains(pool3) {
+		t.Errorf("after reload the filter holds %v", got)
+	}
+
+	// A file caught empty mid-rewrite keeps the set
+	write("")
+	if _, _, err := set.Reload(); err == nil || set.Len() != 3 {
+		t.Errorf("reload of an empty file: %v, %d addresses kept", err, set.Len())
+	}
+
+	// JSON lists reload the same way, and removals are reported
+	write(`["` + pool3.Hex() + `", "` + pool1.Hex() + `"]`)
+	if _, removed, err := set.Reload(); err != nil || !slices.Equal(removed, []common.Address{pool2}) {
+		t.Errorf("JSON reload: removed %v, %v; want pool2", removed, err)
+	}
+}
+
+func TestContractSetWatch(t *testing.T) {
+	pool1 := common.HexToAddress("0x88e6A0c2dDD26FEEb64F039a2c41296FcB3f5640")
+	pool2 := common.HexToAddress("0x8ad599c3A0ff1De082011EFDDc58f1908eb6e6D8")
+	path := filepath.Join(t.TempDir(), "pools.json")
+	if err := os.WriteFile(path, []byte(`["`+pool1.Hex()+`"]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	set, err := LoadContractSet(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go set.Watch(ctx, 10*time.Millisecond, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := os.WriteFile(path, []byte(`["`+pool1.Hex()+`", "`+pool2.Hex()+`"]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !set.Contains(pool2) {
+		if time.Now().After(deadline) {
+			t.Fatal("Watch did not pick up the appended address")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
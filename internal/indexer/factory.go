@@ -0,0 +1,115 @@
+package indexer
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"example/hello/pkg/types"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+)
+
+// ChildArg locates the child contract address in a factory's creation event: an
+// indexed topic (1-3) or a 32-byte word of the data (0-based). Uniswap V2's PairCreated
+// carries the pair in data word 0, V3's PoolCreated the pool in data word 1.
+type ChildArg struct {
+	Topic bool
+	Index int
+}
+
+// ParseChildArg parses "topicN" or "dataN"
+func ParseChildArg(s string) (ChildArg, error) {
+	var arg ChildArg
+	var num string
+	switch {
+	case strings.HasPrefix(s, "topic"):
+		arg.Topic, num = true, strings.TrimPrefix(s, "topic")
+	case strings.HasPrefix(s, "data"):
+		num = strings.TrimPrefix(s, "data")
+	default:
+		return arg, fmt.Errorf("child argument %q must be topic1-topic3 or dataN", s)
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil || n < 0 || (arg.Topic && (n < 1 || n > 3)) {
+		return arg, fmt.Errorf("child argument %q must be topic1-topic3 or dataN", s)
+	}
+	arg.Index = n
+	return arg, nil
+}
+
+func (a ChildArg) String() string {
+	if a.Topic {
+		return fmt.Sprintf("topic%d", a.Index)
+	}
+	return fmt.Sprintf("data%d", a.Index)
+}
+
+// FactoryWatch discovers child contracts from the creation event a factory emits for
+// each of them, so the configured child event can be indexed on every child
+type FactoryWatch struct {
+	Factory common.Address
+	Topic   common.Hash // topic0 of the creation event, e.g. PoolCreated
+	Child   ChildArg
+}
+
+// Query is the eth_getLogs filter for creation events in [from, to]
+func (f *FactoryWatch) Query(from, to uint64) ethereum.FilterQuery {
+	return ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(from),
+		ToBlock:   new(big.Int).SetUint64(to),
+		Addresses: []common.Address{f.Factory},
+		Topics:    [][]common.Hash{{f.Topic}},
+	}
+}
+
+// ChildAddress extracts the child address from a creation event. A word that does not
+// hold a left-padded address is refused, as that means the argument is misconfigured.
+func (f *FactoryWatch) ChildAddress(l ethtypes.Log) (common.Address, error) {
+	if l.Address != f.Factory || len(l.Topics) == 0 || l.Topics[0] != f.Topic {
+		return common.Address{}, fmt.Errorf("log %d in block %d is not a creation event of %s", l.Index, l.BlockNumber, f.Factory.Hex())
+	}
+
+	var word []byte
+	if f.Child.Topic {
+		if f.Child.Index >= len(l.Topics) {
+			return common.Address{}, fmt.Errorf("creation event has no %s", f.Child)
+		}
+		word = l.Topics[f.Child.Index].Bytes()
+	} else {
+		start := f.Child.Index * 32
+		if start+32 > len(l.Data) {
+			return common.Address{}, fmt.Errorf("creation event data has no %s", f.Child)
+		}
+		word = l.Data[start : start+32]
+	}
+	for _, b := range word[:12] {
+		if b != 0 {
+			return common.Address{}, fmt.Errorf("%s of the creation event is not an address", f.Child)
+		}
+	}
+	child := common.BytesToAddress(word[12:])
+	if child == (common.Address{}) {
+		return common.Address{}, fmt.Errorf("%s of the creation event is the zero address", f.Child)
+	}
+	return child, nil
+}
+
+// Discovered turns a creation event into the record persisted for its child
+func (f *FactoryWatch) Discovered(l ethtypes.Log) (*types.DiscoveredContract, error) {
+	child, err := f.ChildAddress(l)
+	if err != nil {
+		return nil, err
+	}
+	return &types.DiscoveredContract{
+		Address:      child.Hex(),
+		Factory:      f.Factory.Hex(),
+		BlockNumber:  l.BlockNumber,
+		TxHash:       l.TxHash.Hex(),
+		DiscoveredAt: time.Now().UTC(),
+	}, nil
+}
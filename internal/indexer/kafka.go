@@ -0,0 +1,235 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"example/hello/pkg/types"
+)
+
+// Kafka message keys
+const (
+	KafkaKeyIndex = "index" // one key per log; needed for a log-compacted topic
+	KafkaKeyBlock = "block" // one key per block, so a block's logs share a partition
+)
+
+// kafkaContentType is the REST Proxy v2 embedded-JSON format
+const kafkaContentType = "application/vnd.kafka.json.v2+json"
+
+// KafkaSink publishes indexed entries to a Kafka topic through a Kafka REST Proxy (v2
+// API), so no Kafka client library is needed. Entries are buffered and sent in batches
+// of up to batchSize, or every flush interval by Run. Delivery is at-least-once: records
+// the proxy did not acknowledge stay buffered, ahead of newer ones, and are sent again
+// by the next flush. A caller must not advance its checkpoint past entries until Flush
+// has returned nil for them.
+type KafkaSink struct {
+	endpoint  string
+	keyBy     string
+	batchSize int
+	interval  time.Duration
+	client    *http.Client
+	logger    *slog.Logger
+
+	buf []kafkaRecord
+	mu  sync.Mutex
+}
+
+// kafkaRecord is one record of a REST Proxy produce request. A nil Value is sent as
+// JSON null, i.e. a tombstone.
+type kafkaRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// kafkaOffset is the proxy's per-record result, in request order
+type kafkaOffset struct {
+	Partition int     `json:"partition"`
+	Offset    int64   `json:"offset"`
+	ErrorCode *int    `json:"error_code"`
+	Error     *string `json:"error"`
+}
+
+// NewKafkaSink publishes to topic through the REST Proxy at proxyURL, keying records
+// by KafkaKeyIndex or KafkaKeyBlock (default index)
+func NewKafkaSink(proxyURL, topic, keyBy string, batchSize int, interval time.Duration, logger *slog.Logger) (*KafkaSink, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid Kafka REST proxy URL %q", proxyURL)
+	}
+	if topic == "" {
+		return nil, fmt.Errorf("kafka topic is required")
+	}
+	switch keyBy {
+	case "":
+		keyBy = KafkaKeyIndex
+	case KafkaKeyIndex, KafkaKeyBlock:
+	default:
+		return nil, fmt.Errorf("unknown kafka key %q (want index or block)", keyBy)
+	}
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	u = u.JoinPath("topics", topic)
+	return &KafkaSink{
+		endpoint:  u.String(),
+		keyBy:     keyBy,
+		batchSize: batchSize,
+		interval:  interval,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		logger:    logger,
+	}, nil
+}
+
+// key returns the record key of an entry
+func (k *KafkaSink) key(entry *types.LogEntry) string {
+	if k.keyBy == KafkaKeyBlock {
+		return strconv.FormatUint(entry.BlockNumber, 10)
+	}
+	return strconv.FormatUint(entry.Index, 10)
+}
+
+// Publish buffers entries and flushes once a full batch is buffered. An error means
+// the flush failed; the entries stay buffered.
+func (k *KafkaSink) Publish(ctx context.Context, entries ...*types.LogEntry) error {
+	records := make([]kafkaRecord, 0, len(entries))
+	for _, entry := range entries {
+		val, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to marshal entry %d: %w", entry.Index, err)
+		}
+		records = append(records, kafkaRecord{Key: k.key(entry), Value: val})
+	}
+	return k.enqueue(ctx, records)
+}
+
+// Tombstone buffers a null-value record for each key of entries removed by a reorg
+// rollback, so compaction drops them from the topic. With block keys one tombstone per
+// block is sent.
+func (k *KafkaSink) Tombstone(ctx context.Context, removed ...*types.LogEntry) error {
+	seen := make(map[string]bool, len(removed))
+	records := make([]kafkaRecord, 0, len(removed))
+	for _, entry := range removed {
+		key := k.key(entry)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		records = append(records, kafkaRecord{Key: key})
+	}
+	return k.enqueue(ctx, records)
+}
+
+func (k *KafkaSink) enqueue(ctx context.Context, records []kafkaRecord) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.buf = append(k.buf, records...)
+	if len(k.buf) < k.batchSize {
+		return nil
+	}
+	return k.flush(ctx)
+}
+
+// Flush sends every buffered record
+func (k *KafkaSink) Flush(ctx context.Context) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.flush(ctx)
+}
+
+// Buffered returns the number of records not yet acknowledged
+func (k *KafkaSink) Buffered() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.buf)
+}
+
+func (k *KafkaSink) flush(ctx context.Context) error {
+	for len(k.buf) > 0 {
+		n := min(len(k.buf), k.batchSize)
+		failed, err := k.produce(ctx, k.buf[:n])
+		if err != nil {
+			return err
+		}
+		// Unacknowledged records go back to the front, in their original order
+		k.buf = append(failed, k.buf[n:]...)
+		if len(failed) > 0 {
+			return fmt.Errorf("kafka proxy rejected %d of %d records", len(failed), n)
+		}
+	}
+	return nil
+}
+
+// produce sends one batch and returns the records the proxy reported as failed
+func (k *KafkaSink) produce(ctx context.Context, records []kafkaRecord) ([]kafkaRecord, error) {
+	body, err := json.Marshal(map[string]interface{}{"records": records})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", kafkaContentType)
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("kafka proxy returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	var result struct {
+		Offsets []kafkaOffset `json:"offsets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid kafka proxy response: %w", err)
+	}
+	if len(result.Offsets) != len(records) {
+		return nil, fmt.Errorf("kafka proxy acknowledged %d of %d records", len(result.Offsets), len(records))
+	}
+	var failed []kafkaRecord
+	for i, off := range result.Offsets {
+		if off.ErrorCode != nil || off.Error != nil {
+			failed = append(failed, records[i])
+		}
+	}
+	return failed, nil
+}
+
+// Run flushes every interval until ctx is cancelled, then makes a final flush so
+// buffered entries of a clean shutdown are not left behind
+func (k *KafkaSink) Run(ctx context.Context) {
+	ticker := time.NewTicker(k.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := k.Flush(flushCtx); err != nil {
+				k.logger.Warn("Final Kafka flush failed", "buffered", k.Buffered(), "err", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := k.Flush(ctx); err != nil {
+				k.logger.Warn("Kafka flush failed, will retry", "buffered", k.Buffered(), "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	"example/hello/pkg/types"
+)
+
+// restProxy is a Kafka REST Proxy receiving produce requests for one topic. reject
+// decides, per record, whether the broker fails it; status overrides the HTTP status.
+type restProxy struct {
+	mu       sync.Mutex
+	received []kafkaRecord
+	requests int
+	reject   func(key string) bool
+	status   int
+}
+
+func (p *restProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests++
+	if r.URL.Path != "/topics/eth-logs" || r.Header.Get("Content-Type") != kafkaContentType {
+		http.Error(w, "unexpected request "+r.URL.Path, http.StatusBadRequest)
+		return
+	}
+	if p.status != 0 {
+		w.WriteHeader(p.status)
+		return
+	}
+	var body struct {
+		Records []kafkaRecord `json:"records"`
+	}
+	data, _ := io.ReadAll(r.Body)
+	if err := json.Unmarshal(data, &body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offsets := make([]map[string]interface{}, len(body.Records))
+	for i, rec := range body.Records {
+		if p.reject != nil && p.reject(rec.Key) {
+			offsets[i] = map[string]interface{}{"error_code": 50002, "error": "leader not available"}
+			continue
+		}
+		p.received = append(p.received, rec)
+		offsets[i] = map[string]interface{}{"partition": 0, "offset": len(p.received) - 1}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"offsets": offsets})
+}
+
+// keys returns the keys received so far, with "~" marking a tombstone
+func (p *restProxy) keys() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var keys []string
+	for _, rec := range p.received {
+		if string(rec.Value) == "null" {
+			keys = append(keys, "~"+rec.Key)
+		} else {
+			keys = append(keys, rec.Key)
+		}
+	}
+	return keys
+}
+
+func newTestSink(t *testing.T, proxy *restProxy, keyBy string, batch int) *KafkaSink {
+	t.Helper()
+	srv := httptest.NewServer(proxy)
+	t.Cleanup(srv.Close)
+	sink, err := NewKafkaSink(srv.URL, "eth-logs", keyBy, batch, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sink
+}
+
+func TestKafkaSinkPublishesBatches(t *testing.T) {
+	ctx := context.Background()
+	proxy := &restProxy{}
+	sink := newTestSink(t, proxy, KafkaKeyIndex, 2)
+
+	// Less than a batch waits for a flush
+	if err := sink.Publish(ctx, &types.LogEntry{Index: 7, BlockNumber: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if got := proxy.keys(); len(got) != 0 || sink.Buffered() != 1 {
+		t.Errorf("after one entry: received %v with %d buffered, want nothing sent", got, sink.Buffered())
+	}
+
+	// A full batch flushes the buffer, in produce requests of at most two records
+	if err := sink.Publish(ctx, &types.LogEntry{Index: 8, BlockNumber: 100}, &types.LogEntry{Index: 9, BlockNumber: 101}); err != nil {
+		t.Fatal(err)
+	}
+	if got := proxy.keys(); !slices.Equal(got, []string{"7", "8", "9"}) || sink.Buffered() != 0 || proxy.requests != 2 {
+		t.Errorf("after a full batch: received %v in %d requests with %d buffered", got, proxy.requests, sink.Buffered())
+	}
+	var entry types.LogEntry
+	if err := json.Unmarshal(proxy.received[2].Value, &entry); err != nil || entry.Index != 9 || entry.BlockNumber != 101 {
+		t.Errorf("record value %s does not carry entry 9: %v", proxy.received[2].Value, err)
+	}
+}
+
+func TestKafkaSinkRedeliversUnacknowledged(t *testing.T) {
+	ctx := context.Background()
+	proxy := &restProxy{status: http.StatusServiceUnavailable}
+	sink := newTestSink(t, proxy, KafkaKeyIndex, 10)
+
+	if err := sink.Publish(ctx, &types.LogEntry{Index: 1}, &types.LogEntry{Index: 2}, &types.LogEntry{Index: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Flush(ctx); err == nil || sink.Buffered() != 3 {
+		t.Errorf("flush to a failing proxy: %v with %d buffered, want an error and all 3 kept", err, sink.Buffered())
+	}
+
+	// The proxy is back but the broker fails record 2: it alone is kept, then sent
+	proxy.status = 0
+	proxy.reject = func(key string) bool { return key == "2" }
+	if err := sink.Flush(ctx); err == nil || sink.Buffered() != 1 {
+		t.Errorf("partial failure: %v with %d buffered, want an error and 1 kept", err, sink.Buffered())
+	}
+	proxy.reject = nil
+	if err := sink.Flush(ctx); err != nil || sink.Buffered() != 0 {
+		t.Fatalf("retry: %v with %d buffered", err, sink.Buffered())
+	}
+	if got := proxy.keys(); !slices.Equal(got, []string{"1", "3", "2"}) {
+		t.Errorf("received %v, want every entry at least once", got)
+	}
+}
+
+func TestKafkaSinkTombstonesRolledBackBlocks(t *testing.T) {
+	ctx := context.Background()
+	proxy := &restProxy{}
+	sink := newTestSink(t, proxy, KafkaKeyBlock, 100)
+
+	removed := []*types.LogEntry{{Index: 4, BlockNumber: 200}, {Index: 5, BlockNumber: 200}, {Index: 6, BlockNumber: 201}}
+	if err := sink.Tombstone(ctx, removed...); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := proxy.keys(); !slices.Equal(got, []string{"~200", "~201"}) {
+		t.Errorf("tombstones %v, want one null record per rolled-back block", got)
+	}
+}
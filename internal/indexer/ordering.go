@@ -0,0 +1,116 @@
+package indexer
+
+import (
+	"context"
+	"sync"
+
+	"example/hello/pkg/types"
+)
+
+// Orderer releases indexed entries strictly in index order. Workers hand entries over as
+// they finish; an entry that arrives ahead of a gap is held until the gap fills. At most
+// max entries are held: further out-of-order arrivals wait for room, while the entry
+// that fills the gap is always accepted. Each producer must add its own entries in
+// ascending index order, otherwise it can block holding the very entry that frees room.
+type Orderer struct {
+	next    uint64
+	held    map[uint64]*types.LogEntry // nil value: index skipped
+	max     int
+	emit    func(*types.LogEntry) error
+	err     error
+	changed chan struct{} // closed and replaced whenever held shrinks or next moves
+	mu      sync.Mutex
+}
+
+// NewOrderer creates an orderer whose first released entry has index next. emit is
+// called in index order, one entry at a time; once it fails, every later Add returns
+// that error.
+func NewOrderer(next uint64, max int, emit func(*types.LogEntry) error) *Orderer {
+	if max <= 0 {
+		max = 1
+	}
+	return &Orderer{
+		next:    next,
+		held:    make(map[uint64]*types.LogEntry),
+		max:     max,
+		emit:    emit,
+		changed: make(chan struct{}),
+	}
+}
+
+// Add hands over a completed entry
+func (o *Orderer) Add(ctx context.Context, entry *types.LogEntry) error {
+	return o.put(ctx, entry.Index, entry)
+}
+
+// Skip marks index as never coming, e.g. an entry dropped before storage, so later
+// entries are not held back waiting for it
+func (o *Orderer) Skip(ctx context.Context, index uint64) error {
+	return o.put(ctx, index, nil)
+}
+
+// Held returns the number of entries waiting for an earlier index
+func (o *Orderer) Held() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.held)
+}
+
+// Next returns the index of the next entry to be released
+func (o *Orderer) Next() uint64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.next
+}
+
+func (o *Orderer) put(ctx context.Context, index uint64, entry *types.LogEntry) error {
+	o.mu.Lock()
+	for {
+		if o.err != nil || index <= o.next || len(o.held) < o.max {
+			break
+		}
+		changed := o.changed
+		o.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		o.mu.Lock()
+	}
+	defer o.mu.Unlock()
+
+	if o.err != nil {
+		return o.err
+	}
+	if index < o.next {
+		return nil // already released or skipped; a retry must not emit twice
+	}
+	o.held[index] = entry
+	return o.release()
+}
+
+// release emits every held entry from next onward without a gap
+func (o *Orderer) release() error {
+	progressed := false
+	for {
+		entry, ok := o.held[o.next]
+		if !ok {
+			break
+		}
+		delete(o.held, o.next)
+		if entry != nil {
+			if err := o.emit(entry); err != nil {
+				o.err = err
+				break
+			}
+		}
+		o.next++
+		progressed = true
+	}
+	if progressed || o.err != nil {
+		close(o.changed)
+		o.changed = make(chan struct{})
+	}
+	return o.err
+}
@@ -0,0 +1,99 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"example/hello/pkg/types"
+)
+
+func TestOrdererReleasesInIndexOrder(t *testing.T) {
+	ctx := context.Background()
+	var emitted []uint64
+	o := NewOrderer(10, 2, func(e *types.LogEntry) error {
+		emitted = append(emitted, e.Index)
+		return nil
+	})
+
+	if err := o.Add(ctx, &types.LogEntry{Index: 12}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Skip(ctx, 13); err != nil {
+		t.Fatal(err)
+	}
+	if len(emitted) != 0 || o.Held() != 2 {
+		t.Fatalf("emitted %v holding %d before index 10 arrived, want nothing and 2", emitted, o.Held())
+	}
+
+	// The buffer is full: a further early arrival waits, the gap fillers do not
+	added := make(chan error, 1)
+	go func() { added <- o.Add(ctx, &types.LogEntry{Index: 14}) }()
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := o.Add(short, &types.LogEntry{Index: 15}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Add(15) over the bound = %v, want it to wait until the deadline", err)
+	}
+	if err := o.Add(ctx, &types.LogEntry{Index: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Add(ctx, &types.LogEntry{Index: 11}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-added:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Add(14) still blocked after the gap filled")
+	}
+	if want := []uint64{10, 11, 12, 14}; !slices.Equal(emitted, want) {
+		t.Errorf("emitted %v, want %v with 13 skipped", emitted, want)
+	}
+
+	// A retried entry is not emitted twice
+	if err := o.Add(ctx, &types.LogEntry{Index: 11}); err != nil || len(emitted) != 4 {
+		t.Errorf("re-adding 11: %v, emitted %v", err, emitted)
+	}
+}
+
+func TestOrdererConcurrentProducers(t *testing.T) {
+	const producers, perProducer = 8, 50
+	var emitted []uint64
+	o := NewOrderer(0, 4, func(e *types.LogEntry) error {
+		emitted = append(emitted, e.Index)
+		return nil
+	})
+
+	// Each producer completes its own indices in ascending order at random speeds
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(p)))
+			for i := 0; i < perProducer; i++ {
+				time.Sleep(time.Duration(rng.Intn(200)) * time.Microsecond)
+				if err := o.Add(context.Background(), &types.LogEntry{Index: uint64(i*producers + p)}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	if len(emitted) != producers*perProducer {
+		t.Fatalf("emitted %d entries, want %d", len(emitted), producers*perProducer)
+	}
+	for i, idx := range emitted {
+		if idx != uint64(i) {
+			t.Fatalf("emission %d was index %d; out of order", i, idx)
+		}
+	}
+}
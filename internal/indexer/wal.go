@@ -0,0 +1,230 @@
+package indexer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+)
+
+// walCompactAfter is the number of records appended before an empty WAL is truncated
+const walCompactAfter = 4096
+
+// WAL is an append-only file recording the live logs that were seen but whose enriched
+// entry is not yet committed to storage. The indexer calls Seen before fetching a log's
+// block and receipt and Done once the entry is stored; after a crash in between,
+// Pending returns the logs to enrich again instead of losing them.
+//
+// Seen records are synced to disk before Seen returns. Done records are not: losing one
+// only means the log is enriched and stored a second time, which overwrites the same
+// entry.
+type WAL struct {
+	path    string
+	f       *os.File
+	pending map[walKey]ethtypes.Log
+	written int // records appended since the file was last rewritten
+	mu      sync.Mutex
+}
+
+// walKey identifies a log independently of the index it is stored under
+type walKey struct {
+	Block common.Hash
+	Index uint
+}
+
+// walRecord is one line of the WAL file: Log is set on "seen" records only
+type walRecord struct {
+	Op    string        `json:"op"` // "seen" or "done"
+	Block common.Hash   `json:"block"`
+	Index uint          `json:"index"`
+	Log   *ethtypes.Log `json:"log,omitempty"`
+}
+
+// OpenWAL opens or creates the WAL at path and replays it. A record cut short by a
+// crash mid-write ends the replay; the file is then rewritten with just the pending logs.
+func OpenWAL(path string) (*WAL, error) {
+	w := &WAL{path: path, pending: make(map[walKey]ethtypes.Log)}
+	if err := w.replay(); err != nil {
+		return nil, err
+	}
+	if err := w.rewrite(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *WAL) replay() error {
+	f, err := os.Open(w.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open wal: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return nil // an unterminated last line is a torn write
+		}
+		if err != nil {
+			return fmt.Errorf("read wal: %w", err)
+		}
+		var rec walRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("wal %s: corrupt record: %w", w.path, err)
+		}
+		key := walKey{rec.Block, rec.Index}
+		switch rec.Op {
+		case "seen":
+			if rec.Log != nil {
+				w.pending[key] = *rec.Log
+			}
+		case "done":
+			delete(w.pending, key)
+		default:
+			return fmt.Errorf("wal %s: unknown op %q", w.path, rec.Op)
+		}
+	}
+}
+
+// rewrite replaces the file with the pending logs only and reopens it for appending
+func (w *WAL) rewrite() error {
+	tmp := w.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("rewrite wal: %w", err)
+	}
+	buf := bufio.NewWriter(f)
+	for _, l := range w.sortedPending() {
+		if err := writeRecord(buf, walRecord{Op: "seen", Block: l.BlockHash, Index: l.Index, Log: &l}); err != nil {
+			f.Close()
+			return fmt.Errorf("rewrite wal: %w", err)
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("rewrite wal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("rewrite wal: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("rewrite wal: %w", err)
+	}
+	if err := os.Rename(tmp, w.path); err != nil {
+		return fmt.Errorf("rewrite wal: %w", err)
+	}
+
+	if w.f != nil {
+		w.f.Close()
+	}
+	w.f, err = os.OpenFile(w.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("reopen wal: %w", err)
+	}
+	w.written = 0
+	return nil
+}
+
+func writeRecord(out io.Writer, rec walRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(append(data, '\n'))
+	return err
+}
+
+// Seen records logs as pending enrichment and syncs the file
+func (w *WAL) Seen(logs ...ethtypes.Log) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	buf := bufio.NewWriter(w.f)
+	for _, l := range logs {
+		if err := writeRecord(buf, walRecord{Op: "seen", Block: l.BlockHash, Index: l.Index, Log: &l}); err != nil {
+			return fmt.Errorf("wal seen: %w", err)
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("wal seen: %w", err)
+	}
+	if err := w.f.Sync(); err != nil {
+		return fmt.Errorf("wal sync: %w", err)
+	}
+	for _, l := range logs {
+		w.pending[walKey{l.BlockHash, l.Index}] = l
+	}
+	w.written += len(logs)
+	return nil
+}
+
+// Done clears logs whose entries are committed to storage. Once nothing is pending and
+// enough records have accumulated, the file is truncated.
+func (w *WAL) Done(logs ...ethtypes.Log) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	buf := bufio.NewWriter(w.f)
+	for _, l := range logs {
+		if err := writeRecord(buf, walRecord{Op: "done", Block: l.BlockHash, Index: l.Index}); err != nil {
+			return fmt.Errorf("wal done: %w", err)
+		}
+		delete(w.pending, walKey{l.BlockHash, l.Index})
+	}
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("wal done: %w", err)
+	}
+	w.written += len(logs)
+
+	if len(w.pending) == 0 && w.written >= walCompactAfter {
+		return w.rewrite()
+	}
+	return nil
+}
+
+// Pending returns the logs seen but not done, in chain order. The indexer re-enriches
+// them on startup before following the head again.
+func (w *WAL) Pending() []ethtypes.Log {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.sortedPending()
+}
+
+func (w *WAL) sortedPending() []ethtypes.Log {
+	logs := make([]ethtypes.Log, 0, len(w.pending))
+	for _, l := range w.pending {
+		logs = append(logs, l)
+	}
+	sort.Slice(logs, func(i, j int) bool {
+		if logs[i].BlockNumber != logs[j].BlockNumber {
+			return logs[i].BlockNumber < logs[j].BlockNumber
+		}
+		return logs[i].Index < logs[j].Index
+	})
+	return logs
+}
+
+// Close closes the file; pending logs stay recorded for the next OpenWAL
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}
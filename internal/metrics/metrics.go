@@ -17,6 +17,17 @@ type Metrics struct {
 	ReorgsDetected    prometheus.Counter
 	BlocksRolledBack  prometheus.Counter
 	CheckpointsSaved  prometheus.Counter
+
+	BatchDurationSeconds prometheus.Histogram
+	BatchLogCount        prometheus.Gauge
+	RPCEndpointErrors    *prometheus.CounterVec
+	WebSocketConnections prometheus.Gauge
+	RPCRetriesTotal      prometheus.Counter
+	RPCBreakerState      prometheus.Gauge
+	BlockCacheEvents     *prometheus.CounterVec
+	RPCMethodCalls       *prometheus.CounterVec
+	HeadSkewSeconds      prometheus.Gauge
+	HeadStale            prometheus.Gauge
 }
 
 // NewMetrics creates and registers all Prometheus metrics
@@ -63,6 +74,47 @@ func NewMetrics() *Metrics {
 			Name: "eth_indexer_checkpoints_saved_total",
 			Help: "Total number of checkpoints saved",
 		}),
+		BatchDurationSeconds: promauto.NewHistogram(prometheus.HistogramOpts{
+			Name:    "eth_indexer_batch_duration_seconds",
+			Help:    "Time to fetch, enrich and store one backfill batch",
+			Buckets: []float64{1, 5, 10, 30, 60, 120, 300, 600},
+		}),
+		BatchLogCount: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "eth_indexer_batch_log_count",
+			Help: "Number of logs in the most recently completed batch",
+		}),
+		RPCEndpointErrors: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "eth_indexer_rpc_endpoint_errors_total",
+			Help: "RPC errors per endpoint, used to track failover",
+		}, []string{"endpoint"}),
+		WebSocketConnections: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "eth_indexer_websocket_connections",
+			Help: "Currently open WebSocket connections",
+		}),
+		RPCRetriesTotal: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "eth_indexer_rpc_retries_total",
+			Help: "RPC calls retried after a failure",
+		}),
+		RPCBreakerState: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "eth_indexer_rpc_breaker_state",
+			Help: "RPC circuit breaker state: 0 closed, 1 open, 2 half-open",
+		}),
+		BlockCacheEvents: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "eth_indexer_block_cache_events_total",
+			Help: "Block cache lookups and evictions by event (hit, miss, eviction)",
+		}, []string{"event"}),
+		RPCMethodCalls: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "eth_indexer_rpc_method_calls_total",
+			Help: "RPC calls by JSON-RPC method and outcome (ok, error, blocked by the allowlist)",
+		}, []string{"method", "outcome"}),
+		HeadSkewSeconds: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "eth_indexer_head_skew_seconds",
+			Help: "Local time minus the RPC head block's timestamp",
+		}),
+		HeadStale: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "eth_indexer_head_stale",
+			Help: "1 when the head block's timestamp trails local time by more than the max head skew",
+		}),
 	}
 }
 
@@ -115,3 +167,45 @@ func (m *Metrics) RecordBlocksRolledBack(count uint64) {
 func (m *Metrics) RecordCheckpointSaved() {
 	m.CheckpointsSaved.Inc()
 }
+
+// RecordBatchCompleted records a finished backfill batch's duration and log count
+func (m *Metrics) RecordBatchCompleted(seconds float64, logCount int) {
+	m.BatchDurationSeconds.Observe(seconds)
+	m.BatchLogCount.Set(float64(logCount))
+}
+
+// RecordEndpointError records an RPC error against a specific endpoint
+func (m *Metrics) RecordEndpointError(endpoint string) {
+	m.RPCErrorsTotal.Inc()
+	m.RPCEndpointErrors.WithLabelValues(endpoint).Inc()
+}
+
+// RecordRPCRetry records an RPC call being retried
+func (m *Metrics) RecordRPCRetry() {
+	m.RPCRetriesTotal.Inc()
+}
+
+// SetBreakerState records the RPC circuit breaker state (0 closed, 1 open, 2 half-open)
+func (m *Metrics) SetBreakerState(state int) {
+	m.RPCBreakerState.Set(float64(state))
+}
+
+// RecordBlockCacheEvent records a block cache hit, miss or eviction
+func (m *Metrics) RecordBlockCacheEvent(event string) {
+	m.BlockCacheEvents.WithLabelValues(event).Inc()
+}
+
+// RecordRPCMethodCall records one RPC call by method and outcome
+func (m *Metrics) RecordRPCMethodCall(method, outcome string) {
+	m.RPCMethodCalls.WithLabelValues(method, outcome).Inc()
+}
+
+// SetHeadFreshness records the head block's clock skew and whether it counts as stale
+func (m *Metrics) SetHeadFreshness(skewSeconds float64, stale bool) {
+	m.HeadSkewSeconds.Set(skewSeconds)
+	if stale {
+		m.HeadStale.Set(1)
+	} else {
+		m.HeadStale.Set(0)
+	}
+}
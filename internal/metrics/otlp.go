@@ -0,0 +1,258 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// OTLP aggregation temporality; Prometheus counters and histograms are cumulative
+const otlpCumulative = 2
+
+// OTLPExporter pushes the Prometheus registry to an OpenTelemetry collector using
+// OTLP/HTTP with JSON encoding, so the same metrics can be scraped, pushed, or both.
+// Counters become monotonic sums, gauges gauges and histograms explicit-bucket
+// histograms; metric names and label sets are unchanged.
+type OTLPExporter struct {
+	endpoint string
+	interval time.Duration
+	gatherer prometheus.Gatherer
+	client   *http.Client
+	logger   *slog.Logger
+	start    time.Time
+}
+
+// NewOTLPExporter exports the default registry to endpoint every interval. An endpoint
+// without a path gets the standard /v1/metrics.
+func NewOTLPExporter(endpoint string, interval time.Duration, logger *slog.Logger) (*OTLPExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/metrics"
+	}
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	return &OTLPExporter{
+		endpoint: u.String(),
+		interval: interval,
+		gatherer: prometheus.DefaultGatherer,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		logger:   logger,
+		start:    time.Now(),
+	}, nil
+}
+
+// Run exports every interval until ctx is cancelled, then makes a final export so
+// the last values of a finished run are not lost
+func (e *OTLPExporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := e.Export(flushCtx); err != nil {
+				e.logger.Warn("Final OTLP export failed", "err", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := e.Export(ctx); err != nil {
+				e.logger.Warn("OTLP export failed", "endpoint", e.endpoint, "err", err)
+			}
+		}
+	}
+}
+
+// Export gathers the registry and pushes it once
+func (e *OTLPExporter) Export(ctx context.Context) error {
+	families, err := e.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("failed to gather metrics: %w", err)
+	}
+	body, err := json.Marshal(e.request(families, time.Now()))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// OTLP JSON shapes (opentelemetry-proto ExportMetricsServiceRequest). 64-bit integers
+// are strings, as the protobuf JSON mapping requires.
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpAttribute struct {
+	Key   string        `json:"key"`
+	Value otlpAttrValue `json:"value"`
+}
+
+type otlpAttrValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpMetric struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Sum         *otlpSum       `json:"sum,omitempty"`
+	Gauge       *otlpGauge     `json:"gauge,omitempty"`
+	Histogram   *otlpHistogram `json:"histogram,omitempty"`
+}
+
+type otlpSum struct {
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+	DataPoints             []otlpNumberPoint `json:"dataPoints"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberPoint `json:"dataPoints"`
+}
+
+type otlpNumberPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsDouble          float64         `json:"asDouble"`
+}
+
+type otlpHistogram struct {
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+	DataPoints             []otlpHistogramPoint `json:"dataPoints"`
+}
+
+type otlpHistogramPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	Count             string          `json:"count"`
+	Sum               float64         `json:"sum"`
+	BucketCounts      []string        `json:"bucketCounts"`
+	ExplicitBounds    []float64       `json:"explicitBounds"`
+}
+
+func (e *OTLPExporter) request(families []*dto.MetricFamily, now time.Time) otlpRequest {
+	start := strconv.FormatInt(e.start.UnixNano(), 10)
+	ts := strconv.FormatInt(now.UnixNano(), 10)
+
+	var out []otlpMetric
+	for _, mf := range families {
+		m := otlpMetric{Name: mf.GetName(), Description: mf.GetHelp()}
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			m.Sum = &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: true}
+			for _, metric := range mf.GetMetric() {
+				m.Sum.DataPoints = append(m.Sum.DataPoints, otlpNumberPoint{
+					Attributes:        otlpLabels(metric.GetLabel()),
+					StartTimeUnixNano: start,
+					TimeUnixNano:      ts,
+					AsDouble:          metric.GetCounter().GetValue(),
+				})
+			}
+		case dto.MetricType_GAUGE:
+			m.Gauge = &otlpGauge{}
+			for _, metric := range mf.GetMetric() {
+				m.Gauge.DataPoints = append(m.Gauge.DataPoints, otlpNumberPoint{
+					Attributes:   otlpLabels(metric.GetLabel()),
+					TimeUnixNano: ts,
+					AsDouble:     metric.GetGauge().GetValue(),
+				})
+			}
+		case dto.MetricType_HISTOGRAM:
+			m.Histogram = &otlpHistogram{AggregationTemporality: otlpCumulative}
+			for _, metric := range mf.GetMetric() {
+				m.Histogram.DataPoints = append(m.Histogram.DataPoints, otlpHistogramPointFrom(metric, start, ts))
+			}
+		default:
+			continue // summaries and untyped metrics have no direct OTLP equivalent
+		}
+		out = append(out, m)
+	}
+
+	return otlpRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			{Key: "service.name", Value: otlpAttrValue{StringValue: "eth-log-indexer"}},
+		}},
+		ScopeMetrics: []otlpScopeMetrics{{
+			Scope:   otlpScope{Name: "example/hello/internal/metrics"},
+			Metrics: out,
+		}},
+	}}}
+}
+
+// otlpHistogramPointFrom converts Prometheus' cumulative buckets into OTLP's per-bucket
+// counts, adding the implicit +Inf bucket
+func otlpHistogramPointFrom(metric *dto.Metric, start, ts string) otlpHistogramPoint {
+	h := metric.GetHistogram()
+	point := otlpHistogramPoint{
+		Attributes:        otlpLabels(metric.GetLabel()),
+		StartTimeUnixNano: start,
+		TimeUnixNano:      ts,
+		Count:             strconv.FormatUint(h.GetSampleCount(), 10),
+		Sum:               h.GetSampleSum(),
+	}
+	var prev uint64
+	for _, b := range h.GetBucket() {
+		point.ExplicitBounds = append(point.ExplicitBounds, b.GetUpperBound())
+		point.BucketCounts = append(point.BucketCounts, strconv.FormatUint(b.GetCumulativeCount()-prev, 10))
+		prev = b.GetCumulativeCount()
+	}
+	point.BucketCounts = append(point.BucketCounts, strconv.FormatUint(h.GetSampleCount()-prev, 10))
+	return point
+}
+
+func otlpLabels(labels []*dto.LabelPair) []otlpAttribute {
+	attrs := make([]otlpAttribute, 0, len(labels))
+	for _, l := range labels {
+		attrs = append(attrs, otlpAttribute{Key: l.GetName(), Value: otlpAttrValue{StringValue: l.GetValue()}})
+	}
+	return attrs
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestOTLPExporterPushesToCollector(t *testing.T) {
+	var mu sync.Mutex
+	var received []otlpRequest
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		received = append(received, req)
+		mu.Unlock()
+	}))
+	t.Cleanup(collector.Close)
+
+	reg := prometheus.NewRegistry()
+	logs := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_logs_total"}, []string{"event"})
+	head := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_head_block"})
+	latency := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_latency_seconds", Buckets: []float64{1, 5}})
+	reg.MustRegister(logs, head, latency)
+	logs.WithLabelValues("Transfer").Add(3)
+	head.Set(19_000_000)
+	for _, v := range []float64{0.5, 2, 3, 9} {
+		latency.Observe(v)
+	}
+
+	e, err := NewOTLPExporter(collector.URL, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.gatherer = reg
+
+	// An hour-long interval never ticks, so the only push is the final one on cancel
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { e.Run(ctx); close(done) }()
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 {
+		t.Fatalf("collector received %d exports, want the final one", len(received))
+	}
+	metrics := make(map[string]otlpMetric)
+	for _, m := range received[0].ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m
+	}
+
+	sum := metrics["test_logs_total"].Sum
+	if sum == nil || !sum.IsMonotonic || len(sum.DataPoints) != 1 || sum.DataPoints[0].AsDouble != 3 {
+		t.Errorf("counter exported as %+v, want a monotonic sum of 3", sum)
+	} else if attrs := sum.DataPoints[0].Attributes; len(attrs) != 1 || attrs[0].Value.StringValue != "Transfer" {
+		t.Errorf("counter labels exported as %+v, want event=Transfer", attrs)
+	}
+	if g := metrics["test_head_block"].Gauge; g == nil || g.DataPoints[0].AsDouble != 19_000_000 {
+		t.Errorf("gauge exported as %+v, want 19000000", g)
+	}
+	h := metrics["test_latency_seconds"].Histogram
+	if h == nil || len(h.DataPoints) != 1 {
+		t.Fatalf("histogram exported as %+v", h)
+	}
+	// Cumulative Prometheus buckets (1, 3, +Inf 4) become per-bucket counts
+	if p := h.DataPoints[0]; p.Count != "4" || !slices.Equal(p.BucketCounts, []string{"1", "2", "1"}) ||
+		!slices.Equal(p.ExplicitBounds, []float64{1, 5}) {
+		t.Errorf("histogram point %+v, want count 4 over buckets [1 2 1] bounded by [1 5]", p)
+	}
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Server exposes the Prometheus registry on its own listener, separate from the API
+type Server struct {
+	addr   string
+	token  string
+	logger *slog.Logger
+}
+
+// NewServer creates a metrics server. When token is non-empty every scrape must send
+// "Authorization: Bearer <token>"; this is independent of any API authentication.
+func NewServer(addr, token string, logger *slog.Logger) *Server {
+	return &Server{
+		addr:   addr,
+		token:  token,
+		logger: logger,
+	}
+}
+
+// Handler returns the /metrics handler, wrapped with bearer auth when a token is set
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.requireToken(promhttp.Handler()))
+	return mux
+}
+
+// requireToken rejects requests without the configured bearer token
+func (s *Server) requireToken(next http.Handler) http.Handler {
+	if s.token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		token, ok := strings.CutPrefix(auth, "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// StartWithContext serves metrics until ctx is cancelled
+func (s *Server) StartWithContext(ctx context.Context) error {
+	server := &http.Server{
+		Addr:         s.addr,
+		Handler:      s.Handler(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	s.logger.Info("Metrics server starting", "addr", s.addr, "auth", s.token != "")
+	err := server.ListenAndServe()
+	if err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
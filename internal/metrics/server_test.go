@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// scrape GETs /metrics from h with the given Authorization header, if any
+func scrape(h http.Handler, auth string) int {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestMetricsBearerAuth(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	open := NewServer(":0", "", logger).Handler()
+	if code := scrape(open, ""); code != http.StatusOK {
+		t.Errorf("scrape without a configured token = %d, want 200", code)
+	}
+
+	guarded := NewServer(":0", "s3cret", logger).Handler()
+	for auth, want := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"s3cret":        http.StatusUnauthorized,
+		"Basic s3cret":  http.StatusUnauthorized,
+		"Bearer s3cret": http.StatusOK,
+	} {
+		if code := scrape(guarded, auth); code != want {
+			t.Errorf("scrape with Authorization %q = %d, want %d", auth, code, want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package rpcclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ErrMethodNotAllowed is returned for a call whose JSON-RPC method is not allowlisted
+var ErrMethodNotAllowed = errors.New("rpc method not allowed")
+
+// JSON-RPC methods behind the Client interface; this is the indexer's entire RPC surface
+const (
+	MethodBlockNumber           = "eth_blockNumber"
+	MethodGetLogs               = "eth_getLogs"
+	MethodGetBlockByHash        = "eth_getBlockByHash"
+	MethodGetBlockByNumber      = "eth_getBlockByNumber"
+	MethodGetTransactionByHash  = "eth_getTransactionByHash"
+	MethodGetTransactionReceipt = "eth_getTransactionReceipt"
+	MethodGetCode               = "eth_getCode"
+	MethodGetBlockReceipts      = "eth_getBlockReceipts"
+)
+
+// Methods lists every JSON-RPC method the Client interface can issue
+var Methods = []string{
+	MethodBlockNumber,
+	MethodGetLogs,
+	MethodGetBlockByHash,
+	MethodGetBlockByNumber,
+	MethodGetTransactionByHash,
+	MethodGetTransactionReceipt,
+	MethodGetCode,
+	MethodGetBlockReceipts,
+}
+
+// MethodRecorder is notified of every call with its JSON-RPC method and outcome:
+// "ok", "error" or "blocked"
+type MethodRecorder func(method, outcome string)
+
+// Audited records every call by JSON-RPC method and, when given an allowlist,
+// refuses methods outside it with ErrMethodNotAllowed before reaching the node
+type Audited struct {
+	client  Client
+	allowed map[string]bool // nil allows everything
+	onCall  MethodRecorder
+}
+
+// NewAudited wraps client. An empty allowlist only records; onCall may be nil.
+func NewAudited(client Client, allowlist []string, onCall MethodRecorder) *Audited {
+	a := &Audited{client: client, onCall: onCall}
+	if len(allowlist) > 0 {
+		a.allowed = make(map[string]bool, len(allowlist))
+		for _, m := range allowlist {
+			a.allowed[m] = true
+		}
+	}
+	return a
+}
+
+// ParseAllowlist splits a comma-separated method list, rejecting names the indexer
+// never calls so typos do not silently allow nothing
+func ParseAllowlist(s string) ([]string, error) {
+	var methods []string
+	for _, m := range strings.Split(s, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		known := false
+		for _, k := range Methods {
+			known = known || k == m
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown rpc method %q (the indexer calls %s)", m, strings.Join(Methods, ", "))
+		}
+		methods = append(methods, m)
+	}
+	return methods, nil
+}
+
+func (a *Audited) do(method string, call func() error) error {
+	if a.allowed != nil && !a.allowed[method] {
+		a.record(method, "blocked")
+		return fmt.Errorf("%w: %s", ErrMethodNotAllowed, method)
+	}
+	err := call()
+	if err != nil {
+		a.record(method, "error")
+	} else {
+		a.record(method, "ok")
+	}
+	return err
+}
+
+func (a *Audited) record(method, outcome string) {
+	if a.onCall != nil {
+		a.onCall(method, outcome)
+	}
+}
+
+// BlockNumber implements Client
+func (a *Audited) BlockNumber(ctx context.Context) (n uint64, err error) {
+	err = a.do(MethodBlockNumber, func() (e error) { n, e = a.client.BlockNumber(ctx); return })
+	return
+}
+
+// FilterLogs implements Client
+func (a *Audited) FilterLogs(ctx context.Context, q ethereum.FilterQuery) (logs []types.Log, err error) {
+	err = a.do(MethodGetLogs, func() (e error) { logs, e = a.client.FilterLogs(ctx, q); return })
+	return
+}
+
+// BlockByHash implements Client
+func (a *Audited) BlockByHash(ctx context.Context, hash common.Hash) (b *types.Block, err error) {
+	err = a.do(MethodGetBlockByHash, func() (e error) { b, e = a.client.BlockByHash(ctx, hash); return })
+	return
+}
+
+// BlockByNumber implements Client
+func (a *Audited) BlockByNumber(ctx context.Context, number *big.Int) (b *types.Block, err error) {
+	err = a.do(MethodGetBlockByNumber, func() (e error) { b, e = a.client.BlockByNumber(ctx, number); return })
+	return
+}
+
+// HeaderByNumber implements Client; it is eth_getBlockByNumber without transactions
+func (a *Audited) HeaderByNumber(ctx context.Context, number *big.Int) (h *types.Header, err error) {
+	err = a.do(MethodGetBlockByNumber, func() (e error) { h, e = a.client.HeaderByNumber(ctx, number); return })
+	return
+}
+
+// HeaderByHash implements Client; it is eth_getBlockByHash without transactions
+func (a *Audited) HeaderByHash(ctx context.Context, hash common.Hash) (h *types.Header, err error) {
+	err = a.do(MethodGetBlockByHash, func() (e error) { h, e = a.client.HeaderByHash(ctx, hash); return })
+	return
+}
+
+// TransactionByHash implements Client
+func (a *Audited) TransactionByHash(ctx context.Context, hash common.Hash) (tx *types.Transaction, pending bool, err error) {
+	err = a.do(MethodGetTransactionByHash, func() (e error) { tx, pending, e = a.client.TransactionByHash(ctx, hash); return })
+	return
+}
+
+// TransactionReceipt implements Client
+func (a *Audited) TransactionReceipt(ctx context.Context, txHash common.Hash) (r *types.Receipt, err error) {
+	err = a.do(MethodGetTransactionReceipt, func() (e error) { r, e = a.client.TransactionReceipt(ctx, txHash); return })
+	return
+}
+
+// CodeAt implements Client
+func (a *Audited) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) (code []byte, err error) {
+	err = a.do(MethodGetCode, func() (e error) { code, e = a.client.CodeAt(ctx, account, blockNumber); return })
+	return
+}
+
+// BlockReceipts implements Client
+func (a *Audited) BlockReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (receipts []*types.Receipt, err error) {
+	err = a.do(MethodGetBlockReceipts, func() (e error) { receipts, e = a.client.BlockReceipts(ctx, blockNrOrHash); return })
+	return
+}
@@ -0,0 +1,39 @@
+package rpcclient
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestAuditedBlocksDisallowedMethod(t *testing.T) {
+	ctx := context.Background()
+	node := &stubClient{head: 42}
+	var calls []string
+	a := NewAudited(node, []string{MethodBlockNumber}, func(method, outcome string) {
+		calls = append(calls, method+":"+outcome)
+	})
+
+	if head, err := a.BlockNumber(ctx); err != nil || head != 42 {
+		t.Fatalf("allowlisted eth_blockNumber = %d, %v", head, err)
+	}
+	// stubClient panics on FilterLogs, so reaching the node would fail the test
+	if _, err := a.FilterLogs(ctx, ethereum.FilterQuery{}); !errors.Is(err, ErrMethodNotAllowed) {
+		t.Errorf("eth_getLogs outside the allowlist = %v, want ErrMethodNotAllowed", err)
+	}
+	if _, err := a.CodeAt(ctx, common.Address{}, nil); !errors.Is(err, ErrMethodNotAllowed) {
+		t.Errorf("eth_getCode outside the allowlist = %v, want ErrMethodNotAllowed", err)
+	}
+	want := []string{"eth_blockNumber:ok", "eth_getLogs:blocked", "eth_getCode:blocked"}
+	if !slices.Equal(calls, want) {
+		t.Errorf("recorded %v, want %v", calls, want)
+	}
+
+	if _, err := ParseAllowlist("eth_getLogs, eth_sendRawTransaction"); err == nil {
+		t.Error("an allowlist naming eth_sendRawTransaction was accepted")
+	}
+}
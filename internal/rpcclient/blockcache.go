@@ -0,0 +1,124 @@
+package rpcclient
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// CacheEvent labels a block cache outcome for metrics
+type CacheEvent string
+
+const (
+	CacheHit      CacheEvent = "hit"
+	CacheMiss     CacheEvent = "miss"
+	CacheEviction CacheEvent = "eviction"
+)
+
+// CacheRecorder is notified of every block cache hit, miss and eviction
+type CacheRecorder func(event CacheEvent)
+
+type cachedBlock struct {
+	hash  common.Hash
+	block *types.Block
+	size  int64
+}
+
+// BlockCache serves BlockByHash from a bounded LRU cache; every other call goes
+// straight to the wrapped client. Blocks are keyed by hash, so a reorg can never
+// return stale data. The cache is bounded by entry count, by encoded block size, or
+// both; the least recently used blocks are evicted first.
+type BlockCache struct {
+	Client
+
+	maxEntries int   // 0 = unbounded by count
+	maxBytes   int64 // 0 = unbounded by size
+	onEvent    CacheRecorder
+
+	mu    sync.Mutex
+	lru   *list.List // front = most recently used
+	items map[common.Hash]*list.Element
+	bytes int64
+}
+
+// NewBlockCache wraps client with an LRU block cache; onEvent may be nil
+func NewBlockCache(client Client, maxEntries int, maxBytes int64, onEvent CacheRecorder) *BlockCache {
+	return &BlockCache{
+		Client:     client,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		onEvent:    onEvent,
+		lru:        list.New(),
+		items:      make(map[common.Hash]*list.Element),
+	}
+}
+
+// BlockByHash implements Client, consulting the cache first
+func (c *BlockCache) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	if block, ok := c.get(hash); ok {
+		return block, nil
+	}
+	block, err := c.Client.BlockByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	// A partial block from a light or proxy endpoint is not kept, so a later call can
+	// get the real one
+	if CheckHeader(block.Header()) == nil {
+		c.add(hash, block)
+	}
+	return block, nil
+}
+
+// Len returns the number of cached blocks and their total encoded size
+func (c *BlockCache) Len() (entries int, bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len(), c.bytes
+}
+
+func (c *BlockCache) get(hash common.Hash) (*types.Block, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[hash]
+	if !ok {
+		c.record(CacheMiss)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	c.record(CacheHit)
+	return el.Value.(*cachedBlock).block, true
+}
+
+func (c *BlockCache) add(hash common.Hash, block *types.Block) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.items[hash]; ok {
+		return // another worker fetched it concurrently
+	}
+	entry := &cachedBlock{hash: hash, block: block, size: int64(block.Size())}
+	c.items[hash] = c.lru.PushFront(entry)
+	c.bytes += entry.size
+
+	// Never evict the block just added, even if it alone exceeds maxBytes
+	for c.lru.Len() > 1 && ((c.maxEntries > 0 && c.lru.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes)) {
+		oldest := c.lru.Back()
+		evicted := oldest.Value.(*cachedBlock)
+		c.lru.Remove(oldest)
+		delete(c.items, evicted.hash)
+		c.bytes -= evicted.size
+		c.record(CacheEviction)
+	}
+}
+
+// record must be called with mu held
+func (c *BlockCache) record(event CacheEvent) {
+	if c.onEvent != nil {
+		c.onEvent(event)
+	}
+}
@@ -0,0 +1,62 @@
+package rpcclient
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// blockStub serves BlockByHash from blocks and counts the calls per hash
+type blockStub struct {
+	Client
+
+	blocks map[common.Hash]*types.Block
+	calls  map[common.Hash]int
+}
+
+func (s *blockStub) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	s.calls[hash]++
+	return s.blocks[hash], nil
+}
+
+func TestBlockCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	node := &blockStub{blocks: make(map[common.Hash]*types.Block), calls: make(map[common.Hash]int)}
+	var hashes []common.Hash
+	for n := int64(1); n <= 3; n++ {
+		block := types.NewBlockWithHeader(&types.Header{
+			Number:     big.NewInt(n),
+			Time:       uint64(1_700_000_000 + n),
+			ParentHash: common.BigToHash(big.NewInt(n)),
+		})
+		node.blocks[block.Hash()] = block
+		hashes = append(hashes, block.Hash())
+	}
+	events := make(map[CacheEvent]int)
+	c := NewBlockCache(node, 2, 0, func(e CacheEvent) { events[e]++ })
+
+	a, b, third := hashes[0], hashes[1], hashes[2]
+	for _, h := range []common.Hash{a, b, a, third} {
+		if _, err := c.BlockByHash(ctx, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a was used after b, so adding a third block over the cap of 2 evicts b
+	if n, _ := c.Len(); n != 2 {
+		t.Errorf("cache holds %d blocks, want the cap of 2", n)
+	}
+	if events[CacheEviction] != 1 {
+		t.Errorf("%d evictions recorded, want 1", events[CacheEviction])
+	}
+	c.BlockByHash(ctx, a)
+	c.BlockByHash(ctx, b)
+	if node.calls[a] != 1 || node.calls[b] != 2 {
+		t.Errorf("node fetched a %d and b %d times, want 1 and 2", node.calls[a], node.calls[b])
+	}
+	if events[CacheHit] != 2 || events[CacheMiss] != 4 {
+		t.Errorf("%d hits and %d misses, want 2 and 4", events[CacheHit], events[CacheMiss])
+	}
+}
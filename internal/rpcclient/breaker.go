@@ -0,0 +1,209 @@
+package rpcclient
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ErrCircuitOpen is returned without contacting the node while the breaker is open
+var ErrCircuitOpen = errors.New("rpc circuit breaker open")
+
+// BreakerState is the state of a Breaker; the numeric values are exported as a gauge
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = 0
+	BreakerOpen     BreakerState = 1
+	BreakerHalfOpen BreakerState = 2
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Breaker stops calling a node that keeps failing. After Threshold consecutive
+// failures it opens and rejects calls with ErrCircuitOpen for Cooldown. The first call
+// after the cooldown is let through as a probe (half-open): success closes the
+// breaker, failure opens it for another cooldown. Other calls are rejected while the
+// probe is in flight.
+type Breaker struct {
+	client        Client
+	threshold     int
+	cooldown      time.Duration
+	onStateChange func(BreakerState)
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewBreaker wraps client with a circuit breaker; onStateChange may be nil
+func NewBreaker(client Client, threshold int, cooldown time.Duration, onStateChange func(BreakerState)) *Breaker {
+	if threshold <= 0 {
+		threshold = 5
+	}
+	return &Breaker{
+		client:        client,
+		threshold:     threshold,
+		cooldown:      cooldown,
+		onStateChange: onStateChange,
+	}
+}
+
+// State returns the current breaker state
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// setState must be called with mu held
+func (b *Breaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	if b.onStateChange != nil {
+		b.onStateChange(state)
+	}
+}
+
+// allow reports whether a call may go to the node and whether it is the half-open probe
+func (b *Breaker) allow() (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false, ErrCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return true, nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return false, ErrCircuitOpen
+		}
+		b.probing = true
+		return true, nil
+	}
+	return false, nil
+}
+
+func (b *Breaker) record(ctx context.Context, probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+	}
+	// A cancelled caller says nothing about the node's health
+	if err != nil && ctx.Err() != nil {
+		if probe {
+			b.setState(BreakerOpen)
+			b.openedAt = time.Now().Add(-b.cooldown) // let the next call probe straight away
+		}
+		return
+	}
+
+	if err == nil {
+		b.failures = 0
+		b.setState(BreakerClosed)
+		return
+	}
+	b.failures++
+	if probe || b.failures >= b.threshold {
+		b.failures = 0
+		b.openedAt = time.Now()
+		b.setState(BreakerOpen)
+	}
+}
+
+func (b *Breaker) do(ctx context.Context, call func(Client) error) error {
+	probe, err := b.allow()
+	if err != nil {
+		return err
+	}
+	err = call(b.client)
+	b.record(ctx, probe, err)
+	return err
+}
+
+// BlockNumber implements Client
+func (b *Breaker) BlockNumber(ctx context.Context) (n uint64, err error) {
+	err = b.do(ctx, func(c Client) (e error) { n, e = c.BlockNumber(ctx); return })
+	return
+}
+
+// FilterLogs implements Client
+func (b *Breaker) FilterLogs(ctx context.Context, q ethereum.FilterQuery) (logs []types.Log, err error) {
+	err = b.do(ctx, func(c Client) (e error) { logs, e = c.FilterLogs(ctx, q); return })
+	return
+}
+
+// BlockByHash implements Client
+func (b *Breaker) BlockByHash(ctx context.Context, hash common.Hash) (blk *types.Block, err error) {
+	err = b.do(ctx, func(c Client) (e error) { blk, e = c.BlockByHash(ctx, hash); return })
+	return
+}
+
+// BlockByNumber implements Client
+func (b *Breaker) BlockByNumber(ctx context.Context, number *big.Int) (blk *types.Block, err error) {
+	err = b.do(ctx, func(c Client) (e error) { blk, e = c.BlockByNumber(ctx, number); return })
+	return
+}
+
+// HeaderByNumber implements Client
+func (b *Breaker) HeaderByNumber(ctx context.Context, number *big.Int) (h *types.Header, err error) {
+	err = b.do(ctx, func(c Client) (e error) { h, e = c.HeaderByNumber(ctx, number); return })
+	return
+}
+
+// HeaderByHash implements Client
+func (b *Breaker) HeaderByHash(ctx context.Context, hash common.Hash) (h *types.Header, err error) {
+	err = b.do(ctx, func(c Client) (e error) { h, e = c.HeaderByHash(ctx, hash); return })
+	return
+}
+
+// TransactionByHash implements Client
+func (b *Breaker) TransactionByHash(ctx context.Context, hash common.Hash) (tx *types.Transaction, pending bool, err error) {
+	err = b.do(ctx, func(c Client) (e error) { tx, pending, e = c.TransactionByHash(ctx, hash); return })
+	return
+}
+
+// TransactionReceipt implements Client
+func (b *Breaker) TransactionReceipt(ctx context.Context, txHash common.Hash) (r *types.Receipt, err error) {
+	err = b.do(ctx, func(c Client) (e error) { r, e = c.TransactionReceipt(ctx, txHash); return })
+	return
+}
+
+// CodeAt implements Client
+func (b *Breaker) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) (code []byte, err error) {
+	err = b.do(ctx, func(c Client) (e error) { code, e = c.CodeAt(ctx, account, blockNumber); return })
+	return
+}
+
+// BlockReceipts implements Client
+func (b *Breaker) BlockReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (receipts []*types.Receipt, err error) {
+	err = b.do(ctx, func(c Client) (e error) { receipts, e = c.BlockReceipts(ctx, blockNrOrHash); return })
+	return
+}
@@ -0,0 +1,59 @@
+package rpcclient
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAndRecloses(t *testing.T) {
+	ctx := context.Background()
+	node := &stubClient{err: errors.New("connection refused")}
+	var states []BreakerState
+	b := NewBreaker(node, 3, 30*time.Millisecond, func(s BreakerState) { states = append(states, s) })
+
+	// Failures below the threshold keep it closed, and a success starts the count again
+	for i := 0; i < 2; i++ {
+		b.BlockNumber(ctx)
+	}
+	node.err = nil
+	if _, err := b.BlockNumber(ctx); err != nil || b.State() != BreakerClosed {
+		t.Fatalf("success after 2 failures: %v, state %s", err, b.State())
+	}
+	node.err = errors.New("connection refused")
+	for i := 0; i < 3; i++ {
+		b.BlockNumber(ctx)
+	}
+	if b.State() != BreakerOpen {
+		t.Fatalf("state %s after 3 consecutive failures, want open", b.State())
+	}
+
+	// Open: calls fail fast without reaching the node
+	before := node.calls
+	if _, err := b.BlockNumber(ctx); !errors.Is(err, ErrCircuitOpen) || node.calls != before {
+		t.Errorf("call while open = %v after %d node calls, want ErrCircuitOpen and none", err, node.calls-before)
+	}
+
+	// A failed half-open probe opens it for another cooldown
+	time.Sleep(40 * time.Millisecond)
+	if _, err := b.BlockNumber(ctx); err == nil || errors.Is(err, ErrCircuitOpen) || node.calls != before+1 {
+		t.Errorf("probe = %v, want the node's error from one call", err)
+	}
+	if _, err := b.BlockNumber(ctx); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("call after a failed probe = %v, want ErrCircuitOpen", err)
+	}
+
+	// The node recovers: the next probe closes the breaker
+	node.err = nil
+	time.Sleep(40 * time.Millisecond)
+	if _, err := b.BlockNumber(ctx); err != nil || b.State() != BreakerClosed {
+		t.Errorf("successful probe: %v, state %s, want closed", err, b.State())
+	}
+
+	want := []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerOpen, BreakerHalfOpen, BreakerClosed}
+	if !slices.Equal(states, want) {
+		t.Errorf("state changes %v, want %v", states, want)
+	}
+}
@@ -0,0 +1,192 @@
+package rpcclient
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ErrorRecorder is notified of every failed call, labelled by endpoint
+type ErrorRecorder func(endpoint string)
+
+// Endpoint is a named client taking part in failover
+type Endpoint struct {
+	Name   string
+	Client Client
+
+	consecutiveFailures int
+	unhealthyUntil      time.Time
+}
+
+// Failover spreads calls round-robin across healthy endpoints. An endpoint that
+// fails MaxFailures times in a row is taken out of rotation for Cooldown, and a
+// failed call is retried on the next healthy endpoint before giving up.
+type Failover struct {
+	endpoints   []*Endpoint
+	next        int
+	maxFailures int
+	cooldown    time.Duration
+	onError     ErrorRecorder
+	mu          sync.Mutex
+}
+
+// NewFailover creates a failover client; onError may be nil
+func NewFailover(endpoints []*Endpoint, maxFailures int, cooldown time.Duration, onError ErrorRecorder) *Failover {
+	if maxFailures <= 0 {
+		maxFailures = 3
+	}
+	return &Failover{
+		endpoints:   endpoints,
+		maxFailures: maxFailures,
+		cooldown:    cooldown,
+		onError:     onError,
+	}
+}
+
+// EndpointLabel reduces an RPC URL to its host so API keys in the path never reach
+// logs or metric labels. IPC paths are returned unchanged.
+func EndpointLabel(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return endpoint
+	}
+	return u.Host
+}
+
+// pick returns the next healthy endpoint in round-robin order, skipping tried ones.
+// When every untried endpoint is cooling down the least recently failed one is used
+// so calls never stall outright.
+func (f *Failover) pick(tried map[*Endpoint]bool) *Endpoint {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	var fallback *Endpoint
+	for i := 0; i < len(f.endpoints); i++ {
+		ep := f.endpoints[(f.next+i)%len(f.endpoints)]
+		if tried[ep] {
+			continue
+		}
+		if now.After(ep.unhealthyUntil) {
+			f.next = (f.next + i + 1) % len(f.endpoints)
+			return ep
+		}
+		if fallback == nil || ep.unhealthyUntil.Before(fallback.unhealthyUntil) {
+			fallback = ep
+		}
+	}
+	return fallback
+}
+
+func (f *Failover) report(ep *Endpoint, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err == nil {
+		ep.consecutiveFailures = 0
+		return
+	}
+	ep.consecutiveFailures++
+	if ep.consecutiveFailures >= f.maxFailures {
+		ep.unhealthyUntil = time.Now().Add(f.cooldown)
+		ep.consecutiveFailures = 0
+	}
+	if f.onError != nil {
+		f.onError(ep.Name)
+	}
+}
+
+// do runs call against endpoints until one succeeds or all have been tried
+func (f *Failover) do(ctx context.Context, call func(Client) error) error {
+	tried := make(map[*Endpoint]bool, len(f.endpoints))
+	var lastErr error
+	for len(tried) < len(f.endpoints) {
+		ep := f.pick(tried)
+		if ep == nil {
+			break
+		}
+		tried[ep] = true
+
+		err := call(ep.Client)
+		f.report(ep, err)
+		if err == nil {
+			return nil
+		}
+		lastErr = fmt.Errorf("%s: %w", ep.Name, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no rpc endpoints configured")
+	}
+	return lastErr
+}
+
+// BlockNumber implements Client
+func (f *Failover) BlockNumber(ctx context.Context) (n uint64, err error) {
+	err = f.do(ctx, func(c Client) (e error) { n, e = c.BlockNumber(ctx); return })
+	return
+}
+
+// FilterLogs implements Client
+func (f *Failover) FilterLogs(ctx context.Context, q ethereum.FilterQuery) (logs []types.Log, err error) {
+	err = f.do(ctx, func(c Client) (e error) { logs, e = c.FilterLogs(ctx, q); return })
+	return
+}
+
+// BlockByHash implements Client
+func (f *Failover) BlockByHash(ctx context.Context, hash common.Hash) (b *types.Block, err error) {
+	err = f.do(ctx, func(c Client) (e error) { b, e = c.BlockByHash(ctx, hash); return })
+	return
+}
+
+// BlockByNumber implements Client
+func (f *Failover) BlockByNumber(ctx context.Context, number *big.Int) (b *types.Block, err error) {
+	err = f.do(ctx, func(c Client) (e error) { b, e = c.BlockByNumber(ctx, number); return })
+	return
+}
+
+// HeaderByNumber implements Client
+func (f *Failover) HeaderByNumber(ctx context.Context, number *big.Int) (h *types.Header, err error) {
+	err = f.do(ctx, func(c Client) (e error) { h, e = c.HeaderByNumber(ctx, number); return })
+	return
+}
+
+// HeaderByHash implements Client
+func (f *Failover) HeaderByHash(ctx context.Context, hash common.Hash) (h *types.Header, err error) {
+	err = f.do(ctx, func(c Client) (e error) { h, e = c.HeaderByHash(ctx, hash); return })
+	return
+}
+
+// TransactionByHash implements Client
+func (f *Failover) TransactionByHash(ctx context.Context, hash common.Hash) (tx *types.Transaction, pending bool, err error) {
+	err = f.do(ctx, func(c Client) (e error) { tx, pending, e = c.TransactionByHash(ctx, hash); return })
+	return
+}
+
+// TransactionReceipt implements Client
+func (f *Failover) TransactionReceipt(ctx context.Context, txHash common.Hash) (r *types.Receipt, err error) {
+	err = f.do(ctx, func(c Client) (e error) { r, e = c.TransactionReceipt(ctx, txHash); return })
+	return
+}
+
+// CodeAt implements Client
+func (f *Failover) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) (code []byte, err error) {
+	err = f.do(ctx, func(c Client) (e error) { code, e = c.CodeAt(ctx, account, blockNumber); return })
+	return
+}
+
+// BlockReceipts implements Client
+func (f *Failover) BlockReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (receipts []*types.Receipt, err error) {
+	err = f.do(ctx, func(c Client) (e error) { receipts, e = c.BlockReceipts(ctx, blockNrOrHash); return })
+	return
+}
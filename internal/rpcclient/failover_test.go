@@ -0,0 +1,67 @@
+package rpcclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubClient answers BlockNumber with head or err and counts the calls. Other methods
+// panic through the nil Client.
+type stubClient struct {
+	Client
+
+	mu    sync.Mutex
+	head  uint64
+	err   error
+	calls int
+}
+
+func (s *stubClient) BlockNumber(ctx context.Context) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	return s.head, s.err
+}
+
+func TestFailoverMovesTrafficOffFailingEndpoint(t *testing.T) {
+	down := &stubClient{err: errors.New("503 service unavailable")}
+	up := &stubClient{head: 100}
+	var errorsSeen []string
+	f := NewFailover([]*Endpoint{{Name: "down", Client: down}, {Name: "up", Client: up}}, 2, time.Minute,
+		func(endpoint string) { errorsSeen = append(errorsSeen, endpoint) })
+
+	for i := 0; i < 6; i++ {
+		head, err := f.BlockNumber(context.Background())
+		if err != nil || head != 100 {
+			t.Fatalf("call %d = %d, %v; want 100 from the healthy endpoint", i, head, err)
+		}
+	}
+	// The failing endpoint is tried until it reaches maxFailures, then cools down
+	if down.calls != 2 || up.calls != 6 {
+		t.Errorf("calls: down %d, up %d; want 2 and 6", down.calls, up.calls)
+	}
+	if len(errorsSeen) != 2 || errorsSeen[0] != "down" {
+		t.Errorf("errors recorded against %v, want down twice", errorsSeen)
+	}
+
+	// With every endpoint failing the last error is returned
+	up.err = errors.New("timeout")
+	if _, err := f.BlockNumber(context.Background()); err == nil {
+		t.Error("all endpoints failing returned no error")
+	}
+}
+
+func TestEndpointLabelHidesPath(t *testing.T) {
+	for endpoint, want := range map[string]string{
+		"https://mainnet.infura.io/v3/secret-key": "mainnet.infura.io",
+		"wss://node.example.org:8546/ws":          "node.example.org:8546",
+		"/var/lib/geth/geth.ipc":                  "/var/lib/geth/geth.ipc",
+	} {
+		if got := EndpointLabel(endpoint); got != want {
+			t.Errorf("EndpointLabel(%q) = %q, want %q", endpoint, got, want)
+		}
+	}
+}
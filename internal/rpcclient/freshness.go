@@ -0,0 +1,34 @@
+package rpcclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// HeadFreshness compares the head block's timestamp with the local clock. A head that
+// trails the clock by much more than the block time means the node has stopped
+// following the chain, or is serving an old view of it.
+type HeadFreshness struct {
+	Number    uint64
+	Timestamp time.Time
+	Skew      time.Duration // local time minus the head timestamp; negative when the head is ahead of the clock
+	Stale     bool          // Skew is above the threshold
+}
+
+// CheckHeadFreshness fetches the head header and measures its skew against now. A
+// maxSkew of 0 never marks the head stale.
+func CheckHeadFreshness(ctx context.Context, client Client, maxSkew time.Duration, now time.Time) (*HeadFreshness, error) {
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get head header: %w", err)
+	}
+	ts := time.Unix(int64(header.Time), 0)
+	skew := now.Sub(ts)
+	return &HeadFreshness{
+		Number:    header.Number.Uint64(),
+		Timestamp: ts,
+		Skew:      skew,
+		Stale:     maxSkew > 0 && skew > maxSkew,
+	}, nil
+}
@@ -0,0 +1,44 @@
+package rpcclient
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// headStub serves a head header stamped at head
+type headStub struct {
+	Client
+	head time.Time
+}
+
+func (s *headStub) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return &types.Header{Number: big.NewInt(19_000_000), Time: uint64(s.head.Unix())}, nil
+}
+
+func TestStaleHeadTripsFlag(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name    string
+		age     time.Duration
+		maxSkew time.Duration
+		stale   bool
+	}{
+		{"one block behind", 12 * time.Second, 2 * time.Minute, false},
+		{"stalled node", 10 * time.Minute, 2 * time.Minute, true},
+		{"just at the threshold", 2 * time.Minute, 2 * time.Minute, false},
+		{"head ahead of the clock", -5 * time.Second, 2 * time.Minute, false},
+		{"check disabled", time.Hour, 0, false},
+	} {
+		fresh, err := CheckHeadFreshness(context.Background(), &headStub{head: now.Add(-tc.age)}, tc.maxSkew, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fresh.Stale != tc.stale || fresh.Skew != tc.age || fresh.Number != 19_000_000 {
+			t.Errorf("%s: stale %v skew %v head %d, want stale %v skew %v", tc.name, fresh.Stale, fresh.Skew, fresh.Number, tc.stale, tc.age)
+		}
+	}
+}
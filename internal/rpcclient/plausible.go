@@ -0,0 +1,28 @@
+package rpcclient
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ErrImplausibleBlock is returned by CheckHeader for a header with fields left unset
+var ErrImplausibleBlock = errors.New("implausible block data")
+
+// CheckHeader rejects header fields that some light and proxy endpoints return unset
+// instead of failing the call: a zero timestamp, or a zero parent hash on any block but
+// genesis. Storing them would give logs a 1970 timestamp and break parent-hash chaining.
+func CheckHeader(h *types.Header) error {
+	if h == nil {
+		return fmt.Errorf("%w: no header", ErrImplausibleBlock)
+	}
+	if h.Time == 0 {
+		return fmt.Errorf("%w: block %v has timestamp 0", ErrImplausibleBlock, h.Number)
+	}
+	if h.ParentHash == (common.Hash{}) && (h.Number == nil || h.Number.Sign() > 0) {
+		return fmt.Errorf("%w: block %v has a zero parent hash", ErrImplausibleBlock, h.Number)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"bytes"
+
+	"example/hello/pkg/types"
+
+	bolt "github.com/boltdb/bolt"
+)
+
+// BucketBlockIndex lists the logs stored in each block. Keys are blockNumber (8 bytes)
+// followed by the entry's key in the logs bucket, values the logs bucket key alone, so
+// a block's entries are the keys under its 8-byte prefix, in log-key order.
+const BucketBlockIndex = "blockindex"
+
+// blockIndexKey returns the block index key of the entry stored under logKey
+func blockIndexKey(blockNumber uint64, logKey []byte) []byte {
+	return append(uint64ToBytes(blockNumber), logKey...)
+}
+
+// putBlockIndex records the entry at logKey under its block, dropping the record under
+// the block of prev, the entry it replaces, when that differs
+func putBlockIndex(tx *bolt.Tx, logKey []byte, entry, prev *types.LogEntry) error {
+	b := tx.Bucket([]byte(BucketBlockIndex))
+	if b == nil {
+		return nil
+	}
+	if prev != nil && prev.BlockNumber != entry.BlockNumber {
+		if err := b.Delete(blockIndexKey(prev.BlockNumber, logKey)); err != nil {
+			return err
+		}
+	}
+	return b.Put(blockIndexKey(entry.BlockNumber, logKey), logKey)
+}
+
+// blockLogKeys returns the logs bucket keys recorded for blockNumber
+func blockLogKeys(b *bolt.Bucket, blockNumber uint64) [][]byte {
+	prefix := uint64ToBytes(blockNumber)
+	var keys [][]byte
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		keys = append(keys, v)
+	}
+	return keys
+}
+
+// rollbackBlockIndex drops the records of every block above toBlockNumber
+func rollbackBlockIndex(tx *bolt.Tx, toBlockNumber uint64) error {
+	b := tx.Bucket([]byte(BucketBlockIndex))
+	if b == nil {
+		return nil
+	}
+	var stale [][]byte
+	c := b.Cursor()
+	for k, _ := c.Seek(uint64ToBytes(toBlockNumber + 1)); k != nil; k, _ = c.Next() {
+		stale = append(stale, k)
+	}
+	for _, k := range stale {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// CompactResult reports the file size before and after a compaction
+type CompactResult struct {
+	BeforeBytes int64
+	AfterBytes  int64
+	Duration    time.Duration
+}
+
+// Compact rewrites the database into a fresh file, dropping the free pages that
+// pruning and rollbacks leave behind (bolt never shrinks a file in place). Writers
+// and readers are blocked for the duration; the original file is replaced only after
+// the copy has been written and synced.
+func (s *BoltStorage) Compact(ctx context.Context) (*CompactResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := time.Now()
+	path := s.db.Path()
+	before, err := fileSize(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpPath := path + ".compact"
+	os.Remove(tmpPath)
+	dst, err := bolt.Open(tmpPath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create compaction target: %w", err)
+	}
+
+	err = s.db.View(func(src *bolt.Tx) error {
+		return dst.Update(func(out *bolt.Tx) error {
+			return src.ForEach(func(name []byte, b *bolt.Bucket) error {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				nb, err := out.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+				return copyBucket(nb, b)
+			})
+		})
+	})
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("compaction copy failed: %w", err)
+	}
+
+	if err := s.db.Close(); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to close database for compaction: %w", err)
+	}
+	renameErr := os.Rename(tmpPath, path)
+
+	// Reopen whichever file is now at path so the storage stays usable either way
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 0})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reopen database after compaction: %w", err)
+	}
+	s.db = db
+	if renameErr != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to replace database with compacted copy: %w", renameErr)
+	}
+
+	after, err := fileSize(path)
+	if err != nil {
+		return nil, err
+	}
+	return &CompactResult{BeforeBytes: before, AfterBytes: after, Duration: time.Since(start)}, nil
+}
+
+// copyBucket copies every key and nested bucket of src into dst
+func copyBucket(dst, src *bolt.Bucket) error {
+	dst.FillPercent = 1.0 // keys are copied in order, so pages can be packed full
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+		nested, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return copyBucket(nested, src.Bucket(k))
+	})
+}
+
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// CompactionWindow restricts scheduled compaction to a daily UTC time range such as
+// "02:00-05:00". The zero value allows compaction at any time.
+type CompactionWindow struct {
+	start, end time.Duration // offsets from UTC midnight
+	set        bool
+}
+
+// ParseCompactionWindow parses "HH:MM-HH:MM"; an empty string means any time.
+// A window may wrap midnight, e.g. "23:00-02:00".
+func ParseCompactionWindow(s string) (CompactionWindow, error) {
+	if s == "" {
+		return CompactionWindow{}, nil
+	}
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return CompactionWindow{}, fmt.Errorf("invalid compaction window %q, want HH:MM-HH:MM", s)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return CompactionWindow{}, fmt.Errorf("invalid compaction window start %q", from)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return CompactionWindow{}, fmt.Errorf("invalid compaction window end %q", to)
+	}
+	midnight := time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC)
+	return CompactionWindow{start: start.Sub(midnight), end: end.Sub(midnight), set: true}, nil
+}
+
+// Contains reports whether t falls inside the window
+func (w CompactionWindow) Contains(t time.Time) bool {
+	if !w.set {
+		return true
+	}
+	t = t.UTC()
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if w.start <= w.end {
+		return offset >= w.start && offset < w.end
+	}
+	return offset >= w.start || offset < w.end
+}
+
+// RunCompactionSchedule compacts every interval while inside window, until ctx is
+// cancelled. Ticks outside the window are skipped rather than queued.
+func (s *BoltStorage) RunCompactionSchedule(ctx context.Context, interval time.Duration, window CompactionWindow, logger *slog.Logger) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if !window.Contains(now) {
+				logger.Debug("Skipping compaction outside window", "time", now.UTC().Format("15:04"))
+				continue
+			}
+			result, err := s.Compact(ctx)
+			if err != nil {
+				logger.Error("Scheduled compaction failed", "err", err)
+				continue
+			}
+			logger.Info("Database compacted",
+				"beforeBytes", result.BeforeBytes,
+				"afterBytes", result.AfterBytes,
+				"reclaimedBytes", result.BeforeBytes-result.AfterBytes,
+				"duration", result.Duration)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"example/hello/pkg/types"
+)
+
+func TestScheduledCompactionShrinksAfterPruning(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, Options{})
+	path := s.db.Path()
+
+	for i := uint64(0); i < 4000; i++ {
+		storeLogs(t, s, &types.LogEntry{Index: i, BlockNumber: 1 + i/4, TxHash: fmt.Sprintf("0x%064x", i),
+			Topics: []string{fmt.Sprintf("0x%064x", i)}, Enriched: true})
+	}
+	// Pruning frees pages but bolt keeps the file at its high-water mark
+	if err := s.Rollback(ctx, 100); err != nil {
+		t.Fatal(err)
+	}
+	before, err := fileSize(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.RunCompactionSchedule(runCtx, 20*time.Millisecond, CompactionWindow{}, logger)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.RLock()
+		size, err := fileSize(path)
+		s.mu.RUnlock()
+		if err == nil && size < before/2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			cancel()
+			<-done
+			t.Fatalf("file still %d bytes (was %d) after scheduled compaction", size, before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if !strings.Contains(logs.String(), "Database compacted") || !strings.Contains(logs.String(), fmt.Sprintf("beforeBytes=%d", before)) {
+		t.Errorf("compaction log does not report sizes:\n%s", logs.String())
+	}
+	if n, _ := s.GetTotalCount(ctx); n != 400 {
+		t.Errorf("count after compaction = %d, want 400", n)
+	}
+	if e, err := s.GetLog(ctx, 399); err != nil || e.BlockNumber != 100 {
+		t.Errorf("log 399 after compaction = %+v (%v)", e, err)
+	}
+	// Writes go to the reopened file
+	storeLogs(t, s, &types.LogEntry{Index: 400, BlockNumber: 101, Enriched: true})
+}
+
+func TestCompactionWindow(t *testing.T) {
+	at := func(hhmm string) time.Time {
+		t, _ := time.Parse("15:04", hhmm)
+		return t
+	}
+	for spec, cases := range map[string]map[string]bool{
+		"":            {"00:00": true, "13:37": true},
+		"02:00-05:00": {"01:59": false, "02:00": true, "04:59": true, "05:00": false},
+		"23:00-02:00": {"22:59": false, "23:30": true, "00:10": true, "02:00": false},
+	} {
+		w, err := ParseCompactionWindow(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for hhmm, want := range cases {
+			if got := w.Contains(at(hhmm)); got != want {
+				t.Errorf("window %q contains %s = %v, want %v", spec, hhmm, got, want)
+			}
+		}
+	}
+	if _, err := ParseCompactionWindow("2am-5am"); err == nil {
+		t.Error(`"2am-5am" parsed`)
+	}
+}
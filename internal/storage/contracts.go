@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"example/hello/pkg/types"
+
+	bolt "github.com/boltdb/bolt"
+)
+
+// BucketContracts maps a lowercase 0x-prefixed address to a types.DiscoveredContract.
+// The bulk indexer writes the same bucket, keyed and encoded the same way.
+const BucketContracts = "contracts"
+
+// StoreDiscoveredContracts records child contracts found by factory discovery. A
+// contract already stored keeps its first record.
+func (s *BoltStorage) StoreDiscoveredContracts(ctx context.Context, contracts []*types.DiscoveredContract) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(BucketContracts))
+		if err != nil {
+			return err
+		}
+		for _, c := range contracts {
+			key := []byte(strings.ToLower(c.Address))
+			if b.Get(key) != nil {
+				continue
+			}
+			val, err := json.Marshal(c)
+			if err != nil {
+				return fmt.Errorf("failed to marshal contract %s: %w", c.Address, err)
+			}
+			if err := b.Put(key, val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetDiscoveredContracts returns every stored child contract, ordered by address
+func (s *BoltStorage) GetDiscoveredContracts(ctx context.Context) ([]*types.DiscoveredContract, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	results := make([]*types.DiscoveredContract, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketContracts))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var c types.DiscoveredContract
+			if err := json.Unmarshal(v, &c); err != nil {
+				return fmt.Errorf("failed to decode contract %s: %w", k, err)
+			}
+			results = append(results, &c)
+			return nil
+		})
+	})
+	return results, err
+}
+
+// rollbackContracts forgets contracts whose creation event was in a rolled-back block;
+// if the creation is re-mined they are discovered again
+func rollbackContracts(tx *bolt.Tx, toBlockNumber uint64) error {
+	b := tx.Bucket([]byte(BucketContracts))
+	if b == nil {
+		return nil
+	}
+	var stale [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		var c types.DiscoveredContract
+		if err := json.Unmarshal(v, &c); err != nil {
+			return fmt.Errorf("failed to decode contract %s: %w", k, err)
+		}
+		if c.BlockNumber > toBlockNumber {
+			stale = append(stale, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range stale {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"example/hello/pkg/types"
+
+	bolt "github.com/boltdb/bolt"
+)
+
+// DayLayout is the UTC day format used for daily aggregate keys and queries
+const DayLayout = "2006-01-02"
+
+// dayKey returns the UTC day of a log's block timestamp, or nil for an entry stored
+// without block data, which is counted once enrichment fills the timestamp in
+func dayKey(le *types.LogEntry) []byte {
+	if le.Timestamp == 0 {
+		return nil
+	}
+	return []byte(time.Unix(int64(le.Timestamp), 0).UTC().Format(DayLayout))
+}
+
+// addDaily adds le to the aggregate of its day, or removes it again when remove is set
+func addDaily(tx *bolt.Tx, le *types.LogEntry, remove bool) error {
+	key := dayKey(le)
+	b := tx.Bucket([]byte(BucketDaily))
+	if key == nil || b == nil {
+		return nil
+	}
+
+	stat := types.DailyStat{Day: string(key)}
+	if v := b.Get(key); v != nil {
+		if err := json.Unmarshal(v, &stat); err != nil {
+			return fmt.Errorf("corrupt daily aggregate %s: %w", key, err)
+		}
+	}
+	if remove {
+		if stat.Count <= 1 {
+			return b.Delete(key)
+		}
+		stat.Count--
+		if stat.GasUsed >= le.GasUsed {
+			stat.GasUsed -= le.GasUsed
+		} else {
+			stat.GasUsed = 0
+		}
+	} else {
+		stat.Count++
+		stat.GasUsed += le.GasUsed
+	}
+
+	val, err := json.Marshal(&stat)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, val)
+}
+
+// GetDailyStats returns the per-day log count and gas sum for UTC days from..to
+// (DayLayout, inclusive; empty is open-ended), read from the aggregate bucket
+// maintained as logs are stored and rolled back
+func (s *BoltStorage) GetDailyStats(ctx context.Context, from, to string) ([]*types.DailyStat, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := make([]*types.DailyStat, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketDaily))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		k, v := c.First()
+		if from != "" {
+			k, v = c.Seek([]byte(from))
+		}
+		for ; k != nil; k, v = c.Next() {
+			if to != "" && string(k) > to {
+				break
+			}
+			var stat types.DailyStat
+			if err := json.Unmarshal(v, &stat); err != nil {
+				return err
+			}
+			stats = append(stats, &stat)
+		}
+		return nil
+	})
+	return stats, err
+}
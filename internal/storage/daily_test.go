@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"example/hello/pkg/types"
+)
+
+func TestDailyAggregatesFollowStoreAndRollback(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, Options{})
+	day := func(d, hour int) uint64 {
+		return uint64(time.Date(2024, 3, d, hour, 0, 0, 0, time.UTC).Unix())
+	}
+	daily := func(from, to string) string {
+		t.Helper()
+		stats, err := s.GetDailyStats(ctx, from, to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := ""
+		for _, st := range stats {
+			out += fmt.Sprintf("%s:%d/%d ", st.Day, st.Count, st.GasUsed)
+		}
+		return out
+	}
+
+	storeLogs(t, s,
+		&types.LogEntry{Index: 0, BlockNumber: 10, Timestamp: day(1, 9), GasUsed: 100},
+		&types.LogEntry{Index: 1, BlockNumber: 11, Timestamp: day(1, 23), GasUsed: 50},
+		&types.LogEntry{Index: 2, BlockNumber: 12, Timestamp: day(2, 0), GasUsed: 70},
+		&types.LogEntry{Index: 3, BlockNumber: 13, Timestamp: day(3, 5), GasUsed: 30},
+		&types.LogEntry{Index: 4, BlockNumber: 14}, // not enriched yet
+	)
+	if got, want := daily("", ""), "2024-03-01:2/150 2024-03-02:1/70 2024-03-03:1/30 "; got != want {
+		t.Errorf("after indexing: %s, want %s", got, want)
+	}
+
+	// Overwriting an entry moves its contribution; enrichment adds the late one
+	storeLogs(t, s,
+		&types.LogEntry{Index: 1, BlockNumber: 11, Timestamp: day(1, 23), GasUsed: 80},
+		&types.LogEntry{Index: 4, BlockNumber: 14, Timestamp: day(3, 6), GasUsed: 5},
+	)
+	if got, want := daily("2024-03-01", "2024-03-02"), "2024-03-01:2/180 2024-03-02:1/70 "; got != want {
+		t.Errorf("after overwrite, days 1-2: %s, want %s", got, want)
+	}
+
+	// Rolling back to block 11 empties days 2 and 3 entirely
+	if err := s.Rollback(ctx, 11); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := daily("", ""), "2024-03-01:2/180 "; got != want {
+		t.Errorf("after rollback: %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"example/hello/pkg/types"
+
+	bolt "github.com/boltdb/bolt"
+)
+
+// BucketDeadLetter maps index to a types.DeadLetter for logs that failed processing.
+// The bulk indexer writes the same bucket, keyed and encoded the same way.
+const BucketDeadLetter = "dead_letter"
+
+// StoreDeadLetter records dl under its entry's index. A later failure of the same log
+// replaces the record and carries its attempt count forward.
+func (s *BoltStorage) StoreDeadLetter(ctx context.Context, dl *types.DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putDeadLetter(tx, dl)
+	})
+}
+
+func putDeadLetter(tx *bolt.Tx, dl *types.DeadLetter) error {
+	if dl.Entry == nil {
+		return fmt.Errorf("dead letter has no entry")
+	}
+	b, err := tx.CreateBucketIfNotExists([]byte(BucketDeadLetter))
+	if err != nil {
+		return err
+	}
+	key := uint64ToBytes(dl.Entry.Index)
+	if old := b.Get(key); old != nil {
+		var prev types.DeadLetter
+		if err := json.Unmarshal(old, &prev); err == nil && prev.Attempts > dl.Attempts {
+			dl.Attempts = prev.Attempts
+		}
+	}
+	dl.Attempts++
+	if dl.FailedAt.IsZero() {
+		dl.FailedAt = time.Now().UTC()
+	}
+	val, err := json.Marshal(dl)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+	return b.Put(key, val)
+}
+
+// GetDeadLetters returns dead letters from startIndex onward in index order, at most
+// limit of them (0 for all)
+func (s *BoltStorage) GetDeadLetters(ctx context.Context, startIndex uint64, limit int) ([]*types.DeadLetter, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	results := make([]*types.DeadLetter, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketDeadLetter))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Seek(uint64ToBytes(startIndex)); k != nil; k, v = c.Next() {
+			if limit > 0 && len(results) >= limit {
+				break
+			}
+			var dl types.DeadLetter
+			if err := json.Unmarshal(v, &dl); err != nil {
+				return fmt.Errorf("failed to decode dead letter %d: %w", bytesToUint64(k), err)
+			}
+			results = append(results, &dl)
+		}
+		return nil
+	})
+	return results, err
+}
+
+// ReprocessDeadLetters stores the captured entry of each dead letter in indices and
+// removes the dead letter. Each is stored in its own transaction, so one that fails
+// again stays dead-lettered, with the new error and attempt count, without holding
+// back the rest.
+func (s *BoltStorage) ReprocessDeadLetters(ctx context.Context, indices []uint64) (*types.ReprocessResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &types.ReprocessResult{Stored: make([]uint64, 0)}
+	for _, index := range indices {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		var dl *types.DeadLetter
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(BucketDeadLetter))
+			if b == nil {
+				return nil
+			}
+			v := b.Get(uint64ToBytes(index))
+			if v == nil {
+				return nil
+			}
+			var stored types.DeadLetter
+			if err := json.Unmarshal(v, &stored); err != nil || stored.Entry == nil {
+				return fmt.Errorf("dead letter %d is unreadable: %v", index, err)
+			}
+			dl = &stored
+			if err := s.storeLogTx(tx, dl.Entry); err != nil {
+				return err
+			}
+			return b.Delete(uint64ToBytes(index))
+		})
+		switch {
+		case dl == nil && err != nil:
+			return result, err
+		case dl == nil:
+			result.Missing = append(result.Missing, index)
+		case err == nil:
+			result.Stored = append(result.Stored, index)
+		default:
+			// The failed transaction left the dead letter untouched; record the new error
+			dl.Stage, dl.Error, dl.FailedAt = "store", err.Error(), time.Time{}
+			if err := s.db.Update(func(tx *bolt.Tx) error { return putDeadLetter(tx, dl) }); err != nil {
+				return result, fmt.Errorf("failed to update dead letter %d: %w", index, err)
+			}
+			result.Failed = append(result.Failed, dl)
+		}
+	}
+	return result, nil
+}
+
+// rollbackDeadLetters deletes the dead letters of logs above toBlockNumber along with
+// the logs themselves; a reorg makes them as stale as the stored entries
+func rollbackDeadLetters(tx *bolt.Tx, toBlockNumber uint64) error {
+	b := tx.Bucket([]byte(BucketDeadLetter))
+	if b == nil {
+		return nil
+	}
+	var stale [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		var dl types.DeadLetter
+		if err := json.Unmarshal(v, &dl); err == nil && dl.Entry != nil && dl.Entry.BlockNumber > toBlockNumber {
+			stale = append(stale, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range stale {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"example/hello/pkg/types"
+)
+
+// ManifestFile is the name of the manifest inside a shard directory
+const ManifestFile = "manifest.json"
+
+// ErrInvalidManifest is returned for a manifest whose shards are unsorted or overlap
+var ErrInvalidManifest = errors.New("invalid shard manifest")
+
+// LoadShardManifest reads a shard manifest from a shard directory or the manifest file
+// itself. Shard file paths are resolved against the manifest's directory.
+func LoadShardManifest(path string) (*types.ShardManifest, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, ManifestFile)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shard manifest: %w", err)
+	}
+
+	var m types.ShardManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse shard manifest %s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	for i := range m.Shards {
+		shard := &m.Shards[i]
+		if shard.EndIndex < shard.StartIndex {
+			return nil, fmt.Errorf("%w: shard %s ends before it starts", ErrInvalidManifest, shard.File)
+		}
+		if i > 0 && shard.StartIndex <= m.Shards[i-1].EndIndex {
+			return nil, fmt.Errorf("%w: shard %s overlaps %s", ErrInvalidManifest, shard.File, m.Shards[i-1].File)
+		}
+		if !filepath.IsAbs(shard.File) {
+			shard.File = filepath.Join(dir, shard.File)
+		}
+	}
+	return &m, nil
+}
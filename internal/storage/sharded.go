@@ -0,0 +1,453 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"example/hello/pkg/types"
+
+	"github.com/boltdb/bolt"
+)
+
+// ErrReadOnly is returned by write operations on read-only storage
+var ErrReadOnly = errors.New("storage is read-only")
+
+// ShardedStorage serves a sharded backfill (see LoadShardManifest) through the Storage
+// interface without consolidating it. Reads are dispatched to the shards whose index
+// or block range can hold the answer; shards are opened read-only on first use and kept
+// open. All writes fail with ErrReadOnly.
+type ShardedStorage struct {
+	manifest *types.ShardManifest
+	shards   map[string]*BoltStorage
+	mu       sync.Mutex
+}
+
+// NewShardedStorage loads the manifest at path (a shard directory or manifest file)
+func NewShardedStorage(path string) (*ShardedStorage, error) {
+	manifest, err := LoadShardManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ShardedStorage{manifest: manifest, shards: make(map[string]*BoltStorage)}, nil
+}
+
+// shard returns the opened storage for a shard file
+func (s *ShardedStorage) shard(info types.ShardInfo) (*BoltStorage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if st, ok := s.shards[info.File]; ok {
+		return st, nil
+	}
+	db, err := bolt.Open(info.File, 0600, &bolt.Options{ReadOnly: true, Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open shard %s: %w", info.File, err)
+	}
+	st := &BoltStorage{db: db}
+	s.shards[info.File] = st
+	return st, nil
+}
+
+// shardsForBlock returns the shards whose block range contains blockNumber
+func (s *ShardedStorage) shardsForBlock(blockNumber uint64) []types.ShardInfo {
+	var shards []types.ShardInfo
+	for _, info := range s.manifest.Shards {
+		if info.StartBlock <= blockNumber && blockNumber <= info.EndBlock {
+			shards = append(shards, info)
+		}
+	}
+	return shards
+}
+
+// StoreLog implements Storage; sharded backfills are read-only
+func (s *ShardedStorage) StoreLog(ctx context.Context, entry *types.LogEntry) error {
+	return ErrReadOnly
+}
+
+// StoreLogs implements Storage; sharded backfills are read-only
+func (s *ShardedStorage) StoreLogs(ctx context.Context, entries []*types.LogEntry) error {
+	return ErrReadOnly
+}
+
+// GetLog reads the index from the one shard that can hold it
+func (s *ShardedStorage) GetLog(ctx context.Context, index uint64) (*types.LogEntry, error) {
+	info, ok := s.manifest.Find(index)
+	if !ok {
+		return nil, fmt.Errorf("not found")
+	}
+	st, err := s.shard(info)
+	if err != nil {
+		return nil, err
+	}
+	return st.GetLog(ctx, index)
+}
+
+// GetLogByPosition searches the shards covering blockNumber
+func (s *ShardedStorage) GetLogByPosition(ctx context.Context, blockNumber, logIndex uint64) (*types.LogEntry, error) {
+	for _, info := range s.shardsForBlock(blockNumber) {
+		st, err := s.shard(info)
+		if err != nil {
+			return nil, err
+		}
+		if entry, err := st.GetLogByPosition(ctx, blockNumber, logIndex); err == nil {
+			return entry, nil
+		}
+	}
+	return nil, fmt.Errorf("not found")
+}
+
+// GetLogsByRange concatenates the overlapping shards in index order. Each shard is only
+// read within its manifest range, and an entry at or below the last one returned is
+// still dropped, so a bad manifest cannot produce duplicates or out-of-order results.
+// Shards lying wholly within offset are counted rather than read.
+func (s *ShardedStorage) GetLogsByRange(ctx context.Context, startIndex, endIndex uint64, offset, limit int) ([]*types.LogEntry, error) {
+	results := make([]*types.LogEntry, 0, 64)
+	for _, info := range s.manifest.Overlapping(startIndex, endIndex) {
+		st, err := s.shard(info)
+		if err != nil {
+			return nil, err
+		}
+		from, to := max(startIndex, info.StartIndex), info.EndIndex
+		if endIndex > 0 {
+			to = min(endIndex, to)
+		}
+		if offset > 0 {
+			n, err := st.CountRange(ctx, from, to)
+			if err != nil {
+				return nil, err
+			}
+			if n <= uint64(offset) {
+				offset -= int(n)
+				continue
+			}
+		}
+		remaining := 0
+		if limit > 0 {
+			remaining = limit - len(results)
+		}
+		entries, err := st.GetLogsByRange(ctx, from, to, offset, remaining)
+		if err != nil {
+			return nil, err
+		}
+		offset = 0
+		for _, entry := range entries {
+			if n := len(results); n > 0 && entry.Index <= results[n-1].Index {
+				continue
+			}
+			results = append(results, entry)
+		}
+		if limit > 0 && len(results) >= limit {
+			break
+		}
+	}
+	return results, nil
+}
+
+// GetLogsAfter pages through the shards like BoltStorage.GetLogsAfter
+func (s *ShardedStorage) GetLogsAfter(ctx context.Context, cursor uint64, limit int) ([]*types.LogEntry, *uint64, error) {
+	logs, err := s.GetLogsByRange(ctx, cursor, 0, 0, PageProbe(limit))
+	if err != nil {
+		return nil, nil, err
+	}
+	logs, next := SplitPage(logs, limit)
+	return logs, next, nil
+}
+
+// GetLogsByBlockNumber collects the block's logs from the shards covering it
+func (s *ShardedStorage) GetLogsByBlockNumber(ctx context.Context, blockNumber uint64) ([]*types.LogEntry, error) {
+	var results []*types.LogEntry
+	for _, info := range s.shardsForBlock(blockNumber) {
+		st, err := s.shard(info)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := st.GetLogsByBlockNumber(ctx, blockNumber)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, entries...)
+	}
+	return results, nil
+}
+
+// GetLogsByTxIndexRange filters the block's logs from the shards covering it
+func (s *ShardedStorage) GetLogsByTxIndexRange(ctx context.Context, blockNumber, fromTx, toTx uint64) ([]*types.LogEntry, error) {
+	logs, err := s.GetLogsByBlockNumber(ctx, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	return filterTxIndexRange(logs, fromTx, toTx), nil
+}
+
+// GetLogsByTxHash has no block hint, so every shard is searched
+func (s *ShardedStorage) GetLogsByTxHash(ctx context.Context, txHash string) ([]*types.LogEntry, error) {
+	var results []*types.LogEntry
+	if txHash == "" {
+		return results, nil
+	}
+	for _, info := range s.manifest.Shards {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		st, err := s.shard(info)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := st.GetLogsByTxHash(ctx, txHash)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, entries...)
+	}
+	return results, nil
+}
+
+// GetIncompleteLogs walks the shards from startIndex until limit entries are found
+func (s *ShardedStorage) GetIncompleteLogs(ctx context.Context, startIndex uint64, limit int) ([]*types.LogEntry, error) {
+	results := make([]*types.LogEntry, 0)
+	for _, info := range s.manifest.Overlapping(startIndex, 0) {
+		st, err := s.shard(info)
+		if err != nil {
+			return nil, err
+		}
+		remaining := 0
+		if limit > 0 {
+			remaining = limit - len(results)
+		}
+		entries, err := st.GetIncompleteLogs(ctx, startIndex, remaining)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, entries...)
+		if limit > 0 && len(results) >= limit {
+			break
+		}
+	}
+	return results, nil
+}
+
+// GetLastIndex returns one past the highest index, as BoltStorage does
+func (s *ShardedStorage) GetLastIndex(ctx context.Context) (uint64, error) {
+	if len(s.manifest.Shards) == 0 {
+		return 0, nil
+	}
+	return s.manifest.Shards[len(s.manifest.Shards)-1].EndIndex + 1, nil
+}
+
+// GetLastBlockNumber returns the block of the highest-indexed log
+func (s *ShardedStorage) GetLastBlockNumber(ctx context.Context) (uint64, error) {
+	if len(s.manifest.Shards) == 0 {
+		return 0, nil
+	}
+	st, err := s.shard(s.manifest.Shards[len(s.manifest.Shards)-1])
+	if err != nil {
+		return 0, err
+	}
+	return st.GetLastBlockNumber(ctx)
+}
+
+// GetTotalCount sums the manifest's per-shard counts without opening any shard
+func (s *ShardedStorage) GetTotalCount(ctx context.Context) (uint64, error) {
+	return s.manifest.TotalCount(), nil
+}
+
+// CountRange uses the manifest count for shards entirely inside the range and only
+// counts keys in the (at most two) shards it cuts through
+func (s *ShardedStorage) CountRange(ctx context.Context, startIndex, endIndex uint64) (uint64, error) {
+	var count uint64
+	for _, info := range s.manifest.Overlapping(startIndex, endIndex) {
+		if info.StartIndex >= startIndex && (endIndex == 0 || info.EndIndex <= endIndex) {
+			count += info.LogCount
+			continue
+		}
+		st, err := s.shard(info)
+		if err != nil {
+			return 0, err
+		}
+		to := info.EndIndex
+		if endIndex > 0 {
+			to = min(endIndex, to)
+		}
+		n, err := st.CountRange(ctx, max(startIndex, info.StartIndex), to)
+		if err != nil {
+			return 0, err
+		}
+		count += n
+	}
+	return count, nil
+}
+
+// GetIndexRange combines the first and last shards' ranges with the manifest total
+func (s *ShardedStorage) GetIndexRange(ctx context.Context) (*types.IndexRange, error) {
+	if len(s.manifest.Shards) == 0 {
+		return &types.IndexRange{}, nil
+	}
+	first, err := s.shard(s.manifest.Shards[0])
+	if err != nil {
+		return nil, err
+	}
+	last, err := s.shard(s.manifest.Shards[len(s.manifest.Shards)-1])
+	if err != nil {
+		return nil, err
+	}
+	firstRange, err := first.GetIndexRange(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lastRange, err := last.GetIndexRange(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &types.IndexRange{
+		FirstBlock: firstRange.FirstBlock,
+		LastBlock:  lastRange.LastBlock,
+		FirstIndex: firstRange.FirstIndex,
+		LastIndex:  lastRange.LastIndex,
+		TotalCount: s.manifest.TotalCount(),
+	}, nil
+}
+
+// GetBatchInfo returns none; batch analytics are only written on consolidation
+func (s *ShardedStorage) GetBatchInfo(ctx context.Context) ([]*types.BatchInfo, error) {
+	return nil, nil
+}
+
+// SaveCheckpoint implements Storage; sharded backfills are read-only
+func (s *ShardedStorage) SaveCheckpoint(ctx context.Context, checkpoint *types.CheckpointData) error {
+	return ErrReadOnly
+}
+
+// GetCheckpoint reports the end of the backfilled block range
+func (s *ShardedStorage) GetCheckpoint(ctx context.Context) (*types.CheckpointData, error) {
+	var last uint64
+	for _, info := range s.manifest.Shards {
+		if info.EndBlock > last {
+			last = info.EndBlock
+		}
+	}
+	return &types.CheckpointData{LastProcessedBlock: last}, nil
+}
+
+// StoreBlockHash implements Storage; sharded backfills are read-only
+func (s *ShardedStorage) StoreBlockHash(ctx context.Context, blockNumber uint64, blockHash string) error {
+	return ErrReadOnly
+}
+
+// GetBlockHash fails: worker DBs do not record block hashes
+func (s *ShardedStorage) GetBlockHash(ctx context.Context, blockNumber uint64) (string, error) {
+	return "", fmt.Errorf("not found")
+}
+
+// IterateBlockHashes visits nothing: worker DBs do not record block hashes
+func (s *ShardedStorage) IterateBlockHashes(ctx context.Context, from, to uint64, fn func(number uint64, hash string) error) error {
+	return nil
+}
+
+// GetDailyStats fails: worker DBs do not keep daily aggregates
+func (s *ShardedStorage) GetDailyStats(ctx context.Context, from, to string) ([]*types.DailyStat, error) {
+	return nil, fmt.Errorf("daily aggregates are not kept for sharded backfills")
+}
+
+// StoreDeadLetter implements Storage; sharded backfills are read-only
+func (s *ShardedStorage) StoreDeadLetter(ctx context.Context, dl *types.DeadLetter) error {
+	return ErrReadOnly
+}
+
+// GetDeadLetters walks the shards from startIndex until limit dead letters are found
+func (s *ShardedStorage) GetDeadLetters(ctx context.Context, startIndex uint64, limit int) ([]*types.DeadLetter, error) {
+	results := make([]*types.DeadLetter, 0)
+	for _, info := range s.manifest.Overlapping(startIndex, 0) {
+		st, err := s.shard(info)
+		if err != nil {
+			return nil, err
+		}
+		remaining := 0
+		if limit > 0 {
+			remaining = limit - len(results)
+		}
+		letters, err := st.GetDeadLetters(ctx, startIndex, remaining)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, letters...)
+		if limit > 0 && len(results) >= limit {
+			break
+		}
+	}
+	return results, nil
+}
+
+// ReprocessDeadLetters implements Storage; sharded backfills are read-only
+func (s *ShardedStorage) ReprocessDeadLetters(ctx context.Context, indices []uint64) (*types.ReprocessResult, error) {
+	return nil, ErrReadOnly
+}
+
+// StoreDiscoveredContracts implements Storage; sharded backfills are read-only
+func (s *ShardedStorage) StoreDiscoveredContracts(ctx context.Context, contracts []*types.DiscoveredContract) error {
+	return ErrReadOnly
+}
+
+// GetDiscoveredContracts returns none: worker DBs do not record discovered contracts
+func (s *ShardedStorage) GetDiscoveredContracts(ctx context.Context) ([]*types.DiscoveredContract, error) {
+	return nil, nil
+}
+
+// Snapshot fails: re-chunk a sharded backfill with the bulk indexer's -rechunk instead
+func (s *ShardedStorage) Snapshot(ctx context.Context, path string, atBlock uint64) (*types.SnapshotInfo, error) {
+	return nil, fmt.Errorf("snapshots of sharded backfills are not supported")
+}
+
+// PromotePending implements Storage; sharded backfills are read-only
+func (s *ShardedStorage) PromotePending(ctx context.Context, throughBlock uint64) (uint64, error) {
+	return 0, ErrReadOnly
+}
+
+// Rollback implements Storage; sharded backfills are read-only
+func (s *ShardedStorage) Rollback(ctx context.Context, toBlockNumber uint64) error {
+	return ErrReadOnly
+}
+
+// RollbackIfLastBlock implements Storage; sharded backfills are read-only
+func (s *ShardedStorage) RollbackIfLastBlock(ctx context.Context, toBlockNumber, expectedLastBlock uint64) error {
+	return ErrReadOnly
+}
+
+// Reindex implements Storage; sharded backfills are read-only
+func (s *ShardedStorage) Reindex(ctx context.Context) (*types.ReindexResult, error) {
+	return nil, ErrReadOnly
+}
+
+// Ping opens every shard in the manifest and checks that its logs bucket is readable
+func (s *ShardedStorage) Ping(ctx context.Context) error {
+	for _, info := range s.manifest.Shards {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		st, err := s.shard(info)
+		if err != nil {
+			return err
+		}
+		if err := st.ping(BucketLogs); err != nil {
+			return fmt.Errorf("shard %s: %w", info.File, err)
+		}
+	}
+	return nil
+}
+
+// Close closes every opened shard
+func (s *ShardedStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var firstErr error
+	for file, st := range s.shards {
+		if err := st.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.shards, file)
+	}
+	return firstErr
+}
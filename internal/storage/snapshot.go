@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"example/hello/pkg/types"
+
+	bolt "github.com/boltdb/bolt"
+)
+
+// KeySnapshot stores the SnapshotInfo in the meta bucket of a database written by Snapshot
+const KeySnapshot = "snapshot"
+
+// ErrSnapshotExists is returned by Snapshot when the target file is already there
+var ErrSnapshotExists = errors.New("snapshot file already exists")
+
+// snapshotCommitEvery bounds the entries copied per write transaction
+const snapshotCommitEvery = 10000
+
+// Snapshot writes every log with blockNumber <= atBlock, and the block hashes up to it,
+// into a new database at path: the index as of that block, however far indexing has
+// moved on since. The source is read in a single transaction, so the snapshot is
+// consistent. The copy's secondary indexes and daily aggregates are rebuilt from its
+// logs, and its meta bucket records the SnapshotInfo under KeySnapshot.
+func (s *BoltStorage) Snapshot(ctx context.Context, path string, atBlock uint64) (*types.SnapshotInfo, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotExists, path)
+	}
+	dst, err := NewBoltStorageWithOptions(path, s.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &types.SnapshotInfo{Block: atBlock, CreatedAt: time.Now().UTC()}
+	err = s.copyUpTo(ctx, dst.db, atBlock, info)
+	if err == nil {
+		_, err = dst.Reindex(ctx)
+	}
+	if err == nil {
+		err = dst.db.Update(func(tx *bolt.Tx) error {
+			val, err := json.Marshal(info)
+			if err != nil {
+				return err
+			}
+			return tx.Bucket([]byte(BucketMeta)).Put([]byte(KeySnapshot), val)
+		})
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("snapshot at block %d failed: %w", atBlock, err)
+	}
+	return info, nil
+}
+
+// copyUpTo copies logs and block hashes up to atBlock from s into dst
+func (s *BoltStorage) copyUpTo(ctx context.Context, dst *bolt.DB, atBlock uint64, info *types.SnapshotInfo) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.db.View(func(src *bolt.Tx) error {
+		// Writes to dst commit while src is still open, so keys and values taken from
+		// src's mmap stay valid without copying
+		out, err := dst.Begin(true)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if out != nil {
+				out.Rollback()
+			}
+		}()
+		pending := 0
+		flush := func() error {
+			if pending++; pending < snapshotCommitEvery {
+				return nil
+			}
+			pending = 0
+			if err := out.Commit(); err != nil {
+				return err
+			}
+			out, err = dst.Begin(true)
+			return err
+		}
+
+		if logs := src.Bucket([]byte(BucketLogs)); logs != nil {
+			err := logs.ForEach(func(k, v []byte) error {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				var le types.LogEntry
+				if err := json.Unmarshal(v, &le); err != nil {
+					return fmt.Errorf("failed to decode log: %w", err)
+				}
+				if le.BlockNumber > atBlock {
+					return nil
+				}
+				if err := out.Bucket([]byte(BucketLogs)).Put(k, v); err != nil {
+					return err
+				}
+				info.LogCount++
+				if le.Index > info.LastIndex {
+					info.LastIndex = le.Index
+				}
+				return flush()
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if hashes := src.Bucket([]byte(BucketBlockMap)); hashes != nil {
+			c := hashes.Cursor()
+			for k, v := c.First(); k != nil && bytesToUint64(k) <= atBlock; k, v = c.Next() {
+				if err := out.Bucket([]byte(BucketBlockMap)).Put(k, v); err != nil {
+					return err
+				}
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+
+		err = out.Commit()
+		out = nil
+		return err
+	})
+}
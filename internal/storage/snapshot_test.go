@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"example/hello/pkg/types"
+
+	bolt "github.com/boltdb/bolt"
+)
+
+func TestSnapshotExcludesLogsAboveBlock(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, Options{})
+	for i := uint64(0); i < 6; i++ {
+		storeLogs(t, s, &types.LogEntry{Index: i, BlockNumber: 100 + i/2, LogIndex: i % 2, TxHash: fmt.Sprintf("0x%x", i)})
+		if err := s.StoreBlockHash(ctx, 100+i/2, fmt.Sprintf("0xb%d", 100+i/2)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot_101.db")
+	info, err := s.Snapshot(ctx, path, 101)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Block != 101 || info.LogCount != 4 || info.LastIndex != 3 {
+		t.Errorf("snapshot info %+v, want block 101 with 4 logs up to index 3", info)
+	}
+	if _, err := s.Snapshot(ctx, path, 101); !errors.Is(err, ErrSnapshotExists) {
+		t.Errorf("second snapshot to the same file = %v, want ErrSnapshotExists", err)
+	}
+
+	snap, err := NewBoltStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+	logs, err := snap.GetLogsByRange(ctx, 0, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{0, 1, 2, 3}; !slices.Equal(indices(logs), want) {
+		t.Errorf("snapshot holds %v, want %v", indices(logs), want)
+	}
+	if n, _ := snap.GetTotalCount(ctx); n != 4 {
+		t.Errorf("snapshot count %d, want 4", n)
+	}
+	if h, err := snap.GetBlockHash(ctx, 101); err != nil || h != "0xb101" {
+		t.Errorf("block 101 hash in snapshot = %q, %v", h, err)
+	}
+	if _, err := snap.GetBlockHash(ctx, 102); err == nil {
+		t.Error("snapshot holds the hash of block 102")
+	}
+	if txLogs, _ := snap.GetLogsByTxHash(ctx, "0x4"); len(txLogs) != 0 {
+		t.Errorf("tx index in snapshot resolves %d logs of block 102", len(txLogs))
+	}
+
+	var stored types.SnapshotInfo
+	snap.db.View(func(tx *bolt.Tx) error {
+		return json.Unmarshal(tx.Bucket([]byte(BucketMeta)).Get([]byte(KeySnapshot)), &stored)
+	})
+	if stored.Block != 101 {
+		t.Errorf("snapshot metadata records block %d, want 101", stored.Block)
+	}
+}
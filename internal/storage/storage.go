@@ -1,10 +1,15 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 
 	"example/hello/pkg/types"
@@ -16,43 +21,149 @@ const (
 	BucketLogs       = "logs"
 	BucketMeta       = "meta"
 	BucketCheckpoint = "checkpoint"
-	BucketBlockMap   = "blockmap" // maps block hash to index
+	BucketBlockMap   = "blockmap"   // maps block hash to index
+	BucketNaturalKey = "naturalkey" // maps blockNumber|logIndex to index
+	BucketBatchInfo  = "batch_info" // per-batch analytics written by the bulk indexer
+	BucketIncomplete = "incomplete" // maps index to log key for entries stored with enriched:false
+	BucketPending    = "pending"    // maps index to log key for entries not yet past the confirmation depth
+	BucketDaily      = "daily"      // maps UTC day to the count and gas sum of its logs
+	BucketIndexKey   = "indexkey"   // maps index to log key for entries not keyed by their index (CompositeKeys)
 )
 
 // KeyLastBlock stores the last processed block number
 const KeyLastBlock = "lastBlock"
 
-// KeyNextIndex stores the next index to assign
+// KeyNextIndex stores the next index to assign. It is only maintained with
+// MonotonicIndices, where it is a high-water mark that rollbacks do not lower.
 const KeyNextIndex = "nextIndex"
 
 // KeyLastBlockHash stores the hash of the last processed block
 const KeyLastBlockHash = "lastBlockHash"
 
+// KeyLogCount stores the number of entries in the logs bucket, kept in step by every
+// write that adds or removes one so that GetTotalCount does not walk the B+tree
+const KeyLogCount = "logCount"
+
+// SchemaVersion identifies the on-disk bucket layout; bump it when buckets or key encodings change
+const SchemaVersion = 8
+
+// UpsertPolicy decides what StoreLog does in natural-key mode when a log with the
+// same (blockNumber, logIndex) has already been stored
+type UpsertPolicy string
+
+const (
+	UpsertOverwrite UpsertPolicy = "overwrite" // replace the stored entry, keeping its index
+	UpsertSkip      UpsertPolicy = "skip"      // keep the stored entry and drop the new one
+	UpsertError     UpsertPolicy = "error"     // reject the new entry with ErrDuplicateLog
+)
+
+// ErrDuplicateLog is returned by StoreLog under UpsertError for an existing natural key
+var ErrDuplicateLog = errors.New("log with same blockNumber and logIndex already stored")
+
+// ErrIndexReused is returned by StoreLog under MonotonicIndices for a new entry whose
+// index is below the high-water mark, e.g. one freed by a rollback
+var ErrIndexReused = errors.New("index already assigned")
+
+// ErrBlockHashChanged is returned by StoreBlockHash when a different hash is already
+// stored for the block number: a sign of a reorg. The stored hash is kept.
+var ErrBlockHashChanged = errors.New("block hash changed")
+
+// ErrLastBlockMismatch is returned by RollbackIfLastBlock when the index has moved on
+var ErrLastBlockMismatch = errors.New("last indexed block does not match expected block")
+
+// ErrNoCheckpoint is returned by GetCheckpoint before the first checkpoint is saved
+var ErrNoCheckpoint = errors.New("no checkpoint found")
+
+// ParseUpsertPolicy validates an upsert policy name
+func ParseUpsertPolicy(s string) (UpsertPolicy, error) {
+	switch p := UpsertPolicy(s); p {
+	case UpsertOverwrite, UpsertSkip, UpsertError:
+		return p, nil
+	case "":
+		return UpsertOverwrite, nil
+	default:
+		return "", fmt.Errorf("unknown upsert policy %q (want overwrite, skip or error)", s)
+	}
+}
+
+// Options tunes optional BoltStorage behaviour
+type Options struct {
+	// NaturalKeys tracks (blockNumber, logIndex) per entry so reruns are idempotent
+	NaturalKeys bool
+	// UpsertPolicy applies when NaturalKeys is set and the natural key already exists
+	UpsertPolicy UpsertPolicy
+	// CompositeKeys keys the logs bucket by blockNumber(8 bytes)|logIndex(4 bytes) instead
+	// of the synthetic index, so entries of different event types interleave in chain
+	// order. The key is natural, so UpsertPolicy applies to it directly. Index lookups go
+	// through the indexkey bucket, since event types indexed in separate passes get
+	// indices that do not follow chain order.
+	CompositeKeys bool
+	// MonotonicIndices never hands out an index twice: indices freed by a rollback are
+	// abandoned and re-indexed logs get fresh ones, so a consumer holding index N never
+	// sees a different log under it. Implies NaturalKeys, whose bucket then maps each
+	// chain position to its current index. The cost is gaps in the index sequence.
+	MonotonicIndices bool
+}
+
 // Storage defines the interface for persistent storage
 type Storage interface {
 	StoreLog(ctx context.Context, entry *types.LogEntry) error
+	StoreLogs(ctx context.Context, entries []*types.LogEntry) error
 	GetLog(ctx context.Context, index uint64) (*types.LogEntry, error)
-	GetLogsByRange(ctx context.Context, startIndex, endIndex uint64, limit int) ([]*types.LogEntry, error)
+	GetLogByPosition(ctx context.Context, blockNumber, logIndex uint64) (*types.LogEntry, error)
+	GetLogsByRange(ctx context.Context, startIndex, endIndex uint64, offset, limit int) ([]*types.LogEntry, error)
+	GetLogsAfter(ctx context.Context, cursor uint64, limit int) ([]*types.LogEntry, *uint64, error)
 	GetLogsByBlockNumber(ctx context.Context, blockNumber uint64) ([]*types.LogEntry, error)
 	GetLogsByTxHash(ctx context.Context, txHash string) ([]*types.LogEntry, error)
+	GetLogsByTxIndexRange(ctx context.Context, blockNumber, fromTx, toTx uint64) ([]*types.LogEntry, error)
+	GetIncompleteLogs(ctx context.Context, startIndex uint64, limit int) ([]*types.LogEntry, error)
 	GetLastIndex(ctx context.Context) (uint64, error)
+	GetLastBlockNumber(ctx context.Context) (uint64, error)
 	GetTotalCount(ctx context.Context) (uint64, error)
+	CountRange(ctx context.Context, startIndex, endIndex uint64) (uint64, error)
+	GetIndexRange(ctx context.Context) (*types.IndexRange, error)
+	GetBatchInfo(ctx context.Context) ([]*types.BatchInfo, error)
+	GetDailyStats(ctx context.Context, from, to string) ([]*types.DailyStat, error)
+	StoreDeadLetter(ctx context.Context, dl *types.DeadLetter) error
+	GetDeadLetters(ctx context.Context, startIndex uint64, limit int) ([]*types.DeadLetter, error)
+	ReprocessDeadLetters(ctx context.Context, indices []uint64) (*types.ReprocessResult, error)
+	StoreDiscoveredContracts(ctx context.Context, contracts []*types.DiscoveredContract) error
+	GetDiscoveredContracts(ctx context.Context) ([]*types.DiscoveredContract, error)
 	SaveCheckpoint(ctx context.Context, checkpoint *types.CheckpointData) error
 	GetCheckpoint(ctx context.Context) (*types.CheckpointData, error)
 	StoreBlockHash(ctx context.Context, blockNumber uint64, blockHash string) error
 	GetBlockHash(ctx context.Context, blockNumber uint64) (string, error)
+	IterateBlockHashes(ctx context.Context, from, to uint64, fn func(number uint64, hash string) error) error
+	PromotePending(ctx context.Context, throughBlock uint64) (uint64, error)
 	Rollback(ctx context.Context, toBlockNumber uint64) error
+	RollbackIfLastBlock(ctx context.Context, toBlockNumber, expectedLastBlock uint64) error
+	Reindex(ctx context.Context) (*types.ReindexResult, error)
+	Snapshot(ctx context.Context, path string, atBlock uint64) (*types.SnapshotInfo, error)
+	Ping(ctx context.Context) error
 	Close() error
 }
 
 // BoltStorage implements Storage using BoltDB
 type BoltStorage struct {
-	db *bolt.DB
-	mu sync.RWMutex
+	db   *bolt.DB
+	opts Options
+	mu   sync.RWMutex
 }
 
 // NewBoltStorage creates a new BoltDB storage instance
 func NewBoltStorage(dbPath string) (*BoltStorage, error) {
+	return NewBoltStorageWithOptions(dbPath, Options{})
+}
+
+// NewBoltStorageWithOptions creates a new BoltDB storage instance with optional behaviour enabled
+func NewBoltStorageWithOptions(dbPath string, opts Options) (*BoltStorage, error) {
+	if opts.UpsertPolicy == "" {
+		opts.UpsertPolicy = UpsertOverwrite
+	}
+	if opts.MonotonicIndices && !opts.CompositeKeys {
+		opts.NaturalKeys = true
+	}
+
 	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: 0})
 	if err != nil {
 		return nil, fmt.Errorf("failed to open boltdb: %w", err)
@@ -60,11 +171,21 @@ func NewBoltStorage(dbPath string) (*BoltStorage, error) {
 
 	// Create required buckets
 	err = db.Update(func(tx *bolt.Tx) error {
-		for _, bucket := range []string{BucketLogs, BucketMeta, BucketCheckpoint, BucketBlockMap} {
+		// Runs before the bucket list below would create them empty
+		if err := buildMissingIndexes(tx, BucketBlockIndex, BucketTxIndex, BucketIndexKey); err != nil {
+			return fmt.Errorf("build secondary indexes: %w", err)
+		}
+		for _, bucket := range []string{BucketLogs, BucketMeta, BucketCheckpoint, BucketBlockMap, BucketNaturalKey, BucketIncomplete, BucketPending, BucketDaily, BucketDeadLetter, BucketContracts} {
 			if _, e := tx.CreateBucketIfNotExists([]byte(bucket)); e != nil {
 				return e
 			}
 		}
+		// Databases written before the count was maintained get it seeded once here
+		meta := tx.Bucket([]byte(BucketMeta))
+		if meta.Get([]byte(KeyLogCount)) == nil {
+			n := tx.Bucket([]byte(BucketLogs)).Stats().KeyN
+			return meta.Put([]byte(KeyLogCount), uint64ToBytes(uint64(n)))
+		}
 		return nil
 	})
 	if err != nil {
@@ -72,7 +193,7 @@ func NewBoltStorage(dbPath string) (*BoltStorage, error) {
 		return nil, fmt.Errorf("failed to create buckets: %w", err)
 	}
 
-	return &BoltStorage{db: db}, nil
+	return &BoltStorage{db: db, opts: opts}, nil
 }
 
 // StoreLog persists a log entry
@@ -80,18 +201,295 @@ func (s *BoltStorage) StoreLog(ctx context.Context, entry *types.LogEntry) error
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return s.storeLogTx(tx, entry)
+	})
+}
+
+// StoreLogs persists entries in a single transaction: either all are stored or,
+// on the first error, none are
+func (s *BoltStorage) StoreLogs(ctx context.Context, entries []*types.LogEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, entry := range entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := s.storeLogTx(tx, entry); err != nil {
+				return fmt.Errorf("index %d: %w", entry.Index, err)
+			}
+		}
+		return nil
+	})
+}
+
+// storeLogTx writes one entry within tx, applying the key mode and upsert policy
+func (s *BoltStorage) storeLogTx(tx *bolt.Tx, entry *types.LogEntry) error {
 	val, err := json.Marshal(entry)
 	if err != nil {
 		return fmt.Errorf("failed to marshal log: %w", err)
 	}
 
-	return s.db.Update(func(tx *bolt.Tx) error {
+	b := tx.Bucket([]byte(BucketLogs))
+	if b == nil {
+		return fmt.Errorf("logs bucket missing")
+	}
+	if s.opts.CompositeKeys {
+		key := naturalKey(entry.BlockNumber, entry.LogIndex)
+		if existing := b.Get(key); existing != nil {
+			switch s.opts.UpsertPolicy {
+			case UpsertSkip:
+				return nil
+			case UpsertError:
+				return fmt.Errorf("%w: block %d logIndex %d", ErrDuplicateLog, entry.BlockNumber, entry.LogIndex)
+			}
+		} else if s.opts.MonotonicIndices {
+			if err := reserveIndex(tx, entry.Index); err != nil {
+				return err
+			}
+		}
+		return putLog(tx, key, entry, val)
+	}
+	if !s.opts.NaturalKeys {
+		return putLog(tx, uint64ToBytes(entry.Index), entry, val)
+	}
+
+	nk := tx.Bucket([]byte(BucketNaturalKey))
+	if nk == nil {
+		return fmt.Errorf("naturalkey bucket missing")
+	}
+	key := naturalKey(entry.BlockNumber, entry.LogIndex)
+	if existing := nk.Get(key); existing != nil {
+		switch s.opts.UpsertPolicy {
+		case UpsertSkip:
+			return nil
+		case UpsertError:
+			return fmt.Errorf("%w: block %d logIndex %d", ErrDuplicateLog, entry.BlockNumber, entry.LogIndex)
+		default:
+			// Overwrite in place so the entry keeps the index it was first given
+			entry.Index = bytesToUint64(existing)
+			if val, err = json.Marshal(entry); err != nil {
+				return fmt.Errorf("failed to marshal log: %w", err)
+			}
+			return putLog(tx, existing, entry, val)
+		}
+	}
+
+	if s.opts.MonotonicIndices {
+		if err := reserveIndex(tx, entry.Index); err != nil {
+			return err
+		}
+	}
+	if err := putLog(tx, uint64ToBytes(entry.Index), entry, val); err != nil {
+		return err
+	}
+	return nk.Put(key, uint64ToBytes(entry.Index))
+}
+
+// reserveIndex claims index for a new entry under MonotonicIndices. It fails when index
+// is below the high-water mark in meta, and otherwise moves the mark past it.
+func reserveIndex(tx *bolt.Tx, index uint64) error {
+	meta := tx.Bucket([]byte(BucketMeta))
+	if meta == nil {
+		return fmt.Errorf("meta bucket missing")
+	}
+	var next uint64
+	if v := meta.Get([]byte(KeyNextIndex)); v != nil {
+		next = bytesToUint64(v)
+	}
+	if index < next {
+		return fmt.Errorf("%w: %d is below the next index %d", ErrIndexReused, index, next)
+	}
+	return meta.Put([]byte(KeyNextIndex), uint64ToBytes(index+1))
+}
+
+// putLog writes an entry under key and keeps the incomplete and pending flag buckets, the
+// block and tx indexes, the indexkey bucket and the daily aggregates in step
+func putLog(tx *bolt.Tx, key []byte, entry *types.LogEntry, val []byte) error {
+	logs := tx.Bucket([]byte(BucketLogs))
+	var replaced *types.LogEntry
+	if old := logs.Get(key); old != nil {
+		var prev types.LogEntry
+		if err := json.Unmarshal(old, &prev); err == nil {
+			if err := addDaily(tx, &prev, true); err != nil {
+				return err
+			}
+			replaced = &prev
+		}
+	} else if err := addLogCount(tx, 1); err != nil {
+		return err
+	}
+	if err := logs.Put(key, val); err != nil {
+		return err
+	}
+	if err := putBlockIndex(tx, key, entry, replaced); err != nil {
+		return err
+	}
+	if err := putTxIndex(tx, key, entry, replaced); err != nil {
+		return err
+	}
+	if err := addDaily(tx, entry, false); err != nil {
+		return err
+	}
+	// With composite keys an overwrite may carry a new index; the flags are keyed by
+	// index, so the replaced entry's must go or they would point at this key
+	if replaced != nil && replaced.Index != entry.Index {
+		if err := setFlag(tx, BucketIncomplete, replaced.Index, key, false); err != nil {
+			return err
+		}
+		if err := setFlag(tx, BucketPending, replaced.Index, key, false); err != nil {
+			return err
+		}
+		if err := setFlag(tx, BucketIndexKey, replaced.Index, key, false); err != nil {
+			return err
+		}
+	}
+	if !bytes.Equal(key, uint64ToBytes(entry.Index)) {
+		if err := setFlag(tx, BucketIndexKey, entry.Index, key, true); err != nil {
+			return err
+		}
+	}
+	if err := setFlag(tx, BucketIncomplete, entry.Index, key, !entry.Enriched); err != nil {
+		return err
+	}
+	return setFlag(tx, BucketPending, entry.Index, key, entry.Pending)
+}
+
+// PutRawLog stores the encoded entry val under key like StoreLog does, keeping the log
+// count, secondary indexes, daily aggregates and flags in step. Other writers to a
+// database that BoltStorage has opened before, such as the bulk indexer appending to
+// its final DB, use it in place of a bare Put into the logs bucket.
+func PutRawLog(tx *bolt.Tx, key, val []byte) error {
+	if tx.Bucket([]byte(BucketLogs)) == nil {
+		return fmt.Errorf("logs bucket missing")
+	}
+	var entry types.LogEntry
+	if err := json.Unmarshal(val, &entry); err != nil {
+		return fmt.Errorf("failed to decode log %x: %w", key, err)
+	}
+	return putLog(tx, key, &entry, val)
+}
+
+// addLogCount adjusts the maintained log count by delta
+func addLogCount(tx *bolt.Tx, delta int64) error {
+	meta := tx.Bucket([]byte(BucketMeta))
+	if meta == nil {
+		return fmt.Errorf("meta bucket missing")
+	}
+	var n uint64
+	if v := meta.Get([]byte(KeyLogCount)); v != nil {
+		n = bytesToUint64(v)
+	}
+	if delta < 0 && uint64(-delta) > n {
+		n = 0
+	} else {
+		n = uint64(int64(n) + delta)
+	}
+	return meta.Put([]byte(KeyLogCount), uint64ToBytes(n))
+}
+
+// setFlag adds index (pointing at key) to the flag bucket when set, or removes it
+func setFlag(tx *bolt.Tx, bucket string, index uint64, key []byte, set bool) error {
+	b := tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+	if set {
+		return b.Put(uint64ToBytes(index), key)
+	}
+	return b.Delete(uint64ToBytes(index))
+}
+
+// PromotePending confirms every pending entry at or below throughBlock, i.e. the ones
+// that have reached the confirmation depth, and returns how many were promoted.
+// Pending entries above a reorg are removed by Rollback like any other.
+func (s *BoltStorage) PromotePending(ctx context.Context, throughBlock uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var promoted uint64
+	err := s.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketLogs))
-		if b == nil {
-			return fmt.Errorf("logs bucket missing")
+		pending := tx.Bucket([]byte(BucketPending))
+		if b == nil || pending == nil {
+			return nil
 		}
-		return b.Put(uint64ToBytes(entry.Index), val)
+
+		var confirmed [][]byte
+		err := pending.ForEach(func(k, logKey []byte) error {
+			v := b.Get(logKey)
+			if v == nil {
+				confirmed = append(confirmed, k)
+				return nil
+			}
+			var le types.LogEntry
+			if err := json.Unmarshal(v, &le); err != nil {
+				return err
+			}
+			if le.BlockNumber > throughBlock {
+				return nil
+			}
+			le.Pending = false
+			val, err := json.Marshal(&le)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(logKey, val); err != nil {
+				return err
+			}
+			confirmed = append(confirmed, k)
+			promoted++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range confirmed {
+			if err := pending.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
 	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to promote pending logs: %w", err)
+	}
+	return promoted, nil
+}
+
+// GetIncompleteLogs returns entries stored with enriched:false from startIndex onward,
+// read through the incomplete flag bucket rather than a scan of every log
+func (s *BoltStorage) GetIncompleteLogs(ctx context.Context, startIndex uint64, limit int) ([]*types.LogEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	results := make([]*types.LogEntry, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketLogs))
+		inc := tx.Bucket([]byte(BucketIncomplete))
+		if b == nil || inc == nil {
+			return nil
+		}
+		c := inc.Cursor()
+		for k, logKey := c.Seek(uint64ToBytes(startIndex)); k != nil; k, logKey = c.Next() {
+			v := b.Get(logKey)
+			if v == nil {
+				continue
+			}
+			var le types.LogEntry
+			if err := json.Unmarshal(v, &le); err != nil {
+				return err
+			}
+			results = append(results, &le)
+			if limit > 0 && len(results) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	return results, err
 }
 
 // GetLog retrieves a single log by index
@@ -101,12 +499,15 @@ func (s *BoltStorage) GetLog(ctx context.Context, index uint64) (*types.LogEntry
 
 	var entry types.LogEntry
 	err := s.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(BucketLogs))
-		if b == nil {
-			return fmt.Errorf("logs bucket missing")
+		c, value, err := s.indexCursor(tx)
+		if err != nil {
+			return err
 		}
-		v := b.Get(uint64ToBytes(index))
-		if v == nil {
+		k, v := c.Seek(uint64ToBytes(index))
+		if k == nil || bytesToUint64(k) != index {
+			return fmt.Errorf("not found")
+		}
+		if v = value(v); v == nil {
 			return fmt.Errorf("not found")
 		}
 		return json.Unmarshal(v, &entry)
@@ -117,24 +518,88 @@ func (s *BoltStorage) GetLog(ctx context.Context, index uint64) (*types.LogEntry
 	return &entry, nil
 }
 
-// GetLogsByRange retrieves logs within a range of indices
-func (s *BoltStorage) GetLogsByRange(ctx context.Context, startIndex, endIndex uint64, limit int) ([]*types.LogEntry, error) {
+// GetLogByPosition retrieves a log by its chain position. This is a direct lookup
+// with CompositeKeys or NaturalKeys. Otherwise a naturalkey bucket built by Reindex is
+// tried first, checking the entry it points at since it is not kept current, before
+// falling back to a scan.
+func (s *BoltStorage) GetLogByPosition(ctx context.Context, blockNumber, logIndex uint64) (*types.LogEntry, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	results := make([]*types.LogEntry, 0, 64)
+	var entry types.LogEntry
 	err := s.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketLogs))
 		if b == nil {
 			return fmt.Errorf("logs bucket missing")
 		}
+		key := naturalKey(blockNumber, logIndex)
+		if s.opts.CompositeKeys {
+			if v := b.Get(key); v != nil {
+				return json.Unmarshal(v, &entry)
+			}
+			return fmt.Errorf("not found")
+		}
+		if nk := tx.Bucket([]byte(BucketNaturalKey)); s.opts.NaturalKeys && nk != nil {
+			if idx := nk.Get(key); idx != nil {
+				if v := b.Get(idx); v != nil {
+					return json.Unmarshal(v, &entry)
+				}
+			}
+			return fmt.Errorf("not found")
+		}
+		if nk := tx.Bucket([]byte(BucketNaturalKey)); nk != nil {
+			if idx := nk.Get(key); idx != nil {
+				if v := b.Get(idx); v != nil {
+					var le types.LogEntry
+					if err := json.Unmarshal(v, &le); err == nil && le.BlockNumber == blockNumber && le.LogIndex == logIndex {
+						entry = le
+						return nil
+					}
+				}
+			}
+		}
 		c := b.Cursor()
-		minKey := uint64ToBytes(startIndex)
-		for k, v := c.Seek(minKey); k != nil; k, v = c.Next() {
-			idx := bytesToUint64(k)
-			if endIndex > 0 && idx > endIndex {
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var le types.LogEntry
+			if err := json.Unmarshal(v, &le); err != nil {
+				continue
+			}
+			if le.BlockNumber == blockNumber && le.LogIndex == logIndex {
+				entry = le
+				return nil
+			}
+		}
+		return fmt.Errorf("not found")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// GetLogsByRange retrieves logs within a range of indices, skipping the first offset of them
+func (s *BoltStorage) GetLogsByRange(ctx context.Context, startIndex, endIndex uint64, offset, limit int) ([]*types.LogEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	results := make([]*types.LogEntry, 0, 64)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c, value, err := s.indexCursor(tx)
+		if err != nil {
+			return err
+		}
+		for k, v := c.Seek(uint64ToBytes(startIndex)); k != nil; k, v = c.Next() {
+			if endIndex > 0 && bytesToUint64(k) > endIndex {
 				break
 			}
+			// The cursor's keys are indices, so skipped entries are not decoded
+			if offset > 0 {
+				offset--
+				continue
+			}
+			if v = value(v); v == nil {
+				continue
+			}
 			var le types.LogEntry
 			if err := json.Unmarshal(v, &le); err != nil {
 				return err
@@ -149,10 +614,70 @@ func (s *BoltStorage) GetLogsByRange(ctx context.Context, startIndex, endIndex u
 	return results, err
 }
 
-// GetLogsByBlockNumber retrieves all logs for a specific block
+// GetLogsAfter returns up to limit logs from index cursor on, in index order, with the
+// cursor of the next page: the index of the first log not returned, or nil when none is
+// left. Unlike a range query with a guessed next index, the next cursor skips index gaps
+// and a full last page does not lead to an empty one.
+func (s *BoltStorage) GetLogsAfter(ctx context.Context, cursor uint64, limit int) ([]*types.LogEntry, *uint64, error) {
+	logs, err := s.GetLogsByRange(ctx, cursor, 0, 0, PageProbe(limit))
+	if err != nil {
+		return nil, nil, err
+	}
+	logs, next := SplitPage(logs, limit)
+	return logs, next, nil
+}
+
+// PageProbe is the number of logs to read for a page of limit: one more, to learn whether
+// another page follows (limit 0 reads everything)
+func PageProbe(limit int) int {
+	if limit <= 0 {
+		return 0
+	}
+	return limit + 1
+}
+
+// SplitPage cuts logs read with PageProbe(limit) to the page and returns the next
+// page's cursor, or nil when logs held no more than the page
+func SplitPage(logs []*types.LogEntry, limit int) ([]*types.LogEntry, *uint64) {
+	if limit <= 0 || len(logs) <= limit {
+		return logs, nil
+	}
+	next := logs[limit].Index
+	return logs[:limit], &next
+}
+
+// CountRange counts logs with startIndex <= index <= endIndex (endIndex 0 = open-ended)
+// without decoding values: the cursor only touches index keys, of the logs bucket or,
+// with CompositeKeys, of the indexkey bucket.
+func (s *BoltStorage) CountRange(ctx context.Context, startIndex, endIndex uint64) (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var count uint64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c, _, err := s.indexCursor(tx)
+		if err != nil {
+			return err
+		}
+		for k, _ := c.Seek(uint64ToBytes(startIndex)); k != nil; k, _ = c.Next() {
+			if endIndex > 0 && bytesToUint64(k) > endIndex {
+				break
+			}
+			count++
+			if count%100000 == 0 {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+// GetLogsByBlockNumber retrieves all logs for a specific block through the block index.
+// Databases opened read-only without one, such as bulk backfill shards, are scanned.
 func (s *BoltStorage) GetLogsByBlockNumber(ctx context.Context, blockNumber uint64) ([]*types.LogEntry, error) {
-	// For BoltDB without secondary indexes, we scan all logs
-	// In a production system, use a database with proper indexing
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -162,6 +687,20 @@ func (s *BoltStorage) GetLogsByBlockNumber(ctx context.Context, blockNumber uint
 		if b == nil {
 			return nil
 		}
+		if bi := tx.Bucket([]byte(BucketBlockIndex)); bi != nil {
+			for _, logKey := range blockLogKeys(bi, blockNumber) {
+				v := b.Get(logKey)
+				if v == nil {
+					continue
+				}
+				var le types.LogEntry
+				if err := json.Unmarshal(v, &le); err != nil {
+					return err
+				}
+				results = append(results, &le)
+			}
+			return nil
+		}
 		c := b.Cursor()
 		for k, v := c.First(); k != nil; k, v = c.Next() {
 			var le types.LogEntry
@@ -177,24 +716,75 @@ func (s *BoltStorage) GetLogsByBlockNumber(ctx context.Context, blockNumber uint
 	return results, err
 }
 
-// GetLogsByTxHash retrieves all logs for a specific transaction
+// GetLogsByTxIndexRange returns the logs of a block emitted by the transactions at
+// positions fromTx through toTx, see filterTxIndexRange
+func (s *BoltStorage) GetLogsByTxIndexRange(ctx context.Context, blockNumber, fromTx, toTx uint64) ([]*types.LogEntry, error) {
+	logs, err := s.GetLogsByBlockNumber(ctx, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	return filterTxIndexRange(logs, fromTx, toTx), nil
+}
+
+// filterTxIndexRange keeps the entries whose transaction position is in [fromTx, toTx]
+// and orders them by transaction position, then log index. Entries whose position is
+// unknown are left out.
+func filterTxIndexRange(logs []*types.LogEntry, fromTx, toTx uint64) []*types.LogEntry {
+	results := make([]*types.LogEntry, 0, len(logs))
+	for _, le := range logs {
+		if pos, ok := le.TxPosition(); ok && pos >= fromTx && pos <= toTx {
+			results = append(results, le)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		pi, _ := results[i].TxPosition()
+		pj, _ := results[j].TxPosition()
+		if pi != pj {
+			return pi < pj
+		}
+		return results[i].LogIndex < results[j].LogIndex
+	})
+	return results
+}
+
+// GetLogsByTxHash retrieves all logs for a specific transaction through the tx index.
+// Databases opened read-only without one, such as bulk backfill shards, are scanned
+// instead. Either way the hash matches case-insensitively and an empty hash matches none.
 func (s *BoltStorage) GetLogsByTxHash(ctx context.Context, txHash string) ([]*types.LogEntry, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	results := make([]*types.LogEntry, 0)
+	// Entries without a tx hash are not indexed, so the scan must not match them either
+	if txHash == "" {
+		return results, nil
+	}
 	err := s.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketLogs))
 		if b == nil {
 			return nil
 		}
+		if ti := tx.Bucket([]byte(BucketTxIndex)); ti != nil {
+			for _, logKey := range txLogKeys(ti, txHash) {
+				v := b.Get(logKey)
+				if v == nil {
+					continue
+				}
+				var le types.LogEntry
+				if err := json.Unmarshal(v, &le); err != nil {
+					return err
+				}
+				results = append(results, &le)
+			}
+			return nil
+		}
 		c := b.Cursor()
 		for k, v := c.First(); k != nil; k, v = c.Next() {
 			var le types.LogEntry
 			if err := json.Unmarshal(v, &le); err != nil {
 				continue
 			}
-			if le.TxHash == txHash {
+			if strings.EqualFold(le.TxHash, txHash) {
 				results = append(results, &le)
 			}
 		}
@@ -203,20 +793,24 @@ func (s *BoltStorage) GetLogsByTxHash(ctx context.Context, txHash string) ([]*ty
 	return results, err
 }
 
-// GetLastIndex returns the next index to assign
+// GetLastIndex returns the next index to assign. With MonotonicIndices that is never
+// below the high-water mark, so indices freed by a rollback are not handed out again.
 func (s *BoltStorage) GetLastIndex(ctx context.Context) (uint64, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	var last uint64 = 0
 	s.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(BucketLogs))
-		if b == nil {
+		if meta := tx.Bucket([]byte(BucketMeta)); s.opts.MonotonicIndices && meta != nil {
+			if v := meta.Get([]byte(KeyNextIndex)); v != nil {
+				last = bytesToUint64(v)
+			}
+		}
+		c, _, err := s.indexCursor(tx)
+		if err != nil {
 			return nil
 		}
-		c := b.Cursor()
-		k, _ := c.Last()
-		if k != nil {
+		if k, _ := c.Last(); k != nil && bytesToUint64(k)+1 > last {
 			last = bytesToUint64(k) + 1
 		}
 		return nil
@@ -224,22 +818,139 @@ func (s *BoltStorage) GetLastIndex(ctx context.Context) (uint64, error) {
 	return last, nil
 }
 
-// GetTotalCount returns the total number of stored logs
+// GetLastBlockNumber returns the block number of the highest-indexed log, or 0 when empty
+func (s *BoltStorage) GetLastBlockNumber(ctx context.Context) (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var last uint64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketLogs))
+		if b == nil {
+			return nil
+		}
+		k, v := b.Cursor().Last()
+		if k == nil {
+			return nil
+		}
+		var le types.LogEntry
+		if err := json.Unmarshal(v, &le); err != nil {
+			return err
+		}
+		last = le.BlockNumber
+		return nil
+	})
+	return last, err
+}
+
+// GetTotalCount returns the total number of stored logs from the count maintained
+// under KeyLogCount
 func (s *BoltStorage) GetTotalCount(ctx context.Context) (uint64, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	var cnt uint64 = 0
 	s.db.View(func(tx *bolt.Tx) error {
+		cnt = logCount(tx)
+		return nil
+	})
+	return cnt, nil
+}
+
+// logCount reads the count maintained under KeyLogCount
+func logCount(tx *bolt.Tx) uint64 {
+	if meta := tx.Bucket([]byte(BucketMeta)); meta != nil {
+		if v := meta.Get([]byte(KeyLogCount)); v != nil {
+			return bytesToUint64(v)
+		}
+	}
+	return 0
+}
+
+// GetIndexRange returns the first and last indexed block and index using cursor
+// First()/Last() only. Block bounds come from the blockmap bucket when populated,
+// otherwise from the first and last log entries.
+func (s *BoltStorage) GetIndexRange(ctx context.Context) (*types.IndexRange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rng := &types.IndexRange{}
+	err := s.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketLogs))
 		if b == nil {
+			return fmt.Errorf("logs bucket missing")
+		}
+		c := b.Cursor()
+		firstKey, firstVal := c.First()
+		if firstKey == nil {
 			return nil
 		}
-		stats := b.Stats()
-		cnt = uint64(stats.KeyN)
+		_, lastVal := c.Last()
+		ic, _, err := s.indexCursor(tx)
+		if err != nil {
+			return err
+		}
+		k, _ := ic.First()
+		rng.FirstIndex = bytesToUint64(k)
+		k, _ = ic.Last()
+		rng.LastIndex = bytesToUint64(k)
+		rng.TotalCount = logCount(tx)
+
+		if bm := tx.Bucket([]byte(BucketBlockMap)); bm != nil {
+			bc := bm.Cursor()
+			if k, _ := bc.First(); k != nil {
+				rng.FirstBlock = bytesToUint64(k)
+				k, _ = bc.Last()
+				rng.LastBlock = bytesToUint64(k)
+				return nil
+			}
+		}
+
+		var first, last types.LogEntry
+		if err := json.Unmarshal(firstVal, &first); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(lastVal, &last); err != nil {
+			return err
+		}
+		rng.FirstBlock = first.BlockNumber
+		rng.LastBlock = last.BlockNumber
 		return nil
 	})
-	return cnt, nil
+	if err != nil {
+		return nil, err
+	}
+	return rng, nil
+}
+
+// GetBatchInfo returns the bulk indexer's batch analytics ordered by batch ID.
+// Databases written by the live indexer have no batch_info bucket and return none.
+func (s *BoltStorage) GetBatchInfo(ctx context.Context) ([]*types.BatchInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var batches []*types.BatchInfo
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketBatchInfo))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var batch types.BatchInfo
+			if err := json.Unmarshal(v, &batch); err != nil {
+				return fmt.Errorf("failed to unmarshal batch %s: %w", k, err)
+			}
+			batches = append(batches, &batch)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys are "batch_<id>", which sort lexically rather than numerically
+	sort.Slice(batches, func(i, j int) bool { return batches[i].BatchID < batches[j].BatchID })
+	return batches, nil
 }
 
 // SaveCheckpoint persists checkpoint data for resuming
@@ -274,7 +985,7 @@ func (s *BoltStorage) GetCheckpoint(ctx context.Context) (*types.CheckpointData,
 		}
 		v := b.Get([]byte("current"))
 		if v == nil {
-			return fmt.Errorf("no checkpoint found")
+			return ErrNoCheckpoint
 		}
 		return json.Unmarshal(v, &checkpoint)
 	})
@@ -284,7 +995,10 @@ func (s *BoltStorage) GetCheckpoint(ctx context.Context) (*types.CheckpointData,
 	return &checkpoint, nil
 }
 
-// StoreBlockHash stores the block hash for a given block number
+// StoreBlockHash stores the block hash for a given block number. Storing the same hash
+// again is a no-op; a different hash for a number that already has one is refused with
+// ErrBlockHashChanged so the old hash survives for reorg handling. Roll back past the
+// block first to replace it.
 func (s *BoltStorage) StoreBlockHash(ctx context.Context, blockNumber uint64, blockHash string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -294,7 +1008,14 @@ func (s *BoltStorage) StoreBlockHash(ctx context.Context, blockNumber uint64, bl
 		if b == nil {
 			return fmt.Errorf("blockmap bucket missing")
 		}
-		return b.Put(uint64ToBytes(blockNumber), []byte(blockHash))
+		key := uint64ToBytes(blockNumber)
+		if existing := b.Get(key); existing != nil {
+			if string(existing) == blockHash {
+				return nil
+			}
+			return fmt.Errorf("%w: block %d stored %s, got %s", ErrBlockHashChanged, blockNumber, existing, blockHash)
+		}
+		return b.Put(key, []byte(blockHash))
 	})
 }
 
@@ -319,32 +1040,319 @@ func (s *BoltStorage) GetBlockHash(ctx context.Context, blockNumber uint64) (str
 	return hash, err
 }
 
+// IterateBlockHashes calls fn for each stored block hash with from <= number <= to, in
+// ascending block order, seeking straight to from. A non-nil error from fn stops the
+// walk and is returned; fn must not call back into the storage.
+func (s *BoltStorage) IterateBlockHashes(ctx context.Context, from, to uint64, fn func(number uint64, hash string) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketBlockMap))
+		if b == nil {
+			return fmt.Errorf("blockmap bucket missing")
+		}
+		c := b.Cursor()
+		for k, v := c.Seek(uint64ToBytes(from)); k != nil; k, v = c.Next() {
+			number := bytesToUint64(k)
+			if number > to {
+				break
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(number, string(v)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // Rollback removes all logs from a given block number onwards
 func (s *BoltStorage) Rollback(ctx context.Context, toBlockNumber uint64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	return s.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(BucketLogs))
-		if b == nil {
-			return nil
+		return rollbackTx(tx, toBlockNumber)
+	})
+}
+
+// RollbackIfLastBlock rolls back like Rollback, but only when the highest indexed
+// block still equals expectedLastBlock. The check and the delete share one
+// transaction, so a stale or mistyped request fails with ErrLastBlockMismatch
+// instead of deleting data it did not expect.
+func (s *BoltStorage) RollbackIfLastBlock(ctx context.Context, toBlockNumber, expectedLastBlock uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		var last uint64
+		if b := tx.Bucket([]byte(BucketLogs)); b != nil {
+			if k, v := b.Cursor().Last(); k != nil {
+				var le types.LogEntry
+				if err := json.Unmarshal(v, &le); err != nil {
+					return err
+				}
+				last = le.BlockNumber
+			}
+		}
+		if last != expectedLastBlock {
+			return fmt.Errorf("%w: expected %d, current %d", ErrLastBlockMismatch, expectedLastBlock, last)
 		}
+		return rollbackTx(tx, toBlockNumber)
+	})
+}
 
-		var keysToDelete [][]byte
-		c := b.Cursor()
-		for k, v := c.First(); k != nil; k, v = c.Next() {
+// rollbackTx deletes every log above toBlockNumber, with its natural key, block and tx
+// index records and any dead letter, and the block hashes recorded above it
+func rollbackTx(tx *bolt.Tx, toBlockNumber uint64) error {
+	if bm := tx.Bucket([]byte(BucketBlockMap)); bm != nil {
+		var stale [][]byte
+		c := bm.Cursor()
+		for k, _ := c.Seek(uint64ToBytes(toBlockNumber + 1)); k != nil; k, _ = c.Next() {
+			stale = append(stale, k)
+		}
+		for _, k := range stale {
+			if err := bm.Delete(k); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := rollbackDeadLetters(tx, toBlockNumber); err != nil {
+		return err
+	}
+	if err := rollbackContracts(tx, toBlockNumber); err != nil {
+		return err
+	}
+	if err := rollbackBlockIndex(tx, toBlockNumber); err != nil {
+		return err
+	}
+
+	b := tx.Bucket([]byte(BucketLogs))
+	if b == nil {
+		return nil
+	}
+
+	nk := tx.Bucket([]byte(BucketNaturalKey))
+	ti := tx.Bucket([]byte(BucketTxIndex))
+	flags := []*bolt.Bucket{tx.Bucket([]byte(BucketIncomplete)), tx.Bucket([]byte(BucketPending)), tx.Bucket([]byte(BucketIndexKey))}
+
+	var keysToDelete, naturalKeysToDelete, indicesToDelete, txKeysToDelete [][]byte
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		var le types.LogEntry
+		if err := json.Unmarshal(v, &le); err != nil {
+			continue
+		}
+		if le.BlockNumber > toBlockNumber {
+			if err := addDaily(tx, &le, true); err != nil {
+				return err
+			}
+			keysToDelete = append(keysToDelete, k)
+			naturalKeysToDelete = append(naturalKeysToDelete, naturalKey(le.BlockNumber, le.LogIndex))
+			indicesToDelete = append(indicesToDelete, uint64ToBytes(le.Index))
+			if key := txIndexKey(le.TxHash, k); key != nil {
+				txKeysToDelete = append(txKeysToDelete, key)
+			}
+		}
+	}
+
+	for _, k := range keysToDelete {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	if err := addLogCount(tx, -int64(len(keysToDelete))); err != nil {
+		return err
+	}
+	if nk != nil {
+		for _, k := range naturalKeysToDelete {
+			if err := nk.Delete(k); err != nil {
+				return err
+			}
+		}
+	}
+	if ti != nil {
+		for _, k := range txKeysToDelete {
+			if err := ti.Delete(k); err != nil {
+				return err
+			}
+		}
+	}
+	for _, flag := range flags {
+		if flag == nil {
+			continue
+		}
+		for _, k := range indicesToDelete {
+			if err := flag.Delete(k); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// secondaryIndex is a bucket derived entirely from the logs bucket. entry returns the
+// key/value a stored log (at logKey) contributes to the index, or a nil key for none.
+type secondaryIndex struct {
+	bucket string
+	entry  func(logKey []byte, le *types.LogEntry) (key, value []byte)
+}
+
+// secondaryIndexes are the buckets Reindex rebuilds
+var secondaryIndexes = []secondaryIndex{
+	{BucketNaturalKey, func(logKey []byte, le *types.LogEntry) ([]byte, []byte) {
+		return naturalKey(le.BlockNumber, le.LogIndex), logKey
+	}},
+	{BucketIncomplete, func(logKey []byte, le *types.LogEntry) ([]byte, []byte) {
+		if le.Enriched {
+			return nil, nil
+		}
+		return uint64ToBytes(le.Index), logKey
+	}},
+	{BucketPending, func(logKey []byte, le *types.LogEntry) ([]byte, []byte) {
+		if !le.Pending {
+			return nil, nil
+		}
+		return uint64ToBytes(le.Index), logKey
+	}},
+	{BucketBlockIndex, func(logKey []byte, le *types.LogEntry) ([]byte, []byte) {
+		return blockIndexKey(le.BlockNumber, logKey), logKey
+	}},
+	{BucketIndexKey, func(logKey []byte, le *types.LogEntry) ([]byte, []byte) {
+		if bytes.Equal(logKey, uint64ToBytes(le.Index)) {
+			return nil, nil
+		}
+		return uint64ToBytes(le.Index), logKey
+	}},
+	{BucketTxIndex, func(logKey []byte, le *types.LogEntry) ([]byte, []byte) {
+		return txIndexKey(le.TxHash, logKey), logKey
+	}},
+}
+
+// buildMissingIndexes creates those of the named secondary indexes that do not exist yet
+// and fills them with one scan of the logs bucket, so a database written before an index
+// was added gets it on first open
+func buildMissingIndexes(tx *bolt.Tx, names ...string) error {
+	var missing []secondaryIndex
+	var buckets []*bolt.Bucket
+	for _, idx := range secondaryIndexes {
+		if !slices.Contains(names, idx.bucket) || tx.Bucket([]byte(idx.bucket)) != nil {
+			continue
+		}
+		b, err := tx.CreateBucket([]byte(idx.bucket))
+		if err != nil {
+			return err
+		}
+		missing = append(missing, idx)
+		buckets = append(buckets, b)
+	}
+	logs := tx.Bucket([]byte(BucketLogs))
+	if len(missing) == 0 || logs == nil {
+		return nil
+	}
+	return logs.ForEach(func(k, v []byte) error {
+		var le types.LogEntry
+		if err := json.Unmarshal(v, &le); err != nil {
+			return nil // undecodable entries are skipped, as by Reindex
+		}
+		for i, idx := range missing {
+			if key, value := idx.entry(k, &le); key != nil {
+				if err := buckets[i].Put(key, value); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Reindex rebuilds every secondary-index bucket with a single scan of the logs bucket,
+// e.g. for databases written by the bulk indexer before the indexes existed. Buckets are
+// recreated from scratch, so re-running it is safe.
+func (s *BoltStorage) Reindex(ctx context.Context) (*types.ReindexResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &types.ReindexResult{}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		indexBuckets := make([]*bolt.Bucket, len(secondaryIndexes))
+		for i, idx := range secondaryIndexes {
+			if err := tx.DeleteBucket([]byte(idx.bucket)); err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+			b, err := tx.CreateBucket([]byte(idx.bucket))
+			if err != nil {
+				return err
+			}
+			indexBuckets[i] = b
+			result.Buckets = append(result.Buckets, idx.bucket)
+		}
+		if err := tx.DeleteBucket([]byte(BucketDaily)); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		if _, err := tx.CreateBucket([]byte(BucketDaily)); err != nil {
+			return err
+		}
+		result.Buckets = append(result.Buckets, BucketDaily)
+
+		logs := tx.Bucket([]byte(BucketLogs))
+		if logs == nil {
+			return nil
+		}
+		err := logs.ForEach(func(k, v []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			var le types.LogEntry
 			if err := json.Unmarshal(v, &le); err != nil {
-				continue
+				result.Skipped++
+				return nil
 			}
-			if le.BlockNumber > toBlockNumber {
-				keysToDelete = append(keysToDelete, k)
+			for i, idx := range secondaryIndexes {
+				key, value := idx.entry(k, &le)
+				if key == nil {
+					continue
+				}
+				if err := indexBuckets[i].Put(key, value); err != nil {
+					return err
+				}
 			}
+			if err := addDaily(tx, &le, false); err != nil {
+				return err
+			}
+			result.Scanned++
+			return nil
+		})
+		if err != nil {
+			return err
 		}
+		// The scan has seen every key, so the maintained count is reset from it too
+		count := result.Scanned + result.Skipped
+		return tx.Bucket([]byte(BucketMeta)).Put([]byte(KeyLogCount), uint64ToBytes(count))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reindex failed: %w", err)
+	}
+	return result, nil
+}
 
-		for _, k := range keysToDelete {
-			if err := b.Delete(k); err != nil {
-				return err
+// Ping checks that the database is open and readable and that the buckets the
+// indexer relies on exist
+func (s *BoltStorage) Ping(ctx context.Context) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ping(BucketLogs, BucketMeta, BucketCheckpoint)
+}
+
+func (s *BoltStorage) ping(buckets ...string) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		for _, name := range buckets {
+			if tx.Bucket([]byte(name)) == nil {
+				return fmt.Errorf("%s bucket missing", name)
 			}
 		}
 		return nil
@@ -368,3 +1376,30 @@ func uint64ToBytes(n uint64) []byte {
 func bytesToUint64(b []byte) uint64 {
 	return binary.BigEndian.Uint64(b)
 }
+
+// indexCursor returns a cursor over stored logs in index order, whose keys are indices,
+// and value, which turns a cursor value into the encoded entry (nil if it is gone). That
+// is the logs bucket itself unless CompositeKeys is set, in which case it is the indexkey
+// bucket, whose values are log keys.
+func (s *BoltStorage) indexCursor(tx *bolt.Tx) (*bolt.Cursor, func(v []byte) []byte, error) {
+	logs := tx.Bucket([]byte(BucketLogs))
+	if logs == nil {
+		return nil, nil, fmt.Errorf("logs bucket missing")
+	}
+	if !s.opts.CompositeKeys {
+		return logs.Cursor(), func(v []byte) []byte { return v }, nil
+	}
+	ik := tx.Bucket([]byte(BucketIndexKey))
+	if ik == nil {
+		return nil, nil, fmt.Errorf("indexkey bucket missing")
+	}
+	return ik.Cursor(), logs.Get, nil
+}
+
+// naturalKey encodes blockNumber (8 bytes) | logIndex (4 bytes) so keys sort in chain order
+func naturalKey(blockNumber, logIndex uint64) []byte {
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint64(b, blockNumber)
+	binary.BigEndian.PutUint32(b[8:], uint32(logIndex))
+	return b
+}
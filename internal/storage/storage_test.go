@@ -0,0 +1,649 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"example/hello/pkg/types"
+
+	bolt "github.com/boltdb/bolt"
+)
+
+// newTestStorage opens a BoltStorage on a fresh file in the test's temp dir
+func newTestStorage(t *testing.T, opts Options) *BoltStorage {
+	t.Helper()
+	s, err := NewBoltStorageWithOptions(filepath.Join(t.TempDir(), "test.db"), opts)
+	if err != nil {
+		t.Fatalf("open storage: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// storeLogs stores entries, failing the test on the first error
+func storeLogs(t *testing.T, s Storage, entries ...*types.LogEntry) {
+	t.Helper()
+	for _, e := range entries {
+		if err := s.StoreLog(context.Background(), e); err != nil {
+			t.Fatalf("store %d: %v", e.Index, err)
+		}
+	}
+}
+
+// indices returns the index of every entry, in order
+func indices(entries []*types.LogEntry) []uint64 {
+	out := make([]uint64, len(entries))
+	for i, e := range entries {
+		out[i] = e.Index
+	}
+	return out
+}
+
+func TestCompositeOverwriteMovesFlags(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, Options{CompositeKeys: true})
+
+	storeLogs(t, s,
+		&types.LogEntry{Index: 5, BlockNumber: 1, LogIndex: 0, Pending: true},
+		&types.LogEntry{Index: 7, BlockNumber: 1, LogIndex: 0, Pending: true},
+	)
+
+	incomplete, err := s.GetIncompleteLogs(ctx, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(indices(incomplete), []uint64{7}) {
+		t.Errorf("incomplete = %v, want [7]", indices(incomplete))
+	}
+
+	promoted, err := s.PromotePending(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if promoted != 1 {
+		t.Errorf("promoted %d entries, want 1", promoted)
+	}
+}
+
+func TestPutRawLogKeepsCountAndIndexes(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "final.db")
+	s, err := NewBoltStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storeLogs(t, s, &types.LogEntry{Index: 0, BlockNumber: 1, TxHash: "0xAA", Enriched: true})
+	s.Close()
+
+	// Append behind the service's back, as the bulk indexer does
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	val, _ := json.Marshal(&types.LogEntry{Index: 1, BlockNumber: 2, TxHash: "0xBB", Enriched: true})
+	err = db.Update(func(tx *bolt.Tx) error {
+		return PutRawLog(tx, uint64ToBytes(1), val)
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewBoltStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if n, _ := s.GetTotalCount(ctx); n != 2 {
+		t.Errorf("count = %d, want 2", n)
+	}
+	byBlock, err := s.GetLogsByBlockNumber(ctx, 2)
+	if err != nil || !slices.Equal(indices(byBlock), []uint64{1}) {
+		t.Errorf("block 2 = %v (%v), want [1]", indices(byBlock), err)
+	}
+	byTx, err := s.GetLogsByTxHash(ctx, "0xbb")
+	if err != nil || !slices.Equal(indices(byTx), []uint64{1}) {
+		t.Errorf("tx 0xbb = %v (%v), want [1]", indices(byTx), err)
+	}
+}
+
+// scanCount counts the logs bucket the slow way
+func scanCount(t *testing.T, s *BoltStorage) uint64 {
+	t.Helper()
+	var n int
+	s.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket([]byte(BucketLogs)).Stats().KeyN
+		return nil
+	})
+	return uint64(n)
+}
+
+func TestLogCountMatchesScan(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, Options{})
+
+	for i := uint64(0); i < 10; i++ {
+		storeLogs(t, s, &types.LogEntry{Index: i, BlockNumber: 100 + i/2, Enriched: true})
+	}
+	// Overwrites do not change the count
+	storeLogs(t, s, &types.LogEntry{Index: 3, BlockNumber: 101, Enriched: true})
+	if err := s.Rollback(ctx, 102); err != nil {
+		t.Fatal(err)
+	}
+	storeLogs(t, s, &types.LogEntry{Index: 6, BlockNumber: 103, Enriched: true})
+	if err := s.Rollback(ctx, 99); err != nil {
+		t.Fatal(err)
+	}
+	storeLogs(t, s, &types.LogEntry{Index: 0, BlockNumber: 100, Enriched: true})
+
+	want := scanCount(t, s)
+	if want != 1 {
+		t.Fatalf("scan found %d entries, want 1", want)
+	}
+	if n, _ := s.GetTotalCount(ctx); n != want {
+		t.Errorf("GetTotalCount = %d, scan = %d", n, want)
+	}
+	rng, err := s.GetIndexRange(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rng.TotalCount != want {
+		t.Errorf("GetIndexRange count = %d, scan = %d", rng.TotalCount, want)
+	}
+}
+
+func TestTxHashLookupAgreesWithScan(t *testing.T) {
+	ctx := context.Background()
+	entries := []*types.LogEntry{
+		{Index: 0, BlockNumber: 1, TxHash: "0xAbC"},
+		{Index: 1, BlockNumber: 1},
+	}
+
+	indexed := newTestStorage(t, Options{})
+	storeLogs(t, indexed, entries...)
+
+	// A bulk worker DB: a bare logs bucket, opened read-only like a shard
+	path := filepath.Join(t.TempDir(), "shard.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(BucketLogs))
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			val, _ := json.Marshal(e)
+			if err := b.Put(uint64ToBytes(e.Index), val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err = bolt.Open(path, 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanned := &BoltStorage{db: db}
+	defer scanned.Close()
+
+	for hash, want := range map[string][]uint64{"0xabc": {0}, "0xABC": {0}, "": {}} {
+		for name, s := range map[string]*BoltStorage{"index": indexed, "scan": scanned} {
+			got, err := s.GetLogsByTxHash(ctx, hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(indices(got), want) {
+				t.Errorf("%s: tx %q = %v, want %v", name, hash, indices(got), want)
+			}
+		}
+	}
+}
+
+func TestUpsertPolicyOnRerun(t *testing.T) {
+	ctx := context.Background()
+	first := &types.LogEntry{Index: 0, BlockNumber: 5, LogIndex: 1, TxHash: "0xaa"}
+
+	for _, tc := range []struct {
+		policy  UpsertPolicy
+		wantErr bool
+		wantTx  string
+	}{
+		{UpsertOverwrite, false, "0xbb"},
+		{UpsertSkip, false, "0xaa"},
+		{UpsertError, true, "0xaa"},
+	} {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			s := newTestStorage(t, Options{NaturalKeys: true, UpsertPolicy: tc.policy})
+			storeLogs(t, s, first)
+
+			// A rerun numbered the same log differently
+			err := s.StoreLog(ctx, &types.LogEntry{Index: 9, BlockNumber: 5, LogIndex: 1, TxHash: "0xbb"})
+			if tc.wantErr != errors.Is(err, ErrDuplicateLog) || (!tc.wantErr && err != nil) {
+				t.Fatalf("re-store error = %v, want ErrDuplicateLog: %v", err, tc.wantErr)
+			}
+
+			got, err := s.GetLogByPosition(ctx, 5, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Index != 0 || got.TxHash != tc.wantTx {
+				t.Errorf("stored log = index %d tx %s, want index 0 tx %s", got.Index, got.TxHash, tc.wantTx)
+			}
+			if n, _ := s.GetTotalCount(ctx); n != 1 {
+				t.Errorf("count = %d, want 1", n)
+			}
+			if _, err := s.GetLog(ctx, 9); err == nil {
+				t.Error("the rerun's index 9 was stored as a second entry")
+			}
+		})
+	}
+
+	if _, err := ParseUpsertPolicy("replace"); err == nil {
+		t.Error(`ParseUpsertPolicy("replace") passed`)
+	}
+}
+
+// bucketKeys counts the keys in a bucket, 0 when it does not exist
+func TestMonotonicIndicesSurviveReorg(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, Options{MonotonicIndices: true})
+	for i := uint64(0); i < 5; i++ {
+		storeLogs(t, s, &types.LogEntry{Index: i, BlockNumber: 10 + i, BlockHash: "0xold"})
+	}
+
+	// Blocks 13 and 14 are reorged out; their indices 3 and 4 are abandoned
+	if err := s.Rollback(ctx, 12); err != nil {
+		t.Fatal(err)
+	}
+	next, err := s.GetLastIndex(ctx)
+	if err != nil || next != 5 {
+		t.Fatalf("next index after rollback = %d, %v; want 5, not the freed 3", next, err)
+	}
+	if err := s.StoreLog(ctx, &types.LogEntry{Index: 3, BlockNumber: 13, BlockHash: "0xnew"}); !errors.Is(err, ErrIndexReused) {
+		t.Errorf("storing the freed index 3 returned %v, want ErrIndexReused", err)
+	}
+
+	// The new canonical logs get fresh numbers and still resolve by chain position
+	storeLogs(t, s,
+		&types.LogEntry{Index: 5, BlockNumber: 13, BlockHash: "0xnew"},
+		&types.LogEntry{Index: 6, BlockNumber: 14, BlockHash: "0xnew"},
+	)
+	if e, err := s.GetLogByPosition(ctx, 13, 0); err != nil || e.Index != 5 || e.BlockHash != "0xnew" {
+		t.Errorf("block 13 log 0 = %+v, %v; want the new log at index 5", e, err)
+	}
+	if _, err := s.GetLog(ctx, 3); err == nil {
+		t.Error("abandoned index 3 still resolves")
+	}
+	logs, err := s.GetLogsByRange(ctx, 0, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{0, 1, 2, 5, 6}; !slices.Equal(indices(logs), want) {
+		t.Errorf("indices after the reorg = %v, want %v", indices(logs), want)
+	}
+}
+
+func TestChangedBlockHashSignalsReorg(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, Options{})
+	for n := uint64(10); n <= 12; n++ {
+		if err := s.StoreBlockHash(ctx, n, fmt.Sprintf("0xold%d", n)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.StoreBlockHash(ctx, 11, "0xold11"); err != nil {
+		t.Errorf("re-storing the same hash: %v", err)
+	}
+	if err := s.StoreBlockHash(ctx, 11, "0xnew11"); !errors.Is(err, ErrBlockHashChanged) {
+		t.Errorf("storing a changed hash for block 11 returned %v, want ErrBlockHashChanged", err)
+	}
+	if h, _ := s.GetBlockHash(ctx, 11); h != "0xold11" {
+		t.Errorf("block 11 hash = %s after the refused store, want the old one kept", h)
+	}
+
+	// Handling the reorg rolls back past the block, after which the new hash is accepted
+	if err := s.Rollback(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StoreBlockHash(ctx, 11, "0xnew11"); err != nil {
+		t.Errorf("storing the new hash after rollback: %v", err)
+	}
+	if h, _ := s.GetBlockHash(ctx, 10); h != "0xold10" {
+		t.Errorf("block 10 hash = %s, want it untouched by the rollback", h)
+	}
+}
+
+func TestLogByPositionUsesKeyLookup(t *testing.T) {
+	ctx := context.Background()
+	for _, opts := range []Options{{NaturalKeys: true}, {CompositeKeys: true}} {
+		s := newTestStorage(t, opts)
+		storeLogs(t, s,
+			&types.LogEntry{Index: 5, BlockNumber: 7, LogIndex: 1},
+			&types.LogEntry{Index: 6, BlockNumber: 7, LogIndex: 2, TxHash: "0xwanted"},
+		)
+		// A decoy sorting first in the logs bucket is what a scan would find; the keyed
+		// lookup never looks at it
+		decoy, _ := json.Marshal(&types.LogEntry{Index: 0, BlockNumber: 7, LogIndex: 2, TxHash: "0xdecoy"})
+		if err := s.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket([]byte(BucketLogs)).Put([]byte{0}, decoy)
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		e, err := s.GetLogByPosition(ctx, 7, 2)
+		if err != nil || e.TxHash != "0xwanted" {
+			t.Errorf("%+v: block 7 log 2 = %+v, %v; want the keyed entry", opts, e, err)
+		}
+		if _, err := s.GetLogByPosition(ctx, 7, 3); err == nil {
+			t.Errorf("%+v: block 7 log 3 was found", opts)
+		}
+	}
+}
+
+func bucketKeys(s *BoltStorage, name string) int {
+	var n int
+	s.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(name)); b != nil {
+			n = b.Stats().KeyN
+		}
+		return nil
+	})
+	return n
+}
+
+func TestReindexLogsOnlyDatabase(t *testing.T) {
+	ctx := context.Background()
+	entries := []*types.LogEntry{
+		{Index: 0, BlockNumber: 10, LogIndex: 0, TxHash: "0xaa", Enriched: true},
+		{Index: 1, BlockNumber: 10, LogIndex: 1, TxHash: "0xaa", Enriched: true},
+		{Index: 2, BlockNumber: 11, LogIndex: 0, TxHash: "0xbb"},
+		{Index: 3, BlockNumber: 12, LogIndex: 4, TxHash: "0xcc", Enriched: true},
+	}
+
+	// What the bulk indexer writes: a logs bucket and nothing else
+	path := filepath.Join(t.TempDir(), "backfill.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(BucketLogs))
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			val, _ := json.Marshal(e)
+			if err := b.Put(uint64ToBytes(e.Index), val); err != nil {
+				return err
+			}
+		}
+		return b.Put(uint64ToBytes(4), []byte("not json"))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Opened for writing as logs -reindex does
+	s, err := NewBoltStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if n := bucketKeys(s, BucketNaturalKey); n != 0 {
+		t.Fatalf("naturalkey bucket has %d keys before Reindex, want 0", n)
+	}
+
+	wantKeys := map[string]int{
+		BucketNaturalKey: 4,
+		BucketBlockIndex: 4,
+		BucketTxIndex:    4,
+		BucketIncomplete: 1,
+		BucketPending:    0,
+	}
+	for run := 1; run <= 2; run++ {
+		result, err := s.Reindex(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Scanned != 4 || result.Skipped != 1 {
+			t.Errorf("run %d: scanned %d skipped %d, want 4 and 1", run, result.Scanned, result.Skipped)
+		}
+		for name, want := range wantKeys {
+			if n := bucketKeys(s, name); n != want {
+				t.Errorf("run %d: %s has %d keys, want %d", run, name, n, want)
+			}
+		}
+	}
+
+	got, err := s.GetLogByPosition(ctx, 12, 4)
+	if err != nil || got.Index != 3 {
+		t.Errorf("position 12/4 = %+v (%v), want index 3", got, err)
+	}
+	byBlock, err := s.GetLogsByBlockNumber(ctx, 10)
+	if err != nil || !slices.Equal(indices(byBlock), []uint64{0, 1}) {
+		t.Errorf("block 10 = %v (%v), want [0 1]", indices(byBlock), err)
+	}
+	byTx, err := s.GetLogsByTxHash(ctx, "0xbb")
+	if err != nil || !slices.Equal(indices(byTx), []uint64{2}) {
+		t.Errorf("tx 0xbb = %v (%v), want [2]", indices(byTx), err)
+	}
+}
+
+func TestCompositeKeysInterleaveEventTypes(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, Options{CompositeKeys: true})
+
+	// Each event type is indexed in its own pass, so indices are handed out per type:
+	// Transfers get 0-2 and Approvals 3-4, out of step with chain order
+	type pos struct{ block, logIndex uint64 }
+	passes := []struct {
+		name      string
+		positions []pos
+	}{
+		{"Transfer", []pos{{9, 5}, {10, 3}, {12, 0}}},
+		{"Approval", []pos{{10, 1}, {11, 0}}},
+	}
+	var next uint64
+	for _, pass := range passes {
+		for _, p := range pass.positions {
+			storeLogs(t, s, &types.LogEntry{Index: next, BlockNumber: p.block, LogIndex: p.logIndex, EventName: pass.name, Enriched: true})
+			next++
+		}
+	}
+
+	// The logs bucket itself is in chain order across both types
+	var order []pos
+	s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(BucketLogs)).ForEach(func(k, v []byte) error {
+			var e types.LogEntry
+			json.Unmarshal(v, &e)
+			order = append(order, pos{e.BlockNumber, e.LogIndex})
+			return nil
+		})
+	})
+	if want := []pos{{9, 5}, {10, 1}, {10, 3}, {11, 0}, {12, 0}}; !slices.Equal(order, want) {
+		t.Errorf("logs bucket holds %v, want chain order %v", order, want)
+	}
+	if block10, _ := s.GetLogsByBlockNumber(ctx, 10); !slices.Equal(indices(block10), []uint64{3, 1}) {
+		t.Errorf("block 10 = %v, want the Approval (3) before the Transfer (1)", indices(block10))
+	}
+	e, err := s.GetLogByPosition(ctx, 10, 1)
+	if err != nil || e.EventName != "Approval" || e.Index != 3 {
+		t.Errorf("position 10/1 = %+v (%v), want the Approval at index 3", e, err)
+	}
+
+	// Index lookups do not depend on indices following chain order
+	for i, want := range []pos{{9, 5}, {10, 3}, {12, 0}, {10, 1}, {11, 0}} {
+		if e, err := s.GetLog(ctx, uint64(i)); err != nil || (pos{e.BlockNumber, e.LogIndex}) != want {
+			t.Errorf("index %d = %+v (%v), want the log at %v", i, e, err, want)
+		}
+	}
+	transfers, err := s.GetLogsByRange(ctx, 0, 2, 0, 0)
+	if err != nil || !slices.Equal(indices(transfers), []uint64{0, 1, 2}) {
+		t.Errorf("range 0-2 = %v (%v), want [0 1 2]", indices(transfers), err)
+	}
+	if n, _ := s.CountRange(ctx, 0, 2); n != uint64(len(transfers)) {
+		t.Errorf("count of 0-2 is %d, range returned %d", n, len(transfers))
+	}
+	if page, _ := s.GetLogsByRange(ctx, 1, 0, 2, 2); !slices.Equal(indices(page), []uint64{3, 4}) {
+		t.Errorf("offset 2 from index 1 = %v, want [3 4]", indices(page))
+	}
+	if last, _ := s.GetLastIndex(ctx); last != 5 {
+		t.Errorf("next index %d, want 5 past the last Approval", last)
+	}
+	if rng, err := s.GetIndexRange(ctx); err != nil || rng.FirstIndex != 0 || rng.LastIndex != 4 {
+		t.Errorf("index range %+v (%v), want 0-4", rng, err)
+	}
+
+	// A rollback drops the index lookups of the logs it removes
+	if err := s.Rollback(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetLog(ctx, 4); err == nil {
+		t.Error("index 4 (block 11) still found after rolling back to block 10")
+	}
+	if last, _ := s.GetLastIndex(ctx); last != 4 {
+		t.Errorf("next index after rollback %d, want 4 after the Approval at block 10", last)
+	}
+}
+
+func TestIterateBlockHashesRange(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, Options{})
+	// Gaps and numbers past 255 check the keys sort numerically
+	for _, n := range []uint64{5, 6, 8, 255, 256, 300} {
+		if err := s.StoreBlockHash(ctx, n, fmt.Sprintf("0x%x", n)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []uint64
+	err := s.IterateBlockHashes(ctx, 6, 256, func(number uint64, hash string) error {
+		if want := fmt.Sprintf("0x%x", number); hash != want {
+			t.Errorf("block %d hash %s, want %s", number, hash, want)
+		}
+		got = append(got, number)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, []uint64{6, 8, 255, 256}) {
+		t.Errorf("visited %v, want [6 8 255 256]", got)
+	}
+
+	// An error from fn stops the walk and comes back unchanged
+	stop := errors.New("mismatch")
+	got = nil
+	err = s.IterateBlockHashes(ctx, 0, 1000, func(number uint64, hash string) error {
+		got = append(got, number)
+		if number == 8 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || !slices.Equal(got, []uint64{5, 6, 8}) {
+		t.Errorf("stopped walk visited %v and returned %v, want [5 6 8] and %v", got, err, stop)
+	}
+}
+
+func TestPagingAcrossIndexGaps(t *testing.T) {
+	ctx := context.Background()
+	for _, composite := range []bool{false, true} {
+		s := newTestStorage(t, Options{CompositeKeys: composite})
+		for _, i := range []uint64{2, 3, 7, 8, 9, 15} {
+			storeLogs(t, s, &types.LogEntry{Index: i, BlockNumber: i, Enriched: true})
+		}
+
+		// offset counts stored entries, not index values
+		for _, tc := range []struct {
+			start, end    uint64
+			offset, limit int
+			want          []uint64
+		}{
+			{0, 0, 2, 0, []uint64{7, 8, 9, 15}},
+			{3, 0, 1, 2, []uint64{7, 8}},
+			{0, 9, 3, 0, []uint64{8, 9}},
+			{0, 9, 5, 0, []uint64{}},
+			{4, 6, 0, 0, []uint64{}},
+		} {
+			page, err := s.GetLogsByRange(ctx, tc.start, tc.end, tc.offset, tc.limit)
+			if err != nil || !slices.Equal(indices(page), tc.want) {
+				t.Errorf("composite=%v range %d-%d offset %d limit %d = %v (%v), want %v",
+					composite, tc.start, tc.end, tc.offset, tc.limit, indices(page), err, tc.want)
+			}
+		}
+
+		// Each cursor is the next stored index, so the gaps 4-6 and 10-14 are never paged through
+		var got, cursors []uint64
+		for cursor := uint64(0); ; {
+			page, next, err := s.GetLogsAfter(ctx, cursor, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, indices(page)...)
+			if next == nil {
+				break
+			}
+			cursors = append(cursors, *next)
+			cursor = *next
+		}
+		if !slices.Equal(got, []uint64{2, 3, 7, 8, 9, 15}) || !slices.Equal(cursors, []uint64{7, 9}) {
+			t.Errorf("composite=%v cursor walk = %v via cursors %v, want every entry via [7 9]", composite, got, cursors)
+		}
+	}
+}
+
+// benchmarkStore fills a store with n logs for the range benchmarks
+func benchmarkStore(b *testing.B, n int) *BoltStorage {
+	b.Helper()
+	s, err := NewBoltStorageWithOptions(filepath.Join(b.TempDir(), "bench.db"), Options{})
+	if err != nil {
+		b.Fatalf("open storage: %v", err)
+	}
+	b.Cleanup(func() { s.Close() })
+	entries := make([]*types.LogEntry, n)
+	for i := range entries {
+		entries[i] = &types.LogEntry{Index: uint64(i), BlockNumber: uint64(i / 4), Enriched: true}
+	}
+	if err := s.StoreLogs(context.Background(), entries); err != nil {
+		b.Fatal(err)
+	}
+	return s
+}
+
+// BenchmarkCountRange compares CountRange with fetching the range and taking its length,
+// which is what /v1/logs/count replaces
+func BenchmarkCountRange(b *testing.B) {
+	ctx := context.Background()
+	s := benchmarkStore(b, 20000)
+
+	b.Run("CountRange", func(b *testing.B) {
+		for range b.N {
+			if n, err := s.CountRange(ctx, 1000, 18999); err != nil || n != 18000 {
+				b.Fatalf("CountRange = %d, %v", n, err)
+			}
+		}
+	})
+	b.Run("GetLogsByRange", func(b *testing.B) {
+		for range b.N {
+			logs, err := s.GetLogsByRange(ctx, 1000, 18999, 0, 0)
+			if err != nil || len(logs) != 18000 {
+				b.Fatalf("GetLogsByRange = %d, %v", len(logs), err)
+			}
+		}
+	})
+}
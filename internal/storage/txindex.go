@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"bytes"
+	"strings"
+
+	"example/hello/pkg/types"
+
+	bolt "github.com/boltdb/bolt"
+)
+
+// BucketTxIndex lists the logs emitted by each transaction. Keys are the lowercase tx
+// hash, a '|' and the entry's key in the logs bucket, values the logs bucket key alone.
+// A key per entry means a transaction with several logs has several keys, and storing
+// the same entry again rewrites its key instead of adding a second one.
+const BucketTxIndex = "txindex"
+
+// txIndexPrefix returns the key prefix shared by a transaction's entries
+func txIndexPrefix(txHash string) []byte {
+	return []byte(strings.ToLower(txHash) + "|")
+}
+
+// txIndexKey returns the tx index key of the entry stored under logKey, or nil for an
+// entry without a tx hash
+func txIndexKey(txHash string, logKey []byte) []byte {
+	if txHash == "" {
+		return nil
+	}
+	return append(txIndexPrefix(txHash), logKey...)
+}
+
+// putTxIndex records the entry at logKey under its transaction, dropping the record
+// under the transaction of prev, the entry it replaces, when that differs
+func putTxIndex(tx *bolt.Tx, logKey []byte, entry, prev *types.LogEntry) error {
+	b := tx.Bucket([]byte(BucketTxIndex))
+	if b == nil {
+		return nil
+	}
+	if prev != nil && !strings.EqualFold(prev.TxHash, entry.TxHash) {
+		if key := txIndexKey(prev.TxHash, logKey); key != nil {
+			if err := b.Delete(key); err != nil {
+				return err
+			}
+		}
+	}
+	if key := txIndexKey(entry.TxHash, logKey); key != nil {
+		return b.Put(key, logKey)
+	}
+	return nil
+}
+
+// txLogKeys returns the logs bucket keys recorded for txHash
+func txLogKeys(b *bolt.Bucket, txHash string) [][]byte {
+	prefix := txIndexPrefix(txHash)
+	var keys [][]byte
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		keys = append(keys, v)
+	}
+	return keys
+}
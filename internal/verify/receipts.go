@@ -0,0 +1,69 @@
+// Package verify checks indexed logs against the commitments in their block header
+package verify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+var (
+	// ErrReceiptsRoot is returned when a block's receipts do not hash to its receiptsRoot
+	ErrReceiptsRoot = errors.New("receipts do not match the block's receiptsRoot")
+	// ErrLogsBloom is returned when a block's receipts do not combine to its logsBloom
+	ErrLogsBloom = errors.New("receipts do not match the block's logsBloom")
+	// ErrLogMismatch is returned when a log is missing from, or differs from, the receipts
+	ErrLogMismatch = errors.New("log does not match the block's receipts")
+)
+
+// Receipts checks a block's complete receipt list against its header: the receipts
+// trie must hash to ReceiptHash and the combined bloom must equal Bloom. Receipts that
+// pass are exactly the ones the canonical header commits to.
+func Receipts(header *types.Header, receipts []*types.Receipt) error {
+	root := types.DeriveSha(types.Receipts(receipts), trie.NewStackTrie(nil))
+	if root != header.ReceiptHash {
+		return fmt.Errorf("%w: block %d derives %s, header has %s",
+			ErrReceiptsRoot, header.Number, root.Hex(), header.ReceiptHash.Hex())
+	}
+	if bloom := types.CreateBloom(types.Receipts(receipts)); bloom != header.Bloom {
+		return fmt.Errorf("%w: block %d", ErrLogsBloom, header.Number)
+	}
+	return nil
+}
+
+// Log checks that l appears unchanged in receipts that passed Receipts, found by its
+// transaction hash and block-wide log index
+func Log(receipts []*types.Receipt, l *types.Log) error {
+	for _, r := range receipts {
+		if r.TxHash != l.TxHash {
+			continue
+		}
+		for _, rl := range r.Logs {
+			if rl.Index != l.Index {
+				continue
+			}
+			if rl.Address != l.Address || !bytes.Equal(rl.Data, l.Data) || !equalTopics(rl.Topics, l.Topics) {
+				return fmt.Errorf("%w: tx %s log %d differs", ErrLogMismatch, l.TxHash.Hex(), l.Index)
+			}
+			return nil
+		}
+		break
+	}
+	return fmt.Errorf("%w: tx %s has no log %d", ErrLogMismatch, l.TxHash.Hex(), l.Index)
+}
+
+func equalTopics(a, b []common.Hash) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package verify
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// testBlock returns two receipts of one log each and a header committing to them
+func testBlock() (*types.Header, []*types.Receipt) {
+	var receipts []*types.Receipt
+	for i := 0; i < 2; i++ {
+		tx := common.BigToHash(big.NewInt(int64(100 + i)))
+		r := &types.Receipt{
+			Status:            types.ReceiptStatusSuccessful,
+			CumulativeGasUsed: uint64(21_000 * (i + 1)),
+			TxHash:            tx,
+			Logs: []*types.Log{{
+				Address: common.HexToAddress("0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"),
+				Topics:  []common.Hash{common.HexToHash("0xddf252ad"), common.BigToHash(big.NewInt(int64(i)))},
+				Data:    []byte{byte(i), 1, 2, 3},
+				TxHash:  tx,
+				Index:   uint(i),
+			}},
+		}
+		r.Bloom = types.CreateBloom(types.Receipts{r})
+		receipts = append(receipts, r)
+	}
+	header := &types.Header{
+		Number:      big.NewInt(7),
+		ReceiptHash: types.DeriveSha(types.Receipts(receipts), trie.NewStackTrie(nil)),
+		Bloom:       types.CreateBloom(types.Receipts(receipts)),
+	}
+	return header, receipts
+}
+
+func TestTamperedLogFailsVerification(t *testing.T) {
+	header, receipts := testBlock()
+	if err := Receipts(header, receipts); err != nil {
+		t.Fatalf("untouched receipts: %v", err)
+	}
+
+	indexed := *receipts[1].Logs[0]
+	if err := Log(receipts, &indexed); err != nil {
+		t.Errorf("untouched log: %v", err)
+	}
+
+	// A node serving a log with altered data
+	tampered := indexed
+	tampered.Data = []byte{9, 9, 9}
+	if err := Log(receipts, &tampered); !errors.Is(err, ErrLogMismatch) {
+		t.Errorf("tampered data: %v, want ErrLogMismatch", err)
+	}
+	missing := indexed
+	missing.Index = 5
+	if err := Log(receipts, &missing); !errors.Is(err, ErrLogMismatch) {
+		t.Errorf("log absent from the receipts: %v, want ErrLogMismatch", err)
+	}
+
+	// A node serving receipts whose log was altered to match
+	receipts[1].Logs[0].Data = tampered.Data
+	if err := Receipts(header, receipts); !errors.Is(err, ErrReceiptsRoot) {
+		t.Errorf("tampered receipts: %v, want ErrReceiptsRoot", err)
+	}
+}
@@ -0,0 +1,29 @@
+package version
+
+import "runtime"
+
+// Version and Commit are injected at build time:
+//
+//	go build -ldflags "-X example/hello/internal/version.Version=v1.2.0 -X example/hello/internal/version.Commit=$(git rev-parse --short HEAD)"
+var (
+	Version = "dev"
+	Commit  = "unknown"
+)
+
+// Info describes the running build
+type Info struct {
+	Version       string `json:"version"`
+	Commit        string `json:"commit"`
+	GoVersion     string `json:"goVersion"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+// Get returns the build info for a storage schema version
+func Get(schemaVersion int) Info {
+	return Info{
+		Version:       Version,
+		Commit:        Commit,
+		GoVersion:     runtime.Version(),
+		SchemaVersion: schemaVersion,
+	}
+}
@@ -1,27 +1,67 @@
 package main
 
 import (
+    "bytes"
+    "context"
     "encoding/binary"
+    "encoding/csv"
     "encoding/json"
+    "errors"
     "flag"
     "fmt"
     "log"
+    "os"
+    "sort"
+    "strings"
+    "time"
+
+    "example/hello/internal/storage"
+    apitypes "example/hello/pkg/types"
 
     "github.com/boltdb/bolt"
 )
 
 const (
-    BUCKET_NAME = "logs"
-    META_BUCKET = "metadata"
+    BUCKET_NAME  = "logs"
+    META_BUCKET  = "metadata"
+    BATCH_BUCKET = "batch_info"
+)
+
+// Output settings shared by the query printers, set once from the flags
+var (
+    jsonOutput bool
+    csvOutput  bool
+    keyStyle   apitypes.KeyStyle
+)
+
+// csvOut buffers CSV rows; the header is written before the first row
+var (
+    csvOut        = csv.NewWriter(os.Stdout)
+    csvHeaderDone bool
 )
 
-type LogEntry struct {
-    Index       uint64 `json:"index"`
-    BlockNumber uint64 `json:"blockNumber"`
-    ParentHash  string `json:"parentHash"`
-    L1InfoRoot  string `json:"l1InfoRoot"`
+// errNoLogsBucket means the file is a BoltDB but not one written by the indexer
+var errNoLogsBucket = errors.New("database has no logs bucket (is this an indexer database?)")
+
+// LogEntry is the API's entry type so CSV and JSON output match what /v1/logs serves
+type LogEntry = apitypes.LogEntry
+
+// BatchInfo is the per-batch analytics record written by the bulk indexer
+type BatchInfo struct {
+    WorkerID         int    `json:"workerId"`
+    BatchID          int    `json:"batchId"`
+    StartBlock       uint64 `json:"startBlock"`
+    EndBlock         uint64 `json:"endBlock"`
+    StartIndex       uint64 `json:"startIndex"`
+    LogCount         uint64 `json:"logCount"`
+    ProcessingTimeMs int64  `json:"processingTimeMs"`
+    GasAnalyzed      uint64 `json:"gasAnalyzed"`
+    FeesWei          string `json:"feesWei,omitempty"` // decimal string, may exceed uint64
 }
 
+// TopicFilter matches logs whose topics[i] equals the value at position i; empty positions match anything
+type TopicFilter [4]string
+
 type QueryOptions struct {
     dbPath     string
     index      uint64
@@ -30,13 +70,38 @@ type QueryOptions struct {
     count      bool    
     latest     int
     format     string
+    topics     TopicFilter
+    diffPath   string
+    batches    bool
+    reindex    bool
+    keys       string
+    manifest   string
 }
 
 func main() {
     opts := parseFlags()
 
+    if opts.diffPath != "" {
+        os.Exit(diffDatabases(opts.dbPath, opts.diffPath))
+    }
+
+    if opts.reindex {
+        reindex(opts.dbPath)
+        return
+    }
+
+    if opts.manifest != "" {
+        queryShards(opts)
+        return
+    }
+
+    // Refuse to run against a missing file; bolt.Open would silently create an empty one
+    if _, err := os.Stat(opts.dbPath); err != nil {
+        log.Fatalf("Database %s not found: %v", opts.dbPath, err)
+    }
+
     // Open database
-    db, err := bolt.Open(opts.dbPath, 0600, nil)
+    db, err := bolt.Open(opts.dbPath, 0600, &bolt.Options{ReadOnly: true, Timeout: 2 * time.Second})
     if err != nil {
         log.Fatalf("Failed to open database: %v", err)
     }
@@ -45,12 +110,14 @@ func main() {
     switch {
     case opts.index > 0:
         queryByIndex(db, opts.index)
-    case opts.startIndex > 0 || opts.endIndex > 0:
-        queryRange(db, opts.startIndex, opts.endIndex)
+    case opts.startIndex > 0 || opts.endIndex > 0 || !opts.topics.empty():
+        queryRange(db, opts.startIndex, opts.endIndex, opts.topics)
     case opts.latest > 0:
         queryLatest(db, opts.latest)
     case opts.count:    
         getTotalCount(db)
+    case opts.batches:
+        listBatches(db, opts.format)
     default:
         fmt.Println("Please specify a query option. Use -h for help.")
     }
@@ -65,9 +132,25 @@ func parseFlags() QueryOptions {
     flag.Uint64Var(&opts.endIndex, "end", 0, "End index for range query")
     flag.IntVar(&opts.latest, "latest", 0, "Query latest N entries")
     flag.BoolVar(&opts.count, "count", false, "Get total count of entries")    
-    flag.StringVar(&opts.format, "format", "text", "Output format (text/json)")
+    flag.StringVar(&opts.format, "format", "text", "Output format (text/json/csv)")
+    flag.StringVar(&opts.keys, "keys", "", "JSON key style for -format json: empty for camelCase, short or snake")
+    flag.BoolVar(&opts.reindex, "reindex", false, "Rebuild secondary indexes from the logs bucket (opens -db for writing)")
+    flag.BoolVar(&opts.batches, "batches", false, "List per-batch analytics (ranges, log counts, timings, gas)")
+    flag.StringVar(&opts.manifest, "manifest", "", "Query a sharded backfill through its manifest (file or shard directory) instead of -db")
+    flag.StringVar(&opts.diffPath, "diff", "", "Compare -db against this database; exits 1 when they differ")
+    for i := range opts.topics {
+        flag.StringVar(&opts.topics[i], fmt.Sprintf("topic%d", i), "", fmt.Sprintf("Only logs whose topics[%d] equals this value", i))
+    }
 
     flag.Parse()
+
+    style, err := apitypes.ParseKeyStyle(opts.keys)
+    if err != nil {
+        log.Fatalf("Invalid -keys: %v", err)
+    }
+    keyStyle = style
+    jsonOutput = opts.format == "json"
+    csvOutput = opts.format == "csv"
     return opts
 }
 
@@ -78,7 +161,7 @@ func queryByIndex(db *bolt.DB, index uint64) {
     err := db.View(func(tx *bolt.Tx) error {
         bucket := tx.Bucket([]byte(BUCKET_NAME))
         if bucket == nil {
-            return fmt.Errorf("bucket not found")
+            return errNoLogsBucket
         }
 
         data := bucket.Get(uint64ToBytes(index))
@@ -96,14 +179,30 @@ func queryByIndex(db *bolt.DB, index uint64) {
     printEntry(entry)
 }
 
-// Query a range of entries
-func queryRange(db *bolt.DB, start, end uint64) {
+// Query a range of entries, optionally filtered by topic values
+func queryRange(db *bolt.DB, start, end uint64, topics TopicFilter) {
+    entries, err := readRange(db, start, end, topics)
+    if err != nil {
+        log.Fatalf("Error querying range: %v", err)
+    }
+    printRange(entries)
+}
+
+func printRange(entries []LogEntry) {
+    summaryf("Found %d entries\n", len(entries))
+    for _, entry := range entries {
+        printEntry(entry)
+    }
+}
+
+// readRange returns the entries with start <= index <= end (end 0 = open-ended) that match topics
+func readRange(db *bolt.DB, start, end uint64, topics TopicFilter) ([]LogEntry, error) {
     var entries []LogEntry
 
     err := db.View(func(tx *bolt.Tx) error {
         bucket := tx.Bucket([]byte(BUCKET_NAME))
         if bucket == nil {
-            return fmt.Errorf("bucket not found")
+            return errNoLogsBucket
         }
 
         c := bucket.Cursor()
@@ -118,30 +217,50 @@ func queryRange(db *bolt.DB, start, end uint64) {
             if err := json.Unmarshal(v, &entry); err != nil {
                 return err
             }
+            if !topics.matches(entry) {
+                continue
+            }
             entries = append(entries, entry)
         }
 
         return nil
     })
+    return entries, err
+}
 
+// Query latest N entries
+func queryLatest(db *bolt.DB, n int) {
+    entries, err := readLatest(db, n)
     if err != nil {
-        log.Fatalf("Error querying range: %v", err)
+        log.Fatalf("Error querying latest entries: %v", err)
+    }
+    printLatest(entries)
+}
+
+func printLatest(entries []LogEntry) {
+    if len(entries) == 0 {
+        summaryf("No logs indexed yet\n")
+        return
     }
 
-    fmt.Printf("Found %d entries\n", len(entries))
+    summaryf("Latest %d entries:\n", len(entries))
     for _, entry := range entries {
         printEntry(entry)
     }
 }
 
-// Query latest N entries
-func queryLatest(db *bolt.DB, n int) {
+// readLatest returns up to n entries, newest first
+func readLatest(db *bolt.DB, n int) ([]LogEntry, error) {
     var entries []LogEntry
 
     err := db.View(func(tx *bolt.Tx) error {
         bucket := tx.Bucket([]byte(BUCKET_NAME))
         if bucket == nil {
-            return fmt.Errorf("bucket not found")
+            return errNoLogsBucket
+        }
+
+        if isEmpty(bucket) {
+            return nil
         }
 
         c := bucket.Cursor()
@@ -155,15 +274,7 @@ func queryLatest(db *bolt.DB, n int) {
 
         return nil
     })
-
-    if err != nil {
-        log.Fatalf("Error querying latest entries: %v", err)
-    }
-
-    fmt.Printf("Latest %d entries:\n", len(entries))
-    for _, entry := range entries {
-        printEntry(entry)
-    }
+    return entries, err
 }
 
 // Get total count of entries
@@ -171,7 +282,12 @@ func getTotalCount(db *bolt.DB) {
     err := db.View(func(tx *bolt.Tx) error {
         bucket := tx.Bucket([]byte(BUCKET_NAME))
         if bucket == nil {
-            return fmt.Errorf("bucket not found")
+            return errNoLogsBucket
+        }
+
+        if isEmpty(bucket) {
+            fmt.Println("No logs indexed yet")
+            return nil
         }
 
         stats := bucket.Stats()
@@ -184,6 +300,320 @@ func getTotalCount(db *bolt.DB) {
     }
 }
 
+// queryShards answers -index, range, -latest and -count queries on a sharded backfill,
+// opening only the shards the manifest says can hold the requested indices
+func queryShards(opts QueryOptions) {
+    manifest, err := storage.LoadShardManifest(opts.manifest)
+    if err != nil {
+        log.Fatalf("Failed to load manifest: %v", err)
+    }
+
+    switch {
+    case opts.index > 0:
+        shard, ok := manifest.Find(opts.index)
+        if !ok {
+            log.Fatalf("Error querying index %d: no shard holds it", opts.index)
+        }
+        withShard(shard, func(db *bolt.DB) { queryByIndex(db, opts.index) })
+    case opts.startIndex > 0 || opts.endIndex > 0 || !opts.topics.empty():
+        var entries []LogEntry
+        for _, shard := range manifest.Overlapping(opts.startIndex, opts.endIndex) {
+            withShard(shard, func(db *bolt.DB) {
+                found, err := readRange(db, opts.startIndex, opts.endIndex, opts.topics)
+                if err != nil {
+                    log.Fatalf("Error querying range in %s: %v", shard.File, err)
+                }
+                entries = append(entries, found...)
+            })
+        }
+        printRange(entries)
+    case opts.latest > 0:
+        var entries []LogEntry
+        for i := len(manifest.Shards) - 1; i >= 0 && len(entries) < opts.latest; i-- {
+            withShard(manifest.Shards[i], func(db *bolt.DB) {
+                found, err := readLatest(db, opts.latest-len(entries))
+                if err != nil {
+                    log.Fatalf("Error querying latest entries in %s: %v", manifest.Shards[i].File, err)
+                }
+                entries = append(entries, found...)
+            })
+        }
+        printLatest(entries)
+    case opts.count:
+        fmt.Printf("Total entries: %d (%d shards)\n", manifest.TotalCount(), len(manifest.Shards))
+    default:
+        fmt.Println("Please specify -index, -start/-end, -latest or -count with -manifest.")
+    }
+}
+
+// withShard opens a shard read-only for the duration of fn
+func withShard(shard apitypes.ShardInfo, fn func(db *bolt.DB)) {
+    db, err := bolt.Open(shard.File, 0600, &bolt.Options{ReadOnly: true, Timeout: 2 * time.Second})
+    if err != nil {
+        log.Fatalf("Failed to open shard %s: %v", shard.File, err)
+    }
+    defer db.Close()
+    fn(db)
+}
+
+// printCSV writes entry as one CSV row, in the same column layout as the API's CSV
+func printCSV(entry *LogEntry) {
+    if !csvHeaderDone {
+        csvOut.Write(apitypes.CSVHeader)
+        csvHeaderDone = true
+    }
+    csvOut.Write(entry.CSVRecord())
+    csvOut.Flush()
+    if err := csvOut.Error(); err != nil {
+        log.Fatalf("Error writing CSV: %v", err)
+    }
+}
+
+// summaryf prints a human-readable summary line, on stderr in CSV mode so stdout stays parseable
+func summaryf(format string, a ...interface{}) {
+    if csvOutput {
+        fmt.Fprintf(os.Stderr, format, a...)
+        return
+    }
+    fmt.Printf(format, a...)
+}
+
+// printJSON writes v as indented JSON with the -keys style applied
+func printJSON(v interface{}) {
+    data, err := json.Marshal(v)
+    if err == nil {
+        data, err = apitypes.ApplyKeyStyle(data, keyStyle)
+    }
+    if err != nil {
+        log.Fatalf("Error encoding JSON: %v", err)
+    }
+
+    var buf bytes.Buffer
+    json.Indent(&buf, data, "", "  ")
+    fmt.Println(buf.String())
+}
+
+// reindex rebuilds the secondary-index buckets of a database, e.g. bulk indexer output
+func reindex(path string) {
+    if _, err := os.Stat(path); err != nil {
+        log.Fatalf("Database %s not found: %v", path, err)
+    }
+
+    store, err := storage.NewBoltStorage(path)
+    if err != nil {
+        log.Fatalf("Failed to open database: %v", err)
+    }
+    defer store.Close()
+
+    result, err := store.Reindex(context.Background())
+    if err != nil {
+        log.Fatalf("Reindex failed: %v", err)
+    }
+
+    fmt.Printf("Reindexed %d entries into %s", result.Scanned, strings.Join(result.Buckets, ", "))
+    if result.Skipped > 0 {
+        fmt.Printf(" (%d undecodable entries skipped)", result.Skipped)
+    }
+    fmt.Println()
+}
+
+// listBatches prints the batch_info analytics in batch order
+func listBatches(db *bolt.DB, format string) {
+    var batches []BatchInfo
+    err := db.View(func(tx *bolt.Tx) error {
+        bucket := tx.Bucket([]byte(BATCH_BUCKET))
+        if bucket == nil {
+            return nil
+        }
+        return bucket.ForEach(func(k, v []byte) error {
+            var batch BatchInfo
+            if err := json.Unmarshal(v, &batch); err != nil {
+                return fmt.Errorf("batch %s: %v", k, err)
+            }
+            batches = append(batches, batch)
+            return nil
+        })
+    })
+    if err != nil {
+        log.Fatalf("Error reading batch info: %v", err)
+    }
+
+    // Keys are "batch_<id>", which sort lexically rather than numerically
+    sort.Slice(batches, func(i, j int) bool { return batches[i].BatchID < batches[j].BatchID })
+
+    if format == "json" {
+        printJSON(batches)
+        return
+    }
+
+    if len(batches) == 0 {
+        fmt.Println("No batch info stored")
+        return
+    }
+
+    fmt.Printf("%-8s %-12s %-12s %-10s %-12s %s\n", "BATCH", "START", "END", "LOGS", "TIME(ms)", "GAS")
+    for _, b := range batches {
+        fmt.Printf("%-8d %-12d %-12d %-10d %-12d %d\n",
+            b.BatchID, b.StartBlock, b.EndBlock, b.LogCount, b.ProcessingTimeMs, b.GasAnalyzed)
+    }
+}
+
+// indexRange is an inclusive run of consecutive indices
+type indexRange struct {
+    start, end uint64
+}
+
+// addIndex extends the last range when idx is contiguous with it, otherwise starts a new one
+func addIndex(ranges []indexRange, idx uint64) []indexRange {
+    if n := len(ranges); n > 0 && ranges[n-1].end+1 == idx {
+        ranges[n-1].end = idx
+        return ranges
+    }
+    return append(ranges, indexRange{idx, idx})
+}
+
+// openReadOnly opens an existing database without creating it
+func openReadOnly(path string) (*bolt.DB, error) {
+    if _, err := os.Stat(path); err != nil {
+        return nil, err
+    }
+    return bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: 2 * time.Second})
+}
+
+// diffFields returns the JSON field names whose values differ between two entries
+func diffFields(a, b []byte) ([]string, error) {
+    var ma, mb map[string]interface{}
+    if err := json.Unmarshal(a, &ma); err != nil {
+        return nil, err
+    }
+    if err := json.Unmarshal(b, &mb); err != nil {
+        return nil, err
+    }
+
+    var fields []string
+    for k, va := range ma {
+        vb, ok := mb[k]
+        if !ok || fmt.Sprint(va) != fmt.Sprint(vb) {
+            fields = append(fields, k)
+        }
+    }
+    for k := range mb {
+        if _, ok := ma[k]; !ok {
+            fields = append(fields, k)
+        }
+    }
+    sort.Strings(fields)
+    return fields, nil
+}
+
+// Compare two databases index by index, returning the process exit code
+func diffDatabases(pathA, pathB string) int {
+    dbA, err := openReadOnly(pathA)
+    if err != nil {
+        log.Fatalf("Failed to open %s: %v", pathA, err)
+    }
+    defer dbA.Close()
+
+    dbB, err := openReadOnly(pathB)
+    if err != nil {
+        log.Fatalf("Failed to open %s: %v", pathB, err)
+    }
+    defer dbB.Close()
+
+    var onlyA, onlyB []indexRange
+    var changed int
+    var same uint64
+
+    err = dbA.View(func(txA *bolt.Tx) error {
+        return dbB.View(func(txB *bolt.Tx) error {
+            bucketA := txA.Bucket([]byte(BUCKET_NAME))
+            bucketB := txB.Bucket([]byte(BUCKET_NAME))
+            if bucketA == nil || bucketB == nil {
+                return errNoLogsBucket
+            }
+
+            ca, cb := bucketA.Cursor(), bucketB.Cursor()
+            ka, va := ca.First()
+            kb, vb := cb.First()
+            for ka != nil || kb != nil {
+                switch {
+                case kb == nil || (ka != nil && bytesToUint64(ka) < bytesToUint64(kb)):
+                    onlyA = addIndex(onlyA, bytesToUint64(ka))
+                    ka, va = ca.Next()
+                case ka == nil || bytesToUint64(kb) < bytesToUint64(ka):
+                    onlyB = addIndex(onlyB, bytesToUint64(kb))
+                    kb, vb = cb.Next()
+                default:
+                    fields, err := diffFields(va, vb)
+                    if err != nil {
+                        return fmt.Errorf("index %d: %v", bytesToUint64(ka), err)
+                    }
+                    if len(fields) > 0 {
+                        changed++
+                        fmt.Printf("~ index %d differs: %s\n", bytesToUint64(ka), strings.Join(fields, ", "))
+                    } else {
+                        same++
+                    }
+                    ka, va = ca.Next()
+                    kb, vb = cb.Next()
+                }
+            }
+            return nil
+        })
+    })
+    if err != nil {
+        log.Fatalf("Error comparing databases: %v", err)
+    }
+
+    for _, r := range onlyA {
+        fmt.Printf("- indices %d-%d only in %s\n", r.start, r.end, pathA)
+    }
+    for _, r := range onlyB {
+        fmt.Printf("+ indices %d-%d only in %s\n", r.start, r.end, pathB)
+    }
+
+    fmt.Printf("\n=== Diff Summary ===\n")
+    fmt.Printf("Identical entries: %d\n", same)
+    fmt.Printf("Differing entries: %d\n", changed)
+    fmt.Printf("Ranges only in %s: %d\n", pathA, len(onlyA))
+    fmt.Printf("Ranges only in %s: %d\n", pathB, len(onlyB))
+
+    if changed > 0 || len(onlyA) > 0 || len(onlyB) > 0 {
+        return 1
+    }
+    fmt.Println("Databases are identical")
+    return 0
+}
+
+// isEmpty reports whether the bucket holds no keys, without walking it
+func isEmpty(bucket *bolt.Bucket) bool {
+    k, _ := bucket.Cursor().First()
+    return k == nil
+}
+
+// empty reports whether no topic position is filtered
+func (f TopicFilter) empty() bool {
+    for _, t := range f {
+        if t != "" {
+            return false
+        }
+    }
+    return true
+}
+
+// matches compares topic values case-insensitively, since hex may be checksummed or not
+func (f TopicFilter) matches(entry LogEntry) bool {
+    for i, want := range f {
+        if want == "" {
+            continue
+        }
+        if i >= len(entry.Topics) || !strings.EqualFold(entry.Topics[i], want) {
+            return false
+        }
+    }
+    return true
+}
+
 // Helper functions
 func uint64ToBytes(n uint64) []byte {
     b := make([]byte, 8)
@@ -196,9 +626,20 @@ func bytesToUint64(b []byte) uint64 {
 }
 
 func printEntry(entry LogEntry) {
+    if jsonOutput {
+        printJSON(entry)
+        return
+    }
+    if csvOutput {
+        printCSV(&entry)
+        return
+    }
     fmt.Printf("\n=== Entry %d ===\n", entry.Index)
     fmt.Printf("Block Number: %d\n", entry.BlockNumber)
     fmt.Printf("Parent Hash: %s\n", entry.ParentHash)
     fmt.Printf("L1 Info Root: %s\n", entry.L1InfoRoot)
+    for i, topic := range entry.Topics {
+        fmt.Printf("Topic %d: %s\n", i, topic)
+    }
     fmt.Println("===============")
 }
\ No newline at end of file
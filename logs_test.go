@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	apitypes "example/hello/pkg/types"
+
+	"github.com/boltdb/bolt"
+)
+
+// openTestDB writes entries to a logs bucket of a new DB and returns it open
+func openTestDB(t *testing.T, entries ...LogEntry) *bolt.DB {
+	t.Helper()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "logs.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	writeLogs(t, db, entries...)
+	return db
+}
+
+// writeTestDB writes entries to a logs bucket of a new DB at path and closes it
+func writeTestDB(t *testing.T, path string, entries ...LogEntry) {
+	t.Helper()
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	writeLogs(t, db, entries...)
+}
+
+// writeLogs stores entries in the logs bucket of db, creating it
+func writeLogs(t *testing.T, db *bolt.DB, entries ...LogEntry) {
+	t.Helper()
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(BUCKET_NAME))
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			data, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(uint64ToBytes(e.Index), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// entryIndices returns the index of every entry, in order
+func entryIndices(entries []LogEntry) []uint64 {
+	out := make([]uint64, len(entries))
+	for i, e := range entries {
+		out[i] = e.Index
+	}
+	return out
+}
+
+func TestReadRangeTopicFilter(t *testing.T) {
+	const transfer, alice, bob = "0xddf2", "0x00a1", "0x00b0"
+	db := openTestDB(t,
+		LogEntry{Index: 0, Topics: []string{transfer, alice, bob}},
+		LogEntry{Index: 1, Topics: []string{transfer, bob, alice}},
+		LogEntry{Index: 2, Topics: []string{transfer}},
+		LogEntry{Index: 3, Topics: []string{transfer, "0X00A1", bob}},
+		LogEntry{Index: 4},
+	)
+
+	for _, tc := range []struct {
+		name       string
+		start, end uint64
+		topics     TopicFilter
+		want       []uint64
+	}{
+		{"no filter", 0, 0, TopicFilter{}, []uint64{0, 1, 2, 3, 4}},
+		{"topic0", 0, 0, TopicFilter{transfer}, []uint64{0, 1, 2, 3}},
+		{"topic1 any case", 0, 0, TopicFilter{1: alice}, []uint64{0, 3}},
+		{"topic1 and topic2", 0, 0, TopicFilter{1: bob, 2: alice}, []uint64{1}},
+		{"topic past the log's topics", 0, 0, TopicFilter{3: alice}, []uint64{}},
+		{"within a range", 1, 3, TopicFilter{1: alice}, []uint64{3}},
+	} {
+		got, err := readRange(db, tc.start, tc.end, tc.topics)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(entryIndices(got), tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, entryIndices(got), tc.want)
+		}
+	}
+}
+
+func TestEmptyAndForeignDatabases(t *testing.T) {
+	empty := openTestDB(t)
+
+	foreign, err := bolt.Open(filepath.Join(t.TempDir(), "other.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer foreign.Close()
+	foreign.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket([]byte("sessions"))
+		return err
+	})
+
+	latest, err := readLatest(empty, 5)
+	if err != nil || len(latest) != 0 {
+		t.Errorf("latest of an empty logs bucket = %v, %v; want nothing and no error", latest, err)
+	}
+	rng, err := readRange(empty, 0, 0, TopicFilter{})
+	if err != nil || len(rng) != 0 {
+		t.Errorf("range of an empty logs bucket = %v, %v; want nothing and no error", rng, err)
+	}
+
+	if _, err := readLatest(foreign, 5); !errors.Is(err, errNoLogsBucket) {
+		t.Errorf("latest of a DB without a logs bucket: %v, want errNoLogsBucket", err)
+	}
+	if _, err := readRange(foreign, 0, 0, TopicFilter{}); !errors.Is(err, errNoLogsBucket) {
+		t.Errorf("range of a DB without a logs bucket: %v, want errNoLogsBucket", err)
+	}
+}
+
+// captureStdout returns what fn printed to stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan []byte)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- out
+	}()
+	fn()
+	w.Close()
+	return string(<-done)
+}
+
+func TestDiffDatabases(t *testing.T) {
+	dir := t.TempDir()
+	a, b, c := filepath.Join(dir, "a.db"), filepath.Join(dir, "b.db"), filepath.Join(dir, "c.db")
+	writeTestDB(t, a,
+		LogEntry{Index: 0, BlockNumber: 1, TxHash: "0x01"},
+		LogEntry{Index: 1, BlockNumber: 1, TxHash: "0x02"},
+		LogEntry{Index: 2, BlockNumber: 2, TxHash: "0x03"},
+		LogEntry{Index: 3, BlockNumber: 3, TxHash: "0x04"},
+	)
+	writeTestDB(t, b,
+		LogEntry{Index: 0, BlockNumber: 1, TxHash: "0x01"},
+		LogEntry{Index: 1, BlockNumber: 1, TxHash: "0xff"},
+		LogEntry{Index: 5, BlockNumber: 9, TxHash: "0x09"},
+	)
+	writeTestDB(t, c,
+		LogEntry{Index: 0, BlockNumber: 1, TxHash: "0x01"},
+		LogEntry{Index: 1, BlockNumber: 1, TxHash: "0x02"},
+		LogEntry{Index: 2, BlockNumber: 2, TxHash: "0x03"},
+		LogEntry{Index: 3, BlockNumber: 3, TxHash: "0x04"},
+	)
+
+	var code int
+	out := captureStdout(t, func() { code = diffDatabases(a, b) })
+	if code == 0 {
+		t.Error("differing databases exited 0")
+	}
+	for _, want := range []string{
+		"~ index 1 differs: txHash",
+		"- indices 2-3 only in " + a,
+		"+ indices 5-5 only in " + b,
+		"Identical entries: 1",
+		"Differing entries: 1",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("diff output lacks %q:\n%s", want, out)
+		}
+	}
+
+	out = captureStdout(t, func() { code = diffDatabases(a, c) })
+	if code != 0 || !strings.Contains(out, "Databases are identical") {
+		t.Errorf("identical databases exited %d:\n%s", code, out)
+	}
+}
+
+func TestListBatches(t *testing.T) {
+	db := openTestDB(t)
+	stored := []BatchInfo{
+		{BatchID: 10, StartBlock: 5000, EndBlock: 5499, LogCount: 7, ProcessingTimeMs: 1200, GasAnalyzed: 147_000, FeesWei: "1000000000000000000000"},
+		{BatchID: 2, StartBlock: 1000, EndBlock: 1499, LogCount: 3, ProcessingTimeMs: 300, GasAnalyzed: 63_000},
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(BATCH_BUCKET))
+		if err != nil {
+			return err
+		}
+		for _, batch := range stored {
+			data, _ := json.Marshal(batch)
+			if err := b.Put([]byte(fmt.Sprintf("batch_%d", batch.BatchID)), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var listed []BatchInfo
+	out := captureStdout(t, func() { listBatches(db, "json") })
+	if err := json.Unmarshal([]byte(out), &listed); err != nil {
+		t.Fatalf("decode %s: %v", out, err)
+	}
+	if !slices.Equal(listed, []BatchInfo{stored[1], stored[0]}) {
+		t.Errorf("listed %+v, want batches 2 and 10 in order", listed)
+	}
+
+	table := captureStdout(t, func() { listBatches(db, "table") })
+	if !strings.Contains(table, "10       5000         5499         7          1200         147000") {
+		t.Errorf("table lacks batch 10's row:\n%s", table)
+	}
+}
+
+func TestJSONOutputKeyStyles(t *testing.T) {
+	t.Cleanup(func() { jsonOutput, keyStyle = false, apitypes.KeyStyleDefault })
+	jsonOutput = true
+	entry := LogEntry{Index: 3, BlockNumber: 77, TxHash: "0xt", LogIndex: 1}
+
+	for style, want := range map[apitypes.KeyStyle][]string{
+		apitypes.KeyStyleDefault: {`"blockNumber": 77`, `"txHash": "0xt"`, `"logIndex": 1`},
+		apitypes.KeyStyleSnake:   {`"block_number": 77`, `"tx_hash": "0xt"`, `"log_index": 1`},
+	} {
+		keyStyle = style
+		out := captureStdout(t, func() { printEntry(entry) })
+		for _, w := range want {
+			if !strings.Contains(out, w) {
+				t.Errorf("-keys %q: %s missing from\n%s", style, w, out)
+			}
+		}
+		if style == apitypes.KeyStyleSnake && strings.Contains(out, "blockNumber") {
+			t.Errorf("snake_case output still has camelCase keys:\n%s", out)
+		}
+	}
+}
+
+func TestCSVOutputMatchesAPILayout(t *testing.T) {
+	t.Cleanup(func() { csvOutput, csvOut, csvHeaderDone = false, csv.NewWriter(os.Stdout), false })
+	csvOutput = true
+	entries := []*LogEntry{
+		{Index: 0, BlockNumber: 12, TxHash: "0xt", Topics: []string{"0xa"}, GasPrice: apitypes.NewBigInt(big.NewInt(7))},
+		{Index: 1, BlockNumber: 13, LogIndex: 4},
+	}
+
+	out := captureStdout(t, func() {
+		csvOut, csvHeaderDone = csv.NewWriter(os.Stdout), false
+		for _, e := range entries {
+			printEntry(*e)
+		}
+	})
+
+	// The API writes /v1/logs?format=csv with the same function
+	var api bytes.Buffer
+	if err := apitypes.WriteCSV(&api, entries); err != nil {
+		t.Fatal(err)
+	}
+	if out != api.String() {
+		t.Errorf("logs -format csv printed\n%s\nthe API serves\n%s", out, api.String())
+	}
+}
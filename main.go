@@ -2,55 +2,141 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"math/big"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
+	svcconfig "example/hello/internal/config"
+	"example/hello/internal/decoder"
+	"example/hello/internal/indexer"
+	"example/hello/internal/metrics"
+	"example/hello/internal/rpcclient"
+	"example/hello/internal/storage"
+	"example/hello/internal/verify"
+	apitypes "example/hello/pkg/types"
+
 	"github.com/boltdb/bolt"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 const (
-	CONTRACT_ADDR   = "0x6992e2f8E29139cc16683228a4A4CA602e49e048"
-	EVENT_TOPIC     = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
-	RPC_ENDPOINT    = "https://eth-mainnet.g.alchemy.com/public"
-	BUCKET_NAME     = "logs"
-	DB_DIR          = "worker_dbs"
-	FINAL_DB        = "hyperscale_indexed_logs.db"
-	MAX_BLOCK_RANGE = 500 // RPC constraint: maximum 500 blocks per query
+	CONTRACT_ADDR      = "0x6992e2f8E29139cc16683228a4A4CA602e49e048"
+	EVENT_TOPIC        = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+	RPC_ENDPOINT       = "https://eth-mainnet.g.alchemy.com/public"
+	BUCKET_NAME        = "logs"
+	DB_DIR             = "worker_dbs"
+	FINAL_DB           = "hyperscale_indexed_logs.db"
+	PLAN_CACHE_DIR     = "plan_cache"
+	MAX_BLOCK_RANGE    = 500 // Default RPC constraint: blocks per query, probed against the provider at startup
+	FD_RESERVE         = 64  // Descriptors kept free for stdio, the final DB, and misc files
+	HTTP_WORKERS       = 50  // Default workers against a rate-limited HTTP provider
+	RPC_MAX_FAILS      = 3   // Consecutive errors before an endpoint is rotated out
+	IPC_WORKERS        = 200 // Default workers against a local node over IPC
+	BLOCK_RETRIES      = 3   // Attempts per block fetch before storing the log un-enriched
+	ENRICH_CURSOR      = "enrich_cursor"
+	SELF_DESTRUCT_KEY  = "self_destruct" // metadata key of the SelfDestruct record
+	DEAD_LETTER_BUCKET = "dead_letter"   // index -> DeadLetter, matching storage.BucketDeadLetter
+	CONTRACTS_BUCKET   = "contracts"     // lowercase address -> DiscoveredContract, matching storage.BucketContracts
+	BLOOM_BUCKET       = "blooms"        // block number -> 256-byte logsBloom
 )
 
 type LogEntry struct {
-	Index       uint64 `json:"index"`
-	BlockNumber uint64 `json:"blockNumber"`
-	ParentHash  string `json:"parentHash"`
-	L1InfoRoot  string `json:"l1InfoRoot"`
-	Timestamp   uint64 `json:"timestamp"`
-	GasUsed     uint64 `json:"gasUsed"`
-	TxHash      string `json:"txHash"`
-	LogIndex    uint64 `json:"logIndex"`
+	Index       uint64            `json:"index"`
+	BlockNumber uint64            `json:"blockNumber"`
+	Address     string            `json:"address,omitempty"` // Emitting contract
+	ParentHash  string            `json:"parentHash"`
+	L1InfoRoot  string            `json:"l1InfoRoot"`
+	Timestamp   uint64            `json:"timestamp"`
+	GasUsed     uint64            `json:"gasUsed"`
+	GasPrice    *apitypes.BigInt  `json:"gasPrice,omitempty"` // effective gas price in wei
+	TxHash      string            `json:"txHash"`
+	TxIndex     *uint64           `json:"txIndex,omitempty"` // Transaction position in the block
+	LogIndex    uint64            `json:"logIndex"`
+	Topics      []string          `json:"topics,omitempty"`
+	EventTopic  string            `json:"eventTopic,omitempty"` // topic0, the event the log matched
+	EventName   string            `json:"eventName,omitempty"`
+	From        string            `json:"from,omitempty"`        // Token sender or owner, decoded with -preset
+	To          string            `json:"to,omitempty"`          // Token recipient, spender or operator, decoded with -preset
+	Value       *apitypes.BigInt  `json:"value,omitempty"`       // Token amount, decoded with -preset
+	TokenID     *apitypes.BigInt  `json:"tokenId,omitempty"`     // ERC-721/1155 token id, decoded with -preset
+	Enriched    bool              `json:"enriched"`              // false when block data could not be fetched
+	RawLog      *apitypes.RawLog  `json:"rawLog,omitempty"`      // complete on-chain log with -store-raw
+	Annotations map[string]string `json:"annotations,omitempty"` // set by processing hooks
 }
 
 type BatchInfo struct {
-	WorkerID       int
-	BatchID        int
-	StartBlock     uint64
-	EndBlock       uint64
-	StartIndex     uint64
-	LogCount       uint64
-	DbPath         string
-	ProcessingTime time.Duration
-	GasAnalyzed    uint64
+	WorkerID       int              `json:"workerId"`
+	BatchID        int              `json:"batchId"`
+	StartBlock     uint64           `json:"startBlock"`
+	EndBlock       uint64           `json:"endBlock"`
+	StartIndex     uint64           `json:"startIndex"`
+	LogCount       uint64           `json:"logCount"`
+	DbPath         string           `json:"-"`
+	ProcessingTime time.Duration    `json:"-"`
+	GasAnalyzed    uint64           `json:"gasAnalyzed"`
+	FeesWei        *apitypes.BigInt `json:"feesWei,omitempty"`        // sum of gasUsed × gasPrice over the batch
+	Dropped        uint64           `json:"dropped,omitempty"`        // entries a processing hook dropped
+	DeadLettered   uint64           `json:"deadLettered,omitempty"`   // entries stored in the dead-letter bucket instead
+	VerifyFailures uint64           `json:"verifyFailures,omitempty"` // logs that failed -verify-receipts
+}
+
+// MarshalJSON stores the processing time in milliseconds, matching types.BatchInfo
+func (b BatchInfo) MarshalJSON() ([]byte, error) {
+	type plain BatchInfo
+	return json.Marshal(struct {
+		plain
+		ProcessingTimeMs int64 `json:"processingTimeMs"`
+	}{plain(b), b.ProcessingTime.Milliseconds()})
+}
+
+// PlanWindow is a single pre-analyzed block window and its log count
+type PlanWindow struct {
+	StartBlock uint64 `json:"startBlock"`
+	EndBlock   uint64 `json:"endBlock"`
+	LogCount   uint64 `json:"logCount"`
+}
+
+// BatchPlan is the cached result of pre-analysis, keyed by contract+topic+range
+type BatchPlan struct {
+	Contract       string       `json:"contract"`
+	Topic          string       `json:"topic"`
+	StartBlock     uint64       `json:"startBlock"`
+	EndBlock       uint64       `json:"endBlock"`
+	MaxBlockRange  uint64       `json:"maxBlockRange"`
+	ValidateTopic0 bool         `json:"validateTopic0,omitempty"`
+	Hooks          []string     `json:"hooks,omitempty"` // processing hooks registered when the plan was made
+	Windows        []PlanWindow `json:"windows"`
+}
+
+// SelfDestruct records a contract whose code disappeared inside the indexed range;
+// it is stored under SELF_DESTRUCT_KEY in the final DB's metadata bucket
+type SelfDestruct struct {
+	Block        uint64 `json:"block"`        // First block at which eth_getCode returns no code
+	RequestedEnd uint64 `json:"requestedEnd"` // End block before any adjustment
+	Stopped      bool   `json:"stopped"`      // Whether indexing ended at Block (-code-end stop)
 }
 
 type PerformanceMetrics struct {
@@ -61,314 +147,2873 @@ type PerformanceMetrics struct {
 	ProcessingTime     time.Duration
 	ThroughputBPS      float64
 	ThroughputLPS      float64
-	ParallelEfficiency float64
+	WorkerBusyTime     time.Duration // Sum of per-batch processing times, i.e. the single-worker estimate
+	WorkerWallTime     time.Duration // Wall-clock time of the parallel batch-processing phase
+	ParallelSpeedup    float64       // WorkerBusyTime / WorkerWallTime
+	ParallelEfficiency float64       // ParallelSpeedup / NumWorkers, 1.0 means every worker was busy throughout
 	StartTime          time.Time
 	EndTime            time.Time
 }
 
 type IndexerConfig struct {
-	StartBlock    uint64
-	EndBlock      uint64
-	NumWorkers    int
-	EnableCache   bool
-	EnableMetrics bool
+	StartBlock     uint64
+	EndBlock       uint64
+	NumWorkers     int
+	EnableCache    bool // Cache fetched blocks in a bounded LRU (-block-cache, -block-cache-mb)
+	EnableMetrics  bool
+	RefreshPlan    bool
+	MaxOpenDBs     int           // 0 derives the cap from the process file descriptor limit
+	StartIndex     uint64        // First index assigned (-index-base/-index-namespace); continues after existing entries when appending
+	MaxBlockRange  uint64        // Blocks per eth_getLogs query, validated by probeMaxBlockRange
+	StoreBlooms    bool          // Persist every block's logsBloom for bloom-only pre-filtering on re-index
+	KeepEmpty      bool          // Also create batches for windows pre-analysis found empty
+	StoreRaw       bool          // Keep the complete raw log on every entry (archival mode)
+	PlanWorkers    int           // Concurrent pre-analysis queries
+	PlanRate       int           // Pre-analysis queries per second across all plan workers, 0 is unthrottled
+	PlanStrategy   string        // window (one eth_getLogs call per window) or batch (JSON-RPC batches)
+	PlanBatchSize  int           // Windows per JSON-RPC batch request with PlanStrategy batch
+	CheckpointPath string        // Where committed progress is saved on batch failure and at the end; empty disables
+	HookErrors     string        // skip (store the entry as it was before the failing hook) or fail (fail the batch)
+	ValidateTopic0 bool          // Drop returned logs whose topic0 is not one of eventTopics
+	DeadLetter     bool          // Dead-letter logs that fail processing instead of failing their batch
+	VerifyReceipts bool          // Check every log against its block's receiptsRoot and logsBloom
+	HeaderFallback bool          // Re-read a block with implausible header fields as a header alone before storing its logs un-enriched
+	MergeDelay     time.Duration // Pause between batch merges during consolidation
+	MergeRate      int64         // Max worker DB bytes merged per second during consolidation, 0 is unthrottled
+	OpenRetry      time.Duration // Total time a consolidation DB open is retried on lock timeouts, 0 disables
 }
 
-type HyperscaleIndexer struct {
-	client       *ethclient.Client
-	config       IndexerConfig
-	metrics      PerformanceMetrics
-	processed    int64
-	errors       chan error
-	batchCounter int64
-	mu           sync.RWMutex
+// DeadLetter is a log that failed processing with -dead-letter, stored in the
+// DEAD_LETTER_BUCKET under its index. It matches types.DeadLetter, which the service
+// lists and reprocesses at /v1/admin/dead-letters.
+type DeadLetter struct {
+	Entry    *LogEntry `json:"entry"` // As built before the failing stage, with RawLog
+	Stage    string    `json:"stage"` // hook, decode or store
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failedAt"`
 }
 
-func NewHyperscaleIndexer(client *ethclient.Client, config IndexerConfig) *HyperscaleIndexer {
-	return &HyperscaleIndexer{
-		client: client,
-		config: config,
-		errors: make(chan error, config.NumWorkers*10), // Buffer for multiple batches per worker
-		metrics: PerformanceMetrics{
-			StartTime: time.Now(),
-		},
+// putDeadLetter records entry, which failed at stage with cause, in tx's dead-letter
+// bucket. The raw log is always attached so the entry can be rebuilt.
+func putDeadLetter(tx *bolt.Tx, entry *LogEntry, raw types.Log, stage string, cause error) error {
+	bucket, err := tx.CreateBucketIfNotExists([]byte(DEAD_LETTER_BUCKET))
+	if err != nil {
+		return err
 	}
+	entry.RawLog = rawLog(raw)
+	data, err := json.Marshal(DeadLetter{Entry: entry, Stage: stage, Error: cause.Error(), Attempts: 1, FailedAt: time.Now().UTC()})
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %v", err)
+	}
+	log.Printf("📮 Log %d (block %d) failed at %s, dead-lettered: %v", entry.Index, entry.BlockNumber, stage, cause)
+	return bucket.Put(uint64ToBytes(entry.Index), data)
 }
 
-func (h *HyperscaleIndexer) generateAdaptiveBatches() ([]BatchInfo, error) {
-	totalBlocks := h.config.EndBlock - h.config.StartBlock + 1
+// ProcessHook runs on every entry before it is stored. It may annotate or rewrite the
+// entry and return it, return nil to drop the entry, or return an error, which is
+// handled according to -hook-errors. The entry's index cannot be changed by a hook.
+type ProcessHook func(ctx context.Context, entry *LogEntry) (*LogEntry, error)
 
-	// Calculate number of batches needed based on MAX_BLOCK_RANGE constraint
-	numBatches := int((totalBlocks + MAX_BLOCK_RANGE - 1) / MAX_BLOCK_RANGE) // Ceiling division
+type namedHook struct {
+	name string
+	fn   ProcessHook
+}
 
-	batches := make([]BatchInfo, 0, numBatches)
-	currentIndex := uint64(0)
-	batchID := 0
+// processHooks run in registration order on every entry of every batch
+var processHooks []namedHook
 
-	log.Printf("🔄 Adaptive Range Analysis: %d total blocks requires %d batches (max %d blocks each)",
-		totalBlocks, numBatches, MAX_BLOCK_RANGE)
+// RegisterHook adds a processing hook. Call it from an init function before main runs;
+// hooks are not safe to register once workers have started.
+func RegisterHook(name string, hook ProcessHook) {
+	processHooks = append(processHooks, namedHook{name: name, fn: hook})
+}
 
-	for startBlock := h.config.StartBlock; startBlock <= h.config.EndBlock; {
-		endBlock := startBlock + MAX_BLOCK_RANGE - 1
-		if endBlock > h.config.EndBlock {
-			endBlock = h.config.EndBlock
+// hookNames lists the registered hooks in order
+func hookNames() []string {
+	names := make([]string, len(processHooks))
+	for i, hook := range processHooks {
+		names[i] = hook.name
+	}
+	return names
+}
+
+// runHooks passes entry through every registered hook and returns the entry to store,
+// or nil when a hook dropped it
+func (h *HyperscaleIndexer) runHooks(ctx context.Context, entry *LogEntry) (*LogEntry, error) {
+	index := entry.Index // hooks often modify entry in place, so keep the original
+	for _, hook := range processHooks {
+		out, err := hook.fn(ctx, entry)
+		if err != nil {
+			if h.config.HookErrors == "fail" {
+				return nil, fmt.Errorf("hook %s failed on index %d: %v", hook.name, index, err)
+			}
+			log.Printf("Warning: Hook %s failed on index %d, skipping it: %v", hook.name, index, err)
+			continue
+		}
+		if out == nil {
+			return nil, nil
 		}
+		out.Index = index
+		entry = out
+	}
+	return entry, nil
+}
+
+// Outcomes of processEntry
+type entryOutcome int
+
+const (
+	entryStored       entryOutcome = iota
+	entryDropped                   // a processing hook dropped the entry
+	entryDeadLettered              // the entry failed processing and went to the dead-letter bucket
+)
 
-		// Pre-analyze this batch to get log count
-		query := ethereum.FilterQuery{
-			FromBlock: big.NewInt(int64(startBlock)),
-			ToBlock:   big.NewInt(int64(endBlock)),
-			Addresses: []common.Address{common.HexToAddress(CONTRACT_ADDR)},
-			Topics:    [][]common.Hash{{common.HexToHash(EVENT_TOPIC)}},
+// processEntry runs entry, built from raw, through decoding (event name and -preset
+// fields) and the processing hooks, and encodes the result. With -dead-letter an entry
+// failing any stage is put in tx's dead-letter bucket instead of returning an error.
+// The encoded entry is returned only for entryStored; it belongs under entry.Index.
+func (h *HyperscaleIndexer) processEntry(tx *bolt.Tx, entry LogEntry, raw types.Log) ([]byte, entryOutcome, error) {
+	if len(raw.Topics) > 0 {
+		entry.EventTopic = raw.Topics[0].Hex()
+		entry.EventName = h.events.Name(raw.BlockNumber, raw.Topics[0])
+	}
+	if h.preset != nil {
+		fields, err := h.preset.Decode(raw)
+		if err != nil {
+			if h.config.DeadLetter {
+				return nil, entryDeadLettered, putDeadLetter(tx, &entry, raw, "decode", err)
+			}
+			log.Printf("Warning: Could not decode log %d (block %d) with the %s preset: %v",
+				entry.Index, raw.BlockNumber, h.preset.Name, err)
+		} else {
+			entry.From, entry.To = fields.From.Hex(), fields.To.Hex()
+			if fields.Value != nil {
+				entry.Value = apitypes.NewBigInt(fields.Value)
+			}
+			if fields.TokenID != nil {
+				entry.TokenID = apitypes.NewBigInt(fields.TokenID)
+			}
 		}
+	}
 
-		logs, err := h.client.FilterLogs(context.Background(), query)
+	original := entry
+	stored := &entry
+	if len(processHooks) > 0 {
+		var err error
+		stored, err = h.runHooks(context.Background(), stored)
 		if err != nil {
-			return nil, fmt.Errorf("failed to pre-analyze batch %d (blocks %d-%d): %v",
-				batchID, startBlock, endBlock, err)
+			if !h.config.DeadLetter {
+				return nil, entryStored, err
+			}
+			return nil, entryDeadLettered, putDeadLetter(tx, &original, raw, "hook", err)
+		}
+		if stored == nil {
+			return nil, entryDropped, nil
 		}
+	}
 
-		dbPath := filepath.Join(DB_DIR, fmt.Sprintf("adaptive_batch_%d.db", batchID))
-		batch := BatchInfo{
-			WorkerID:   batchID % h.config.NumWorkers, // Round-robin assignment to workers
-			BatchID:    batchID,
-			StartBlock: startBlock,
-			EndBlock:   endBlock,
-			StartIndex: currentIndex,
-			LogCount:   uint64(len(logs)),
-			DbPath:     dbPath,
+	data, err := json.Marshal(stored)
+	if err != nil {
+		if !h.config.DeadLetter {
+			return nil, entryStored, fmt.Errorf("failed to marshal entry: %v", err)
 		}
+		return nil, entryDeadLettered, putDeadLetter(tx, &original, raw, "store", err)
+	}
+	return data, entryStored, nil
+}
 
-		batches = append(batches, batch)
-		currentIndex += uint64(len(logs))
+type HyperscaleIndexer struct {
+	client           rpcclient.Client
+	config           IndexerConfig
+	events           *decoder.Schedule // nil when no ABI is supplied
+	preset           *decoder.Preset   // Built-in token decoder selected by -preset, or nil
+	prom             *metrics.Metrics  // nil when metrics are disabled
+	metrics          PerformanceMetrics
+	processed        int64
+	errors           chan error
+	batchCounter     int64
+	strayLogs        int64              // Logs returned outside their requested block range and dropped
+	stalePlan        int64              // Batches whose log count no longer matches the plan, not stored
+	unexpectedTopics int64              // Logs whose topic0 is not one of eventTopics, dropped with ValidateTopic0
+	dbSlots          chan struct{}      // In-flight semaphore bounding concurrently open worker DBs
+	completed        map[int]BatchInfo  // Finished batches with timing and gas filled in, by BatchID
+	progress         *batchProgress     // Committed-batch prefix for checkpoints, set once batches are planned
+	batcher          *rpc.Client        // Raw client for JSON-RPC batches, set with PlanStrategy batch
+	selfDestruct     *SelfDestruct      // Set when -code-end found the contract's code disappearing in range
+	kafka            *indexer.KafkaSink // Publishes each merged batch during consolidation, set by -kafka-rest-url
+	mu               sync.RWMutex
+}
 
-		log.Printf("📦 Batch %d: Blocks %d-%d (%d blocks) | Events: %d | Worker: %d | Starting Index: %d",
-			batchID, startBlock, endBlock, endBlock-startBlock+1, len(logs), batch.WorkerID, batch.StartIndex)
+func NewHyperscaleIndexer(client rpcclient.Client, config IndexerConfig, prom *metrics.Metrics) *HyperscaleIndexer {
+	if config.MaxBlockRange == 0 {
+		config.MaxBlockRange = MAX_BLOCK_RANGE
+	}
 
-		startBlock = endBlock + 1
-		batchID++
+	maxOpen := config.MaxOpenDBs
+	if maxOpen <= 0 || maxOpen > config.NumWorkers {
+		maxOpen = config.NumWorkers
 	}
 
-	h.metrics.TotalBatches = len(batches)
-	log.Printf("✅ Generated %d adaptive batches distributed across %d workers", len(batches), h.config.NumWorkers)
+	return &HyperscaleIndexer{
+		client:    client,
+		config:    config,
+		errors:    make(chan error, config.NumWorkers*10), // Buffer for multiple batches per worker
+		dbSlots:   make(chan struct{}, maxOpen),
+		completed: make(map[int]BatchInfo),
+		prom:      prom,
+		metrics: PerformanceMetrics{
+			StartTime: time.Now(),
+		},
+	}
+}
 
-	return batches, nil
+// rangeLimitPatterns extract the block range a provider advertises in its rejection,
+// e.g. "up to a 2K block range", "exceed maximum block range: 5000", "limited to a 10,000 range"
+var rangeLimitPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)up to a (\d[\d,]*)\s*(k?) block range`),
+	regexp.MustCompile(`(?i)block range[^\d]{0,20}(\d[\d,]*)\s*(k?)`),
+	regexp.MustCompile(`(?i)limited to a (\d[\d,]*)\s*(k?)`),
+	regexp.MustCompile(`(?i)ranges over (\d[\d,]*)\s*(k?) blocks`),
 }
 
-func (h *HyperscaleIndexer) processAdaptiveBatch(batch BatchInfo) error {
-	startTime := time.Now()
+// parseRangeLimit returns the block range limit advertised in a provider error, if any
+func parseRangeLimit(msg string) (uint64, bool) {
+	for _, re := range rangeLimitPatterns {
+		m := re.FindStringSubmatch(msg)
+		if m == nil {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.ReplaceAll(m[1], ",", ""), 10, 64)
+		if err != nil || n == 0 {
+			continue
+		}
+		if strings.EqualFold(m[2], "k") {
+			n *= 1000
+		}
+		return n, true
+	}
+	return 0, false
+}
 
-	db, err := bolt.Open(batch.DbPath, 0600, &bolt.Options{Timeout: 1 * time.Second})
+// isRangeLimitError reports whether a provider rejected eth_getLogs for its block span
+func isRangeLimitError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "block range") || strings.Contains(msg, "range limit") ||
+		strings.Contains(msg, "range is too") || strings.Contains(msg, "blocks are not supported")
+}
+
+// probeMaxBlockRange validates MaxBlockRange with a real eth_getLogs over a full-width
+// window. If the provider rejects the span and advertises its limit, the range is tuned
+// down to it; otherwise the range is halved until the provider accepts it.
+func probeMaxBlockRange(ctx context.Context, client rpcclient.Client, config *IndexerConfig) error {
+	if config.MaxBlockRange == 0 {
+		config.MaxBlockRange = MAX_BLOCK_RANGE
+	}
+
+	for {
+		width := config.MaxBlockRange
+		from := uint64(0)
+		if config.EndBlock+1 > width {
+			from = config.EndBlock + 1 - width
+		}
+		_, err := client.FilterLogs(ctx, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(from),
+			ToBlock:   new(big.Int).SetUint64(from + width - 1),
+			Addresses: contracts.Addresses(),
+			Topics:    topicFilter(),
+		})
+		if err == nil {
+			log.Printf("📏 Effective max block range: %d blocks per query", config.MaxBlockRange)
+			return nil
+		}
+		if isTooManyResultsError(err) {
+			// The span is accepted; result caps are handled by splitting at query time
+			log.Printf("📏 Effective max block range: %d blocks per query", config.MaxBlockRange)
+			return nil
+		}
+		if !isRangeLimitError(err) {
+			return fmt.Errorf("block range probe failed: %v", err)
+		}
+
+		if limit, ok := parseRangeLimit(err.Error()); ok && limit < width {
+			log.Printf("📏 Provider limits eth_getLogs to %d blocks, lowering max range from %d", limit, width)
+			config.MaxBlockRange = limit
+			continue
+		}
+		if width == 1 {
+			return fmt.Errorf("provider rejects even single-block eth_getLogs: %v", err)
+		}
+		log.Printf("📏 Provider rejected a %d block range (%v), halving", width, err)
+		config.MaxBlockRange = width / 2
+	}
+}
+
+// dialEthClient connects over IPC when the endpoint is a local .ipc socket path,
+// avoiding HTTP overhead and provider rate limits, and over HTTP/WS otherwise
+func dialEthClient(endpoint string) (*ethclient.Client, bool, error) {
+	if svcconfig.IsIPCPath(endpoint) {
+		rpcClient, err := rpc.DialIPC(context.Background(), endpoint)
+		if err != nil {
+			return nil, true, err
+		}
+		return ethclient.NewClient(rpcClient), true, nil
+	}
+	client, err := ethclient.Dial(endpoint)
+	return client, false, err
+}
+
+// dialEndpoints connects to every comma-separated endpoint and wraps them in a
+// failover client. Each endpoint's client is passed through audit first, so every
+// call that reaches a node is recorded. ipc is true only when every endpoint is a
+// local IPC socket.
+func dialEndpoints(endpoints string, onError rpcclient.ErrorRecorder, audit func(rpcclient.Client) rpcclient.Client) (rpcclient.Client, bool, error) {
+	var pool []*rpcclient.Endpoint
+	allIPC := true
+	for _, endpoint := range strings.Split(endpoints, ",") {
+		endpoint = strings.TrimSpace(endpoint)
+		if endpoint == "" {
+			continue
+		}
+		client, ipc, err := dialEthClient(endpoint)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: %v", rpcclient.EndpointLabel(endpoint), err)
+		}
+		allIPC = allIPC && ipc
+		pool = append(pool, &rpcclient.Endpoint{Name: rpcclient.EndpointLabel(endpoint), Client: audit(client)})
+	}
+	if len(pool) == 0 {
+		return nil, false, fmt.Errorf("no rpc endpoint given")
+	}
+	if len(pool) == 1 {
+		return pool[0].Client, allIPC, nil
+	}
+
+	log.Printf("🔀 RPC failover across %d endpoints", len(pool))
+	return rpcclient.NewFailover(pool, RPC_MAX_FAILS, 30*time.Second, onError), allIPC, nil
+}
+
+// clampToHead caps EndBlock at the current head minus confirmations. Ranges that start
+// beyond it are refused outright rather than handed to the node as pending/future blocks.
+func clampToHead(ctx context.Context, client rpcclient.Client, config *IndexerConfig, confirmations uint64) error {
+	head, err := client.BlockNumber(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to open batch db: %v", err)
+		return fmt.Errorf("failed to get current head: %v", err)
 	}
-	defer db.Close()
+	if head < confirmations {
+		return fmt.Errorf("chain head %d has fewer than %d confirmations", head, confirmations)
+	}
+	safeHead := head - confirmations
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(BUCKET_NAME))
-		return err
-	})
+	if config.StartBlock > safeHead {
+		return fmt.Errorf("start block %d is beyond the confirmed head %d (head %d, %d confirmations); pending or future blocks cannot be indexed",
+			config.StartBlock, safeHead, head, confirmations)
+	}
+	if config.EndBlock > safeHead {
+		log.Printf("✂️  End block %d is past the confirmed head, clamping to %d (head %d, %d confirmations)",
+			config.EndBlock, safeHead, head, confirmations)
+		config.EndBlock = safeHead
+	}
+	return nil
+}
+
+// checkHeadFreshness warns when the node's head block is older than maxSkew, which
+// means the node is stalled, still syncing, or serving a stale view. The range is
+// clamped to that head regardless, so recent blocks would be missed.
+func checkHeadFreshness(ctx context.Context, client rpcclient.Client, maxSkew time.Duration, prom *metrics.Metrics) {
+	fresh, err := rpcclient.CheckHeadFreshness(ctx, client, maxSkew, time.Now())
 	if err != nil {
-		return fmt.Errorf("failed to create bucket: %v", err)
+		log.Printf("Warning: Could not check head freshness: %v", err)
+		return
 	}
+	if prom != nil {
+		prom.SetHeadFreshness(fresh.Skew.Seconds(), fresh.Stale)
+	}
+	if fresh.Stale {
+		log.Printf("⏰ Head block %d is %v old (max %v): the RPC node may be stalled or syncing, and later blocks will not be indexed",
+			fresh.Number, fresh.Skew.Round(time.Second), maxSkew)
+	}
+}
 
-	// Ensure we stay within the 500 block limit
-	blockRange := batch.EndBlock - batch.StartBlock + 1
-	if blockRange > MAX_BLOCK_RANGE {
-		return fmt.Errorf("batch %d exceeds max block range: %d > %d",
-			batch.BatchID, blockRange, MAX_BLOCK_RANGE)
+// checkContractCode verifies the contract exists at StartBlock. mode "strict" fails when
+// it has no code there (usually a misconfigured start block), "lenient" advances
+// StartBlock to the deployment block, and "off" skips the check. Both modes need
+// eth_getCode at historical blocks, i.e. an archive node.
+func checkContractCode(ctx context.Context, client rpcclient.Client, config *IndexerConfig, mode string) error {
+	if mode == "off" {
+		return nil
+	}
+	if mode != "strict" && mode != "lenient" {
+		return fmt.Errorf("unknown code check %q (want strict, lenient or off)", mode)
 	}
 
-	query := ethereum.FilterQuery{
-		FromBlock: big.NewInt(int64(batch.StartBlock)),
-		ToBlock:   big.NewInt(int64(batch.EndBlock)),
-		Addresses: []common.Address{common.HexToAddress(CONTRACT_ADDR)},
-		Topics:    [][]common.Hash{{common.HexToHash(EVENT_TOPIC)}},
+	hasCode := func(block uint64) (bool, error) { return contractHasCode(ctx, client, block) }
+
+	ok, err := hasCode(config.StartBlock)
+	if err != nil || ok {
+		return err
+	}
+	if mode == "strict" {
+		return fmt.Errorf("contract %s has no code at start block %d; check the start block or use -code-check=lenient",
+			CONTRACT_ADDR, config.StartBlock)
 	}
 
-	logs, err := h.client.FilterLogs(context.Background(), query)
+	ok, err = hasCode(config.EndBlock)
 	if err != nil {
-		return fmt.Errorf("worker %d batch %d failed to get logs: %v", batch.WorkerID, batch.BatchID, err)
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("contract %s has no code anywhere in blocks %d-%d", CONTRACT_ADDR, config.StartBlock, config.EndBlock)
 	}
 
-	var totalGas uint64
+	// Binary search for the first block with code: no code at lo, code at hi
+	lo, hi := config.StartBlock, config.EndBlock
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		ok, err := hasCode(mid)
+		if err != nil {
+			return err
+		}
+		if ok {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(BUCKET_NAME))
+	log.Printf("⏩ Contract deployed at block %d, advancing start block from %d", hi, config.StartBlock)
+	config.StartBlock = hi
+	return nil
+}
 
-		for i, logEntry := range logs {
-			block, err := h.client.BlockByHash(context.Background(), logEntry.BlockHash)
-			if err != nil {
-				return fmt.Errorf("failed to get block %d: %v", logEntry.BlockNumber, err)
-			}
+// contractHasCode reports whether CONTRACT_ADDR has code at block
+func contractHasCode(ctx context.Context, client rpcclient.Client, block uint64) (bool, error) {
+	code, err := client.CodeAt(ctx, common.HexToAddress(CONTRACT_ADDR), new(big.Int).SetUint64(block))
+	if err != nil {
+		return false, fmt.Errorf("eth_getCode at block %d failed: %v", block, err)
+	}
+	return len(code) > 0, nil
+}
 
-			// Get transaction details for gas analysis
-			tx, _, err := h.client.TransactionByHash(context.Background(), logEntry.TxHash)
-			if err != nil {
-				log.Printf("Warning: Could not get transaction %s: %v", logEntry.TxHash.Hex(), err)
-			}
+// checkCodeEnd detects a contract that self-destructs inside the range: code at
+// StartBlock but none at EndBlock. The first block without code is found by binary
+// search; it can still carry logs from the destroying transaction, so with mode "stop"
+// EndBlock is lowered to it and later windows, which would all come back empty, are
+// never queried. "warn" only logs the transition and "off" skips the check. Like
+// -code-check, it needs eth_getCode at historical blocks.
+func checkCodeEnd(ctx context.Context, client rpcclient.Client, config *IndexerConfig, mode string) (*SelfDestruct, error) {
+	if mode == "off" {
+		return nil, nil
+	}
+	if mode != "stop" && mode != "warn" {
+		return nil, fmt.Errorf("unknown code end check %q (want stop, warn or off)", mode)
+	}
 
-			var gasUsed uint64
-			if tx != nil {
-				gasUsed = tx.Gas()
-				totalGas += gasUsed
-			}
+	ok, err := contractHasCode(ctx, client, config.EndBlock)
+	if err != nil || ok {
+		return nil, err
+	}
+	if ok, err = contractHasCode(ctx, client, config.StartBlock); err != nil || !ok {
+		// Never had code in range, so nothing disappeared; -code-check covers this case
+		return nil, err
+	}
 
-			entry := LogEntry{
-				Index:       batch.StartIndex + uint64(i),
-				BlockNumber: logEntry.BlockNumber,
-				ParentHash:  block.ParentHash().Hex(),
-				L1InfoRoot:  common.Bytes2Hex(logEntry.Data),
-				Timestamp:   block.Time(),
-				GasUsed:     gasUsed,
-				TxHash:      logEntry.TxHash.Hex(),
-				LogIndex:    uint64(logEntry.Index),
-			}
+	// Binary search for the first block without code: code at lo, none at hi
+	lo, hi := config.StartBlock, config.EndBlock
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		ok, err := contractHasCode(ctx, client, mid)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
 
-			data, err := json.Marshal(entry)
-			if err != nil {
-				return fmt.Errorf("failed to marshal entry: %v", err)
-			}
+	event := &SelfDestruct{Block: hi, RequestedEnd: config.EndBlock, Stopped: mode == "stop"}
+	if event.Stopped {
+		log.Printf("💥 Contract %s has no code from block %d on (self-destructed); ending the range there instead of %d",
+			CONTRACT_ADDR, hi, config.EndBlock)
+		config.EndBlock = hi
+	} else {
+		log.Printf("💥 Contract %s has no code from block %d on (self-destructed); blocks %d-%d will be queried anyway",
+			CONTRACT_ADDR, hi, hi+1, config.EndBlock)
+	}
+	return event, nil
+}
 
-			err = bucket.Put(uint64ToBytes(entry.Index), data)
-			if err != nil {
-				return fmt.Errorf("failed to store entry: %v", err)
-			}
+// dateBlockCache persists resolved date boundaries per chain, since a block's timestamp
+// never changes once it is final and each resolution costs ~30 header fetches
+type dateBlockCache struct {
+	path   string
+	Blocks map[string]uint64 `json:"blocks"` // RFC3339 time -> first block at or after it
+}
 
-			atomic.AddInt64(&h.processed, 1)
+func loadDateBlockCache(ctx context.Context, client rpcclient.Client) (*dateBlockCache, error) {
+	genesis, err := client.HeaderByNumber(ctx, big.NewInt(0))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get genesis header: %v", err)
+	}
+	cache := &dateBlockCache{
+		path:   filepath.Join(PLAN_CACHE_DIR, fmt.Sprintf("date_blocks_%x.json", genesis.Hash().Bytes()[:8])),
+		Blocks: make(map[string]uint64),
+	}
+	if data, err := os.ReadFile(cache.path); err == nil {
+		if err := json.Unmarshal(data, cache); err != nil {
+			log.Printf("⚠️  Ignoring unreadable date cache %s: %v", cache.path, err)
+			cache.Blocks = make(map[string]uint64)
 		}
+	}
+	return cache, nil
+}
 
-		return nil
-	})
+func (c *dateBlockCache) save() error {
+	if err := os.MkdirAll(PLAN_CACHE_DIR, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, data, 0644)
+}
 
-	processingTime := time.Since(startTime)
-	batch.ProcessingTime = processingTime
-	batch.GasAnalyzed = totalGas
+// blockTimeAt returns the timestamp of block n
+func blockTimeAt(ctx context.Context, client rpcclient.Client, n uint64) (uint64, error) {
+	header, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(n))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get header %d: %v", n, err)
+	}
+	return header.Time, nil
+}
 
-	h.mu.Lock()
-	h.metrics.TotalGasAnalyzed += totalGas
-	h.mu.Unlock()
+// firstBlockAtOrAfter binary-searches block timestamps (assumed never to decrease) for
+// the first block at or after t. It returns head+1 when t is past the head block.
+func firstBlockAtOrAfter(ctx context.Context, client rpcclient.Client, t time.Time, head uint64, cache *dateBlockCache) (uint64, error) {
+	key := t.UTC().Format(time.RFC3339)
+	if block, ok := cache.Blocks[key]; ok {
+		return block, nil
+	}
 
-	atomic.AddInt64(&h.batchCounter, 1)
-	completedBatches := atomic.LoadInt64(&h.batchCounter)
+	target := uint64(t.Unix())
+	blockTime := func(n uint64) (uint64, error) { return blockTimeAt(ctx, client, n) }
 
-	log.Printf("✅ Worker %d | Batch %d/%d: %d events in %v (%.1f events/sec) [%d/%d batches complete]",
-		batch.WorkerID, batch.BatchID, h.metrics.TotalBatches, len(logs),
-		processingTime, float64(len(logs))/processingTime.Seconds(),
-		completedBatches, h.metrics.TotalBatches)
+	headTime, err := blockTime(head)
+	if err != nil {
+		return 0, err
+	}
+	if headTime < target {
+		return head + 1, nil // not final yet, so not cached
+	}
 
-	return err
+	genesisTime, err := blockTime(0)
+	if err != nil {
+		return 0, err
+	}
+	if genesisTime >= target {
+		cache.Blocks[key] = 0
+		return 0, nil
+	}
+
+	// Invariant: block lo is before t, block hi is at or after it
+	lo, hi := uint64(0), head
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		ts, err := blockTime(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ts >= target {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+
+	cache.Blocks[key] = hi
+	return hi, nil
 }
 
-func (h *HyperscaleIndexer) consolidateAllBatches(batches []BatchInfo) error {
-	log.Println("🔄 Initiating unified database consolidation...")
+// widenDateBoundary re-checks, one by one, the blocks within tolerance of boundary, the
+// binary-search result for t. Some chains and testnets have timestamps that step back
+// now and then, so a block just before the boundary can be at or after t, and one just
+// after it before t. It returns the first block of the window at or after t, where a
+// range should start, and one past the last block before t, where a range should stop,
+// so neither boundary cuts such blocks off. Blocks outside the window are taken to be
+// ordered. With tolerance 0 both results are boundary and nothing is fetched.
+func widenDateBoundary(ctx context.Context, client rpcclient.Client, t time.Time, boundary, head, tolerance uint64) (start, stop uint64, err error) {
+	start, stop = boundary, boundary
+	if tolerance == 0 {
+		return start, stop, nil
+	}
+	target := uint64(t.Unix())
+	from := uint64(0)
+	if boundary > tolerance {
+		from = boundary - tolerance
+	}
+	to := boundary + tolerance
+	if to > head {
+		to = head
+	}
+
+	for n := from; n <= to; n++ {
+		ts, err := blockTimeAt(ctx, client, n)
+		if err != nil {
+			return 0, 0, err
+		}
+		if ts >= target && n < start {
+			start = n
+		}
+		if ts < target && n+1 > stop {
+			stop = n + 1
+		}
+	}
+	if start != boundary || stop != boundary {
+		log.Printf("🕰️  Out-of-order timestamps around block %d for %s: range starts at %d, stops before %d",
+			boundary, t.UTC().Format(time.RFC3339), start, stop)
+	}
+	return start, stop, nil
+}
 
-	finalDb, err := bolt.Open(FINAL_DB, 0600, &bolt.Options{Timeout: 5 * time.Second})
+// resolveDateRange sets StartBlock to the first block of startDate and EndBlock to the
+// last block of endDate (UTC days, YYYY-MM-DD). Empty dates leave the bound unchanged.
+// Each boundary is widened over blocks within tolerance of it, see widenDateBoundary.
+func resolveDateRange(ctx context.Context, client rpcclient.Client, config *IndexerConfig, startDate, endDate string, tolerance uint64) error {
+	if startDate == "" && endDate == "" {
+		return nil
+	}
+	head, err := client.BlockNumber(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to open final consolidated db: %v", err)
+		return fmt.Errorf("failed to get current head: %v", err)
+	}
+	cache, err := loadDateBlockCache(ctx, client)
+	if err != nil {
+		return err
 	}
-	defer finalDb.Close()
 
-	err = finalDb.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(BUCKET_NAME))
+	if startDate != "" {
+		day, err := time.Parse("2006-01-02", startDate)
 		if err != nil {
-			return err
+			return fmt.Errorf("invalid -start-date %q, want YYYY-MM-DD", startDate)
 		}
-		_, err = tx.CreateBucketIfNotExists([]byte("metadata"))
+		block, err := firstBlockAtOrAfter(ctx, client, day, head, cache)
 		if err != nil {
 			return err
 		}
-		_, err = tx.CreateBucketIfNotExists([]byte("batch_info"))
-		return err
-	})
-	if err != nil {
-		return fmt.Errorf("failed to create buckets in final db: %v", err)
-	}
-
+		if block, _, err = widenDateBoundary(ctx, client, day, block, head, tolerance); err != nil {
+			return err
+		}
+		if block > head {
+			return fmt.Errorf("start date %s is after the chain head", startDate)
+		}
+		log.Printf("📅 %s 00:00 UTC starts at block %d", startDate, block)
+		config.StartBlock = block
+	}
+
+	if endDate != "" {
+		day, err := time.Parse("2006-01-02", endDate)
+		if err != nil {
+			return fmt.Errorf("invalid -end-date %q, want YYYY-MM-DD", endDate)
+		}
+		next, err := firstBlockAtOrAfter(ctx, client, day.AddDate(0, 0, 1), head, cache)
+		if err != nil {
+			return err
+		}
+		if _, next, err = widenDateBoundary(ctx, client, day.AddDate(0, 0, 1), next, head, tolerance); err != nil {
+			return err
+		}
+		if next == 0 {
+			return fmt.Errorf("end date %s is before the genesis block", endDate)
+		}
+		log.Printf("📅 %s 23:59:59 UTC ends at block %d", endDate, next-1)
+		config.EndBlock = next - 1
+	}
+
+	if err := cache.save(); err != nil {
+		log.Printf("⚠️  Failed to save date cache: %v", err)
+	}
+	return nil
+}
+
+// putFinalLog writes an entry into the logs bucket of a final DB. Once the service has
+// opened the DB it keeps a log count and secondary indexes beside the logs, which
+// storage.PutRawLog updates along with the entry.
+func putFinalLog(tx *bolt.Tx, bucket *bolt.Bucket, k, v []byte) error {
+	if tx.Bucket([]byte(storage.BucketMeta)) == nil {
+		return bucket.Put(k, v)
+	}
+	return storage.PutRawLog(tx, k, v)
+}
+
+// lastIndexedPosition returns the block number and index of the highest entry in an
+// existing final DB. ok is false when the DB does not exist or holds no logs.
+func lastIndexedPosition(dbPath string) (lastBlock, lastIndex uint64, ok bool, err error) {
+	if _, statErr := os.Stat(dbPath); os.IsNotExist(statErr) {
+		return 0, 0, false, nil
+	}
+
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{ReadOnly: true, Timeout: 5 * time.Second})
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("failed to open %s: %v", dbPath, err)
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(BUCKET_NAME))
+		if bucket == nil {
+			return nil
+		}
+		k, v := bucket.Cursor().Last()
+		if k == nil {
+			return nil
+		}
+		var entry LogEntry
+		if err := json.Unmarshal(v, &entry); err != nil {
+			return err
+		}
+		lastBlock, lastIndex, ok = entry.BlockNumber, bytesToUint64(k), true
+		return nil
+	})
+	return lastBlock, lastIndex, ok, err
+}
+
+// indexBase returns the first index to assign. A namespace n reserves the index space
+// [n<<56, (n+1)<<56) so the outputs of up to 256 indexers can be concatenated without
+// collisions; base sets an arbitrary start instead. Setting both is refused.
+func indexBase(base uint64, namespace int) (uint64, error) {
+	if namespace < 0 {
+		return base, nil
+	}
+	if namespace > 255 {
+		return 0, fmt.Errorf("index namespace %d out of range 0-255", namespace)
+	}
+	if base != 0 {
+		return 0, fmt.Errorf("-index-base and -index-namespace are mutually exclusive")
+	}
+	return uint64(namespace) << 56, nil
+}
+
+// resolveOverlap compares the requested range with what FINAL_DB already holds.
+// With policy "skip" the start is moved past the indexed range; with "error" any
+// overlap is refused. Appended entries continue from the existing last index.
+func resolveOverlap(config *IndexerConfig, policy string) error {
+	lastBlock, lastIndex, ok, err := lastIndexedPosition(FINAL_DB)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	if lastIndex+1 > config.StartIndex {
+		config.StartIndex = lastIndex + 1
+	}
+
+	if config.StartBlock > lastBlock {
+		log.Printf("📎 Appending after existing index: last block %d, next index %d", lastBlock, config.StartIndex)
+		return nil
+	}
+
+	switch policy {
+	case "skip":
+		log.Printf("⏭️  Blocks %d-%d are already indexed in %s, starting at block %d",
+			config.StartBlock, lastBlock, FINAL_DB, lastBlock+1)
+		config.StartBlock = lastBlock + 1
+		return nil
+	case "error":
+		return fmt.Errorf("requested start block %d overlaps %s which is indexed up to block %d; use -start above it or -overlap skip",
+			config.StartBlock, FINAL_DB, lastBlock)
+	default:
+		return fmt.Errorf("unknown overlap policy %q (want skip or error)", policy)
+	}
+}
+
+// checkFileDescriptorLimit reads RLIMIT_NOFILE and derives how many worker DBs may be
+// open at once. Each worker holds one DB file plus roughly one RPC connection, so the
+// usable budget is the soft limit minus FD_RESERVE minus one socket per worker.
+func checkFileDescriptorLimit(numWorkers, requested int) (int, error) {
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil {
+		log.Printf("Warning: Could not read file descriptor limit: %v", err)
+		return requested, nil
+	}
+
+	available := int64(rl.Cur) - FD_RESERVE - int64(numWorkers)
+	log.Printf("🗂️  File descriptor limit: soft=%d hard=%d | %d available for worker DBs", rl.Cur, rl.Max, available)
+
+	if available < 1 {
+		return 0, fmt.Errorf("file descriptor limit %d is too low for %d workers; raise it (ulimit -n) to at least %d or reduce workers",
+			rl.Cur, numWorkers, FD_RESERVE+2*numWorkers)
+	}
+
+	limit := requested
+	if limit <= 0 {
+		limit = numWorkers
+	}
+	if int64(limit) > available {
+		log.Printf("⚠️  Capping concurrently open worker DBs at %d (requested %d) to stay under the fd limit; raise ulimit -n for full concurrency",
+			available, limit)
+		limit = int(available)
+	}
+	return limit, nil
+}
+
+func (h *HyperscaleIndexer) generateAdaptiveBatches() ([]BatchInfo, error) {
+	planPath := h.planCachePath()
+	if !h.config.RefreshPlan {
+		plan, err := loadBatchPlan(planPath)
+		if err == nil {
+			err = h.checkPlan(plan)
+		}
+		if err == nil {
+			log.Printf("♻️  Reusing cached batch plan %s (%d windows, no pre-analysis needed)", planPath, len(plan.Windows))
+			return h.batchesFromPlan(plan), nil
+		}
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: Ignoring batch plan %s: %v", planPath, err)
+		}
+	}
+
+	totalBlocks := h.config.EndBlock - h.config.StartBlock + 1
+
+	// Calculate number of batches needed based on the max block range constraint
+	numBatches := int((totalBlocks + h.config.MaxBlockRange - 1) / h.config.MaxBlockRange) // Ceiling division
+
+	plan := &BatchPlan{
+		Contract:       contractsKey(),
+		Topic:          topicsKey(),
+		StartBlock:     h.config.StartBlock,
+		EndBlock:       h.config.EndBlock,
+		MaxBlockRange:  h.config.MaxBlockRange,
+		ValidateTopic0: h.config.ValidateTopic0,
+		Hooks:          hookNames(),
+		Windows:        make([]PlanWindow, 0, numBatches),
+	}
+
+	log.Printf("🔄 Adaptive Range Analysis: %d total blocks requires %d batches (max %d blocks each)",
+		totalBlocks, numBatches, h.config.MaxBlockRange)
+
+	bloomDb := openBloomIndex(FINAL_DB)
+	if bloomDb != nil {
+		defer bloomDb.Close()
+	}
+	var bloomSkipped int
+
+	// Lay out every window first; only those not ruled out by stored blooms need an RPC
+	var pending []int
+	for startBlock := h.config.StartBlock; startBlock <= h.config.EndBlock; {
+		endBlock := startBlock + h.config.MaxBlockRange - 1
+		if endBlock > h.config.EndBlock {
+			endBlock = h.config.EndBlock
+		}
+
+		plan.Windows = append(plan.Windows, PlanWindow{StartBlock: startBlock, EndBlock: endBlock})
+		if bloomDb != nil && bloomsExclude(bloomDb, startBlock, endBlock) {
+			bloomSkipped++
+		} else {
+			pending = append(pending, len(plan.Windows)-1)
+		}
+
+		startBlock = endBlock + 1
+	}
+
+	analyze := h.preAnalyze
+	if h.config.PlanStrategy == "batch" && h.batcher != nil {
+		analyze = h.preAnalyzeBatched
+	}
+	if err := analyze(plan.Windows, pending); err != nil {
+		return nil, err
+	}
+
+	if bloomSkipped > 0 {
+		log.Printf("🌸 Skipped pre-analysis of %d windows ruled out by stored block blooms", bloomSkipped)
+	}
+
+	if err := saveBatchPlan(planPath, plan); err != nil {
+		log.Printf("Warning: Failed to cache batch plan: %v", err)
+	}
+
+	return h.batchesFromPlan(plan), nil
+}
+
+// preAnalyze fills in LogCount for the windows at the pending positions using a pool of
+// PlanWorkers, throttled to PlanRate queries per second. Each result is written back to
+// its own position, so the plan (and every StartIndex derived from it) is identical to
+// a sequential run.
+func (h *HyperscaleIndexer) preAnalyze(windows []PlanWindow, pending []int) error {
+	workers := h.config.PlanWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+	if workers > len(pending) {
+		workers = len(pending)
+	}
+
+	var throttle <-chan time.Time
+	if h.config.PlanRate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(h.config.PlanRate))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var firstErr error
+	var errOnce sync.Once
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pos := range jobs {
+				w := &windows[pos]
+				query := ethereum.FilterQuery{
+					FromBlock: new(big.Int).SetUint64(w.StartBlock),
+					ToBlock:   new(big.Int).SetUint64(w.EndBlock),
+					Addresses: contracts.Addresses(),
+					Topics:    topicFilter(),
+				}
+
+				logs, err := h.filterLogs(ctx, query)
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = fmt.Errorf("failed to pre-analyze batch %d (blocks %d-%d): %v",
+							pos, w.StartBlock, w.EndBlock, err)
+						cancel()
+					})
+					continue
+				}
+				w.LogCount = uint64(len(logs))
+			}
+		}()
+	}
+
+feed:
+	for _, pos := range pending {
+		if throttle != nil {
+			select {
+			case <-throttle:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+		select {
+		case jobs <- pos:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return firstErr
+}
+
+// preAnalyzeBatched is the PlanStrategy batch alternative to preAnalyze: the windows'
+// eth_getLogs queries go out PlanBatchSize at a time as JSON-RPC batches, one round trip
+// per batch instead of per window, with PlanRate limiting batches per second. A window
+// whose element fails, e.g. over the provider's result cap, is retried alone through
+// filterLogs, so the counts match a per-window run.
+func (h *HyperscaleIndexer) preAnalyzeBatched(windows []PlanWindow, pending []int) error {
+	size := h.config.PlanBatchSize
+	if size <= 0 {
+		size = 1
+	}
+
+	var throttle <-chan time.Time
+	if h.config.PlanRate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(h.config.PlanRate))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	ctx := context.Background()
+	for start := 0; start < len(pending); start += size {
+		chunk := pending[start:min(start+size, len(pending))]
+		if throttle != nil {
+			<-throttle
+		}
+
+		results := make([][]types.Log, len(chunk))
+		elems := make([]rpc.BatchElem, len(chunk))
+		for i, pos := range chunk {
+			elems[i] = rpc.BatchElem{
+				Method: "eth_getLogs",
+				Args:   []interface{}{filterArg(windows[pos].StartBlock, windows[pos].EndBlock)},
+				Result: &results[i],
+			}
+		}
+		if err := h.batcher.BatchCallContext(ctx, elems); err != nil {
+			return fmt.Errorf("failed to pre-analyze windows %d-%d in a batch: %v", chunk[0], chunk[len(chunk)-1], err)
+		}
+
+		for i, pos := range chunk {
+			w := &windows[pos]
+			if elems[i].Error == nil {
+				w.LogCount = uint64(len(h.dropUnexpectedTopics(h.dropStrayLogs(results[i], w.StartBlock, w.EndBlock))))
+				continue
+			}
+			logs, err := h.filterLogs(ctx, ethereum.FilterQuery{
+				FromBlock: new(big.Int).SetUint64(w.StartBlock),
+				ToBlock:   new(big.Int).SetUint64(w.EndBlock),
+				Addresses: contracts.Addresses(),
+				Topics:    topicFilter(),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to pre-analyze batch %d (blocks %d-%d): %v",
+					pos, w.StartBlock, w.EndBlock, err)
+			}
+			w.LogCount = uint64(len(logs))
+		}
+	}
+	return nil
+}
+
+// filterArg builds the eth_getLogs parameter object for the indexed contract and event
+func filterArg(from, to uint64) map[string]interface{} {
+	return map[string]interface{}{
+		"address":   contracts.Addresses(),
+		"topics":    topicFilter(),
+		"fromBlock": hexutil.EncodeUint64(from),
+		"toBlock":   hexutil.EncodeUint64(to),
+	}
+}
+
+// batchesFromPlan assigns workers, db paths and starting indices to the windows of a plan.
+// Windows known to be empty are dropped unless KeepEmpty is set, or StoreBlooms needs
+// every block visited; they contribute no indices, so numbering stays contiguous.
+func (h *HyperscaleIndexer) batchesFromPlan(plan *BatchPlan) []BatchInfo {
+	batches := make([]BatchInfo, 0, len(plan.Windows))
+	currentIndex := h.config.StartIndex
+	keepEmpty := h.config.KeepEmpty || h.config.StoreBlooms
+	var skipped int
+
+	for batchID, window := range plan.Windows {
+		if window.LogCount == 0 && !keepEmpty {
+			skipped++
+			continue
+		}
+
+		dbPath := filepath.Join(DB_DIR, fmt.Sprintf("adaptive_batch_%d.db", batchID))
+		batch := BatchInfo{
+			WorkerID:   batchID % h.config.NumWorkers, // Round-robin assignment to workers
+			BatchID:    batchID,
+			StartBlock: window.StartBlock,
+			EndBlock:   window.EndBlock,
+			StartIndex: currentIndex,
+			LogCount:   window.LogCount,
+			DbPath:     dbPath,
+		}
+
+		batches = append(batches, batch)
+		currentIndex += window.LogCount
+
+		log.Printf("📦 Batch %d: Blocks %d-%d (%d blocks) | Events: %d | Worker: %d | Starting Index: %d",
+			batchID, window.StartBlock, window.EndBlock, window.EndBlock-window.StartBlock+1,
+			window.LogCount, batch.WorkerID, batch.StartIndex)
+	}
+
+	if skipped > 0 {
+		log.Printf("⏭️  Skipped %d empty windows (no batch DB needed)", skipped)
+	}
+
+	h.metrics.TotalBatches = len(batches)
+	log.Printf("✅ Generated %d adaptive batches distributed across %d workers", len(batches), h.config.NumWorkers)
+
+	return batches
+}
+
+// planCachePath derives the plan cache file from everything that shapes the plan,
+// including the options that change which logs are counted
+func (h *HyperscaleIndexer) planCachePath() string {
+	return filepath.Join(PLAN_CACHE_DIR, fmt.Sprintf("plan_%s.json", h.planKey()[:16]))
+}
+
+// planKey hashes the settings that shape the batch plan
+func (h *HyperscaleIndexer) planKey() string {
+	key := fmt.Sprintf("%s|%s|%d|%d|%d|%t|%s", contractsKey(), topicsKey(),
+		h.config.StartBlock, h.config.EndBlock, h.config.MaxBlockRange,
+		h.config.ValidateTopic0, strings.Join(hookNames(), ","))
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkPlan rejects a cached plan that was made for other settings, or whose windows do
+// not tile the configured range, instead of trusting the file name alone
+func (h *HyperscaleIndexer) checkPlan(plan *BatchPlan) error {
+	if plan.Contract != contractsKey() || plan.Topic != topicsKey() ||
+		plan.StartBlock != h.config.StartBlock || plan.EndBlock != h.config.EndBlock ||
+		plan.MaxBlockRange != h.config.MaxBlockRange || plan.ValidateTopic0 != h.config.ValidateTopic0 ||
+		!slices.Equal(plan.Hooks, hookNames()) {
+		return fmt.Errorf("plan was made for other settings")
+	}
+	next := plan.StartBlock
+	for _, w := range plan.Windows {
+		if w.StartBlock != next || w.EndBlock < w.StartBlock || w.EndBlock-w.StartBlock >= plan.MaxBlockRange {
+			return fmt.Errorf("window %d-%d does not follow block %d", w.StartBlock, w.EndBlock, next-1)
+		}
+		next = w.EndBlock + 1
+	}
+	if len(plan.Windows) == 0 || next != plan.EndBlock+1 {
+		return fmt.Errorf("windows do not cover blocks %d-%d", plan.StartBlock, plan.EndBlock)
+	}
+	return nil
+}
+
+func loadBatchPlan(path string) (*BatchPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan BatchPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("failed to decode batch plan: %v", err)
+	}
+	return &plan, nil
+}
+
+func saveBatchPlan(path string, plan *BatchPlan) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file first so an interrupted run never leaves a truncated plan
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (h *HyperscaleIndexer) processAdaptiveBatch(batch BatchInfo) error {
+	h.dbSlots <- struct{}{}
+	defer func() { <-h.dbSlots }()
+
+	startTime := time.Now()
+
+	db, err := bolt.Open(batch.DbPath, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return fmt.Errorf("failed to open batch db: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(BUCKET_NAME))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create bucket: %v", err)
+	}
+
+	// Ensure we stay within the provider's block range limit
+	blockRange := batch.EndBlock - batch.StartBlock + 1
+	if blockRange > h.config.MaxBlockRange {
+		return fmt.Errorf("batch %d exceeds max block range: %d > %d",
+			batch.BatchID, blockRange, h.config.MaxBlockRange)
+	}
+
+	query := ethereum.FilterQuery{
+		FromBlock: big.NewInt(int64(batch.StartBlock)),
+		ToBlock:   big.NewInt(int64(batch.EndBlock)),
+		Addresses: contracts.Addresses(),
+		Topics:    topicFilter(),
+	}
+
+	logs, err := h.filterLogs(context.Background(), query)
+	if err != nil {
+		return fmt.Errorf("worker %d batch %d failed to get logs: %v", batch.WorkerID, batch.BatchID, err)
+	}
+	// The batch owns exactly LogCount indices from StartIndex; storing a different number
+	// would shift into, and overwrite, the next batch's range at consolidation
+	if uint64(len(logs)) != batch.LogCount {
+		atomic.AddInt64(&h.stalePlan, 1)
+		return fmt.Errorf("batch %d (blocks %d-%d) returned %d logs but the plan counted %d",
+			batch.BatchID, batch.StartBlock, batch.EndBlock, len(logs), batch.LogCount)
+	}
+
+	var totalGas, unenriched, dropped, deadLettered, verifyFailures uint64
+	totalFees := new(big.Int)
+	receipts := make(map[common.Hash]*blockReceipts)
+	txReceipts := make(map[common.Hash]*types.Receipt)
+	txCounted := make(map[common.Hash]bool)
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(BUCKET_NAME))
+		dbTx := tx // tx is shadowed by each log's transaction below
+
+		for i, logEntry := range logs {
+			// A block that cannot be fetched, or comes back without plausible header
+			// fields, must not discard the rest of the batch; store the log un-enriched
+			// so a later enrichment pass can fill it in
+			var header *types.Header
+			block, err := h.fetchBlockWithRetry(logEntry.BlockHash)
+			if err == nil {
+				header, err = h.blockHeader(block, logEntry.BlockHash)
+			}
+			if err != nil {
+				log.Printf("Warning: Storing log %d (block %d) un-enriched: %v",
+					batch.StartIndex+uint64(i), logEntry.BlockNumber, err)
+				unenriched++
+			}
+			if h.config.VerifyReceipts && header != nil {
+				if err := h.verifyLog(header, &logEntry, receipts); err != nil {
+					log.Printf("🚨 Log %d (block %d) failed receipt verification: %v",
+						batch.StartIndex+uint64(i), logEntry.BlockNumber, err)
+					verifyFailures++
+				}
+			}
+
+			// The receipt has the gas the transaction actually used and the price it paid.
+			// A transaction's gas and fees count once per batch, however many logs it emitted.
+			gasUsed, price, err := h.txGas(logEntry.TxHash, header, txReceipts)
+			if err != nil {
+				log.Printf("Warning: Could not get gas used by transaction %s: %v", logEntry.TxHash.Hex(), err)
+			} else if !txCounted[logEntry.TxHash] {
+				txCounted[logEntry.TxHash] = true
+				totalGas += gasUsed
+				if price != nil {
+					totalFees.Add(totalFees, new(big.Int).Mul(price, new(big.Int).SetUint64(gasUsed)))
+				}
+			}
+
+			txIndex := uint64(logEntry.TxIndex)
+			entry := LogEntry{
+				Index:       batch.StartIndex + uint64(i),
+				BlockNumber: logEntry.BlockNumber,
+				Address:     logEntry.Address.Hex(),
+				L1InfoRoot:  common.Bytes2Hex(logEntry.Data),
+				GasUsed:     gasUsed,
+				TxHash:      logEntry.TxHash.Hex(),
+				TxIndex:     &txIndex,
+				LogIndex:    uint64(logEntry.Index),
+				Topics:      topicsToHex(logEntry.Topics),
+			}
+			if h.config.StoreRaw {
+				entry.RawLog = rawLog(logEntry)
+			}
+			if header != nil {
+				entry.ParentHash = header.ParentHash.Hex()
+				entry.Timestamp = header.Time
+				entry.Enriched = true
+			}
+			if price != nil {
+				entry.GasPrice = apitypes.NewBigInt(price)
+			}
+
+			data, outcome, err := h.processEntry(dbTx, entry, logEntry)
+			if err != nil {
+				return err
+			}
+			switch outcome {
+			case entryDropped:
+				dropped++
+				continue
+			case entryDeadLettered:
+				deadLettered++
+				continue
+			}
+
+			err = bucket.Put(uint64ToBytes(entry.Index), data)
+			if err != nil {
+				return fmt.Errorf("failed to store entry: %v", err)
+			}
+
+			atomic.AddInt64(&h.processed, 1)
+		}
+
+		return nil
+	})
+
+	if err == nil && h.config.StoreBlooms {
+		err = h.storeBlooms(db, batch)
+	}
+
+	if unenriched > 0 {
+		log.Printf("⚠️  Worker %d | Batch %d: %d logs stored without block data (enriched:false)",
+			batch.WorkerID, batch.BatchID, unenriched)
+	}
+	if verifyFailures > 0 {
+		log.Printf("🚨 Worker %d | Batch %d: %d logs do not match their block's receipts",
+			batch.WorkerID, batch.BatchID, verifyFailures)
+	}
+	if dropped > 0 {
+		log.Printf("🪝 Worker %d | Batch %d: processing hooks dropped %d logs",
+			batch.WorkerID, batch.BatchID, dropped)
+	}
+	if deadLettered > 0 {
+		log.Printf("📮 Worker %d | Batch %d: %d logs failed processing and were dead-lettered",
+			batch.WorkerID, batch.BatchID, deadLettered)
+	}
+
+	processingTime := time.Since(startTime)
+	batch.ProcessingTime = processingTime
+	if h.prom != nil {
+		h.prom.RecordBatchCompleted(processingTime.Seconds(), len(logs))
+	}
+	batch.GasAnalyzed = totalGas
+	batch.FeesWei = apitypes.NewBigInt(totalFees)
+	batch.Dropped = dropped
+	batch.DeadLettered = deadLettered
+	batch.VerifyFailures = verifyFailures
+
+	h.mu.Lock()
+	h.metrics.TotalGasAnalyzed += totalGas
+	h.metrics.WorkerBusyTime += processingTime
+	h.completed[batch.BatchID] = batch
+	h.mu.Unlock()
+
+	atomic.AddInt64(&h.batchCounter, 1)
+	completedBatches := atomic.LoadInt64(&h.batchCounter)
+
+	log.Printf("✅ Worker %d | Batch %d/%d: %d events in %v (%.1f events/sec) [%d/%d batches complete]",
+		batch.WorkerID, batch.BatchID, h.metrics.TotalBatches, len(logs),
+		processingTime, float64(len(logs))/processingTime.Seconds(),
+		completedBatches, h.metrics.TotalBatches)
+
+	return err
+}
+
+// tooManyResultsMarkers are fragments providers use when eth_getLogs hits a result cap
+var tooManyResultsMarkers = []string{
+	"query returned more than",
+	"more than 10000 results",
+	"too many results",
+	"response size exceeded",
+	"response size should not greater than",
+	"log response size exceeded",
+}
+
+// isTooManyResultsError reports whether err is a provider result-cap rejection
+func isTooManyResultsError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, marker := range tooManyResultsMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterLogs runs FilterLogs and, when the provider rejects the range for returning
+// too many results, splits it in half and retries recursively down to single blocks.
+// Halves are queried in order so the merged result keeps chain order.
+func (h *HyperscaleIndexer) filterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	from, to := query.FromBlock.Uint64(), query.ToBlock.Uint64()
+
+	logs, err := h.client.FilterLogs(ctx, query)
+	if err == nil {
+		return h.dropUnexpectedTopics(h.dropStrayLogs(logs, from, to)), nil
+	}
+	if !isTooManyResultsError(err) {
+		return nil, err
+	}
+
+	if from >= to {
+		return nil, fmt.Errorf("block %d alone exceeds the provider result cap: %v", from, err)
+	}
+
+	mid := from + (to-from)/2
+	log.Printf("✂️  Blocks %d-%d exceed the provider result cap, splitting at %d", from, to, mid)
+
+	lower, upper := query, query
+	lower.ToBlock = new(big.Int).SetUint64(mid)
+	upper.FromBlock = new(big.Int).SetUint64(mid + 1)
+
+	first, err := h.filterLogs(ctx, lower)
+	if err != nil {
+		return nil, err
+	}
+	second, err := h.filterLogs(ctx, upper)
+	if err != nil {
+		return nil, err
+	}
+	return append(first, second...), nil
+}
+
+// dropStrayLogs removes logs whose block lies outside [from, to]. Some providers serve
+// cached results that spill past the requested range; keeping them would shift every
+// index after them, since StartIndex assumes exactly the logs of the batch range.
+func (h *HyperscaleIndexer) dropStrayLogs(logs []types.Log, from, to uint64) []types.Log {
+	kept := logs[:0]
+	for _, l := range logs {
+		if l.BlockNumber < from || l.BlockNumber > to {
+			atomic.AddInt64(&h.strayLogs, 1)
+			log.Printf("⚠️  Dropped stray log from block %d (tx %s, logIndex %d) outside requested range %d-%d",
+				l.BlockNumber, l.TxHash.Hex(), l.Index, from, to)
+			continue
+		}
+		kept = append(kept, l)
+	}
+	return kept
+}
+
+// dropUnexpectedTopics removes logs whose topic0 is not one of eventTopics when
+// ValidateTopic0 is set. With several topics OR-ed in the filter, a provider bug or a
+// misconfigured filter would otherwise index a foreign event under the wrong name.
+// Like stray logs, they are dropped before indices are assigned.
+func (h *HyperscaleIndexer) dropUnexpectedTopics(logs []types.Log) []types.Log {
+	if !h.config.ValidateTopic0 || len(eventTopics) == 0 {
+		return logs
+	}
+	kept := logs[:0]
+	for _, l := range logs {
+		if len(l.Topics) == 0 || !isEventTopic(l.Topics[0]) {
+			atomic.AddInt64(&h.unexpectedTopics, 1)
+			topic0 := "none"
+			if len(l.Topics) > 0 {
+				topic0 = l.Topics[0].Hex()
+			}
+			log.Printf("⚠️  Dropped log from block %d (tx %s, logIndex %d) with unconfigured topic0 %s",
+				l.BlockNumber, l.TxHash.Hex(), l.Index, topic0)
+			continue
+		}
+		kept = append(kept, l)
+	}
+	return kept
+}
+
+// txGas returns the gas a transaction used and its effective gas price, from its receipt,
+// fetched once per batch through cache. A node that predates the receipt's
+// effectiveGasPrice field gets the price derived from the transaction and header; the
+// price is nil when that fails too.
+func (h *HyperscaleIndexer) txGas(txHash common.Hash, header *types.Header, cache map[common.Hash]*types.Receipt) (uint64, *big.Int, error) {
+	receipt, ok := cache[txHash]
+	if !ok {
+		var err error
+		if receipt, err = h.client.TransactionReceipt(context.Background(), txHash); err != nil {
+			return 0, nil, err
+		}
+		cache[txHash] = receipt
+	}
+	if receipt.EffectiveGasPrice != nil && receipt.EffectiveGasPrice.Sign() > 0 {
+		return receipt.GasUsed, receipt.EffectiveGasPrice, nil
+	}
+	tx, _, err := h.client.TransactionByHash(context.Background(), txHash)
+	if err != nil {
+		return receipt.GasUsed, nil, nil
+	}
+	return receipt.GasUsed, effectiveGasPrice(tx, header), nil
+}
+
+// effectiveGasPrice is what the sender paid per gas: the base fee plus the capped tip
+// for EIP-1559 blocks, or the legacy gas price when the block is unknown or pre-London
+func effectiveGasPrice(tx *types.Transaction, header *types.Header) *big.Int {
+	if header == nil || header.BaseFee == nil {
+		return tx.GasPrice()
+	}
+	tip, err := tx.EffectiveGasTip(header.BaseFee)
+	if err != nil {
+		return tx.GasPrice()
+	}
+	return tip.Add(tip, header.BaseFee)
+}
+
+// rawLog copies every field of a go-ethereum log for archival storage
+func rawLog(l types.Log) *apitypes.RawLog {
+	return &apitypes.RawLog{
+		Address:     l.Address.Hex(),
+		Topics:      topicsToHex(l.Topics),
+		Data:        hexutil.Encode(l.Data),
+		BlockNumber: l.BlockNumber,
+		TxHash:      l.TxHash.Hex(),
+		TxIndex:     l.TxIndex,
+		BlockHash:   l.BlockHash.Hex(),
+		Index:       l.Index,
+		Removed:     l.Removed,
+	}
+}
+
+// decodeRawLog rebuilds the go-ethereum log archived by rawLog
+func decodeRawLog(r *apitypes.RawLog) (types.Log, error) {
+	if !common.IsHexAddress(r.Address) {
+		return types.Log{}, fmt.Errorf("invalid address %q", r.Address)
+	}
+	data, err := hexutil.Decode(r.Data)
+	if err != nil {
+		return types.Log{}, fmt.Errorf("invalid data: %v", err)
+	}
+	topics := make([]common.Hash, len(r.Topics))
+	for i, topic := range r.Topics {
+		topics[i] = common.HexToHash(topic)
+	}
+	return types.Log{
+		Address:     common.HexToAddress(r.Address),
+		Topics:      topics,
+		Data:        data,
+		BlockNumber: r.BlockNumber,
+		TxHash:      common.HexToHash(r.TxHash),
+		TxIndex:     r.TxIndex,
+		BlockHash:   common.HexToHash(r.BlockHash),
+		Index:       r.Index,
+		Removed:     r.Removed,
+	}, nil
+}
+
+// eventTopics are the topic0 values indexed, OR-ed in every eth_getLogs filter; set by -topics
+var eventTopics = []common.Hash{common.HexToHash(EVENT_TOPIC)}
+
+// contracts are the addresses indexed, the Addresses of every eth_getLogs filter. Set
+// by -contracts-file and -factory before planning: batch indices are planned from the
+// counts it gives, so it must not change once batches exist.
+var contracts = indexer.NewContractSet(common.HexToAddress(CONTRACT_ADDR))
+
+// discovered are the child contracts -factory found in this run, written to the final
+// DB on consolidation so later runs keep indexing them
+var discovered []*apitypes.DiscoveredContract
+
+// contractsKey renders the contract addresses for plan cache keys; a single contract
+// keys as before
+func contractsKey() string {
+	addresses := contracts.Addresses()
+	keys := make([]string, len(addresses))
+	for i, address := range addresses {
+		keys[i] = strings.ToLower(address.Hex())
+	}
+	return strings.Join(keys, ",")
+}
+
+// discoverContracts scans [from, to] for the factory's creation events and returns a
+// record per child contract. A creation event whose child argument is not an address
+// fails the scan: it means -factory-child points at the wrong argument.
+func discoverContracts(ctx context.Context, client rpcclient.Client, watch *indexer.FactoryWatch, from, to, maxRange uint64) ([]*apitypes.DiscoveredContract, error) {
+	var found []*apitypes.DiscoveredContract
+	for start := from; start <= to; start += maxRange {
+		end := start + maxRange - 1
+		if end > to || end < start {
+			end = to
+		}
+		logs, err := client.FilterLogs(ctx, watch.Query(start, end))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch factory events in blocks %d-%d: %v", start, end, err)
+		}
+		for _, l := range logs {
+			if l.Removed {
+				continue
+			}
+			child, err := watch.Discovered(l)
+			if err != nil {
+				return nil, fmt.Errorf("block %d tx %s: %v", l.BlockNumber, l.TxHash.Hex(), err)
+			}
+			found = append(found, child)
+		}
+		if end == to {
+			break
+		}
+	}
+	return found, nil
+}
+
+// loadDiscoveredContracts reads the child contracts stored by earlier runs, so a run
+// appending to the final DB keeps indexing children created before its start block
+func loadDiscoveredContracts(dbPath string) ([]*apitypes.DiscoveredContract, error) {
+	if _, statErr := os.Stat(dbPath); os.IsNotExist(statErr) {
+		return nil, nil
+	}
+
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{ReadOnly: true, Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", dbPath, err)
+	}
+	defer db.Close()
+
+	var stored []*apitypes.DiscoveredContract
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(CONTRACTS_BUCKET))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var c apitypes.DiscoveredContract
+			if err := json.Unmarshal(v, &c); err != nil {
+				return fmt.Errorf("contract %s: %v", k, err)
+			}
+			stored = append(stored, &c)
+			return nil
+		})
+	})
+	return stored, err
+}
+
+// storeDiscoveredContracts records child contracts in the final DB; a contract already
+// stored keeps its first record
+func storeDiscoveredContracts(db *bolt.DB, found []*apitypes.DiscoveredContract) error {
+	if len(found) == 0 {
+		return nil
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(CONTRACTS_BUCKET))
+		if err != nil {
+			return err
+		}
+		for _, c := range found {
+			key := []byte(strings.ToLower(c.Address))
+			if bucket.Get(key) != nil {
+				continue
+			}
+			data, err := json.Marshal(c)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(key, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// topicFilter is the Topics of every eth_getLogs filter: topic0 matching any of
+// eventTopics, or no topic condition at all when eventTopics is empty
+func topicFilter() [][]common.Hash {
+	if len(eventTopics) == 0 {
+		return nil
+	}
+	return [][]common.Hash{eventTopics}
+}
+
+// isEventTopic reports whether topic is one of eventTopics
+func isEventTopic(topic common.Hash) bool {
+	for _, t := range eventTopics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// topicsKey renders eventTopics for plan cache keys; a single topic keys as before
+func topicsKey() string {
+	return strings.Join(topicsToHex(eventTopics), ",")
+}
+
+// parseTopics parses a comma-separated list of 32-byte topic hashes. An empty list
+// means every event of the contracts.
+func parseTopics(s string) ([]common.Hash, error) {
+	var topics []common.Hash
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		b, err := hexutil.Decode(part)
+		if err != nil || len(b) != common.HashLength {
+			return nil, fmt.Errorf("invalid topic %q: want a 0x-prefixed 32-byte hash", part)
+		}
+		topics = append(topics, common.BytesToHash(b))
+	}
+	return topics, nil
+}
+
+// topicsToHex renders log topics as 0x-prefixed hex strings
+func topicsToHex(topics []common.Hash) []string {
+	out := make([]string, len(topics))
+	for i, t := range topics {
+		out[i] = t.Hex()
+	}
+	return out
+}
+
+// storeBlooms saves the logsBloom of every block in the batch range, including blocks
+// without matching logs, so a later re-index for another event can pre-filter offline
+func (h *HyperscaleIndexer) storeBlooms(db *bolt.DB, batch BatchInfo) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(BLOOM_BUCKET))
+		if err != nil {
+			return err
+		}
+		for number := batch.StartBlock; number <= batch.EndBlock; number++ {
+			header, err := h.client.HeaderByNumber(context.Background(), new(big.Int).SetUint64(number))
+			if err != nil {
+				return fmt.Errorf("failed to get header %d for bloom: %v", number, err)
+			}
+			if err := bucket.Put(uint64ToBytes(number), header.Bloom.Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// openBloomIndex opens dbPath read-only when it holds stored blooms, otherwise returns nil
+func openBloomIndex(dbPath string) *bolt.DB {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil
+	}
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{ReadOnly: true, Timeout: 2 * time.Second})
+	if err != nil {
+		log.Printf("Warning: Could not open %s for bloom pre-filtering: %v", dbPath, err)
+		return nil
+	}
+
+	var hasBlooms bool
+	db.View(func(tx *bolt.Tx) error {
+		hasBlooms = tx.Bucket([]byte(BLOOM_BUCKET)) != nil
+		return nil
+	})
+	if !hasBlooms {
+		db.Close()
+		return nil
+	}
+	return db
+}
+
+// bloomsExclude reports whether stored blooms cover every block in [start, end] and
+// none of them can contain a log from one of the contracts with one of eventTopics. A
+// single missing bloom means the window cannot be ruled out.
+func bloomsExclude(db *bolt.DB, start, end uint64) bool {
+	addresses := contracts.Addresses()
+
+	excluded := true
+	db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(BLOOM_BUCKET))
+		for number := start; number <= end; number++ {
+			v := bucket.Get(uint64ToBytes(number))
+			if v == nil {
+				excluded = false
+				return nil
+			}
+			bloom := types.BytesToBloom(v)
+			if !bloomHasAny(bloom, addresses) {
+				continue
+			}
+			if len(eventTopics) == 0 {
+				excluded = false // every event is indexed, the address alone decides
+				return nil
+			}
+			for _, topic := range eventTopics {
+				if bloom.Test(topic.Bytes()) {
+					excluded = false
+					return nil
+				}
+			}
+		}
+		return nil
+	})
+	return excluded
+}
+
+// bloomHasAny reports whether the bloom may contain a log from any of the addresses
+func bloomHasAny(bloom types.Bloom, addresses []common.Address) bool {
+	for _, address := range addresses {
+		if bloom.Test(address.Bytes()) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchBlockWithRetry fetches a block, retrying with linear backoff before giving up
+func (h *HyperscaleIndexer) fetchBlockWithRetry(hash common.Hash) (*types.Block, error) {
+	var lastErr error
+	for attempt := 1; attempt <= BLOCK_RETRIES; attempt++ {
+		block, err := h.client.BlockByHash(context.Background(), hash)
+		if err == nil {
+			return block, nil
+		}
+		lastErr = err
+		if errors.Is(err, rpcclient.ErrCircuitOpen) {
+			break // the node is being left alone; the log is stored un-enriched
+		}
+		if attempt < BLOCK_RETRIES {
+			if h.prom != nil {
+				h.prom.RecordRPCRetry()
+			}
+			time.Sleep(time.Duration(attempt) * 500 * time.Millisecond)
+		}
+	}
+	return nil, fmt.Errorf("failed to get block %s after %d attempts: %v", hash.Hex(), BLOCK_RETRIES, lastErr)
+}
+
+// blockHeader returns the header of a fetched block once its fields pass
+// rpcclient.CheckHeader. With HeaderFallback, a block that fails is re-read as a header
+// alone, which some light and proxy endpoints serve in full when they do not for a
+// block. hash is the log's block hash: a partial header does not hash to it.
+func (h *HyperscaleIndexer) blockHeader(block *types.Block, hash common.Hash) (*types.Header, error) {
+	header := block.Header()
+	err := rpcclient.CheckHeader(header)
+	if err == nil {
+		return header, nil
+	}
+	if !h.config.HeaderFallback {
+		return nil, err
+	}
+	header, ferr := h.client.HeaderByHash(context.Background(), hash)
+	if ferr != nil {
+		return nil, fmt.Errorf("%v, header fallback failed: %v", err, ferr)
+	}
+	if err := rpcclient.CheckHeader(header); err != nil {
+		return nil, fmt.Errorf("%v, also from the header fallback", err)
+	}
+	if header.Hash() != hash {
+		return nil, fmt.Errorf("header fallback returned block %s for %s", header.Hash().Hex(), hash.Hex())
+	}
+	return header, nil
+}
+
+// openDBWithRetry opens a bolt DB, retrying with exponential backoff while the open
+// times out on the file lock (e.g. a busy disk or a lingering reader) until OpenRetry
+// has elapsed. Other errors, and any timeout with OpenRetry 0, fail straight away.
+func (h *HyperscaleIndexer) openDBWithRetry(path string, opts *bolt.Options) (*bolt.DB, error) {
+	start := time.Now()
+	delay := 250 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		db, err := bolt.Open(path, 0600, opts)
+		if err == nil {
+			return db, nil
+		}
+		if err != bolt.ErrTimeout || time.Since(start)+delay > h.config.OpenRetry {
+			if attempt > 1 {
+				return nil, fmt.Errorf("%v (after %d attempts over %v)", err, attempt, time.Since(start).Round(time.Millisecond))
+			}
+			return nil, err
+		}
+		log.Printf("🔒 Timed out locking %s (attempt %d), retrying in %v", path, attempt, delay)
+		time.Sleep(delay)
+		if delay *= 2; delay > 5*time.Second {
+			delay = 5 * time.Second
+		}
+	}
+}
+
+// blockReceipts is a block's receipts with the outcome of checking them against its header
+type blockReceipts struct {
+	receipts []*types.Receipt
+	err      error
+}
+
+// verifyLog checks l against the receipts of its block, which are fetched and checked
+// against the header's receiptsRoot and logsBloom once per block and kept in cache
+func (h *HyperscaleIndexer) verifyLog(header *types.Header, l *types.Log, cache map[common.Hash]*blockReceipts) error {
+	hash := header.Hash()
+	br, ok := cache[hash]
+	if !ok {
+		br = &blockReceipts{}
+		br.receipts, br.err = h.client.BlockReceipts(context.Background(), rpc.BlockNumberOrHashWithHash(hash, false))
+		if br.err != nil {
+			br.err = fmt.Errorf("failed to get receipts: %v", br.err)
+		} else {
+			br.err = verify.Receipts(header, br.receipts)
+		}
+		cache[hash] = br
+	}
+	if br.err != nil {
+		return br.err
+	}
+	return verify.Log(br.receipts, l)
+}
+
+// BulkCheckpoint records how far a run got: every batch up to CompletedBatches (in
+// plan order) has been fully committed to its worker DB. Batches finished out of order
+// after a gap are not counted, so the checkpoint never claims incomplete work. A later
+// run with the same plan skips those batches and merges their kept worker DBs.
+type BulkCheckpoint struct {
+	Plan             string      `json:"plan"`       // planKey of the run that saved it
+	StartIndex       uint64      `json:"startIndex"` // first index of that run
+	CompletedBatches int         `json:"completedBatches"`
+	LastBlock        uint64      `json:"lastBlock"`
+	NextIndex        uint64      `json:"nextIndex"`
+	Batches          []BatchInfo `json:"batches"` // the committed batches with their totals
+	SavedAt          time.Time   `json:"savedAt"`
+}
+
+// batchProgress tracks committed batches to derive the contiguous committed prefix
+type batchProgress struct {
+	batches  []BatchInfo
+	position map[int]int // BatchID -> position in batches
+	done     []bool
+	prefix   int // leading batches committed
+	mu       sync.Mutex
+}
+
+func newBatchProgress(batches []BatchInfo) *batchProgress {
+	p := &batchProgress{
+		batches:  batches,
+		position: make(map[int]int, len(batches)),
+		done:     make([]bool, len(batches)),
+	}
+	for i, b := range batches {
+		p.position[b.BatchID] = i
+	}
+	return p
+}
+
+// markDone records a committed batch and advances the prefix past it when possible
+func (p *batchProgress) markDone(batchID int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if i, ok := p.position[batchID]; ok {
+		p.done[i] = true
+	}
+	for p.prefix < len(p.done) && p.done[p.prefix] {
+		p.prefix++
+	}
+}
+
+// checkpoint describes the committed prefix; startBlock and startIndex apply when it is empty
+func (p *batchProgress) checkpoint(startBlock, startIndex uint64) BulkCheckpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cp := BulkCheckpoint{CompletedBatches: p.prefix, NextIndex: startIndex, SavedAt: time.Now()}
+	if startBlock > 0 {
+		cp.LastBlock = startBlock - 1
+	}
+	if p.prefix > 0 {
+		last := p.batches[p.prefix-1]
+		cp.LastBlock = last.EndBlock
+		cp.NextIndex = last.StartIndex + last.LogCount
+	}
+	return cp
+}
+
+// saveCheckpoint writes the committed prefix to CheckpointPath, if configured
+func (h *HyperscaleIndexer) saveCheckpoint() {
+	if h.config.CheckpointPath == "" || h.progress == nil {
+		return
+	}
+
+	cp := h.progress.checkpoint(h.config.StartBlock, h.config.StartIndex)
+	cp.Plan, cp.StartIndex = h.planKey(), h.config.StartIndex
+	h.mu.RLock()
+	for _, b := range h.progress.batches[:cp.CompletedBatches] {
+		cp.Batches = append(cp.Batches, h.completed[b.BatchID])
+	}
+	h.mu.RUnlock()
+
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err == nil {
+		// Write to a temp file first so a crash never leaves a truncated checkpoint
+		tmp := h.config.CheckpointPath + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, h.config.CheckpointPath)
+		}
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to save checkpoint: %v", err)
+		return
+	}
+	log.Printf("💾 Checkpoint: %d batches committed through block %d (next index %d)",
+		cp.CompletedBatches, cp.LastBlock, cp.NextIndex)
+}
+
+// resumeCheckpoint loads CheckpointPath and, when it was saved for these batches, marks
+// its committed prefix done. It returns how many leading batches need no processing;
+// 0 when there is no usable checkpoint.
+func (h *HyperscaleIndexer) resumeCheckpoint(batches []BatchInfo) int {
+	if h.config.CheckpointPath == "" || h.progress == nil {
+		return 0
+	}
+	data, err := os.ReadFile(h.config.CheckpointPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: Failed to read checkpoint: %v", err)
+		}
+		return 0
+	}
+	var cp BulkCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		log.Printf("Warning: Ignoring checkpoint %s: %v", h.config.CheckpointPath, err)
+		return 0
+	}
+	if err := checkCheckpoint(&cp, h.planKey(), h.config.StartIndex, batches); err != nil {
+		log.Printf("⚠️  Ignoring checkpoint %s: %v", h.config.CheckpointPath, err)
+		return 0
+	}
+
+	h.mu.Lock()
+	for i, done := range cp.Batches {
+		done.WorkerID, done.DbPath = batches[i].WorkerID, batches[i].DbPath
+		h.completed[done.BatchID] = done
+		h.metrics.TotalGasAnalyzed += done.GasAnalyzed
+		h.progress.markDone(done.BatchID)
+	}
+	h.mu.Unlock()
+	atomic.AddInt64(&h.batchCounter, int64(len(cp.Batches)))
+
+	log.Printf("⏩ Resuming from checkpoint: %d batches committed through block %d are kept",
+		cp.CompletedBatches, cp.LastBlock)
+	return len(cp.Batches)
+}
+
+// checkCheckpoint reports why cp cannot resume batches: it must come from the same plan
+// and start index, and every committed batch must match and still have its worker DB
+func checkCheckpoint(cp *BulkCheckpoint, plan string, startIndex uint64, batches []BatchInfo) error {
+	if cp.Plan != plan || cp.StartIndex != startIndex {
+		return fmt.Errorf("checkpoint was saved for other settings")
+	}
+	if cp.CompletedBatches != len(cp.Batches) || len(cp.Batches) > len(batches) {
+		return fmt.Errorf("checkpoint lists %d of %d committed batches, plan has %d",
+			len(cp.Batches), cp.CompletedBatches, len(batches))
+	}
+	for i, done := range cp.Batches {
+		b := batches[i]
+		if done.BatchID != b.BatchID || done.StartBlock != b.StartBlock || done.EndBlock != b.EndBlock ||
+			done.StartIndex != b.StartIndex || done.LogCount != b.LogCount {
+			return fmt.Errorf("batch %d no longer matches the plan", done.BatchID)
+		}
+		if _, err := os.Stat(b.DbPath); err != nil {
+			return fmt.Errorf("worker DB of batch %d: %w", b.BatchID, err)
+		}
+	}
+	return nil
+}
+
+// prepareWorkerDBs leaves DB_DIR holding only the worker DBs of the first kept batches,
+// so a batch processed again never appends to output of an earlier attempt
+func prepareWorkerDBs(batches []BatchInfo, kept int) error {
+	if kept == 0 {
+		if err := os.RemoveAll(DB_DIR); err != nil {
+			return err
+		}
+	}
+	for _, b := range batches[kept:] {
+		if err := os.Remove(b.DbPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.MkdirAll(DB_DIR, 0755)
+}
+
+// finishRun removes the worker DBs and the checkpoint once their output is final
+func finishRun(checkpointPath string) {
+	if err := os.RemoveAll(DB_DIR); err != nil {
+		log.Printf("Warning: Failed to remove %s: %v", DB_DIR, err)
+	}
+	if checkpointPath != "" {
+		if err := os.Remove(checkpointPath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: Failed to remove checkpoint: %v", err)
+		}
+	}
+}
+
+// ConsolidationReport holds the checks made while merging worker DBs
+type ConsolidationReport struct {
+	ExpectedLogs   uint64 // Sum of pre-analyzed LogCount over all batches, less hook drops
+	MergedLogs     uint64
+	Collisions     uint64 // Keys already present in the final DB when merged
+	CountMismatch  []int  // Batch IDs whose worker DB count differs from LogCount
+	MissingWorkers []int  // Batch IDs with no readable worker DB
+}
+
+// OK reports whether every check passed
+func (r *ConsolidationReport) OK() bool {
+	return r.MergedLogs == r.ExpectedLogs && r.Collisions == 0 &&
+		len(r.CountMismatch) == 0 && len(r.MissingWorkers) == 0
+}
+
+// consolidateAllBatches merges every worker DB into finalPath. Unless keepWorkers is
+// set, each worker DB is removed once merged; verify-only runs keep them. With a Kafka
+// sink each batch is published once merged, and its worker DB is only removed after the
+// proxy has acknowledged every entry.
+func (h *HyperscaleIndexer) consolidateAllBatches(batches []BatchInfo, finalPath string, keepWorkers bool) (*ConsolidationReport, error) {
+	log.Println("🔄 Initiating unified database consolidation...")
+
+	report := &ConsolidationReport{}
+	for _, batch := range batches {
+		done := h.completed[batch.BatchID]
+		report.ExpectedLogs += batch.LogCount - done.Dropped - done.DeadLettered
+	}
+
+	finalDb, err := h.openDBWithRetry(finalPath, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open final consolidated db: %v", err)
+	}
+	defer finalDb.Close()
+
+	err = finalDb.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(BUCKET_NAME))
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists([]byte("metadata"))
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists([]byte("batch_info"))
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists([]byte(BLOOM_BUCKET))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create buckets in final db: %v", err)
+	}
+
 	var totalLogs uint64
+	var mergedBytes int64
 	consolidationStart := time.Now()
 
-	// Store batch information for analytics
-	err = finalDb.Update(func(tx *bolt.Tx) error {
-		batchBucket := tx.Bucket([]byte("batch_info"))
-		for _, batch := range batches {
-			batchData, err := json.Marshal(batch)
-			if err != nil {
-				return err
+	// Store batch information for analytics
+	err = finalDb.Update(func(tx *bolt.Tx) error {
+		batchBucket := tx.Bucket([]byte("batch_info"))
+		for _, batch := range batches {
+			if done, ok := h.completed[batch.BatchID]; ok {
+				batch = done
+			}
+			batchData, err := json.Marshal(batch)
+			if err != nil {
+				return err
+			}
+			err = batchBucket.Put([]byte(fmt.Sprintf("batch_%d", batch.BatchID)), batchData)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to store batch info: %v", err)
+	}
+
+	if h.config.MergeDelay > 0 || h.config.MergeRate > 0 {
+		log.Printf("🐢 Consolidation throttled: %v between merges, %s", h.config.MergeDelay, formatMergeRate(h.config.MergeRate))
+	}
+
+	// Merge all batch databases in order
+	for i, batch := range batches {
+		if i > 0 {
+			time.Sleep(h.config.MergeDelay)
+		}
+		batchStart := time.Now()
+		batchBytes := fileSizeOf(batch.DbPath)
+		mergedBytes += batchBytes
+
+		workerDb, err := h.openDBWithRetry(batch.DbPath, &bolt.Options{ReadOnly: true, Timeout: 2 * time.Second})
+		if err != nil {
+			if keepWorkers {
+				report.MissingWorkers = append(report.MissingWorkers, batch.BatchID)
+				continue
+			}
+			return nil, fmt.Errorf("failed to open batch db %s: %v", batch.DbPath, err)
+		}
+
+		var batchLogs uint64
+		var merged []*apitypes.LogEntry
+		err = workerDb.View(func(tx *bolt.Tx) error {
+			workerBucket := tx.Bucket([]byte(BUCKET_NAME))
+			if workerBucket == nil {
+				return fmt.Errorf("bucket not found in batch db %d", batch.BatchID)
+			}
+
+			return finalDb.Update(func(finalTx *bolt.Tx) error {
+				finalBucket := finalTx.Bucket([]byte(BUCKET_NAME))
+
+				err := workerBucket.ForEach(func(k, v []byte) error {
+					if finalBucket.Get(k) != nil {
+						report.Collisions++
+						log.Printf("⚠️  Index %d from batch %d collides with an already merged entry",
+							bytesToUint64(k), batch.BatchID)
+					}
+					batchLogs++
+					totalLogs++
+					if h.kafka != nil {
+						var entry apitypes.LogEntry
+						if err := json.Unmarshal(v, &entry); err != nil {
+							return fmt.Errorf("failed to decode entry %d for Kafka: %v", bytesToUint64(k), err)
+						}
+						merged = append(merged, &entry)
+					}
+					return putFinalLog(finalTx, finalBucket, k, v)
+				})
+				if err != nil {
+					return err
+				}
+
+				if workerLetters := tx.Bucket([]byte(DEAD_LETTER_BUCKET)); workerLetters != nil {
+					finalLetters, err := finalTx.CreateBucketIfNotExists([]byte(DEAD_LETTER_BUCKET))
+					if err != nil {
+						return err
+					}
+					err = workerLetters.ForEach(func(k, v []byte) error {
+						return finalLetters.Put(k, v)
+					})
+					if err != nil {
+						return err
+					}
+				}
+
+				workerBlooms := tx.Bucket([]byte(BLOOM_BUCKET))
+				if workerBlooms == nil {
+					return nil
+				}
+				finalBlooms := finalTx.Bucket([]byte(BLOOM_BUCKET))
+				return workerBlooms.ForEach(func(k, v []byte) error {
+					return finalBlooms.Put(k, v)
+				})
+			})
+		})
+
+		workerDb.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to merge batch db %s: %v", batch.DbPath, err)
+		}
+		if h.kafka != nil {
+			err := h.kafka.Publish(context.Background(), merged...)
+			if err == nil {
+				err = h.kafka.Flush(context.Background())
 			}
-			err = batchBucket.Put([]byte(fmt.Sprintf("batch_%d", batch.BatchID)), batchData)
 			if err != nil {
+				return nil, fmt.Errorf("failed to publish batch %d to Kafka (worker DB %s kept): %v", batch.BatchID, batch.DbPath, err)
+			}
+		}
+
+		// Entries dropped by a processing hook or dead-lettered were counted by
+		// pre-analysis but never stored in the logs bucket
+		done := h.completed[batch.BatchID]
+		expected := batch.LogCount - done.Dropped - done.DeadLettered
+		if batchLogs != expected {
+			report.CountMismatch = append(report.CountMismatch, batch.BatchID)
+			log.Printf("⚠️  Batch %d merged %d events but pre-analysis counted %d",
+				batch.BatchID, batchLogs, expected)
+		}
+
+		// Clean up individual batch database
+		if !keepWorkers {
+			os.Remove(batch.DbPath)
+		}
+
+		batchTime := time.Since(batchStart)
+		log.Printf("📦 Consolidated Batch %d: %d events merged in %v (%d/%d complete)",
+			batch.BatchID, batchLogs, batchTime, i+1, len(batches))
+		time.Sleep(mergeRatePause(batchBytes, h.config.MergeRate, batchTime))
+	}
+
+	consolidationTime := time.Since(consolidationStart)
+	log.Printf("⚡ Consolidation completed in %v (%.1f events/sec, %.1f MiB/s)",
+		consolidationTime, float64(totalLogs)/consolidationTime.Seconds(),
+		float64(mergedBytes)/(1<<20)/consolidationTime.Seconds())
+
+	report.MergedLogs = totalLogs
+	h.metrics.TotalLogs = totalLogs
+	h.metrics.EndTime = time.Now()
+	h.metrics.ProcessingTime = h.metrics.EndTime.Sub(h.metrics.StartTime)
+
+	err = h.storeMetrics(finalDb)
+	if err != nil {
+		log.Printf("Warning: Failed to store metrics: %v", err)
+	}
+	if err := storeDiscoveredContracts(finalDb, discovered); err != nil {
+		log.Printf("Warning: Failed to store discovered contracts: %v", err)
+	}
+
+	log.Printf("🚀 Unified consolidation complete: %s events indexed in single database", formatNumber(totalLogs))
+	return report, nil
+}
+
+// runWorkers processes batches on NumWorkers workers and returns how many failed.
+// Errors are drained while the workers run, so a burst of failed batches can never
+// fill the errors buffer and block workers on send.
+func (h *HyperscaleIndexer) runWorkers(batches []BatchInfo) int {
+	var wg sync.WaitGroup
+	batchChan := make(chan BatchInfo, len(batches))
+	errorCount := 0
+	errorsDone := make(chan struct{})
+	go func() {
+		defer close(errorsDone)
+		for err := range h.errors {
+			log.Printf("⚠️  Processing error: %v", err)
+			errorCount++
+		}
+	}()
+
+	// Start workers
+	workersStart := time.Now()
+	for i := 0; i < h.config.NumWorkers; i++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+			// A panicking batch takes the process down; persist committed progress first
+			defer func() {
+				if r := recover(); r != nil {
+					h.saveCheckpoint()
+					panic(r)
+				}
+			}()
+			for batch := range batchChan {
+				if err := h.processAdaptiveBatch(batch); err != nil {
+					h.errors <- fmt.Errorf("worker %d batch %d error: %v", workerID, batch.BatchID, err)
+					h.saveCheckpoint()
+					continue
+				}
+				h.progress.markDone(batch.BatchID)
+			}
+		}(i)
+	}
+
+	// Distribute batches to workers
+	go func() {
+		defer close(batchChan)
+		for _, batch := range batches {
+			batchChan <- batch
+		}
+	}()
+
+	wg.Wait()
+	h.metrics.WorkerWallTime = time.Since(workersStart)
+	h.saveCheckpoint()
+	close(h.errors)
+	<-errorsDone
+	return errorCount
+}
+
+// mergeRatePause is how long to wait after merging n bytes in took so the average merge
+// rate stays at or below rate bytes per second
+func mergeRatePause(n, rate int64, took time.Duration) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	target := time.Duration(float64(n) / float64(rate) * float64(time.Second))
+	if target <= took {
+		return 0
+	}
+	return target - took
+}
+
+func formatMergeRate(rate int64) string {
+	if rate <= 0 {
+		return "no rate limit"
+	}
+	return fmt.Sprintf("at most %.1f MiB/s", float64(rate)/(1<<20))
+}
+
+// fileSizeOf returns the size of path, or 0 when it cannot be read
+func fileSizeOf(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// writeShards is the sharded alternative to consolidateAllBatches: every worker DB is
+// moved into dir unchanged and listed in a manifest of index ranges, so no single file
+// has to be rewritten with the whole backfill. Queries are routed via the manifest.
+func (h *HyperscaleIndexer) writeShards(batches []BatchInfo, dir string) (*apitypes.ShardManifest, error) {
+	log.Printf("🧩 Writing %d worker DBs as shards to %s...", len(batches), dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create shard dir: %v", err)
+	}
+
+	manifest := &apitypes.ShardManifest{CreatedAt: time.Now().UTC()}
+	for _, batch := range batches {
+		first, last, count, err := shardBounds(batch.DbPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read batch db %s: %v", batch.DbPath, err)
+		}
+		if count == 0 {
+			os.Remove(batch.DbPath)
+			continue
+		}
+
+		name := fmt.Sprintf("shard_%06d.db", batch.BatchID)
+		if err := os.Rename(batch.DbPath, filepath.Join(dir, name)); err != nil {
+			return nil, fmt.Errorf("failed to move batch db %s: %v", batch.DbPath, err)
+		}
+		manifest.Shards = append(manifest.Shards, apitypes.ShardInfo{
+			File:       name,
+			StartIndex: first,
+			EndIndex:   last,
+			StartBlock: batch.StartBlock,
+			EndBlock:   batch.EndBlock,
+			LogCount:   count,
+		})
+	}
+	sort.Slice(manifest.Shards, func(i, j int) bool {
+		return manifest.Shards[i].StartIndex < manifest.Shards[j].StartIndex
+	})
+
+	manifestPath, err := writeManifest(dir, manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	h.metrics.TotalLogs = manifest.TotalCount()
+	h.metrics.EndTime = time.Now()
+	h.metrics.ProcessingTime = h.metrics.EndTime.Sub(h.metrics.StartTime)
+
+	log.Printf("🧩 %d shards holding %s events, manifest %s",
+		len(manifest.Shards), formatNumber(h.metrics.TotalLogs), manifestPath)
+	return manifest, nil
+}
+
+// writeManifest atomically writes manifest into dir and returns its path
+func writeManifest(dir string, manifest *apitypes.ShardManifest) (string, error) {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	manifestPath := filepath.Join(dir, storage.ManifestFile)
+	if err := os.WriteFile(manifestPath+".tmp", data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write shard manifest: %v", err)
+	}
+	if err := os.Rename(manifestPath+".tmp", manifestPath); err != nil {
+		return "", fmt.Errorf("failed to write shard manifest: %v", err)
+	}
+	return manifestPath, nil
+}
+
+// rechunkCommitEvery bounds the entries written per transaction while re-chunking
+const rechunkCommitEvery = 10000
+
+// rechunkSources returns the DB files of a backfill in index order: the shards listed by
+// a manifest when src is a shard directory or manifest, otherwise src itself
+func rechunkSources(src string) ([]string, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() && filepath.Ext(src) != ".json" {
+		return []string{src}, nil
+	}
+	manifest, err := storage.LoadShardManifest(src)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, len(manifest.Shards))
+	for i, shard := range manifest.Shards {
+		files[i] = shard.File
+	}
+	return files, nil
+}
+
+// chunkWriter appends entries in index order to one output DB, committing periodically
+type chunkWriter struct {
+	path    string
+	db      *bolt.DB
+	tx      *bolt.Tx
+	info    apitypes.ShardInfo
+	pending int
+}
+
+func newChunkWriter(path string) (*chunkWriter, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	w := &chunkWriter{path: path, db: db, info: apitypes.ShardInfo{File: filepath.Base(path)}}
+	if err := w.begin(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *chunkWriter) begin() (err error) {
+	if w.tx, err = w.db.Begin(true); err != nil {
+		return err
+	}
+	if _, err = w.tx.CreateBucketIfNotExists([]byte(BUCKET_NAME)); err != nil {
+		return err
+	}
+	_, err = w.tx.CreateBucketIfNotExists([]byte(BLOOM_BUCKET))
+	return err
+}
+
+func (w *chunkWriter) put(k, v []byte) error {
+	var entry LogEntry
+	if err := json.Unmarshal(v, &entry); err != nil {
+		return fmt.Errorf("failed to decode entry %d: %v", bytesToUint64(k), err)
+	}
+	if w.info.LogCount == 0 {
+		w.info.StartIndex, w.info.StartBlock = bytesToUint64(k), entry.BlockNumber
+	}
+	w.info.EndIndex, w.info.EndBlock = bytesToUint64(k), entry.BlockNumber
+	w.info.LogCount++
+
+	// k and v point into the source DB's mmap, which may be closed before this tx commits
+	k, v = append([]byte{}, k...), append([]byte{}, v...)
+	if err := w.tx.Bucket([]byte(BUCKET_NAME)).Put(k, v); err != nil {
+		return err
+	}
+	if w.pending++; w.pending < rechunkCommitEvery {
+		return nil
+	}
+	w.pending = 0
+	if err := w.tx.Commit(); err != nil {
+		return err
+	}
+	return w.begin()
+}
+
+// close commits outstanding writes and closes the DB
+func (w *chunkWriter) close() error {
+	err := w.tx.Commit()
+	if cerr := w.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// rechunk rewrites an existing backfill without going back to the chain. src is a final
+// DB or a shard directory/manifest; its entries are written in index order either into
+// one DB at finalPath (output single) or into n shards of near-equal entry count in
+// shardDir with a new manifest (output sharded). Blooms follow the entries' block ranges;
+// see rechunkSideBuckets for the other buckets.
+func rechunk(src, output string, n int, finalPath, shardDir string) error {
+	sources, err := rechunkSources(src)
+	if err != nil {
+		return fmt.Errorf("failed to read source %s: %v", src, err)
+	}
+
+	var total uint64
+	for _, path := range sources {
+		_, _, count, err := shardBounds(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		total += count
+	}
+
+	perChunk := total
+	if output == "sharded" {
+		if n <= 0 {
+			return fmt.Errorf("-rechunk-shards must be positive")
+		}
+		if err := os.MkdirAll(shardDir, 0755); err != nil {
+			return fmt.Errorf("failed to create shard dir: %v", err)
+		}
+		perChunk = (total + uint64(n) - 1) / uint64(n)
+	} else if _, err := os.Stat(finalPath); err == nil {
+		return fmt.Errorf("%s already exists; move it aside before re-chunking into it", finalPath)
+	}
+
+	var done []*chunkWriter
+	var current *chunkWriter
+	next := func() error {
+		if current != nil {
+			if err := current.close(); err != nil {
 				return err
 			}
+			done = append(done, current)
+		}
+		path := finalPath
+		if output == "sharded" {
+			path = filepath.Join(shardDir, fmt.Sprintf("shard_%06d.db", len(done)))
+		}
+		current, err = newChunkWriter(path)
+		return err
+	}
+	if err := next(); err != nil {
+		return err
+	}
+
+	var written uint64
+	for _, path := range sources {
+		db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: 2 * time.Second})
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %v", path, err)
+		}
+		err = db.View(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket([]byte(BUCKET_NAME))
+			if bucket == nil {
+				return nil
+			}
+			return bucket.ForEach(func(k, v []byte) error {
+				if current.info.LogCount >= perChunk {
+					if err := next(); err != nil {
+						return err
+					}
+				}
+				written++
+				return current.put(k, v)
+			})
+		})
+		db.Close()
+		if err != nil {
+			current.close()
+			return fmt.Errorf("failed to re-chunk %s: %v", path, err)
 		}
+	}
+	if err := current.close(); err != nil {
+		return err
+	}
+	done = append(done, current)
+
+	if written != total {
+		return fmt.Errorf("re-chunk wrote %d entries but the source holds %d", written, total)
+	}
+	if err := rechunkBlooms(sources, done); err != nil {
+		return err
+	}
+	if err := rechunkSideBuckets(sources, done); err != nil {
+		return err
+	}
+
+	if output != "sharded" {
+		log.Printf("🧩 Re-chunked %d source DBs into %s: %s events", len(sources), finalPath, formatNumber(written))
 		return nil
+	}
+	manifest := &apitypes.ShardManifest{CreatedAt: time.Now().UTC()}
+	for _, w := range done {
+		if w.info.LogCount == 0 {
+			os.Remove(w.path)
+			continue
+		}
+		manifest.Shards = append(manifest.Shards, w.info)
+	}
+	manifestPath, err := writeManifest(shardDir, manifest)
+	if err != nil {
+		return err
+	}
+	log.Printf("🧩 Re-chunked %d source DBs into %d shards: %s events, manifest %s",
+		len(sources), len(manifest.Shards), formatNumber(written), manifestPath)
+	return nil
+}
+
+// rechunkBlooms copies every stored logsBloom into the output chunk whose block range
+// covers it, or the first chunk after it for blocks between chunks
+func rechunkBlooms(sources []string, chunks []*chunkWriter) error {
+	return rechunkBucket(sources, chunks, BLOOM_BUCKET, func(k []byte) int {
+		block := bytesToUint64(k)
+		return sort.Search(len(chunks), func(i int) bool { return chunks[i].info.EndBlock >= block })
+	})
+}
+
+// rechunkSideBuckets copies what the bulk indexer stores next to the entries. Dead letters
+// follow their index like entries do. Run metadata, batch analytics and discovered
+// contracts describe the whole backfill and go to the first chunk, which is the final DB
+// for single output, so re-chunking back into one DB restores them.
+func rechunkSideBuckets(sources []string, chunks []*chunkWriter) error {
+	err := rechunkBucket(sources, chunks, DEAD_LETTER_BUCKET, func(k []byte) int {
+		index := bytesToUint64(k)
+		return sort.Search(len(chunks), func(i int) bool { return chunks[i].info.EndIndex >= index })
 	})
 	if err != nil {
-		log.Printf("Warning: Failed to store batch info: %v", err)
+		return err
+	}
+	for _, name := range []string{"metadata", "batch_info", CONTRACTS_BUCKET} {
+		if err := rechunkBucket(sources, chunks, name, func([]byte) int { return 0 }); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	// Merge all batch databases in order
-	for i, batch := range batches {
-		batchStart := time.Now()
+// rechunkBucket copies bucket name from every source into the chunk route picks for each
+// key, or the last chunk when route returns len(chunks). Keys already copied from an
+// earlier source are kept.
+func rechunkBucket(sources []string, chunks []*chunkWriter, name string, route func(k []byte) int) error {
+	for _, path := range sources {
+		src, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: 2 * time.Second})
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %v", path, err)
+		}
+		pairs := make(map[int][][2][]byte)
+		err = src.View(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket([]byte(name))
+			if bucket == nil {
+				return nil
+			}
+			return bucket.ForEach(func(k, v []byte) error {
+				i := route(k)
+				if i == len(chunks) {
+					i--
+				}
+				pairs[i] = append(pairs[i], [2][]byte{append([]byte{}, k...), append([]byte{}, v...)})
+				return nil
+			})
+		})
+		src.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s from %s: %v", name, path, err)
+		}
+
+		for i, kvs := range pairs {
+			dst := chunks[i].path
+			db, err := bolt.Open(dst, 0600, &bolt.Options{Timeout: 2 * time.Second})
+			if err != nil {
+				return err
+			}
+			err = db.Update(func(tx *bolt.Tx) error {
+				bucket, err := tx.CreateBucketIfNotExists([]byte(name))
+				if err != nil {
+					return err
+				}
+				for _, kv := range kvs {
+					if bucket.Get(kv[0]) != nil {
+						continue
+					}
+					if err := bucket.Put(kv[0], kv[1]); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			db.Close()
+			if err != nil {
+				return fmt.Errorf("failed to copy %s into %s: %v", name, dst, err)
+			}
+		}
+	}
+	return nil
+}
+
+// replayedEntry rebuilds an archived entry from its raw log the way processAdaptiveBatch
+// builds it, keeping the block and transaction fields that came from other RPC calls
+func replayedEntry(archived *LogEntry, raw types.Log) LogEntry {
+	txIndex := uint64(raw.TxIndex)
+	return LogEntry{
+		Index:       archived.Index,
+		BlockNumber: raw.BlockNumber,
+		Address:     raw.Address.Hex(),
+		ParentHash:  archived.ParentHash,
+		L1InfoRoot:  common.Bytes2Hex(raw.Data),
+		Timestamp:   archived.Timestamp,
+		GasUsed:     archived.GasUsed,
+		GasPrice:    archived.GasPrice,
+		TxHash:      raw.TxHash.Hex(),
+		TxIndex:     &txIndex,
+		LogIndex:    uint64(raw.Index),
+		Topics:      topicsToHex(raw.Topics),
+		Enriched:    archived.Enriched,
+		RawLog:      rawLog(raw),
+	}
+}
+
+// replay rebuilds a decoded DB at outPath from src, a final DB or shard dir/manifest
+// indexed with -store-raw, without touching the chain. Every entry, then every dead
+// letter, is rebuilt from its raw log and run through the current decoding (-preset,
+// -abi) and processing hooks, so decoder changes can be applied to an existing backfill.
+// Block and gas fields are not part of the raw log and are kept as archived. Blooms are
+// copied. An entry without a raw log fails the replay.
+func (h *HyperscaleIndexer) replay(src, outPath string) error {
+	sources, err := rechunkSources(src)
+	if err != nil {
+		return fmt.Errorf("failed to read source %s: %v", src, err)
+	}
+	if _, err := os.Stat(outPath); err == nil {
+		return fmt.Errorf("%s already exists; move it aside before replaying into it", outPath)
+	}
+	w, err := newChunkWriter(outPath)
+	if err != nil {
+		return err
+	}
+
+	var stored, dropped, deadLettered uint64
+	replayEntry := func(archived *LogEntry) error {
+		if archived.RawLog == nil {
+			return fmt.Errorf("entry %d has no raw log; replay needs a DB indexed with -store-raw", archived.Index)
+		}
+		raw, err := decodeRawLog(archived.RawLog)
+		if err != nil {
+			return fmt.Errorf("entry %d has an invalid raw log: %v", archived.Index, err)
+		}
+		if len(h.dropUnexpectedTopics([]types.Log{raw})) == 0 {
+			dropped++
+			return nil
+		}
+		data, outcome, err := h.processEntry(w.tx, replayedEntry(archived, raw), raw)
+		if err != nil {
+			return err
+		}
+		switch outcome {
+		case entryDropped:
+			dropped++
+		case entryDeadLettered:
+			deadLettered++
+		default:
+			stored++
+			return w.put(uint64ToBytes(archived.Index), data)
+		}
+		return nil
+	}
 
-		workerDb, err := bolt.Open(batch.DbPath, 0600, &bolt.Options{ReadOnly: true, Timeout: 2 * time.Second})
+	for _, path := range sources {
+		db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: 2 * time.Second})
 		if err != nil {
-			return fmt.Errorf("failed to open batch db %s: %v", batch.DbPath, err)
+			w.close()
+			return fmt.Errorf("failed to open %s: %v", path, err)
 		}
-
-		var batchLogs uint64
-		err = workerDb.View(func(tx *bolt.Tx) error {
-			workerBucket := tx.Bucket([]byte(BUCKET_NAME))
-			if workerBucket == nil {
-				return fmt.Errorf("bucket not found in batch db %d", batch.BatchID)
-			}
-
-			return finalDb.Update(func(finalTx *bolt.Tx) error {
-				finalBucket := finalTx.Bucket([]byte(BUCKET_NAME))
-
-				return workerBucket.ForEach(func(k, v []byte) error {
-					batchLogs++
-					totalLogs++
-					return finalBucket.Put(k, v)
+		err = db.View(func(tx *bolt.Tx) error {
+			if bucket := tx.Bucket([]byte(BUCKET_NAME)); bucket != nil {
+				err := bucket.ForEach(func(k, v []byte) error {
+					var entry LogEntry
+					if err := json.Unmarshal(v, &entry); err != nil {
+						return fmt.Errorf("failed to decode entry %d: %v", bytesToUint64(k), err)
+					}
+					return replayEntry(&entry)
 				})
+				if err != nil {
+					return err
+				}
+			}
+			// Dead letters keep their raw log, so they get another chance with the new decoding
+			bucket := tx.Bucket([]byte(DEAD_LETTER_BUCKET))
+			if bucket == nil {
+				return nil
+			}
+			return bucket.ForEach(func(k, v []byte) error {
+				var dl DeadLetter
+				if err := json.Unmarshal(v, &dl); err != nil || dl.Entry == nil {
+					return fmt.Errorf("failed to decode dead letter %d: %v", bytesToUint64(k), err)
+				}
+				return replayEntry(dl.Entry)
 			})
 		})
-
-		workerDb.Close()
+		db.Close()
 		if err != nil {
-			return fmt.Errorf("failed to merge batch db %s: %v", batch.DbPath, err)
+			w.close()
+			return fmt.Errorf("failed to replay %s: %v", path, err)
 		}
-
-		// Clean up individual batch database
-		os.Remove(batch.DbPath)
-
-		batchTime := time.Since(batchStart)
-		log.Printf("📦 Consolidated Batch %d: %d events merged in %v (%d/%d complete)",
-			batch.BatchID, batchLogs, batchTime, i+1, len(batches))
+	}
+	if err := w.close(); err != nil {
+		return err
+	}
+	if err := rechunkBlooms(sources, []*chunkWriter{w}); err != nil {
+		return err
 	}
 
-	consolidationTime := time.Since(consolidationStart)
-	log.Printf("⚡ Consolidation completed in %v (%.1f events/sec)",
-		consolidationTime, float64(totalLogs)/consolidationTime.Seconds())
-
-	h.metrics.TotalLogs = totalLogs
-	h.metrics.EndTime = time.Now()
-	h.metrics.ProcessingTime = h.metrics.EndTime.Sub(h.metrics.StartTime)
+	log.Printf("🔁 Replayed %d source DBs into %s: %s events stored, %d dropped, %d dead-lettered",
+		len(sources), outPath, formatNumber(stored), dropped, deadLettered)
+	return nil
+}
 
-	err = h.storeMetrics(finalDb)
+// shardBounds returns the first and last index and the entry count of a worker DB
+func shardBounds(dbPath string) (first, last, count uint64, err error) {
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{ReadOnly: true, Timeout: 2 * time.Second})
 	if err != nil {
-		log.Printf("Warning: Failed to store metrics: %v", err)
+		return 0, 0, 0, err
 	}
+	defer db.Close()
 
-	log.Printf("🚀 Unified consolidation complete: %s events indexed in single database", formatNumber(totalLogs))
-	return nil
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(BUCKET_NAME))
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		k, _ := c.First()
+		if k == nil {
+			return nil
+		}
+		first = bytesToUint64(k)
+		k, _ = c.Last()
+		last = bytesToUint64(k)
+		count = uint64(bucket.Stats().KeyN)
+		return nil
+	})
+	return first, last, count, err
 }
 
 func (h *HyperscaleIndexer) storeMetrics(db *bolt.DB) error {
 	h.metrics.TotalBlocks = h.config.EndBlock - h.config.StartBlock + 1
 	h.metrics.ThroughputBPS = float64(h.metrics.TotalBlocks) / h.metrics.ProcessingTime.Seconds()
 	h.metrics.ThroughputLPS = float64(h.metrics.TotalLogs) / h.metrics.ProcessingTime.Seconds()
-	h.metrics.ParallelEfficiency = float64(h.config.NumWorkers) * h.metrics.ThroughputLPS / 1000.0
+	h.metrics.ParallelSpeedup, h.metrics.ParallelEfficiency = parallelEfficiency(
+		h.metrics.WorkerBusyTime, h.metrics.WorkerWallTime, h.config.NumWorkers)
 
 	return db.Update(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket([]byte("metadata"))
@@ -376,27 +3021,210 @@ func (h *HyperscaleIndexer) storeMetrics(db *bolt.DB) error {
 		if err != nil {
 			return err
 		}
-		return bucket.Put([]byte("performance_metrics"), data)
+		if err := bucket.Put([]byte("performance_metrics"), data); err != nil {
+			return err
+		}
+		if h.selfDestruct == nil {
+			return nil
+		}
+		if data, err = json.Marshal(h.selfDestruct); err != nil {
+			return err
+		}
+		return bucket.Put([]byte(SELF_DESTRUCT_KEY), data)
 	})
 }
 
+// parallelEfficiency compares the summed batch time (what a single worker would
+// have needed) with the wall time of the parallel phase. speedup is how many
+// workers were effectively busy on average; efficiency divides that by the pool size.
+func parallelEfficiency(busy, wall time.Duration, workers int) (speedup, efficiency float64) {
+	if wall <= 0 || workers <= 0 {
+		return 0, 0
+	}
+	speedup = busy.Seconds() / wall.Seconds()
+	return speedup, speedup / float64(workers)
+}
+
 func (h *HyperscaleIndexer) printMetrics() {
 	fmt.Println("\n" + strings.Repeat("=", 85))
 	fmt.Println("🏆 ADAPTIVE ETHEREUM LOG INDEXER - PERFORMANCE ANALYTICS")
 	fmt.Println(strings.Repeat("=", 85))
 	fmt.Printf("📊 Blocks Processed:       %s\n", formatNumber(h.metrics.TotalBlocks))
 	fmt.Printf("📈 Events Indexed:         %s\n", formatNumber(h.metrics.TotalLogs))
-	fmt.Printf("📦 Adaptive Batches:       %d (max %d blocks each)\n", h.metrics.TotalBatches, MAX_BLOCK_RANGE)
+	fmt.Printf("📦 Adaptive Batches:       %d (max %d blocks each)\n", h.metrics.TotalBatches, h.config.MaxBlockRange)
 	fmt.Printf("⛽ Gas Analyzed:           %s\n", formatNumber(h.metrics.TotalGasAnalyzed))
 	fmt.Printf("⚡ Total Processing Time:  %v\n", h.metrics.ProcessingTime.Round(time.Millisecond))
 	fmt.Printf("🚀 Throughput (Blocks):    %.2f blocks/sec\n", h.metrics.ThroughputBPS)
 	fmt.Printf("📡 Throughput (Events):    %.2f events/sec\n", h.metrics.ThroughputLPS)
 	fmt.Printf("🔧 Workers Utilized:       %d concurrent workers\n", h.config.NumWorkers)
-	fmt.Printf("🔥 Efficiency Multiplier:  %.2fx performance boost\n", h.metrics.ParallelEfficiency)
+	fmt.Printf("🔥 Parallel Speedup:       %.2fx over a single worker (%.1f%% efficiency)\n",
+		h.metrics.ParallelSpeedup, h.metrics.ParallelEfficiency*100)
 	fmt.Printf("💾 Unified Database:       %s\n", FINAL_DB)
 	fmt.Println(strings.Repeat("=", 85))
 }
 
+// verifyConsolidation merges into a temporary DB instead of FINAL_DB, keeps every
+// worker DB, and exits non-zero when the count or collision checks fail
+func verifyConsolidation(h *HyperscaleIndexer, batches []BatchInfo) {
+	tmp, err := os.CreateTemp("", "verify_consolidation_*.db")
+	if err != nil {
+		log.Fatalf("❌ Failed to create temporary final db: %v", err)
+	}
+	tmp.Close()
+	os.Remove(tmp.Name()) // let bolt initialise the file itself
+
+	log.Println("🔍 Verify-only consolidation: worker DBs are kept and FINAL_DB is untouched")
+	report, err := h.consolidateAllBatches(batches, tmp.Name(), true)
+	if err != nil {
+		log.Fatalf("❌ Verification consolidation failed: %v", err)
+	}
+
+	log.Printf("🔍 Expected %d events, merged %d | collisions: %d | count mismatches: %v | missing worker DBs: %v",
+		report.ExpectedLogs, report.MergedLogs, report.Collisions, report.CountMismatch, report.MissingWorkers)
+	log.Printf("🔍 Worker DBs left in %s, merged result in %s", DB_DIR, tmp.Name())
+	if !report.OK() {
+		log.Fatalf("❌ Consolidation verification failed")
+	}
+	log.Println("✅ Consolidation verification passed")
+}
+
+// needsEnrichment reports whether an entry is missing block or gas fields
+func needsEnrichment(entry *LogEntry) bool {
+	return !entry.Enriched || entry.Timestamp == 0 || entry.ParentHash == "" || entry.GasUsed == 0
+}
+
+// runEnrichment fills block/gas fields of entries stored un-enriched, updating them in
+// place. Progress is recorded in the metadata bucket so an interrupted pass resumes
+// where it stopped; ratePerSec bounds the number of entries enriched per second. The
+// cursor only moves over the unbroken run of successes from where the pass started, so
+// an entry that failed is retried by the next pass even if later ones succeeded.
+func runEnrichment(client rpcclient.Client, dbPath string, ratePerSec int) error {
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return fmt.Errorf("failed to open db: %v", err)
+	}
+	defer db.Close()
+
+	var cursor uint64
+	var pending []uint64
+	err = db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists([]byte("metadata"))
+		if err != nil {
+			return err
+		}
+		if v := meta.Get([]byte(ENRICH_CURSOR)); v != nil {
+			cursor = bytesToUint64(v)
+		}
+
+		bucket := tx.Bucket([]byte(BUCKET_NAME))
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", BUCKET_NAME)
+		}
+		c := bucket.Cursor()
+		for k, v := c.Seek(uint64ToBytes(cursor)); k != nil; k, v = c.Next() {
+			var entry LogEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return fmt.Errorf("failed to decode entry %d: %v", bytesToUint64(k), err)
+			}
+			if needsEnrichment(&entry) {
+				pending = append(pending, entry.Index)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(pending) == 0 {
+		log.Printf("✅ Nothing to enrich (resumed from index %d)", cursor)
+		return nil
+	}
+	log.Printf("🔧 Enriching %s entries from index %d", formatNumber(uint64(len(pending))), cursor)
+
+	var throttle <-chan time.Time
+	if ratePerSec > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(ratePerSec))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	var enriched, failed, retryFrom uint64
+	for _, index := range pending {
+		if throttle != nil {
+			<-throttle
+		}
+		advance := failed == 0
+
+		err := db.Update(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket([]byte(BUCKET_NAME))
+			var entry LogEntry
+			if err := json.Unmarshal(bucket.Get(uint64ToBytes(index)), &entry); err != nil {
+				return err
+			}
+
+			number := new(big.Int).SetUint64(entry.BlockNumber)
+			block, err := client.BlockByNumber(context.Background(), number)
+			if err != nil {
+				return fmt.Errorf("failed to get block %d: %v", entry.BlockNumber, err)
+			}
+			// Partial block data would be stored as if enriched; try the header alone,
+			// and otherwise leave the entry for a later pass
+			header := block.Header()
+			if rpcclient.CheckHeader(header) != nil {
+				if header, err = client.HeaderByNumber(context.Background(), number); err != nil {
+					return fmt.Errorf("failed to get header %d: %v", entry.BlockNumber, err)
+				}
+				if err := rpcclient.CheckHeader(header); err != nil {
+					return err
+				}
+			}
+			entry.ParentHash = header.ParentHash.Hex()
+			entry.Timestamp = header.Time
+
+			if entry.GasUsed == 0 {
+				receipt, err := client.TransactionReceipt(context.Background(), common.HexToHash(entry.TxHash))
+				if err != nil {
+					return fmt.Errorf("failed to get receipt of transaction %s: %v", entry.TxHash, err)
+				}
+				entry.GasUsed = receipt.GasUsed
+				if entry.GasPrice == nil && receipt.EffectiveGasPrice != nil && receipt.EffectiveGasPrice.Sign() > 0 {
+					entry.GasPrice = apitypes.NewBigInt(receipt.EffectiveGasPrice)
+				}
+			}
+			entry.Enriched = true
+
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if err := putFinalLog(tx, bucket, uint64ToBytes(index), data); err != nil {
+				return err
+			}
+			if !advance {
+				return nil
+			}
+			return tx.Bucket([]byte("metadata")).Put([]byte(ENRICH_CURSOR), uint64ToBytes(index+1))
+		})
+		if err != nil {
+			log.Printf("Warning: Could not enrich entry %d: %v", index, err)
+			if failed == 0 {
+				retryFrom = index
+			}
+			failed++
+			continue
+		}
+		enriched++
+	}
+
+	log.Printf("✅ Enrichment complete: %s enriched, %s still incomplete",
+		formatNumber(enriched), formatNumber(failed))
+	if failed > 0 {
+		log.Printf("🔁 The next -enrich pass resumes from index %d, the first entry that failed", retryFrom)
+	}
+	return nil
+}
+
 func formatNumber(n uint64) string {
 	str := fmt.Sprintf("%d", n)
 	if len(str) <= 3 {
@@ -419,45 +3247,391 @@ func uint64ToBytes(n uint64) []byte {
 	return b
 }
 
+func bytesToUint64(b []byte) uint64 {
+	return binary.BigEndian.Uint64(b)
+}
+
 func main() {
+	rpcEndpoint := flag.String("rpc", RPC_ENDPOINT, "RPC endpoint URL or local geth .ipc path; comma-separate several for failover")
+	numWorkers := flag.Int("workers", 0, fmt.Sprintf("Concurrent workers (0 = %d over HTTP, %d over IPC)", HTTP_WORKERS, IPC_WORKERS))
+	refreshPlan := flag.Bool("refresh-plan", false, "Ignore any cached batch plan and redo pre-analysis")
+	maxOpenDBs := flag.Int("max-open-dbs", 0, "Max worker DBs open at once (0 = derive from the fd limit)")
+	enrich := flag.Bool("enrich", false, "Fill missing block/gas fields of un-enriched entries in the final DB, then exit")
+	enrichRate := flag.Int("enrich-rate", 10, "Max entries enriched per second (0 = unlimited)")
+	presetName := flag.String("preset", "", "Built-in decoder for a token standard: erc20, erc721 or erc1155; sets the topics and event names and fills from/to/value/tokenId")
+	abiPath := flag.String("abi", "", "ABI JSON used to resolve topic0 to event names, or fromBlock:path,... for upgradeable proxies")
+	overlap := flag.String("overlap", "error", "When the range overlaps blocks already in the final DB: skip or error")
+	maxRange := flag.Uint64("max-range", MAX_BLOCK_RANGE, "Blocks per eth_getLogs query; lowered automatically if the provider reports a smaller limit")
+	storeRaw := flag.Bool("store-raw", false, "Archival mode: store the complete raw log (all topics, data, removed, txIndex) on each entry")
+	planWorkers := flag.Int("plan-workers", 8, "Concurrent eth_getLogs queries during pre-analysis")
+	planStrategy := flag.String("plan-strategy", "window", "Pre-analysis counting: window (one eth_getLogs call per window) or batch (JSON-RPC batches to the first endpoint)")
+	planBatchSize := flag.Int("plan-batch-size", 50, "Windows counted per JSON-RPC batch request with -plan-strategy batch")
+	planRate := flag.Int("plan-rate", 0, "Max pre-analysis queries per second across plan workers (0 = unthrottled)")
+	codeCheck := flag.String("code-check", "off", "Contract code check at the start block: strict (fail if absent), lenient (advance to deployment) or off")
+	codeEnd := flag.String("code-end", "off", "Contract self-destruct check over the range: stop (end at the block where code disappears), warn (log only) or off")
+	checkpointPath := flag.String("checkpoint", "hyperscale_checkpoint.json", "File recording committed batch progress; a failed run keeps its worker DBs and the next run with the same options resumes from it (empty disables)")
+	output := flag.String("output", "single", "Backfill output: single (consolidate into one DB) or sharded (keep worker DBs plus a manifest)")
+	shardDir := flag.String("shard-dir", "hyperscale_shards", "Directory for -output sharded")
+	verifyOnly := flag.Bool("verify-only", false, "Merge into a temporary DB, run consistency checks and keep worker DBs")
+	keepEmpty := flag.Bool("keep-empty-batches", false, "Create and merge batch DBs even for windows with no logs")
+	storeBlooms := flag.Bool("store-blooms", false, "Store every block's logsBloom so re-indexing another event can skip blocks offline")
+	metricsAddr := flag.String("metrics-addr", ":9090", "Prometheus listen address for backfill metrics (empty disables)")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "Also push metrics to this OTLP/HTTP collector, e.g. http://collector:4318 (empty disables)")
+	otlpInterval := flag.Duration("otlp-interval", 15*time.Second, "Interval between OTLP metric pushes")
+	startIndex := flag.Uint64("index-base", 0, "First index to assign, so several indexers' outputs can be merged without collisions")
+	indexNamespace := flag.Int("index-namespace", -1, "Index namespace 0-255 placed in the top byte of every index (-1 = none)")
+	blockCacheEntries := flag.Int("block-cache", 1024, "Max blocks kept in the LRU block cache (0 = no count bound)")
+	blockCacheMB := flag.Int64("block-cache-mb", 0, "Max encoded size of cached blocks in MiB (0 = no size bound); both 0 disables the cache")
+	rpcAllow := flag.String("rpc-allow", "", "Comma-separated JSON-RPC methods the indexer may call; anything else fails (empty = all, still counted per method)")
+	breakerThreshold := flag.Int("breaker-threshold", 5, "Consecutive RPC failures that open the circuit breaker (0 disables)")
+	breakerCooldown := flag.Duration("breaker-cooldown", 30*time.Second, "How long an open circuit breaker rejects RPC calls before probing")
+	startDate := flag.String("start-date", "", "Start at the first block of this UTC day (YYYY-MM-DD), overriding the start block")
+	dateTolerance := flag.Uint64("date-tolerance", 0, "Blocks either side of a -start-date/-end-date boundary re-checked one by one, for chains whose timestamps are not monotonic")
+	endDate := flag.String("end-date", "", "End at the last block of this UTC day (YYYY-MM-DD), overriding the end block")
+	rechunkSrc := flag.String("rechunk", "", "Rewrite an existing final DB or shard dir per -output (into "+FINAL_DB+" or -shard-dir) without touching the chain, then exit")
+	rechunkShards := flag.Int("rechunk-shards", 4, "Number of shards -rechunk writes with -output sharded")
+	replaySrc := flag.String("replay", "", "Rebuild a decoded DB (-replay-out) from an existing final DB or shard dir indexed with -store-raw, re-running -preset/-abi decoding and processing hooks on the archived raw logs without touching the chain, then exit")
+	replayOut := flag.String("replay-out", "hyperscale_replayed_logs.db", "DB written by -replay; must not exist yet")
+	openRetry := flag.Duration("open-retry", 30*time.Second, "How long consolidation keeps retrying a final or worker DB open that times out on its file lock (0 = fail on the first timeout)")
+	mergeDelay := flag.Duration("merge-delay", 0, "Pause between batch merges during consolidation, to spare shared disks")
+	mergeRateMB := flag.Int64("merge-rate-mb", 0, "Max MiB of worker DBs merged per second during consolidation (0 = unthrottled)")
+	verifyReceipts := flag.Bool("verify-receipts", false, "Check every log against its block's receiptsRoot and logsBloom (one eth_getBlockReceipts per block; slow)")
+	headerFallback := flag.Bool("header-fallback", true, "When a block comes back with a zero timestamp or parent hash (partial data from light/proxy endpoints), re-read its header with eth_getBlockByHash; logs whose block data stays implausible are stored enriched:false")
+	factoryAddr := flag.String("factory", "", "Factory contract whose creation events (-factory-topic) name child contracts to index alongside the others")
+	factoryTopic := flag.String("factory-topic", "", "topic0 of the factory's creation event, e.g. Uniswap V3 PoolCreated")
+	factoryChild := flag.String("factory-child", "data0", "Where the creation event holds the child address: topic1-topic3 or dataN (32-byte data word, 0-based)")
+	factoryStart := flag.Uint64("factory-start", 0, "First block scanned for creation events (0 = the start block); set it to the factory's deployment to find older children")
+	contractsFile := flag.String("contracts-file", "", "File of contract addresses to index instead of the built-in one: one per line (# comments) or a JSON list; read once per run")
+	topics := flag.String("topics", EVENT_TOPIC, "Comma-separated topic0 hashes to index; a log matching any of them is indexed. Empty (-topics=) indexes every event of the contracts")
+	validateTopic0 := flag.Bool("validate-topic0", false, "Drop, with a warning, any returned log whose topic0 is not one of -topics")
+	deadLetter := flag.Bool("dead-letter", false, "Store logs that fail processing (a hook under -hook-errors fail, -preset decoding, or encoding) in the dead_letter bucket instead of failing the batch")
+	hookErrors := flag.String("hook-errors", "skip", "When a processing hook fails: skip (ignore that hook for the entry) or fail (fail the batch)")
+	confirmations := flag.Uint64("confirmations", 0, "Blocks behind head treated as final; EndBlock is clamped to head minus this")
+	maxHeadSkew := flag.Duration("max-head-skew", 2*time.Minute, "Warn when the head block's timestamp trails local time by more than this, a sign of a stalled RPC node (0 disables)")
+	kafkaURL := flag.String("kafka-rest-url", "", "Kafka REST Proxy that each batch is published through as it is consolidated into "+FINAL_DB+" (empty disables)")
+	kafkaTopic := flag.String("kafka-topic", "", "Kafka topic for -kafka-rest-url")
+	kafkaKey := flag.String("kafka-key", indexer.KafkaKeyIndex, "Kafka record key: index (one per log, for compacted topics) or block")
+	kafkaBatch := flag.Int("kafka-batch", 500, "Logs per Kafka produce request")
+	flag.Parse()
+
 	fmt.Println("🌟 ADAPTIVE ETHEREUM EVENT LOG INDEXER v2.1")
 	fmt.Println("   RPC-Optimized Parallel Processing & Unified Database")
 	fmt.Println("   Max Range: 500 blocks per query | Auto-rebalancing batches")
 	fmt.Println()
 
-	os.MkdirAll(DB_DIR, 0755)
-	defer os.RemoveAll(DB_DIR)
+	switch *output {
+	case "single":
+	case "sharded":
+		if _, err := os.Stat(filepath.Join(*shardDir, storage.ManifestFile)); err == nil {
+			log.Fatalf("❌ %s already holds a shard manifest; pick another -shard-dir", *shardDir)
+		}
+	default:
+		log.Fatalf("❌ Unknown -output %q (want single or sharded)", *output)
+	}
+	if *planStrategy != "window" && *planStrategy != "batch" {
+		log.Fatalf("❌ Unknown -plan-strategy %q (want window or batch)", *planStrategy)
+	}
+	if *hookErrors != "skip" && *hookErrors != "fail" {
+		log.Fatalf("❌ Unknown -hook-errors %q (want skip or fail)", *hookErrors)
+	}
+	parsedTopics, err := parseTopics(*topics)
+	if err != nil {
+		log.Fatalf("❌ Invalid -topics: %v", err)
+	}
+	eventTopics = parsedTopics
+
+	if (*contractsFile != "" || *factoryAddr != "") && (*codeCheck != "off" || *codeEnd != "off") {
+		log.Fatalf("❌ -code-check and -code-end follow a single contract; they cannot be used with -contracts-file or -factory")
+	}
+	if *contractsFile != "" {
+		set, err := indexer.LoadContractSet(*contractsFile)
+		if err != nil {
+			log.Fatalf("❌ Invalid -contracts-file: %v", err)
+		}
+		contracts = set
+		log.Printf("📇 Indexing %d contracts from %s", contracts.Len(), *contractsFile)
+	}
+
+	var factory *indexer.FactoryWatch
+	if *factoryAddr != "" {
+		if !common.IsHexAddress(*factoryAddr) {
+			log.Fatalf("❌ Invalid -factory %q", *factoryAddr)
+		}
+		if len(strings.TrimPrefix(*factoryTopic, "0x")) != 64 {
+			log.Fatalf("❌ -factory needs -factory-topic, the 32-byte topic0 of its creation event")
+		}
+		child, err := indexer.ParseChildArg(*factoryChild)
+		if err != nil {
+			log.Fatalf("❌ Invalid -factory-child: %v", err)
+		}
+		factory = &indexer.FactoryWatch{
+			Factory: common.HexToAddress(*factoryAddr),
+			Topic:   common.HexToHash(*factoryTopic),
+			Child:   child,
+		}
+		if *contractsFile == "" {
+			// Only the children are indexed, not the compiled-in contract
+			contracts = indexer.NewContractSet()
+		}
+	}
+
+	var preset *decoder.Preset
+	if *presetName != "" {
+		if *abiPath != "" {
+			log.Fatalf("❌ -preset and -abi are mutually exclusive")
+		}
+		if preset, err = decoder.LoadPreset(*presetName); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		// The preset's events replace the default topic, but an explicit -topics wins
+		topicsSet := false
+		flag.Visit(func(f *flag.Flag) { topicsSet = topicsSet || f.Name == "topics" })
+		if !topicsSet {
+			eventTopics = preset.Topics
+		}
+		log.Printf("🪙 Using the %s preset (%d events)", preset.Name, len(preset.Topics))
+	}
+	var events *decoder.Schedule
+	if preset != nil {
+		events = decoder.NewSchedule(map[uint64]*decoder.EventRegistry{0: preset.Registry()})
+	}
+	if *abiPath != "" {
+		if events, err = decoder.LoadSchedule(*abiPath); err != nil {
+			log.Fatalf("❌ Failed to load ABI: %v", err)
+		}
+	}
+
+	if *rechunkSrc != "" {
+		if err := rechunk(*rechunkSrc, *output, *rechunkShards, FINAL_DB, *shardDir); err != nil {
+			log.Fatalf("❌ Re-chunk failed: %v", err)
+		}
+		return
+	}
+
+	if *replaySrc != "" {
+		replayer := NewHyperscaleIndexer(nil, IndexerConfig{
+			HookErrors:     *hookErrors,
+			ValidateTopic0: *validateTopic0,
+			DeadLetter:     *deadLetter,
+		}, nil)
+		replayer.preset, replayer.events = preset, events
+		if err := replayer.replay(*replaySrc, *replayOut); err != nil {
+			log.Fatalf("❌ Replay failed: %v", err)
+		}
+		return
+	}
+
+	var prom *metrics.Metrics
+	var onRPCError rpcclient.ErrorRecorder
+	if *metricsAddr != "" || *otlpEndpoint != "" {
+		prom = metrics.NewMetrics()
+		onRPCError = prom.RecordEndpointError
+	}
+	if *otlpEndpoint != "" {
+		exporter, err := metrics.NewOTLPExporter(*otlpEndpoint, *otlpInterval, slog.Default())
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		otlpCtx, stopOTLP := context.WithCancel(context.Background())
+		otlpDone := make(chan struct{})
+		go func() {
+			exporter.Run(otlpCtx)
+			close(otlpDone)
+		}()
+		// Stopping triggers a final push, so the finished run's totals reach the collector
+		defer func() {
+			stopOTLP()
+			<-otlpDone
+		}()
+		log.Printf("📡 Pushing metrics to OTLP collector %s every %v", *otlpEndpoint, *otlpInterval)
+	}
+
+	allowlist, err := rpcclient.ParseAllowlist(*rpcAllow)
+	if err != nil {
+		log.Fatalf("❌ Invalid -rpc-allow: %v", err)
+	}
+	var onRPCCall rpcclient.MethodRecorder
+	if prom != nil {
+		onRPCCall = prom.RecordRPCMethodCall
+	}
+	audit := func(c rpcclient.Client) rpcclient.Client { return rpcclient.NewAudited(c, allowlist, onRPCCall) }
 
-	client, err := ethclient.Dial(RPC_ENDPOINT)
+	client, ipc, err := dialEndpoints(*rpcEndpoint, onRPCError, audit)
 	if err != nil {
 		log.Fatalf("❌ Failed to connect to Ethereum client: %v", err)
 	}
+	if ipc {
+		log.Printf("🔌 Connected over IPC: %s", *rpcEndpoint)
+	}
+	if *breakerThreshold > 0 {
+		client = rpcclient.NewBreaker(client, *breakerThreshold, *breakerCooldown, func(state rpcclient.BreakerState) {
+			log.Printf("⚡ RPC circuit breaker %s", state)
+			if prom != nil {
+				prom.SetBreakerState(int(state))
+			}
+		})
+	}
+
+	if *enrich {
+		if err := runEnrichment(client, FINAL_DB, *enrichRate); err != nil {
+			log.Fatalf("❌ Enrichment failed: %v", err)
+		}
+		return
+	}
+
+	workers := *numWorkers
+	if workers <= 0 {
+		workers = HTTP_WORKERS // Optimal for RPC rate limits
+		if ipc {
+			workers = IPC_WORKERS // No provider rate limit on a local node
+		}
+	}
+
+	base, err := indexBase(*startIndex, *indexNamespace)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
 
 	config := IndexerConfig{
-		StartBlock:    22925713,
-		EndBlock:      22961057,
-		NumWorkers:    50, // Optimal for RPC rate limits
-		EnableCache:   true,
-		EnableMetrics: true,
+		StartIndex:     base,
+		StartBlock:     22925713,
+		EndBlock:       22961057,
+		NumWorkers:     workers,
+		EnableCache:    *blockCacheEntries > 0 || *blockCacheMB > 0,
+		EnableMetrics:  prom != nil,
+		RefreshPlan:    *refreshPlan,
+		MaxBlockRange:  *maxRange,
+		StoreBlooms:    *storeBlooms,
+		KeepEmpty:      *keepEmpty,
+		CheckpointPath: *checkpointPath,
+		PlanWorkers:    *planWorkers,
+		StoreRaw:       *storeRaw,
+		PlanRate:       *planRate,
+		PlanStrategy:   *planStrategy,
+		PlanBatchSize:  *planBatchSize,
+		HookErrors:     *hookErrors,
+		ValidateTopic0: *validateTopic0,
+		DeadLetter:     *deadLetter,
+		VerifyReceipts: *verifyReceipts,
+		HeaderFallback: *headerFallback,
+		MergeDelay:     *mergeDelay,
+		MergeRate:      *mergeRateMB << 20,
+		OpenRetry:      *openRetry,
+	}
+
+	if err := resolveDateRange(context.Background(), client, &config, *startDate, *endDate, *dateTolerance); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	if err := clampToHead(context.Background(), client, &config, *confirmations); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	checkHeadFreshness(context.Background(), client, *maxHeadSkew, prom)
+
+	if err := checkContractCode(context.Background(), client, &config, *codeCheck); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	selfDestruct, err := checkCodeEnd(context.Background(), client, &config, *codeEnd)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	if err := resolveOverlap(&config, *overlap); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	if config.StartBlock > config.EndBlock {
+		log.Printf("✅ Requested range is already indexed, nothing to do")
+		return
+	}
+
+	if factory != nil {
+		from := config.StartBlock
+		if *factoryStart != 0 {
+			from = *factoryStart
+		}
+		discovered, err = discoverContracts(context.Background(), client, factory, from, config.EndBlock, config.MaxBlockRange)
+		if err != nil {
+			log.Fatalf("❌ Factory discovery failed: %v", err)
+		}
+		stored, err := loadDiscoveredContracts(FINAL_DB)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		for _, c := range append(stored, discovered...) {
+			contracts.Add(common.HexToAddress(c.Address))
+		}
+		log.Printf("🏭 Factory %s: %d children created in blocks %d-%d, %d known from earlier runs; indexing %d contracts",
+			factory.Factory.Hex(), len(discovered), from, config.EndBlock, len(stored), contracts.Len())
+		if contracts.Len() == 0 {
+			log.Printf("✅ No child contracts to index, nothing to do")
+			return
+		}
+	}
+
+	config.MaxOpenDBs, err = checkFileDescriptorLimit(config.NumWorkers, *maxOpenDBs)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	if err := probeMaxBlockRange(context.Background(), client, &config); err != nil {
+		log.Fatalf("❌ %v", err)
 	}
 
 	totalBlocks := config.EndBlock - config.StartBlock + 1
-	estimatedBatches := int((totalBlocks + MAX_BLOCK_RANGE - 1) / MAX_BLOCK_RANGE)
+	estimatedBatches := int((totalBlocks + config.MaxBlockRange - 1) / config.MaxBlockRange)
 
 	log.Printf("📊 Range Analysis: %s blocks will be processed in ~%d adaptive batches",
 		formatNumber(totalBlocks), estimatedBatches)
 
-	indexer := NewHyperscaleIndexer(client, config)
+	if config.EnableCache {
+		var onCacheEvent rpcclient.CacheRecorder
+		if prom != nil {
+			onCacheEvent = func(event rpcclient.CacheEvent) { prom.RecordBlockCacheEvent(string(event)) }
+		}
+		client = rpcclient.NewBlockCache(client, *blockCacheEntries, *blockCacheMB<<20, onCacheEvent)
+	}
+
+	bulk := NewHyperscaleIndexer(client, config, prom)
+	bulk.selfDestruct = selfDestruct
+	if config.PlanStrategy == "batch" {
+		// Batches bypass failover, so they go to the first endpoint only
+		first, _, _ := strings.Cut(*rpcEndpoint, ",")
+		batchClient, _, err := dialEthClient(strings.TrimSpace(first))
+		if err != nil {
+			log.Fatalf("❌ Failed to connect for batched pre-analysis: %v", err)
+		}
+		defer batchClient.Close()
+		bulk.batcher = batchClient.Client()
+	}
+	if *metricsAddr != "" {
+		metricsServer := metrics.NewServer(*metricsAddr, os.Getenv("METRICS_TOKEN"), slog.Default())
+		go func() {
+			if err := metricsServer.StartWithContext(context.Background()); err != nil {
+				log.Printf("Warning: Metrics server stopped: %v", err)
+			}
+		}()
+	}
+	bulk.preset, bulk.events = preset, events
+	if *kafkaURL != "" {
+		if *output == "sharded" || *verifyOnly {
+			log.Fatalf("❌ -kafka-rest-url publishes while consolidating into %s; it cannot be used with -output sharded or -verify-only", FINAL_DB)
+		}
+		sink, err := indexer.NewKafkaSink(*kafkaURL, *kafkaTopic, *kafkaKey, *kafkaBatch, 0, slog.Default())
+		if err != nil {
+			log.Fatalf("❌ Invalid Kafka settings: %v", err)
+		}
+		bulk.kafka = sink
+		log.Printf("📤 Publishing consolidated logs to Kafka topic %s", *kafkaTopic)
+	}
 
 	log.Println("🔍 Generating RPC-optimized adaptive batches...")
-	batches, err := indexer.generateAdaptiveBatches()
+	batches, err := bulk.generateAdaptiveBatches()
 	if err != nil {
 		log.Fatalf("❌ Failed to generate adaptive batches: %v", err)
 	}
 
 	log.Printf("🚀 Launching %d workers to process %d adaptive batches...", config.NumWorkers, len(batches))
 
-	var wg sync.WaitGroup
 	startTime := time.Now()
 
 	// Enhanced progress monitoring
@@ -468,8 +3642,8 @@ func main() {
 		for {
 			select {
 			case <-ticker.C:
-				processed := atomic.LoadInt64(&indexer.processed)
-				completed := atomic.LoadInt64(&indexer.batchCounter)
+				processed := atomic.LoadInt64(&bulk.processed)
+				completed := atomic.LoadInt64(&bulk.batchCounter)
 				elapsed := time.Since(startTime)
 				rate := float64(processed) / elapsed.Seconds()
 				progress := float64(completed) / float64(len(batches)) * 100
@@ -481,50 +3655,61 @@ func main() {
 	}()
 
 	// Process batches with worker pooling
-	batchChan := make(chan BatchInfo, len(batches))
-
-	// Start workers
-	for i := 0; i < config.NumWorkers; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			for batch := range batchChan {
-				if err := indexer.processAdaptiveBatch(batch); err != nil {
-					indexer.errors <- fmt.Errorf("worker %d batch %d error: %v", workerID, batch.BatchID, err)
-				}
-			}
-		}(i)
+	bulk.progress = newBatchProgress(batches)
+	resumed := bulk.resumeCheckpoint(batches)
+	if err := prepareWorkerDBs(batches, resumed); err != nil {
+		log.Fatalf("❌ Failed to prepare %s: %v", DB_DIR, err)
 	}
 
-	// Distribute batches to workers
-	go func() {
-		defer close(batchChan)
-		for _, batch := range batches {
-			batchChan <- batch
-		}
-	}()
-
-	wg.Wait()
-	close(indexer.errors)
-
-	// Report any errors
-	errorCount := 0
-	for err := range indexer.errors {
-		log.Printf("⚠️  Processing error: %v", err)
-		errorCount++
-	}
+	errorCount := bulk.runWorkers(batches[resumed:])
 
 	if errorCount > 0 {
 		log.Printf("⚠️  Total errors encountered: %d", errorCount)
+		if config.CheckpointPath != "" {
+			log.Fatalf("❌ Stopping before consolidation; worker DBs are kept in %s, run again with the same options to resume from %s",
+				DB_DIR, config.CheckpointPath)
+		}
+	}
+	if stray := atomic.LoadInt64(&bulk.strayLogs); stray > 0 {
+		log.Printf("⚠️  %d logs outside their requested block range were excluded", stray)
+	}
+	if unexpected := atomic.LoadInt64(&bulk.unexpectedTopics); unexpected > 0 {
+		log.Printf("⚠️  %d logs with an unconfigured topic0 were excluded", unexpected)
+	}
+	if stale := atomic.LoadInt64(&bulk.stalePlan); stale > 0 {
+		os.Remove(bulk.planCachePath())
+		log.Fatalf("❌ %d batches no longer match the batch plan (the chain or the options changed since pre-analysis); the cached plan was discarded, run again to re-analyze",
+			stale)
+	}
+
+	if *output == "sharded" && !*verifyOnly {
+		if _, err := bulk.writeShards(batches, *shardDir); err != nil {
+			log.Fatalf("❌ Failed to write shards: %v", err)
+		}
+		finishRun(config.CheckpointPath)
+		bulk.printMetrics()
+		log.Printf("🎉 Adaptive indexing complete! Sharded output: %s", *shardDir)
+		return
 	}
 
 	log.Println("🔄 Consolidating all batches into unified database...")
-	if err := indexer.consolidateAllBatches(batches); err != nil {
+	if *verifyOnly {
+		verifyConsolidation(bulk, batches)
+		return
+	}
+
+	report, err := bulk.consolidateAllBatches(batches, FINAL_DB, false)
+	if err != nil {
 		log.Fatalf("❌ Failed to consolidate databases: %v", err)
 	}
+	finishRun(config.CheckpointPath)
+	if !report.OK() {
+		log.Printf("⚠️  Consolidation checks failed: expected %d events, merged %d, %d collisions, count mismatches in batches %v",
+			report.ExpectedLogs, report.MergedLogs, report.Collisions, report.CountMismatch)
+	}
 
-	indexer.printMetrics()
+	bulk.printMetrics()
 	log.Printf("🎉 Adaptive indexing complete! Unified database: %s", FINAL_DB)
 	log.Printf("📈 Total efficiency: Processed %s events from %s blocks using RPC-optimized batching",
-		formatNumber(indexer.metrics.TotalLogs), formatNumber(indexer.metrics.TotalBlocks))
+		formatNumber(bulk.metrics.TotalLogs), formatNumber(bulk.metrics.TotalBlocks))
 }
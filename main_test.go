@@ -0,0 +1,2339 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"example/hello/internal/indexer"
+	"example/hello/internal/metrics"
+	"example/hello/internal/rpcclient"
+	"example/hello/internal/storage"
+
+	"github.com/boltdb/bolt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// fakeChain serves logs of the indexed contract and event, one block per number, and
+// counts the calls made. Methods it does not implement panic through the nil Client.
+type fakeChain struct {
+	rpcclient.Client
+
+	mu         sync.Mutex
+	head       uint64
+	logs       []types.Log
+	calls      map[string]int
+	hashes     map[common.Hash]uint64      // block hash to number, for blocks holding logs
+	failFilter func(from, to uint64) error // optional FilterLogs failure per range
+	failBlock  map[uint64]bool             // blocks whose BlockByHash fails
+	hasCode    func(block uint64) bool     // whether the contract has code at a block; nil is always
+}
+
+func newFakeChain(head uint64) *fakeChain {
+	return &fakeChain{head: head, calls: make(map[string]int), hashes: make(map[common.Hash]uint64),
+		failBlock: make(map[uint64]bool)}
+}
+
+// header returns block n's header; parent hashes are not chained, only non-zero
+func (c *fakeChain) header(n uint64) *types.Header {
+	return &types.Header{
+		Number:     new(big.Int).SetUint64(n),
+		Time:       1_700_000_000 + 12*n,
+		ParentHash: common.BigToHash(new(big.Int).SetUint64(n + 1_000_000)),
+		Difficulty: big.NewInt(0),
+	}
+}
+
+// addLog appends a log of the indexed contract and event at block in tx, and returns it
+func (c *fakeChain) addLog(block uint64, tx common.Hash) types.Log {
+	return c.addEvent(block, tx, common.HexToHash(EVENT_TOPIC))
+}
+
+// addEvent appends a log of the indexed contract with topic0 at block in tx
+func (c *fakeChain) addEvent(block uint64, tx common.Hash, topic0 common.Hash) types.Log {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var index uint
+	for _, l := range c.logs {
+		if l.BlockNumber == block {
+			index++
+		}
+	}
+	l := types.Log{
+		Address:     common.HexToAddress(CONTRACT_ADDR),
+		Topics:      []common.Hash{topic0},
+		Data:        []byte{byte(block), byte(index)},
+		BlockNumber: block,
+		TxHash:      tx,
+		BlockHash:   c.header(block).Hash(),
+		Index:       index,
+	}
+	c.hashes[l.BlockHash] = block
+	c.logs = append(c.logs, l)
+	return l
+}
+
+// count returns how often method was called
+func (c *fakeChain) count(method string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[method]
+}
+
+func (c *fakeChain) called(method string) {
+	c.mu.Lock()
+	c.calls[method]++
+	c.mu.Unlock()
+}
+
+func (c *fakeChain) BlockNumber(ctx context.Context) (uint64, error) {
+	c.called("BlockNumber")
+	return c.head, nil
+}
+
+func (c *fakeChain) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	c.called("FilterLogs")
+	from, to := q.FromBlock.Uint64(), q.ToBlock.Uint64()
+	if c.failFilter != nil {
+		if err := c.failFilter(from, to); err != nil {
+			return nil, err
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []types.Log
+	for _, l := range c.logs {
+		if l.BlockNumber >= from && l.BlockNumber <= to && queryMatches(q, l) {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+func (c *fakeChain) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	c.called("CodeAt")
+	if c.hasCode != nil && !c.hasCode(blockNumber.Uint64()) {
+		return nil, nil
+	}
+	return []byte{0x60, 0x80}, nil
+}
+
+// queryMatches reports whether l passes q's address and topic0 filters
+func queryMatches(q ethereum.FilterQuery, l types.Log) bool {
+	if len(q.Addresses) > 0 && !slices.Contains(q.Addresses, l.Address) {
+		return false
+	}
+	if len(q.Topics) > 0 && len(q.Topics[0]) > 0 && !slices.Contains(q.Topics[0], l.Topics[0]) {
+		return false
+	}
+	return true
+}
+
+// blockByHash finds the number of a block that holds logs by its hash
+func (c *fakeChain) blockByHash(hash common.Hash) (uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n, ok := c.hashes[hash]
+	return n, ok
+}
+
+func (c *fakeChain) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	c.called("BlockByHash")
+	n, ok := c.blockByHash(hash)
+	if !ok || c.failBlock[n] {
+		return nil, fmt.Errorf("block %s not found", hash.Hex())
+	}
+	return types.NewBlockWithHeader(c.header(n)), nil
+}
+
+func (c *fakeChain) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	c.called("BlockByNumber")
+	n := number.Uint64()
+	if n > c.head || c.failBlock[n] {
+		return nil, fmt.Errorf("block %d not found", n)
+	}
+	return types.NewBlockWithHeader(c.header(n)), nil
+}
+
+func (c *fakeChain) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	c.called("HeaderByHash")
+	n, ok := c.blockByHash(hash)
+	if !ok {
+		return nil, fmt.Errorf("header %s not found", hash.Hex())
+	}
+	return c.header(n), nil
+}
+
+// HeaderByNumber also fills in the bloom of the block's logs, unlike the headers blocks
+// are fetched with, so its hash is not the logs' block hash
+func (c *fakeChain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	c.called("HeaderByNumber")
+	if number == nil {
+		return c.header(c.head), nil
+	}
+	n := number.Uint64()
+	if n > c.head {
+		return nil, ethereum.NotFound
+	}
+	header := c.header(n)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, l := range c.logs {
+		if l.BlockNumber == n {
+			header.Bloom.Add(l.Address.Bytes())
+			header.Bloom.Add(l.Topics[0].Bytes())
+		}
+	}
+	return header, nil
+}
+
+func (c *fakeChain) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	c.called("TransactionReceipt")
+	return &types.Receipt{TxHash: txHash, GasUsed: 50_000, EffectiveGasPrice: big.NewInt(10)}, nil
+}
+
+// testConfig returns a bulk config for blocks start-end in windows of width
+func testConfig(start, end, width uint64) IndexerConfig {
+	return IndexerConfig{StartBlock: start, EndBlock: end, NumWorkers: 2, MaxBlockRange: width, PlanWorkers: 2}
+}
+
+func TestPlanCacheSkipsPreAnalysis(t *testing.T) {
+	t.Chdir(t.TempDir())
+	chain := newFakeChain(100)
+	for _, b := range []uint64{3, 3, 15, 27} {
+		chain.addLog(b, common.HexToHash("0x01"))
+	}
+	config := testConfig(0, 29, 10)
+
+	first, err := NewHyperscaleIndexer(chain, config, nil).generateAdaptiveBatches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chain.count("FilterLogs") != 3 {
+		t.Fatalf("pre-analysis made %d eth_getLogs calls, want 3", chain.count("FilterLogs"))
+	}
+
+	again := newFakeChain(100)
+	second, err := NewHyperscaleIndexer(again, config, nil).generateAdaptiveBatches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := again.count("FilterLogs"); n != 0 {
+		t.Errorf("cached plan still made %d eth_getLogs calls", n)
+	}
+	if len(second) != len(first) {
+		t.Fatalf("cached plan gave %d batches, want %d", len(second), len(first))
+	}
+	for i := range first {
+		if second[i].StartBlock != first[i].StartBlock || second[i].StartIndex != first[i].StartIndex ||
+			second[i].LogCount != first[i].LogCount {
+			t.Errorf("batch %d = %+v, want %+v", i, second[i], first[i])
+		}
+	}
+
+	// Another block range is another plan
+	config.EndBlock = 39
+	NewHyperscaleIndexer(again, config, nil).generateAdaptiveBatches()
+	if again.count("FilterLogs") == 0 {
+		t.Error("a plan cached for blocks 0-29 was reused for 0-39")
+	}
+}
+
+func TestStalePlanFailsBatch(t *testing.T) {
+	t.Chdir(t.TempDir())
+	chain := newFakeChain(100)
+	chain.addLog(5, common.HexToHash("0x01"))
+	config := testConfig(0, 9, 10)
+
+	batches, err := NewHyperscaleIndexer(chain, config, nil).generateAdaptiveBatches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(DB_DIR, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The chain now returns a log the cached plan did not count
+	chain.addLog(6, common.HexToHash("0x02"))
+	h := NewHyperscaleIndexer(chain, config, nil)
+	if err := h.processAdaptiveBatch(batches[0]); err == nil {
+		t.Fatal("batch with more logs than planned was stored")
+	}
+	if h.stalePlan != 1 {
+		t.Errorf("stalePlan = %d, want 1", h.stalePlan)
+	}
+}
+
+// testBatches plans n single-block batches of ten logs with worker DBs under dir
+func testBatches(dir string, n int) []BatchInfo {
+	batches := make([]BatchInfo, n)
+	for i := range batches {
+		batches[i] = BatchInfo{
+			BatchID:    i,
+			StartBlock: uint64(100 + i),
+			EndBlock:   uint64(100 + i),
+			StartIndex: uint64(i * 10),
+			LogCount:   10,
+			DbPath:     filepath.Join(dir, fmt.Sprintf("batch_%d.db", i)),
+		}
+	}
+	return batches
+}
+
+// commitBatch records a batch the way a successful processAdaptiveBatch does
+func commitBatch(t *testing.T, h *HyperscaleIndexer, b BatchInfo) {
+	t.Helper()
+	if err := os.WriteFile(b.DbPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	b.GasAnalyzed = 21000
+	h.completed[b.BatchID] = b
+	h.progress.markDone(b.BatchID)
+}
+
+func TestCheckpointStopsAtFailedBatch(t *testing.T) {
+	dir := t.TempDir()
+	cpPath := filepath.Join(dir, "checkpoint.json")
+	config := IndexerConfig{NumWorkers: 2, StartBlock: 100, EndBlock: 103, CheckpointPath: cpPath}
+	batches := testBatches(dir, 4)
+
+	// Batch 1 fails; batches 0 and 3 commit, so only batch 0 is a committed prefix
+	h := NewHyperscaleIndexer(nil, config, nil)
+	h.progress = newBatchProgress(batches)
+	commitBatch(t, h, batches[0])
+	commitBatch(t, h, batches[3])
+	h.saveCheckpoint()
+
+	cp := h.progress.checkpoint(config.StartBlock, config.StartIndex)
+	if cp.CompletedBatches != 1 || cp.LastBlock != 100 || cp.NextIndex != 10 {
+		t.Fatalf("checkpoint = %d batches through block %d, next index %d; want 1, 100, 10",
+			cp.CompletedBatches, cp.LastBlock, cp.NextIndex)
+	}
+
+	// A second run of the same plan resumes after batch 0 only
+	again := NewHyperscaleIndexer(nil, config, nil)
+	again.progress = newBatchProgress(batches)
+	if resumed := again.resumeCheckpoint(batches); resumed != 1 {
+		t.Fatalf("resumed %d batches, want 1", resumed)
+	}
+	if done := again.completed[0]; done.GasAnalyzed != 21000 || done.DbPath != batches[0].DbPath {
+		t.Errorf("resumed batch 0 = %+v, want its saved totals and worker DB", done)
+	}
+	if _, ok := again.completed[3]; ok {
+		t.Error("batch 3 was resumed although batch 1 before it failed")
+	}
+}
+
+func TestManyFailedBatchesDoNotBlockWorkers(t *testing.T) {
+	// Every batch fails to open its worker DB; 60 failures on one worker are six times
+	// the errors buffer
+	batches := testBatches(filepath.Join(t.TempDir(), "missing"), 60)
+	h := NewHyperscaleIndexer(nil, IndexerConfig{NumWorkers: 1}, nil)
+	h.progress = newBatchProgress(batches)
+
+	done := make(chan int)
+	go func() { done <- h.runWorkers(batches) }()
+	select {
+	case n := <-done:
+		if n != 60 {
+			t.Errorf("%d errors counted, want 60", n)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("workers blocked sending errors")
+	}
+}
+
+func TestCheckpointIgnoredWhenPlanChanges(t *testing.T) {
+	dir := t.TempDir()
+	config := IndexerConfig{NumWorkers: 1, StartBlock: 100, EndBlock: 101, CheckpointPath: filepath.Join(dir, "cp.json")}
+	batches := testBatches(dir, 2)
+
+	h := NewHyperscaleIndexer(nil, config, nil)
+	h.progress = newBatchProgress(batches)
+	commitBatch(t, h, batches[0])
+	h.saveCheckpoint()
+
+	// Re-analysis found a different count for the committed batch
+	changed := testBatches(dir, 2)
+	changed[0].LogCount = 11
+	fresh := NewHyperscaleIndexer(nil, config, nil)
+	fresh.progress = newBatchProgress(changed)
+	if resumed := fresh.resumeCheckpoint(changed); resumed != 0 {
+		t.Errorf("resumed %d batches of a changed plan, want 0", resumed)
+	}
+
+	// The worker DB of a committed batch is gone
+	os.Remove(batches[0].DbPath)
+	fresh = NewHyperscaleIndexer(nil, config, nil)
+	fresh.progress = newBatchProgress(batches)
+	if resumed := fresh.resumeCheckpoint(batches); resumed != 0 {
+		t.Errorf("resumed %d batches without their worker DB, want 0", resumed)
+	}
+}
+
+// writeSourceDB writes n entries, one per block from block 100, plus a bloom per block,
+// a dead letter at index n, run metadata and a discovered contract
+func writeSourceDB(t *testing.T, path string, n int) {
+	t.Helper()
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.Update(func(tx *bolt.Tx) error {
+		buckets := make(map[string]*bolt.Bucket)
+		for _, name := range []string{BUCKET_NAME, BLOOM_BUCKET, DEAD_LETTER_BUCKET, "metadata", CONTRACTS_BUCKET} {
+			b, err := tx.CreateBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+			buckets[name] = b
+		}
+		for i := 0; i < n; i++ {
+			data, err := json.Marshal(LogEntry{Index: uint64(i), BlockNumber: uint64(100 + i)})
+			if err != nil {
+				return err
+			}
+			if err := buckets[BUCKET_NAME].Put(uint64ToBytes(uint64(i)), data); err != nil {
+				return err
+			}
+			if err := buckets[BLOOM_BUCKET].Put(uint64ToBytes(uint64(100+i)), []byte("bloom")); err != nil {
+				return err
+			}
+		}
+		if err := buckets[DEAD_LETTER_BUCKET].Put(uint64ToBytes(uint64(n)), []byte(`{}`)); err != nil {
+			return err
+		}
+		if err := buckets["metadata"].Put([]byte("performance_metrics"), []byte(`{}`)); err != nil {
+			return err
+		}
+		return buckets[CONTRACTS_BUCKET].Put([]byte("0xabc"), []byte(`{}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// bucketLen counts the keys of bucket name in the DB at path
+func bucketLen(t *testing.T, path, name string) int {
+	t.Helper()
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	n := 0
+	db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(name)); b != nil {
+			n = b.Stats().KeyN
+		}
+		return nil
+	})
+	return n
+}
+
+func TestRechunkRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "source.db")
+	writeSourceDB(t, src, 10)
+
+	shardDir := filepath.Join(dir, "shards")
+	if err := rechunk(src, "sharded", 3, "", shardDir); err != nil {
+		t.Fatalf("split: %v", err)
+	}
+	manifest, err := storage.LoadShardManifest(shardDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Shards) != 3 || manifest.TotalCount() != 10 {
+		t.Fatalf("split into %d shards holding %d entries, want 3 holding 10",
+			len(manifest.Shards), manifest.TotalCount())
+	}
+	first := manifest.Shards[0].File
+	last := manifest.Shards[len(manifest.Shards)-1].File
+	if n := bucketLen(t, last, DEAD_LETTER_BUCKET); n != 1 {
+		t.Errorf("last shard holds %d dead letters, want the one past its entries", n)
+	}
+	for _, name := range []string{"metadata", CONTRACTS_BUCKET} {
+		if n := bucketLen(t, first, name); n != 1 {
+			t.Errorf("first shard holds %d keys in %s, want 1", n, name)
+		}
+	}
+
+	merged := filepath.Join(dir, "merged.db")
+	if err := rechunk(shardDir, "single", 0, merged, ""); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	for name, want := range map[string]int{
+		BUCKET_NAME: 10, BLOOM_BUCKET: 10, DEAD_LETTER_BUCKET: 1, "metadata": 1, CONTRACTS_BUCKET: 1,
+	} {
+		if n := bucketLen(t, merged, name); n != want {
+			t.Errorf("merged DB holds %d keys in %s, want %d", n, name, want)
+		}
+	}
+}
+
+// openDBFiles counts the .db files this process has open
+func openDBFiles(t *testing.T) int {
+	t.Helper()
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skipf("cannot list open files: %v", err)
+	}
+	n := 0
+	for _, fd := range fds {
+		target, err := os.Readlink(filepath.Join("/proc/self/fd", fd.Name()))
+		if err == nil && filepath.Ext(target) == ".db" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestOpenWorkerDBsStayUnderCap(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(DB_DIR, 0755); err != nil {
+		t.Fatal(err)
+	}
+	const maxOpen = 2
+	chain := newFakeChain(100)
+	var mu sync.Mutex
+	peak := 0
+	// eth_getLogs runs while the batch DB is open; sample the open DBs there
+	chain.failFilter = func(from, to uint64) error {
+		mu.Lock()
+		peak = max(peak, openDBFiles(t))
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}
+
+	config := testConfig(0, 79, 10)
+	config.NumWorkers = 8
+	config.MaxOpenDBs = maxOpen
+	h := NewHyperscaleIndexer(chain, config, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		b := BatchInfo{BatchID: i, StartBlock: uint64(10 * i), EndBlock: uint64(10*i + 9),
+			DbPath: filepath.Join(DB_DIR, fmt.Sprintf("batch_%d.db", i))}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := h.processAdaptiveBatch(b); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if peak == 0 || peak > maxOpen {
+		t.Errorf("peak of %d worker DBs open at once, want 1-%d", peak, maxOpen)
+	}
+}
+
+func TestFileDescriptorLimitTooLow(t *testing.T) {
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil {
+		t.Skip(err)
+	}
+	if _, err := checkFileDescriptorLimit(int(rl.Cur), 0); err == nil {
+		t.Errorf("%d workers under a limit of %d passed the check", rl.Cur, rl.Cur)
+	}
+	limit, err := checkFileDescriptorLimit(2, int(rl.Cur))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint64(limit) > rl.Cur-FD_RESERVE {
+		t.Errorf("open DB cap %d leaves under %d descriptors spare of %d", limit, FD_RESERVE, rl.Cur)
+	}
+}
+
+// readEntries returns the entries of the logs bucket in the DB at path, in index order
+func readEntries(t *testing.T, path string) []LogEntry {
+	t.Helper()
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var entries []LogEntry
+	err = db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(BUCKET_NAME)).ForEach(func(k, v []byte) error {
+			var e LogEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			entries = append(entries, e)
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestBlockFetchFailureKeepsBatch(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(DB_DIR, 0755); err != nil {
+		t.Fatal(err)
+	}
+	chain := newFakeChain(100)
+	for _, b := range []uint64{2, 3, 4} {
+		chain.addLog(b, common.BigToHash(big.NewInt(int64(b))))
+	}
+	chain.failBlock[3] = true
+
+	h := NewHyperscaleIndexer(chain, testConfig(0, 9, 10), nil)
+	batch := BatchInfo{StartBlock: 0, EndBlock: 9, StartIndex: 40, LogCount: 3, DbPath: filepath.Join(DB_DIR, "batch_0.db")}
+	if err := h.processAdaptiveBatch(batch); err != nil {
+		t.Fatalf("batch with one unfetchable block failed: %v", err)
+	}
+	if n := chain.count("BlockByHash"); n != 2+BLOCK_RETRIES {
+		t.Errorf("%d block fetches, want %d retries of block 3 and one each for blocks 2 and 4", n, BLOCK_RETRIES)
+	}
+
+	entries := readEntries(t, batch.DbPath)
+	if len(entries) != 3 {
+		t.Fatalf("batch stored %d logs, want 3", len(entries))
+	}
+	for i, e := range entries {
+		if e.Index != 40+uint64(i) {
+			t.Errorf("entry %d has index %d, want %d", i, e.Index, 40+i)
+		}
+		wantEnriched := e.BlockNumber != 3
+		if e.Enriched != wantEnriched || (e.ParentHash != "") != wantEnriched || (e.Timestamp != 0) != wantEnriched {
+			t.Errorf("block %d log: enriched=%v parentHash=%q timestamp=%d, want enriched=%v",
+				e.BlockNumber, e.Enriched, e.ParentHash, e.Timestamp, wantEnriched)
+		}
+	}
+}
+
+// partialChain is a fakeChain behind a light endpoint that returns the listed blocks
+// with a zero timestamp and parent hash, and their headers too when headersPartial
+type partialChain struct {
+	*fakeChain
+	partial        map[uint64]bool
+	headersPartial bool
+}
+
+func (c *partialChain) strip(h *types.Header) *types.Header {
+	if c.partial[h.Number.Uint64()] {
+		h.Time, h.ParentHash = 0, common.Hash{}
+	}
+	return h
+}
+
+func (c *partialChain) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	block, err := c.fakeChain.BlockByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewBlockWithHeader(c.strip(block.Header())), nil
+}
+
+func (c *partialChain) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	header, err := c.fakeChain.HeaderByHash(ctx, hash)
+	if err != nil || !c.headersPartial {
+		return header, err
+	}
+	return c.strip(header), nil
+}
+
+func TestPartialBlockDataIsNotStored(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(DB_DIR, 0755); err != nil {
+		t.Fatal(err)
+	}
+	base := newFakeChain(100)
+	for _, b := range []uint64{2, 3} {
+		base.addLog(b, common.BigToHash(big.NewInt(int64(b))))
+	}
+
+	run := func(name string, chain *partialChain, fallback bool) map[uint64]LogEntry {
+		t.Helper()
+		config := testConfig(0, 9, 10)
+		config.HeaderFallback = fallback
+		batch := BatchInfo{StartBlock: 0, EndBlock: 9, LogCount: 2, DbPath: filepath.Join(DB_DIR, name+".db")}
+		if err := NewHyperscaleIndexer(chain, config, nil).processAdaptiveBatch(batch); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		byBlock := make(map[uint64]LogEntry)
+		for _, e := range readEntries(t, batch.DbPath) {
+			byBlock[e.BlockNumber] = e
+		}
+		return byBlock
+	}
+	partial := map[uint64]bool{3: true}
+
+	// The full header from eth_getBlockByHash replaces the partial block's fields
+	fixed := run("fallback", &partialChain{fakeChain: base, partial: partial}, true)
+	if e := fixed[3]; !e.Enriched || e.Timestamp != base.header(3).Time || e.ParentHash != base.header(3).ParentHash.Hex() {
+		t.Errorf("block 3 after the header fallback: enriched=%v timestamp=%d parentHash=%s", e.Enriched, e.Timestamp, e.ParentHash)
+	}
+	if n := base.count("HeaderByHash"); n != 1 {
+		t.Errorf("%d header fallbacks, want 1 for the partial block only", n)
+	}
+
+	// Without the fallback, or when the header is partial too, the log is left for -enrich
+	for name, chain := range map[string]*partialChain{
+		"no-fallback":  {fakeChain: base, partial: partial},
+		"both-partial": {fakeChain: base, partial: partial, headersPartial: true},
+	} {
+		entries := run(name, chain, name != "no-fallback")
+		if e := entries[3]; e.Enriched || e.Timestamp != 0 || e.ParentHash != "" {
+			t.Errorf("%s: block 3 stored enriched=%v timestamp=%d parentHash=%q, want it un-enriched", name, e.Enriched, e.Timestamp, e.ParentHash)
+		}
+		if e := entries[2]; !e.Enriched || e.Timestamp == 0 {
+			t.Errorf("%s: block 2 with full data stored un-enriched", name)
+		}
+	}
+}
+
+// writeEntries stores entries in the logs bucket of a new DB at path
+func writeEntries(t *testing.T, path string, entries ...LogEntry) {
+	t.Helper()
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(BUCKET_NAME))
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			data, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(uint64ToBytes(e.Index), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// enrichCursor reads where the next enrichment pass of the DB at path starts
+func enrichCursor(t *testing.T, path string) uint64 {
+	t.Helper()
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var cursor uint64
+	db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket([]byte("metadata")).Get([]byte(ENRICH_CURSOR)); v != nil {
+			cursor = bytesToUint64(v)
+		}
+		return nil
+	})
+	return cursor
+}
+
+func TestEnrichmentFillsIncompleteEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "final.db")
+	writeEntries(t, path,
+		LogEntry{Index: 0, BlockNumber: 10, TxHash: "0x01", Enriched: true, Timestamp: 1, ParentHash: "0xp", GasUsed: 7},
+		LogEntry{Index: 1, BlockNumber: 11, TxHash: "0x02"},
+		LogEntry{Index: 2, BlockNumber: 12, TxHash: "0x03"},
+		LogEntry{Index: 3, BlockNumber: 13, TxHash: "0x04"},
+	)
+	chain := newFakeChain(100)
+	chain.failBlock[12] = true
+
+	if err := runEnrichment(chain, path, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n := chain.count("BlockByNumber"); n != 3 {
+		t.Errorf("first pass fetched %d blocks, want 3 (entry 0 is complete)", n)
+	}
+	for _, e := range readEntries(t, path) {
+		if needsEnrichment(&e) != (e.Index == 2) {
+			t.Errorf("entry %d after the first pass: %+v", e.Index, e)
+		}
+		if e.Index == 1 && (e.Timestamp != chain.header(11).Time || e.GasUsed != 50_000 || e.GasPrice == nil) {
+			t.Errorf("entry 1 enriched with timestamp %d gas %d price %v", e.Timestamp, e.GasUsed, e.GasPrice)
+		}
+	}
+	if cursor := enrichCursor(t, path); cursor != 2 {
+		t.Errorf("cursor = %d after entry 2 failed, want 2", cursor)
+	}
+
+	// The next pass resumes at the failed entry and finishes
+	delete(chain.failBlock, 12)
+	if err := runEnrichment(chain, path, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n := chain.count("BlockByNumber"); n != 4 {
+		t.Errorf("second pass fetched %d blocks, want 1", n-3)
+	}
+	for _, e := range readEntries(t, path) {
+		if needsEnrichment(&e) {
+			t.Errorf("entry %d still incomplete: %+v", e.Index, e)
+		}
+	}
+
+	// A third pass has nothing left to fetch
+	if err := runEnrichment(chain, path, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n := chain.count("BlockByNumber"); n != 4 {
+		t.Errorf("pass over an enriched DB fetched %d blocks", n-4)
+	}
+}
+
+func TestFilterLogsSplitsCappedRanges(t *testing.T) {
+	chain := newFakeChain(100)
+	var want []uint64
+	for _, b := range []uint64{0, 3, 3, 7, 8, 12, 15} {
+		chain.addLog(b, common.HexToHash("0x01"))
+		want = append(want, b)
+	}
+	// The provider rejects anything wider than four blocks
+	chain.failFilter = func(from, to uint64) error {
+		if to-from+1 > 4 {
+			return fmt.Errorf("query returned more than 10000 results")
+		}
+		return nil
+	}
+	h := NewHyperscaleIndexer(chain, testConfig(0, 15, 16), nil)
+	query := func(from, to uint64) ethereum.FilterQuery {
+		return ethereum.FilterQuery{FromBlock: new(big.Int).SetUint64(from), ToBlock: new(big.Int).SetUint64(to)}
+	}
+
+	logs, err := h.filterLogs(context.Background(), query(0, 15))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []uint64
+	for _, l := range logs {
+		got = append(got, l.BlockNumber)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("merged logs from blocks %v, want %v in chain order", got, want)
+	}
+	// 0-15 fails, 0-7 and 8-15 fail, their four halves succeed
+	if n := chain.count("FilterLogs"); n != 7 {
+		t.Errorf("%d eth_getLogs calls, want 7", n)
+	}
+
+	// A single block over the cap cannot be split further
+	chain.failFilter = func(from, to uint64) error { return fmt.Errorf("too many results") }
+	if _, err := h.filterLogs(context.Background(), query(3, 3)); err == nil {
+		t.Error("single block over the cap returned no error")
+	}
+
+	// Other errors are returned as they are, without splitting
+	chain.failFilter = func(from, to uint64) error { return fmt.Errorf("connection refused") }
+	before := chain.count("FilterLogs")
+	if _, err := h.filterLogs(context.Background(), query(0, 15)); err == nil || chain.count("FilterLogs") != before+1 {
+		t.Errorf("connection error: %v after %d calls, want it returned after one", err, chain.count("FilterLogs")-before)
+	}
+}
+
+// runBulk plans, fetches and consolidates config's range into FINAL_DB the way main
+// does, with -overlap skip, and returns the blocks eth_getLogs was asked for
+func runBulk(t *testing.T, chain *fakeChain, config IndexerConfig) (lowest uint64) {
+	t.Helper()
+	if err := resolveOverlap(&config, "skip"); err != nil {
+		t.Fatal(err)
+	}
+	lowest = config.EndBlock
+	chain.failFilter = func(from, to uint64) error {
+		lowest = min(lowest, from)
+		return nil
+	}
+	defer func() { chain.failFilter = nil }()
+
+	h := NewHyperscaleIndexer(chain, config, nil)
+	batches, err := h.generateAdaptiveBatches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.progress = newBatchProgress(batches)
+	if err := prepareWorkerDBs(batches, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range batches {
+		if err := h.processAdaptiveBatch(b); err != nil {
+			t.Fatal(err)
+		}
+		h.progress.markDone(b.BatchID)
+	}
+	report, err := h.consolidateAllBatches(batches, FINAL_DB, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Fatalf("consolidation report: %+v", report)
+	}
+	return lowest
+}
+
+func TestRestartAppendsWithoutRefetching(t *testing.T) {
+	t.Chdir(t.TempDir())
+	chain := newFakeChain(2100)
+	var want []types.Log
+	for b := uint64(0); b <= 2000; b += 7 {
+		want = append(want, chain.addLog(b, common.BigToHash(new(big.Int).SetUint64(b))))
+		if b%91 == 0 {
+			want = append(want, chain.addLog(b, common.BigToHash(new(big.Int).SetUint64(b))))
+		}
+	}
+
+	runBulk(t, chain, testConfig(0, 1000, 100))
+	lastBlock, _, _, err := lastIndexedPosition(FINAL_DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh indexer asked for the whole range continues after the last stored log.
+	// The final DB records logs, not scanned blocks, so the empty blocks after it are
+	// scanned again; they hold nothing to duplicate.
+	if lowest := runBulk(t, chain, testConfig(0, 2000, 100)); lowest <= lastBlock {
+		t.Errorf("second run fetched logs from block %d, already indexed up to block %d", lowest, lastBlock)
+	}
+
+	entries := readEntries(t, FINAL_DB)
+	if len(entries) != len(want) {
+		t.Fatalf("final DB holds %d entries, want one per log: %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if e.Index != uint64(i) {
+			t.Fatalf("entry %d has index %d; indices are not contiguous", i, e.Index)
+		}
+		if e.BlockNumber != want[i].BlockNumber || e.LogIndex != uint64(want[i].Index) {
+			t.Errorf("entry %d is log %d of block %d, want log %d of block %d",
+				i, e.LogIndex, e.BlockNumber, want[i].Index, want[i].BlockNumber)
+		}
+	}
+}
+
+func TestResolveOverlapWithIndexedRange(t *testing.T) {
+	t.Chdir(t.TempDir())
+	fresh := testConfig(10, 100, 10)
+	if err := resolveOverlap(&fresh, "error"); err != nil || fresh.StartBlock != 10 || fresh.StartIndex != 0 {
+		t.Fatalf("without a final DB: start %d index %d (%v), want 10, 0", fresh.StartBlock, fresh.StartIndex, err)
+	}
+
+	writeEntries(t, FINAL_DB,
+		LogEntry{Index: 0, BlockNumber: 20},
+		LogEntry{Index: 1, BlockNumber: 50},
+	)
+
+	skip := testConfig(10, 100, 10)
+	if err := resolveOverlap(&skip, "skip"); err != nil {
+		t.Fatal(err)
+	}
+	if skip.StartBlock != 51 || skip.StartIndex != 2 {
+		t.Errorf("skip: start %d index %d, want 51, 2", skip.StartBlock, skip.StartIndex)
+	}
+
+	refuse := testConfig(10, 100, 10)
+	if err := resolveOverlap(&refuse, "error"); err == nil {
+		t.Error("error policy accepted a start below the indexed block 50")
+	}
+
+	after := testConfig(60, 100, 10)
+	if err := resolveOverlap(&after, "error"); err != nil || after.StartBlock != 60 || after.StartIndex != 2 {
+		t.Errorf("append after the index: start %d index %d (%v), want 60, 2", after.StartBlock, after.StartIndex, err)
+	}
+}
+
+func TestClampToHead(t *testing.T) {
+	chain := newFakeChain(1000)
+	ctx := context.Background()
+
+	past := testConfig(900, 2000, 100)
+	if err := clampToHead(ctx, chain, &past, 12); err != nil {
+		t.Fatal(err)
+	}
+	if past.StartBlock != 900 || past.EndBlock != 988 {
+		t.Errorf("range past the head became %d-%d, want 900-988", past.StartBlock, past.EndBlock)
+	}
+
+	within := testConfig(0, 500, 100)
+	if err := clampToHead(ctx, chain, &within, 12); err != nil || within.EndBlock != 500 {
+		t.Errorf("range within the head became end %d (%v), want 500", within.EndBlock, err)
+	}
+
+	future := testConfig(995, 2000, 100)
+	if err := clampToHead(ctx, chain, &future, 12); err == nil {
+		t.Error("range starting past the confirmed head was accepted")
+	}
+}
+
+func TestProbeMaxBlockRange(t *testing.T) {
+	ctx := context.Background()
+	widths := func(chain *fakeChain) *[]uint64 {
+		var seen []uint64
+		prev := chain.failFilter
+		chain.failFilter = func(from, to uint64) error {
+			seen = append(seen, to-from+1)
+			return prev(from, to)
+		}
+		return &seen
+	}
+
+	// A provider that names its limit is tuned to it in one step
+	advertised := newFakeChain(100_000)
+	advertised.failFilter = func(from, to uint64) error {
+		if to-from+1 > 2000 {
+			return fmt.Errorf("you can make eth_getLogs requests with up to a 2K block range")
+		}
+		return nil
+	}
+	seen := widths(advertised)
+	config := testConfig(0, 50_000, 10_000)
+	if err := probeMaxBlockRange(ctx, advertised, &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.MaxBlockRange != 2000 || !slices.Equal(*seen, []uint64{10_000, 2000}) {
+		t.Errorf("tuned to %d after probing widths %v, want 2000 after [10000 2000]", config.MaxBlockRange, *seen)
+	}
+
+	// One that does not is halved until it accepts
+	silent := newFakeChain(100_000)
+	silent.failFilter = func(from, to uint64) error {
+		if to-from+1 > 300 {
+			return fmt.Errorf("block range is too wide")
+		}
+		return nil
+	}
+	config = testConfig(0, 50_000, 1000)
+	if err := probeMaxBlockRange(ctx, silent, &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.MaxBlockRange != 250 {
+		t.Errorf("halved to %d, want 250", config.MaxBlockRange)
+	}
+
+	// Other failures are not mistaken for a range limit
+	down := newFakeChain(100_000)
+	down.failFilter = func(from, to uint64) error { return fmt.Errorf("connection refused") }
+	config = testConfig(0, 50_000, 1000)
+	if err := probeMaxBlockRange(ctx, down, &config); err == nil || config.MaxBlockRange != 1000 {
+		t.Errorf("unreachable provider: range %d, error %v; want 1000 and an error", config.MaxBlockRange, err)
+	}
+}
+
+func TestStoredBloomsSkipReindexWindows(t *testing.T) {
+	t.Chdir(t.TempDir())
+	newTopic := common.HexToHash("0x8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925")
+	chain := newFakeChain(100)
+	chain.addLog(3, common.HexToHash("0x01"))
+	chain.addEvent(14, common.HexToHash("0x02"), newTopic)
+	chain.addLog(25, common.HexToHash("0x03"))
+
+	config := testConfig(0, 29, 10)
+	config.StoreBlooms = true
+	runBulk(t, chain, config)
+
+	// Re-index the same blocks for the other event from the stored blooms
+	saved := eventTopics
+	eventTopics = []common.Hash{newTopic}
+	defer func() { eventTopics = saved }()
+
+	var queried [][2]uint64
+	chain.failFilter = func(from, to uint64) error {
+		queried = append(queried, [2]uint64{from, to})
+		return nil
+	}
+	config = testConfig(0, 29, 10)
+	config.RefreshPlan = true
+	batches, err := NewHyperscaleIndexer(chain, config, nil).generateAdaptiveBatches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(queried, [][2]uint64{{10, 19}}) {
+		t.Errorf("pre-analysis queried %v, want only blocks 10-19 whose bloom has the new event", queried)
+	}
+	var planned uint64
+	for _, b := range batches {
+		planned += b.LogCount
+	}
+	if planned != 1 {
+		t.Errorf("re-index planned %d logs, want 1", planned)
+	}
+}
+
+func TestDialSelectsIPCForSocketPaths(t *testing.T) {
+	// A geth-style IPC endpoint serving nothing but the transport
+	path := filepath.Join(t.TempDir(), "geth.ipc")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	server := rpc.NewServer()
+	go server.ServeListener(listener)
+	defer server.Stop()
+	defer listener.Close()
+
+	client, ipc, err := dialEthClient(path)
+	if err != nil {
+		t.Fatalf("dial %s: %v", path, err)
+	}
+	client.Close()
+	if !ipc {
+		t.Errorf("%s was not dialed over IPC", path)
+	}
+
+	// A missing socket fails as IPC instead of being tried over HTTP
+	if _, ipc, err := dialEthClient(filepath.Join(t.TempDir(), "missing.ipc")); err == nil || !ipc {
+		t.Errorf("missing socket: ipc %v, error %v; want an IPC dial error", ipc, err)
+	}
+
+	client, ipc, err = dialEthClient("http://127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if ipc {
+		t.Error("an HTTP URL was dialed over IPC")
+	}
+}
+
+// testProm registers the Prometheus metrics once per test binary; they are global
+var testProm = sync.OnceValue(metrics.NewMetrics)
+
+// histogramCount returns how many observations h holds
+func histogramCount(t *testing.T, h prometheus.Histogram) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := h.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestStaleHeadSetsGauges(t *testing.T) {
+	prom := testProm()
+	// fakeChain's head is stamped in November 2023, far behind the clock
+	checkHeadFreshness(context.Background(), newFakeChain(100), 2*time.Minute, prom)
+	if testutil.ToFloat64(prom.HeadStale) != 1 || testutil.ToFloat64(prom.HeadSkewSeconds) < 86400 {
+		t.Errorf("stale head: stale %v skew %vs", testutil.ToFloat64(prom.HeadStale), testutil.ToFloat64(prom.HeadSkewSeconds))
+	}
+	checkHeadFreshness(context.Background(), newFakeChain(100), 0, prom)
+	if testutil.ToFloat64(prom.HeadStale) != 0 {
+		t.Error("-max-head-skew 0 still flagged the head stale")
+	}
+}
+
+func TestBatchMetricsObserved(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(DB_DIR, 0755); err != nil {
+		t.Fatal(err)
+	}
+	chain := newFakeChain(100)
+	for _, b := range []uint64{1, 2, 2} {
+		chain.addLog(b, common.HexToHash("0x01"))
+	}
+	prom := testProm()
+	before := histogramCount(t, prom.BatchDurationSeconds)
+
+	h := NewHyperscaleIndexer(chain, testConfig(0, 9, 10), prom)
+	batch := BatchInfo{StartBlock: 0, EndBlock: 9, LogCount: 3, DbPath: filepath.Join(DB_DIR, "batch_0.db")}
+	if err := h.processAdaptiveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	if n := histogramCount(t, prom.BatchDurationSeconds) - before; n != 1 {
+		t.Errorf("batch duration histogram gained %d observations, want 1", n)
+	}
+	if n := testutil.ToFloat64(prom.BatchLogCount); n != 3 {
+		t.Errorf("batch log count gauge = %v, want 3", n)
+	}
+
+	// A failed batch is not observed as completed
+	chain.addLog(5, common.HexToHash("0x02"))
+	batch.DbPath = filepath.Join(DB_DIR, "batch_1.db")
+	h.processAdaptiveBatch(batch)
+	if n := histogramCount(t, prom.BatchDurationSeconds) - before; n != 1 {
+		t.Errorf("failed batch was observed: %d observations", n)
+	}
+}
+
+func TestParallelEfficiency(t *testing.T) {
+	for _, tc := range []struct {
+		busy, wall          time.Duration
+		workers             int
+		speedup, efficiency float64
+	}{
+		{40 * time.Second, 10 * time.Second, 4, 4, 1},      // every worker busy throughout
+		{40 * time.Second, 20 * time.Second, 4, 2, 0.5},    // half the pool idle on average
+		{10 * time.Second, 10 * time.Second, 8, 1, 0.125},  // effectively serial
+		{90 * time.Second, 60 * time.Second, 2, 1.5, 0.75}, // uneven batches
+		{10 * time.Second, 0, 4, 0, 0},                     // nothing measured
+		{10 * time.Second, time.Second, 0, 0, 0},           // no workers
+	} {
+		speedup, efficiency := parallelEfficiency(tc.busy, tc.wall, tc.workers)
+		if math.Abs(speedup-tc.speedup) > 1e-9 || math.Abs(efficiency-tc.efficiency) > 1e-9 {
+			t.Errorf("busy %v, wall %v, %d workers: speedup %.3f efficiency %.3f, want %.3f and %.3f",
+				tc.busy, tc.wall, tc.workers, speedup, efficiency, tc.speedup, tc.efficiency)
+		}
+	}
+}
+
+func TestEmptyWindowsGetNoBatchDB(t *testing.T) {
+	t.Chdir(t.TempDir())
+	chain := newFakeChain(200)
+	for _, b := range []uint64{21, 21, 25, 73} {
+		chain.addLog(b, common.HexToHash("0x01"))
+	}
+
+	h := NewHyperscaleIndexer(chain, testConfig(0, 99, 10), nil)
+	batches, err := h.generateAdaptiveBatches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 2 {
+		t.Fatalf("%d batches over 10 windows with logs in 2, want 2", len(batches))
+	}
+	if batches[0].StartIndex != 0 || batches[1].StartIndex != 3 {
+		t.Errorf("batches start at indices %d and %d, want 0 and 3", batches[0].StartIndex, batches[1].StartIndex)
+	}
+
+	if err := prepareWorkerDBs(batches, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range batches {
+		if err := h.processAdaptiveBatch(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, _ := os.ReadDir(DB_DIR)
+	if len(files) != 2 {
+		t.Errorf("%d worker DBs created, want 2", len(files))
+	}
+	if _, err := h.consolidateAllBatches(batches, FINAL_DB, false); err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range readEntries(t, FINAL_DB) {
+		if e.Index != uint64(i) {
+			t.Errorf("entry %d has index %d; skipping windows broke continuity", i, e.Index)
+		}
+	}
+
+	keep := testConfig(0, 99, 10)
+	keep.KeepEmpty = true
+	all, err := NewHyperscaleIndexer(chain, keep, nil).generateAdaptiveBatches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 10 {
+		t.Errorf("KeepEmpty planned %d batches, want all 10", len(all))
+	}
+}
+
+func TestShardedOutputRoutesAcrossShards(t *testing.T) {
+	t.Chdir(t.TempDir())
+	chain := newFakeChain(200)
+	for _, b := range []uint64{3, 4, 12, 12, 15, 27} {
+		chain.addLog(b, common.HexToHash("0x01"))
+	}
+
+	h := NewHyperscaleIndexer(chain, testConfig(0, 29, 10), nil)
+	batches, err := h.generateAdaptiveBatches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := prepareWorkerDBs(batches, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range batches {
+		if err := h.processAdaptiveBatch(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := h.writeShards(batches, "shards"); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := storage.LoadShardManifest("shards")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]uint64{{0, 1}, {2, 4}, {5, 5}}
+	if len(manifest.Shards) != len(want) {
+		t.Fatalf("manifest lists %d shards, want %d", len(manifest.Shards), len(want))
+	}
+	for i, s := range manifest.Shards {
+		if s.StartIndex != want[i][0] || s.EndIndex != want[i][1] {
+			t.Errorf("shard %d covers %d-%d, want %d-%d", i, s.StartIndex, s.EndIndex, want[i][0], want[i][1])
+		}
+		if n := bucketLen(t, s.File, BUCKET_NAME); uint64(n) != s.LogCount {
+			t.Errorf("shard %s holds %d entries, manifest says %d", s.File, n, s.LogCount)
+		}
+	}
+	if manifest.TotalCount() != 6 {
+		t.Errorf("manifest counts %d entries, want 6", manifest.TotalCount())
+	}
+
+	if s, ok := manifest.Find(2); !ok || s.StartIndex != 2 {
+		t.Errorf("index 2 routed to %+v (%v), want the second shard", s, ok)
+	}
+	if _, ok := manifest.Find(6); ok {
+		t.Error("index 6 past the backfill was routed to a shard")
+	}
+	if got := manifest.Overlapping(1, 2); len(got) != 2 || got[0].StartIndex != 0 || got[1].StartIndex != 2 {
+		t.Errorf("range 1-2 opened %+v, want the first two shards", got)
+	}
+	if got := manifest.Overlapping(4, 0); len(got) != 2 || got[0].StartIndex != 2 {
+		t.Errorf("open range from 4 opened %+v, want the last two shards", got)
+	}
+	if files, _ := os.ReadDir(DB_DIR); len(files) != 0 {
+		t.Errorf("%d worker DBs left behind after sharding", len(files))
+	}
+}
+
+func TestProcessHooksAnnotateAndDrop(t *testing.T) {
+	t.Chdir(t.TempDir())
+	saved := processHooks
+	t.Cleanup(func() { processHooks = saved })
+	processHooks = nil
+
+	chain := newFakeChain(100)
+	for _, b := range []uint64{2, 3, 5, 8} {
+		chain.addLog(b, common.HexToHash("0x01"))
+	}
+	RegisterHook("parity", func(ctx context.Context, e *LogEntry) (*LogEntry, error) {
+		e.Annotations = map[string]string{"parity": fmt.Sprint(e.BlockNumber % 2)}
+		e.Index = 999 // hooks cannot renumber entries
+		return e, nil
+	})
+	RegisterHook("drop-5", func(ctx context.Context, e *LogEntry) (*LogEntry, error) {
+		if e.BlockNumber == 5 {
+			return nil, nil
+		}
+		return e, nil
+	})
+	runBulk(t, chain, testConfig(0, 9, 5))
+
+	var got []string
+	for _, e := range readEntries(t, FINAL_DB) {
+		got = append(got, fmt.Sprintf("%d@%d:%s", e.Index, e.BlockNumber, e.Annotations["parity"]))
+	}
+	if want := []string{"0@2:0", "1@3:1", "3@8:0"}; !slices.Equal(got, want) {
+		t.Errorf("stored %v, want %v", got, want)
+	}
+
+	// A failing hook is skipped or fails the entry, per -hook-errors
+	processHooks = nil
+	RegisterHook("broken", func(ctx context.Context, e *LogEntry) (*LogEntry, error) {
+		return nil, fmt.Errorf("metadata lookup timed out")
+	})
+	skip := &HyperscaleIndexer{config: IndexerConfig{HookErrors: "skip"}}
+	if out, err := skip.runHooks(context.Background(), &LogEntry{Index: 4}); err != nil || out == nil || out.Index != 4 {
+		t.Errorf("skip mode returned %+v, %v; want the entry unchanged", out, err)
+	}
+	fail := &HyperscaleIndexer{config: IndexerConfig{HookErrors: "fail"}}
+	if _, err := fail.runHooks(context.Background(), &LogEntry{Index: 4}); err == nil {
+		t.Error("fail mode ignored the hook error")
+	}
+}
+
+func TestFailingLogIsDeadLetteredAndReprocessed(t *testing.T) {
+	t.Chdir(t.TempDir())
+	saved := processHooks
+	t.Cleanup(func() { processHooks = saved })
+	processHooks = nil
+
+	chain := newFakeChain(100)
+	for _, b := range []uint64{2, 3, 5, 8} {
+		chain.addLog(b, common.HexToHash("0x01"))
+	}
+	RegisterHook("lookup", func(ctx context.Context, e *LogEntry) (*LogEntry, error) {
+		if e.BlockNumber == 5 {
+			return nil, fmt.Errorf("token metadata unavailable")
+		}
+		return e, nil
+	})
+	config := testConfig(0, 9, 5)
+	config.HookErrors = "fail"
+	config.DeadLetter = true
+	runBulk(t, chain, config)
+
+	var stored []uint64
+	for _, e := range readEntries(t, FINAL_DB) {
+		stored = append(stored, e.Index)
+	}
+	if want := []uint64{0, 1, 3}; !slices.Equal(stored, want) {
+		t.Errorf("stored %v, want %v without the failing log", stored, want)
+	}
+
+	ctx := context.Background()
+	s, err := storage.NewBoltStorage(FINAL_DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	letters, err := s.GetDeadLetters(ctx, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 {
+		t.Fatalf("%d dead letters, want 1", len(letters))
+	}
+	if dl := letters[0]; dl.Entry.Index != 2 || dl.Entry.BlockNumber != 5 || dl.Stage != "hook" ||
+		!strings.Contains(dl.Error, "token metadata unavailable") || dl.Attempts != 1 || dl.Entry.RawLog == nil {
+		t.Errorf("dead letter %+v, want index 2 of block 5 failed at hook with its raw log", dl)
+	}
+
+	result, err := s.ReprocessDeadLetters(ctx, []uint64{2, 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Stored, []uint64{2}) || !slices.Equal(result.Missing, []uint64{7}) || len(result.Failed) != 0 {
+		t.Errorf("reprocess result %+v, want 2 stored and 7 missing", result)
+	}
+	if e, err := s.GetLog(ctx, 2); err != nil || e.BlockNumber != 5 {
+		t.Errorf("reprocessed log 2 = %+v, %v", e, err)
+	}
+	if letters, _ := s.GetDeadLetters(ctx, 0, 0); len(letters) != 0 {
+		t.Errorf("%d dead letters left after reprocessing", len(letters))
+	}
+}
+
+func TestReplayRedecodesRawArchive(t *testing.T) {
+	t.Chdir(t.TempDir())
+	saved := processHooks
+	t.Cleanup(func() { processHooks = saved })
+	processHooks = nil
+
+	chain := newFakeChain(100)
+	for _, b := range []uint64{2, 3, 5, 8} {
+		chain.addLog(b, common.HexToHash("0x01"))
+	}
+	RegisterHook("lookup", func(ctx context.Context, e *LogEntry) (*LogEntry, error) {
+		if e.BlockNumber == 5 {
+			return nil, fmt.Errorf("token metadata unavailable")
+		}
+		return e, nil
+	})
+	config := testConfig(0, 9, 5)
+	config.StoreRaw = true
+	config.HookErrors = "fail"
+	config.DeadLetter = true
+	runBulk(t, chain, config)
+	fetched := chain.count("FilterLogs")
+
+	// The lookup is fixed and a new hook added; the replay picks up the dead letter too
+	processHooks = nil
+	RegisterHook("parity", func(ctx context.Context, e *LogEntry) (*LogEntry, error) {
+		e.Annotations = map[string]string{"parity": fmt.Sprint(e.BlockNumber % 2)}
+		return e, nil
+	})
+	replayer := NewHyperscaleIndexer(nil, IndexerConfig{HookErrors: "fail", DeadLetter: true}, nil)
+	if err := replayer.replay(FINAL_DB, "replayed.db"); err != nil {
+		t.Fatal(err)
+	}
+	if n := chain.count("FilterLogs"); n != fetched {
+		t.Errorf("replay made %d eth_getLogs calls, want none", n-fetched)
+	}
+
+	var got []string
+	for _, e := range readEntries(t, "replayed.db") {
+		got = append(got, fmt.Sprintf("%d@%d:%s", e.Index, e.BlockNumber, e.Annotations["parity"]))
+		if e.Timestamp != chain.header(e.BlockNumber).Time || e.RawLog == nil {
+			t.Errorf("entry %d lost its archived timestamp or raw log: %+v", e.Index, e)
+		}
+	}
+	if want := []string{"0@2:0", "1@3:1", "2@5:1", "3@8:0"}; !slices.Equal(got, want) {
+		t.Errorf("replayed %v, want %v", got, want)
+	}
+
+	if err := replayer.replay(FINAL_DB, "replayed.db"); err == nil {
+		t.Error("replay overwrote an existing DB")
+	}
+
+	// Without -store-raw there is nothing to decode from
+	writeEntries(t, "plain.db", LogEntry{Index: 0, BlockNumber: 2})
+	if err := replayer.replay("plain.db", "plain_replayed.db"); err == nil || !strings.Contains(err.Error(), "-store-raw") {
+		t.Errorf("replay of a DB without raw logs: %v", err)
+	}
+}
+
+func TestFactoryEventStartsIndexingChild(t *testing.T) {
+	t.Chdir(t.TempDir())
+	savedContracts, savedDiscovered := contracts, discovered
+	t.Cleanup(func() { contracts, discovered = savedContracts, savedDiscovered })
+	contracts, discovered = indexer.NewContractSet(), nil
+
+	factory := common.HexToAddress("0x1F98431c8aD98523631AE4a59f267346ea31F984")
+	poolCreated := common.HexToHash("0x783cca1c0412dd0d695e784568c96da2e9c22ff989357a2e8b1d9b2b4e6b7118")
+	pool := common.HexToAddress("0x88e6A0c2dDD26FEEb64F039a2c41296FcB3f5640")
+	unrelated := common.HexToAddress("0x00000000000000000000000000000000000000dd")
+
+	chain := newFakeChain(100)
+	at := func(addr common.Address, block uint64, topic0 common.Hash, data []byte) {
+		chain.addEvent(block, common.BigToHash(new(big.Int).SetUint64(block)), topic0)
+		chain.logs[len(chain.logs)-1].Address = addr
+		if data != nil {
+			chain.logs[len(chain.logs)-1].Data = data
+		}
+	}
+	// PoolCreated carries tickSpacing in data word 0 and the pool in word 1
+	at(factory, 4, poolCreated, append(common.BigToHash(big.NewInt(60)).Bytes(), common.BytesToHash(pool.Bytes()).Bytes()...))
+	at(pool, 6, common.HexToHash(EVENT_TOPIC), nil)
+	at(unrelated, 7, common.HexToHash(EVENT_TOPIC), nil)
+	at(pool, 9, common.HexToHash(EVENT_TOPIC), nil)
+
+	watch := &indexer.FactoryWatch{Factory: factory, Topic: poolCreated, Child: indexer.ChildArg{Index: 1}}
+	found, err := discoverContracts(context.Background(), chain, watch, 0, 19, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || common.HexToAddress(found[0].Address) != pool || found[0].BlockNumber != 4 {
+		t.Fatalf("discovered %+v, want the pool created in block 4", found)
+	}
+	discovered = found
+	contracts.Add(pool)
+	runBulk(t, chain, testConfig(0, 19, 10))
+
+	var got []string
+	for _, e := range readEntries(t, FINAL_DB) {
+		got = append(got, fmt.Sprintf("%d@%s", e.BlockNumber, e.Address))
+	}
+	if want := []string{"6@" + pool.Hex(), "9@" + pool.Hex()}; !slices.Equal(got, want) {
+		t.Errorf("indexed %v, want the pool's logs only: %v", got, want)
+	}
+
+	// The next run finds the pool in the final DB without rescanning the factory
+	stored, err := loadDiscoveredContracts(FINAL_DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || common.HexToAddress(stored[0].Address) != pool || stored[0].Factory != factory.Hex() {
+		t.Errorf("final DB records %+v, want the pool from the factory", stored)
+	}
+}
+
+func TestOpenRetriesTransientLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "final.db")
+	holder, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &bolt.Options{Timeout: 50 * time.Millisecond}
+
+	failFast := NewHyperscaleIndexer(nil, IndexerConfig{NumWorkers: 1}, nil)
+	if _, err := failFast.openDBWithRetry(path, opts); err != bolt.ErrTimeout {
+		t.Errorf("open without -open-retry = %v, want bolt's timeout at once", err)
+	}
+
+	// Another process holds the lock for a moment, then lets go
+	released := time.AfterFunc(400*time.Millisecond, func() { holder.Close() })
+	defer released.Stop()
+	h := NewHyperscaleIndexer(nil, IndexerConfig{NumWorkers: 1, OpenRetry: 10 * time.Second}, nil)
+	start := time.Now()
+	db, err := h.openDBWithRetry(path, opts)
+	if err != nil {
+		t.Fatalf("open with retry: %v", err)
+	}
+	db.Close()
+	if took := time.Since(start); took < 400*time.Millisecond {
+		t.Errorf("opened after %v, before the lock was released", took)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing", "final.db")
+	start = time.Now()
+	if _, err := h.openDBWithRetry(missing, opts); err == nil || time.Since(start) > time.Second {
+		t.Errorf("open of an uncreatable path = %v after %v, want a prompt error", err, time.Since(start))
+	}
+}
+
+// kafkaProxy is a Kafka REST Proxy recording the keys of produced records; while down is
+// set it answers 503
+type kafkaProxy struct {
+	mu   sync.Mutex
+	keys []string
+	down atomic.Bool
+}
+
+func (p *kafkaProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.down.Load() {
+		http.Error(w, "broker unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	var req struct {
+		Records []struct {
+			Key string `json:"key"`
+		} `json:"records"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	offsets := make([]map[string]int, len(req.Records))
+	for i, rec := range req.Records {
+		p.keys = append(p.keys, rec.Key)
+		offsets[i] = map[string]int{"partition": 0, "offset": len(p.keys)}
+	}
+	p.mu.Unlock()
+	json.NewEncoder(w).Encode(map[string]interface{}{"offsets": offsets})
+}
+
+func TestConsolidationPublishesToKafka(t *testing.T) {
+	proxy := &kafkaProxy{}
+	srv := httptest.NewServer(proxy)
+	defer srv.Close()
+
+	consolidate := func() ([]BatchInfo, error) {
+		t.Helper()
+		t.Chdir(t.TempDir())
+		chain := newFakeChain(100)
+		for _, b := range []uint64{1, 12, 12, 23} {
+			chain.addLog(b, common.HexToHash(fmt.Sprintf("0x%x", b)))
+		}
+		h := NewHyperscaleIndexer(chain, testConfig(0, 29, 10), nil)
+		sink, err := indexer.NewKafkaSink(srv.URL, "eth-logs", indexer.KafkaKeyIndex, 2, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.kafka = sink
+		batches, err := h.generateAdaptiveBatches()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := prepareWorkerDBs(batches, 0); err != nil {
+			t.Fatal(err)
+		}
+		for _, b := range batches {
+			if err := h.processAdaptiveBatch(b); err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err = h.consolidateAllBatches(batches, FINAL_DB, false)
+		return batches, err
+	}
+
+	if _, err := consolidate(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"0", "1", "2", "3"}; !slices.Equal(proxy.keys, want) {
+		t.Errorf("published keys %v, want every merged index once in order %v", proxy.keys, want)
+	}
+
+	// An unacknowledged batch stops consolidation before its worker DB is removed
+	proxy.down.Store(true)
+	batches, err := consolidate()
+	if err == nil || !strings.Contains(err.Error(), "Kafka") {
+		t.Fatalf("consolidation with the proxy down returned %v, want a Kafka error", err)
+	}
+	if _, err := os.Stat(batches[0].DbPath); err != nil {
+		t.Errorf("worker DB of the unpublished batch: %v", err)
+	}
+	if _, err := os.Stat(batches[1].DbPath); err != nil {
+		t.Errorf("worker DB of a batch not yet merged: %v", err)
+	}
+}
+
+func TestMergeDelayBetweenBatches(t *testing.T) {
+	t.Chdir(t.TempDir())
+	chain := newFakeChain(100)
+	for _, b := range []uint64{1, 12, 23} {
+		chain.addLog(b, common.HexToHash("0x01"))
+	}
+	config := testConfig(0, 29, 10)
+	config.MergeDelay = 80 * time.Millisecond
+
+	h := NewHyperscaleIndexer(chain, config, nil)
+	batches, err := h.generateAdaptiveBatches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := prepareWorkerDBs(batches, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range batches {
+		if err := h.processAdaptiveBatch(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now()
+	if _, err := h.consolidateAllBatches(batches, FINAL_DB, false); err != nil {
+		t.Fatal(err)
+	}
+	// Three merges have two gaps between them
+	if took := time.Since(start); took < 2*config.MergeDelay {
+		t.Errorf("consolidating 3 batches took %v, want at least two %v pauses", took, config.MergeDelay)
+	}
+
+	for _, tc := range []struct {
+		n, rate int64
+		took    time.Duration
+		want    time.Duration
+	}{
+		{10 << 20, 0, 0, 0},
+		{10 << 20, 5 << 20, 500 * time.Millisecond, 1500 * time.Millisecond},
+		{10 << 20, 5 << 20, 3 * time.Second, 0},
+	} {
+		if got := mergeRatePause(tc.n, tc.rate, tc.took); got != tc.want {
+			t.Errorf("mergeRatePause(%d, %d, %v) = %v, want %v", tc.n, tc.rate, tc.took, got, tc.want)
+		}
+	}
+}
+
+// spillingChain is a provider whose cached eth_getLogs results run two blocks past
+// the requested range
+type spillingChain struct {
+	*fakeChain
+}
+
+func (c spillingChain) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	wider := q
+	wider.ToBlock = new(big.Int).SetUint64(q.ToBlock.Uint64() + 2)
+	return c.fakeChain.FilterLogs(ctx, wider)
+}
+
+// topicBlindChain is a provider that ignores the topic conditions of eth_getLogs
+type topicBlindChain struct {
+	*fakeChain
+}
+
+func (c topicBlindChain) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	q.Topics = nil
+	return c.fakeChain.FilterLogs(ctx, q)
+}
+
+func TestUnconfiguredTopic0Excluded(t *testing.T) {
+	transfer := common.HexToHash(EVENT_TOPIC)
+	approval := common.HexToHash("0x8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925")
+	foreign := common.HexToHash("0x1c411e9a96e071241c2f21f7726b17ae89e3cab4c78be50e062b03a9fffbbad1")
+	saved := eventTopics
+	t.Cleanup(func() { eventTopics = saved })
+	eventTopics = []common.Hash{transfer, approval}
+
+	chain := newFakeChain(100)
+	chain.addEvent(2, common.HexToHash("0x01"), transfer)
+	chain.addEvent(3, common.HexToHash("0x02"), foreign)
+	chain.addEvent(4, common.HexToHash("0x03"), approval)
+
+	run := func(validate bool) []string {
+		t.Helper()
+		t.Chdir(t.TempDir())
+		config := testConfig(0, 9, 10)
+		config.ValidateTopic0 = validate
+		h := NewHyperscaleIndexer(topicBlindChain{chain}, config, nil)
+		batches, err := h.generateAdaptiveBatches()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := prepareWorkerDBs(batches, 0); err != nil {
+			t.Fatal(err)
+		}
+		for _, b := range batches {
+			if err := h.processAdaptiveBatch(b); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := h.consolidateAllBatches(batches, FINAL_DB, false); err != nil {
+			t.Fatal(err)
+		}
+		var topics []string
+		for _, e := range readEntries(t, FINAL_DB) {
+			topics = append(topics, fmt.Sprintf("%d:%s", e.Index, e.EventTopic))
+		}
+		return topics
+	}
+
+	if got := run(false); len(got) != 3 {
+		t.Fatalf("without validation stored %v, want the foreign log too", got)
+	}
+	want := []string{"0:" + transfer.Hex(), "1:" + approval.Hex()}
+	if got := run(true); !slices.Equal(got, want) {
+		t.Errorf("with -validate-topic0 stored %v, want %v", got, want)
+	}
+}
+
+func TestSeveralTopicsOrNoneInOneRun(t *testing.T) {
+	transfer := common.HexToHash(EVENT_TOPIC)
+	approval := common.HexToHash("0x8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925")
+	other := common.HexToHash("0x1c411e9a96e071241c2f21f7726b17ae89e3cab4c78be50e062b03a9fffbbad1")
+	saved := eventTopics
+	t.Cleanup(func() { eventTopics = saved })
+
+	chain := newFakeChain(100)
+	chain.addEvent(2, common.HexToHash("0x01"), transfer)
+	chain.addEvent(3, common.HexToHash("0x02"), other)
+	chain.addEvent(4, common.HexToHash("0x03"), approval)
+
+	for _, tc := range []struct {
+		flag string
+		want []common.Hash
+	}{
+		{transfer.Hex() + "," + approval.Hex(), []common.Hash{transfer, approval}},
+		{"", []common.Hash{transfer, other, approval}}, // -topics= indexes every event
+	} {
+		t.Chdir(t.TempDir())
+		topics, err := parseTopics(tc.flag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		eventTopics = topics
+		runBulk(t, chain, testConfig(0, 9, 10))
+
+		var got []common.Hash
+		for i, e := range readEntries(t, FINAL_DB) {
+			if e.Index != uint64(i) {
+				t.Errorf("-topics=%s: entry %d has index %d", tc.flag, i, e.Index)
+			}
+			got = append(got, common.HexToHash(e.EventTopic))
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("-topics=%s stored topics %v, want %v", tc.flag, got, tc.want)
+		}
+	}
+}
+
+func TestStrayLogsExcludedFromBatch(t *testing.T) {
+	t.Chdir(t.TempDir())
+	chain := newFakeChain(200)
+	blocks := []uint64{3, 9, 10, 11, 18}
+	for _, b := range blocks {
+		chain.addLog(b, common.HexToHash("0x01"))
+	}
+
+	h := NewHyperscaleIndexer(spillingChain{chain}, testConfig(0, 19, 10), nil)
+	batches, err := h.generateAdaptiveBatches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 2 || batches[1].StartIndex != 2 {
+		t.Fatalf("planned %+v, want 2 batches with the second starting at index 2", batches)
+	}
+	if err := prepareWorkerDBs(batches, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range batches {
+		if err := h.processAdaptiveBatch(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := h.consolidateAllBatches(batches, FINAL_DB, false); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := readEntries(t, FINAL_DB)
+	if len(entries) != len(blocks) {
+		t.Fatalf("%d entries stored, want %d", len(entries), len(blocks))
+	}
+	for i, e := range entries {
+		if e.Index != uint64(i) || e.BlockNumber != blocks[i] {
+			t.Errorf("entry %d = index %d block %d, want index %d block %d", i, e.Index, e.BlockNumber, i, blocks[i])
+		}
+	}
+	if atomic.LoadInt64(&h.strayLogs) == 0 {
+		t.Error("stray logs were dropped without being counted")
+	}
+}
+
+func TestVerifyOnlyKeepsWorkerDBs(t *testing.T) {
+	t.Chdir(t.TempDir())
+	chain := newFakeChain(200)
+	for _, b := range []uint64{2, 5, 14, 17} {
+		chain.addLog(b, common.HexToHash("0x01"))
+	}
+	h := NewHyperscaleIndexer(chain, testConfig(0, 19, 10), nil)
+	batches, err := h.generateAdaptiveBatches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := prepareWorkerDBs(batches, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range batches {
+		if err := h.processAdaptiveBatch(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	workersLeft := func() {
+		t.Helper()
+		for _, b := range batches {
+			if _, err := os.Stat(b.DbPath); err != nil {
+				t.Errorf("worker DB of batch %d gone after verify-only: %v", b.BatchID, err)
+			}
+		}
+	}
+
+	report, err := h.consolidateAllBatches(batches, "verify.db", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.MergedLogs != 4 {
+		t.Errorf("clean run report = %+v, want OK with 4 merged", report)
+	}
+	workersLeft()
+	if _, err := os.Stat(FINAL_DB); !os.IsNotExist(err) {
+		t.Errorf("verify-only touched %s: %v", FINAL_DB, err)
+	}
+
+	// A second batch claiming index 0 is what a StartIndex bug looks like
+	writeEntries(t, batches[1].DbPath, LogEntry{Index: 0, BlockNumber: 15})
+	report, err = h.consolidateAllBatches(batches, "verify2.db", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() || report.Collisions != 1 || !slices.Equal(report.CountMismatch, []int{1}) {
+		t.Errorf("tampered run report = %+v, want 1 collision and a count mismatch in batch 1", report)
+	}
+	workersLeft()
+}
+
+func TestContractCodeCheckModes(t *testing.T) {
+	chain := newFakeChain(10_000)
+	chain.hasCode = func(block uint64) bool { return block >= 4_321 }
+	ctx := context.Background()
+
+	strict := testConfig(1_000, 9_000, 100)
+	if err := checkContractCode(ctx, chain, &strict, "strict"); err == nil {
+		t.Error("strict passed with no code at the start block")
+	}
+	if strict.StartBlock != 1_000 {
+		t.Errorf("strict moved the start block to %d", strict.StartBlock)
+	}
+
+	lenient := testConfig(1_000, 9_000, 100)
+	if err := checkContractCode(ctx, chain, &lenient, "lenient"); err != nil {
+		t.Fatal(err)
+	}
+	if lenient.StartBlock != 4_321 {
+		t.Errorf("lenient advanced to %d, want the deployment block 4321", lenient.StartBlock)
+	}
+	// A binary search, not a walk over every block
+	if n := chain.count("CodeAt"); n > 20 {
+		t.Errorf("%d eth_getCode calls to find the deployment", n)
+	}
+
+	deployed := testConfig(5_000, 9_000, 100)
+	for _, mode := range []string{"strict", "lenient"} {
+		if err := checkContractCode(ctx, chain, &deployed, mode); err != nil || deployed.StartBlock != 5_000 {
+			t.Errorf("%s with code at the start block: %v, start %d", mode, err, deployed.StartBlock)
+		}
+	}
+
+	undeployed := testConfig(1_000, 2_000, 100)
+	if err := checkContractCode(ctx, chain, &undeployed, "lenient"); err == nil {
+		t.Error("lenient passed with no code anywhere in the range")
+	}
+	if err := checkContractCode(ctx, chain, &undeployed, "loose"); err == nil {
+		t.Error(`mode "loose" was accepted`)
+	}
+}
+
+func TestSelfDestructEndsRange(t *testing.T) {
+	t.Chdir(t.TempDir())
+	chain := newFakeChain(200)
+	chain.hasCode = func(block uint64) bool { return block < 63 }
+	for _, b := range []uint64{10, 41, 63} {
+		chain.addLog(b, common.HexToHash("0x01"))
+	}
+	ctx := context.Background()
+
+	warn := testConfig(0, 99, 10)
+	if event, err := checkCodeEnd(ctx, chain, &warn, "warn"); err != nil || event == nil || event.Block != 63 || event.Stopped {
+		t.Errorf("warn found %+v (%v), want block 63 without stopping", event, err)
+	}
+	if warn.EndBlock != 99 {
+		t.Errorf("warn moved the end block to %d", warn.EndBlock)
+	}
+	before := chain.count("CodeAt")
+	off := testConfig(0, 99, 10)
+	if event, err := checkCodeEnd(ctx, chain, &off, "off"); err != nil || event != nil || chain.count("CodeAt") != before {
+		t.Errorf("off returned %+v (%v) after %d eth_getCode calls", event, err, chain.count("CodeAt")-before)
+	}
+
+	config := testConfig(0, 99, 10)
+	event, err := checkCodeEnd(ctx, chain, &config, "stop")
+	if err != nil || event == nil || config.EndBlock != 63 {
+		t.Fatalf("stop found %+v (%v) and ended at %d, want 63", event, err, config.EndBlock)
+	}
+
+	// Windows past the self-destruct block are never queried, and the destroying
+	// transaction's log is still indexed
+	var highest uint64
+	chain.failFilter = func(from, to uint64) error {
+		highest = max(highest, to)
+		return nil
+	}
+	h := NewHyperscaleIndexer(chain, config, nil)
+	h.selfDestruct = event
+	batches, err := h.generateAdaptiveBatches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := prepareWorkerDBs(batches, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range batches {
+		if err := h.processAdaptiveBatch(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := h.consolidateAllBatches(batches, FINAL_DB, false); err != nil {
+		t.Fatal(err)
+	}
+	if highest > 63 {
+		t.Errorf("eth_getLogs reached block %d past the self-destruct", highest)
+	}
+	if n := len(readEntries(t, FINAL_DB)); n != 3 {
+		t.Errorf("%d entries indexed, want 3 including block 63", n)
+	}
+
+	db, err := bolt.Open(FINAL_DB, 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var stored SelfDestruct
+	db.View(func(tx *bolt.Tx) error {
+		return json.Unmarshal(tx.Bucket([]byte("metadata")).Get([]byte(SELF_DESTRUCT_KEY)), &stored)
+	})
+	if stored != (SelfDestruct{Block: 63, RequestedEnd: 99, Stopped: true}) {
+		t.Errorf("metadata records %+v", stored)
+	}
+}
+
+func TestParallelPlanMatchesSequential(t *testing.T) {
+	chain := newFakeChain(1_000)
+	for b := uint64(0); b < 400; b += 1 + b%7 {
+		for range b % 3 {
+			chain.addLog(b, common.HexToHash("0x01"))
+		}
+	}
+	// Uneven latencies finish the parallel queries out of order
+	var mu sync.Mutex
+	var inFlight, peak int
+	chain.failFilter = func(from, to uint64) error {
+		mu.Lock()
+		inFlight++
+		peak = max(peak, inFlight)
+		mu.Unlock()
+		time.Sleep(time.Duration(1+(from/10*7)%5) * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return nil
+	}
+
+	plan := func(workers, rate int) []BatchInfo {
+		t.Helper()
+		t.Chdir(t.TempDir()) // no plan cache shared between runs
+		config := testConfig(0, 399, 10)
+		config.PlanWorkers, config.PlanRate = workers, rate
+		batches, err := NewHyperscaleIndexer(chain, config, nil).generateAdaptiveBatches()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return batches
+	}
+
+	sequential := plan(1, 0)
+	if peak != 1 {
+		t.Fatalf("one plan worker ran %d queries at once", peak)
+	}
+	peak = 0
+	parallel := plan(8, 0)
+	if peak < 2 {
+		t.Errorf("eight plan workers never overlapped (peak %d)", peak)
+	}
+	if !slices.Equal(parallel, sequential) {
+		t.Errorf("parallel plan differs from the sequential one:\n%+v\n%+v", parallel, sequential)
+	}
+
+	start := time.Now()
+	plan(8, 200)
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("40 queries at 200/s took %v", elapsed)
+	}
+}
+
+// logsService serves eth_getLogs over JSON-RPC from a fakeChain, refusing windows
+// that contain a block in tooMany the way a provider caps results
+type logsService struct {
+	chain   *fakeChain
+	tooMany []uint64
+}
+
+type logsCriteria struct {
+	Address   []common.Address `json:"address"`
+	Topics    [][]common.Hash  `json:"topics"`
+	FromBlock hexutil.Uint64   `json:"fromBlock"`
+	ToBlock   hexutil.Uint64   `json:"toBlock"`
+}
+
+func (s *logsService) GetLogs(ctx context.Context, crit logsCriteria) ([]types.Log, error) {
+	for _, b := range s.tooMany {
+		if uint64(crit.FromBlock) <= b && b <= uint64(crit.ToBlock) {
+			return nil, fmt.Errorf("query returned more than 10000 results")
+		}
+	}
+	// Read the logs directly so only the indexer's own client calls are counted
+	q := ethereum.FilterQuery{Addresses: crit.Address, Topics: crit.Topics}
+	s.chain.mu.Lock()
+	defer s.chain.mu.Unlock()
+	out := []types.Log{}
+	for _, l := range s.chain.logs {
+		if uint64(crit.FromBlock) <= l.BlockNumber && l.BlockNumber <= uint64(crit.ToBlock) && queryMatches(q, l) {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+func TestBatchedPlanMatchesPerWindow(t *testing.T) {
+	chain := newFakeChain(1_000)
+	for b := uint64(0); b < 400; b += 1 + b%5 {
+		for range 1 + b%3 {
+			chain.addLog(b, common.HexToHash("0x01"))
+		}
+	}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &logsService{chain: chain, tooMany: []uint64{123}}); err != nil {
+		t.Fatal(err)
+	}
+	var requests atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		server.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	batcher, err := rpc.Dial(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(batcher.Close)
+
+	plan := func(strategy string) ([]BatchInfo, int) {
+		t.Helper()
+		t.Chdir(t.TempDir()) // no plan cache shared between runs
+		config := testConfig(0, 399, 10)
+		config.PlanStrategy, config.PlanBatchSize = strategy, 16
+		h := NewHyperscaleIndexer(chain, config, nil)
+		h.batcher = batcher
+		before := chain.count("FilterLogs")
+		batches, err := h.generateAdaptiveBatches()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return batches, chain.count("FilterLogs") - before
+	}
+
+	perWindow, _ := plan("window")
+	if requests.Load() != 0 {
+		t.Fatalf("window strategy sent %d JSON-RPC batches", requests.Load())
+	}
+	batched, direct := plan("batch")
+	// 40 windows in batches of 16; only the capped window goes through the client
+	if n := requests.Load(); n != 3 {
+		t.Errorf("batch strategy sent %d HTTP requests for 40 windows, want 3", n)
+	}
+	if direct != 1 {
+		t.Errorf("%d windows fell back to per-window eth_getLogs, want the capped one", direct)
+	}
+	if !slices.Equal(batched, perWindow) {
+		t.Errorf("batched plan differs from the per-window one:\n%+v\n%+v", batched, perWindow)
+	}
+}
+
+func TestStoreRawKeepsCompleteLog(t *testing.T) {
+	t.Chdir(t.TempDir())
+	chain := newFakeChain(100)
+	chain.addLog(4, common.HexToHash("0xaa"))
+	chain.addLog(4, common.HexToHash("0xbb"))
+	// Every field the decoded entry does not carry on its own
+	chain.logs[1].Topics = append(chain.logs[1].Topics,
+		common.HexToHash("0x01"), common.HexToHash("0x02"), common.HexToHash("0x03"))
+	chain.logs[1].Data = []byte("arbitrary payload, longer than a word ............")
+	chain.logs[1].TxIndex = 7
+
+	config := testConfig(0, 9, 10)
+	config.StoreRaw = true
+	runBulk(t, chain, config)
+
+	entries := readEntries(t, FINAL_DB)
+	if len(entries) != 2 {
+		t.Fatalf("%d entries, want 2", len(entries))
+	}
+	for i, e := range entries {
+		if e.RawLog == nil {
+			t.Fatalf("entry %d has no raw log with StoreRaw", i)
+		}
+		got, err := decodeRawLog(e.RawLog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, chain.logs[i]) {
+			t.Errorf("entry %d raw log round-tripped to\n%+v\nwant\n%+v", i, got, chain.logs[i])
+		}
+	}
+
+	os.Remove(FINAL_DB)
+	runBulk(t, chain, testConfig(0, 9, 10))
+	if e := readEntries(t, FINAL_DB)[0]; e.RawLog != nil {
+		t.Errorf("raw log stored without StoreRaw: %+v", e.RawLog)
+	}
+}
+
+func TestIndexNamespacesDoNotOverlap(t *testing.T) {
+	chain := newFakeChain(100)
+	for _, b := range []uint64{1, 1, 4, 8} {
+		chain.addLog(b, common.HexToHash("0x01"))
+	}
+
+	// Two independent indexers over the same range, each in its own directory
+	run := func(namespace int) []LogEntry {
+		t.Helper()
+		t.Chdir(t.TempDir())
+		base, err := indexBase(0, namespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config := testConfig(0, 9, 5)
+		config.StartIndex = base
+		runBulk(t, chain, config)
+		return readEntries(t, FINAL_DB)
+	}
+	first, second := run(0), run(1)
+
+	merged := filepath.Join(t.TempDir(), "merged.db")
+	writeEntries(t, merged, append(first, second...)...)
+	if n := bucketLen(t, merged, BUCKET_NAME); n != 8 {
+		t.Errorf("merged DB holds %d entries, want all 8", n)
+	}
+	for i, e := range second {
+		if want := uint64(1)<<56 + uint64(i); e.Index != want {
+			t.Errorf("namespace 1 entry %d has index %#x, want %#x", i, e.Index, want)
+		}
+	}
+
+	if base, err := indexBase(5_000_000, -1); err != nil || base != 5_000_000 {
+		t.Errorf("explicit base = %d (%v), want 5000000", base, err)
+	}
+	if _, err := indexBase(5, 1); err == nil {
+		t.Error("a base and a namespace together were accepted")
+	}
+	if _, err := indexBase(0, 256); err == nil {
+		t.Error("namespace 256 was accepted")
+	}
+}
+
+func TestResolveDateRange(t *testing.T) {
+	t.Chdir(t.TempDir())
+	// fakeChain blocks are 12s apart from 2023-11-14 22:13:20 UTC (block 0)
+	chain := newFakeChain(100_000)
+	ctx := context.Background()
+
+	config := testConfig(0, 0, 10)
+	if err := resolveDateRange(ctx, chain, &config, "2023-11-15", "2023-11-15", 0); err != nil {
+		t.Fatal(err)
+	}
+	// Midnight on the 15th falls 6400s after block 0, inside block 534's 12s slot;
+	// midnight on the 16th is 92800s in, so block 7733 is the last of the day
+	if config.StartBlock != 534 || config.EndBlock != 7733 {
+		t.Errorf("2023-11-15 resolved to blocks %d-%d, want 534-7733", config.StartBlock, config.EndBlock)
+	}
+	if before := chain.header(533).Time; before >= 1_700_006_400 {
+		t.Errorf("block 533 at %d is not before midnight", before)
+	}
+	if n := chain.count("HeaderByNumber"); n > 60 {
+		t.Errorf("%d header fetches, want a binary search", n)
+	}
+
+	// Resolved boundaries come from the cache on the next run
+	before := chain.count("HeaderByNumber")
+	again := testConfig(0, 0, 10)
+	if err := resolveDateRange(ctx, chain, &again, "2023-11-15", "2023-11-15", 0); err != nil {
+		t.Fatal(err)
+	}
+	if again != config {
+		t.Errorf("cached run resolved %d-%d, want %d-%d", again.StartBlock, again.EndBlock, config.StartBlock, config.EndBlock)
+	}
+	if n := chain.count("HeaderByNumber") - before; n != 1 {
+		t.Errorf("cached run fetched %d headers, want only genesis", n)
+	}
+
+	if err := resolveDateRange(ctx, chain, &again, "2030-01-01", "", 0); err == nil {
+		t.Error("a start date after the head was accepted")
+	}
+	if err := resolveDateRange(ctx, chain, &again, "", "2023-01-01", 0); err == nil {
+		t.Error("an end date before genesis was accepted")
+	}
+}
+
+// skewedChain is a fakeChain whose block timestamps are shifted by skew seconds for
+// the listed blocks, as on a chain whose timestamps step back around reorgs
+type skewedChain struct {
+	*fakeChain
+	skew map[uint64]int64
+}
+
+func (c *skewedChain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	header, err := c.fakeChain.HeaderByNumber(ctx, number)
+	if err == nil && number != nil {
+		header.Time = uint64(int64(header.Time) + c.skew[number.Uint64()])
+	}
+	return header, err
+}
+
+func TestDateToleranceCoversOutOfOrderTimestamps(t *testing.T) {
+	t.Chdir(t.TempDir())
+	// Midnight on the 15th is 1_700_006_400 and on the 16th 1_700_092_800; see
+	// TestResolveDateRange. Block 531 is stamped after the first midnight and 536
+	// before it; block 7737 is stamped before the second midnight.
+	base := newFakeChain(100_000)
+	stamp := func(n uint64, at int64) int64 { return at - int64(base.header(n).Time) }
+	chain := &skewedChain{fakeChain: base, skew: map[uint64]int64{
+		531:  stamp(531, 1_700_006_401),
+		536:  stamp(536, 1_700_006_370),
+		7737: stamp(7737, 1_700_092_793),
+	}}
+	ctx := context.Background()
+
+	strict := testConfig(0, 0, 10)
+	if err := resolveDateRange(ctx, chain, &strict, "2023-11-15", "2023-11-15", 0); err != nil {
+		t.Fatal(err)
+	}
+	if strict.StartBlock == 531 || strict.EndBlock == 7737 {
+		t.Fatalf("binary search alone resolved %d-%d; the skew does not exercise the tolerance", strict.StartBlock, strict.EndBlock)
+	}
+
+	tolerant := testConfig(0, 0, 10)
+	if err := resolveDateRange(ctx, chain, &tolerant, "2023-11-15", "2023-11-15", 10); err != nil {
+		t.Fatal(err)
+	}
+	if tolerant.StartBlock != 531 || tolerant.EndBlock != 7737 {
+		t.Errorf("with -date-tolerance 10, 2023-11-15 resolved to %d-%d, want 531-7737", tolerant.StartBlock, tolerant.EndBlock)
+	}
+}
@@ -0,0 +1,44 @@
+package types
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+)
+
+// BigInt carries wei amounts, which overflow uint64. It encodes as a JSON decimal
+// string because most JSON clients parse numbers as float64 and would lose precision.
+// Bare JSON numbers are still accepted when decoding.
+type BigInt struct {
+	big.Int
+}
+
+// NewBigInt copies x into a BigInt; nil stays nil
+func NewBigInt(x *big.Int) *BigInt {
+	if x == nil {
+		return nil
+	}
+	b := &BigInt{}
+	b.Set(x)
+	return b
+}
+
+// MarshalJSON encodes the value as a quoted decimal string
+func (b *BigInt) MarshalJSON() ([]byte, error) {
+	if b == nil {
+		return []byte("null"), nil
+	}
+	return []byte(`"` + b.String() + `"`), nil
+}
+
+// UnmarshalJSON accepts a quoted decimal string or a bare JSON number
+func (b *BigInt) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	s := string(bytes.Trim(data, `"`))
+	if _, ok := b.SetString(s, 10); !ok {
+		return fmt.Errorf("invalid big integer %s", data)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func TestBigIntRoundTripsPastUint64(t *testing.T) {
+	// 1000 × 2^64 + 7 wei, well past what uint64 or float64 can carry exactly
+	wei := new(big.Int).Lsh(big.NewInt(1000), 64)
+	wei.Add(wei, big.NewInt(7))
+
+	data, err := json.Marshal(BatchInfo{BatchID: 3, FeesWei: NewBigInt(wei)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte(`"feesWei":"` + wei.String() + `"`); !bytes.Contains(data, want) {
+		t.Errorf("encoded %s, want it to contain %s", data, want)
+	}
+	var batch BatchInfo
+	if err := json.Unmarshal(data, &batch); err != nil {
+		t.Fatal(err)
+	}
+	if batch.FeesWei == nil || batch.FeesWei.Cmp(wei) != 0 {
+		t.Errorf("decoded feesWei %v, want %s", batch.FeesWei, wei)
+	}
+
+	// Older writers and hand-written requests may send a bare number
+	var entry LogEntry
+	if err := json.Unmarshal([]byte(`{"gasPrice":`+wei.String()+`}`), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.GasPrice == nil || entry.GasPrice.Cmp(wei) != 0 {
+		t.Errorf("bare number decoded to %v, want %s", entry.GasPrice, wei)
+	}
+
+	if data, _ := json.Marshal(LogEntry{}); bytes.Contains(data, []byte("gasPrice")) {
+		t.Errorf("unset gasPrice was encoded: %s", data)
+	}
+	if err := json.Unmarshal([]byte(`{"gasPrice":"12gwei"}`), &entry); err == nil {
+		t.Error(`"12gwei" decoded without error`)
+	}
+}
@@ -0,0 +1,56 @@
+package types
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// CSVHeader is the column order used for CSV output by both the API and the logs CLI
+var CSVHeader = []string{
+	"index", "blockNumber", "blockHash", "parentHash", "l1InfoRoot", "timestamp",
+	"gasUsed", "gasPrice", "txHash", "logIndex", "eventName",
+	"topic0", "topic1", "topic2", "topic3",
+}
+
+// CSVRecord formats the entry as one row matching CSVHeader. Numbers are written in
+// base 10 (gasPrice included, since it can exceed uint64), hashes exactly as stored,
+// and absent values as empty cells.
+func (e *LogEntry) CSVRecord() []string {
+	gasPrice := ""
+	if e.GasPrice != nil {
+		gasPrice = e.GasPrice.String()
+	}
+	var topics [4]string
+	copy(topics[:], e.Topics)
+
+	return []string{
+		strconv.FormatUint(e.Index, 10),
+		strconv.FormatUint(e.BlockNumber, 10),
+		e.BlockHash,
+		e.ParentHash,
+		e.L1InfoRoot,
+		strconv.FormatUint(e.Timestamp, 10),
+		strconv.FormatUint(e.GasUsed, 10),
+		gasPrice,
+		e.TxHash,
+		strconv.FormatUint(e.LogIndex, 10),
+		e.EventName,
+		topics[0], topics[1], topics[2], topics[3],
+	}
+}
+
+// WriteCSV writes a header row followed by one row per entry
+func WriteCSV(w io.Writer, entries []*LogEntry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(CSVHeader); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := cw.Write(e.CSVRecord()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,156 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// KeyStyle selects how LogEntry JSON keys are rendered on the wire
+type KeyStyle string
+
+const (
+	KeyStyleDefault KeyStyle = ""      // camelCase keys from the struct tags
+	KeyStyleShort   KeyStyle = "short" // compact keys from ShortKeys
+	KeyStyleSnake   KeyStyle = "snake" // every key in snake_case, e.g. block_number
+)
+
+// ShortKeys maps verbose LogEntry keys to their compact form. Keys not listed are
+// left untouched, so envelope fields such as status and data keep their names.
+//
+//	index       -> i      timestamp -> ts     topics    -> t
+//	blockNumber -> bn     gasUsed   -> gas    eventName -> ev
+//	blockHash   -> bh     txHash    -> tx     enriched  -> en
+//	parentHash  -> ph     logIndex  -> li     createdAt -> ca
+//	l1InfoRoot  -> root   gasPrice  -> gp     rawLog    -> raw
+var ShortKeys = map[string]string{
+	"index":       "i",
+	"blockNumber": "bn",
+	"blockHash":   "bh",
+	"parentHash":  "ph",
+	"l1InfoRoot":  "root",
+	"timestamp":   "ts",
+	"gasUsed":     "gas",
+	"gasPrice":    "gp",
+	"txHash":      "tx",
+	"logIndex":    "li",
+	"topics":      "t",
+	"eventName":   "ev",
+	"enriched":    "en",
+	"createdAt":   "ca",
+	"rawLog":      "raw",
+}
+
+// ParseKeyStyle validates a key style name
+func ParseKeyStyle(s string) (KeyStyle, error) {
+	switch style := KeyStyle(s); style {
+	case KeyStyleDefault, KeyStyleShort, KeyStyleSnake:
+		return style, nil
+	default:
+		return "", fmt.Errorf("unknown key style %q", s)
+	}
+}
+
+// keyRenamers returns the verbose->styled key function for a style and its inverse,
+// or nil for the default style
+func keyRenamers(style KeyStyle) (apply, restore func(string) string) {
+	switch style {
+	case KeyStyleShort:
+		inverse := make(map[string]string, len(ShortKeys))
+		for verbose, short := range ShortKeys {
+			inverse[short] = verbose
+		}
+		return lookup(ShortKeys), lookup(inverse)
+	case KeyStyleSnake:
+		return toSnake, toCamel
+	default:
+		return nil, nil
+	}
+}
+
+// ApplyKeyStyle rewrites the object keys of a JSON document into the given style
+func ApplyKeyStyle(data []byte, style KeyStyle) ([]byte, error) {
+	apply, _ := keyRenamers(style)
+	if apply == nil {
+		return data, nil
+	}
+	return renameKeys(data, apply)
+}
+
+// RestoreKeyStyle rewrites styled keys back to the verbose form so the document
+// decodes into the regular structs
+func RestoreKeyStyle(data []byte, style KeyStyle) ([]byte, error) {
+	_, restore := keyRenamers(style)
+	if restore == nil {
+		return data, nil
+	}
+	return renameKeys(data, restore)
+}
+
+// lookup renames keys present in mapping and leaves the rest untouched
+func lookup(mapping map[string]string) func(string) string {
+	return func(k string) string {
+		if renamed, ok := mapping[k]; ok {
+			return renamed
+		}
+		return k
+	}
+}
+
+// toSnake converts camelCase to snake_case: l1InfoRoot -> l1_info_root
+func toSnake(k string) string {
+	var b strings.Builder
+	for i, r := range k {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// toCamel converts snake_case back to camelCase: l1_info_root -> l1InfoRoot
+func toCamel(k string) string {
+	parts := strings.Split(k, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// renameKeys decodes with UseNumber so uint64 values survive the round trip intact
+func renameKeys(data []byte, rename func(string) string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(renameValue(doc, rename))
+}
+
+func renameValue(v interface{}, rename func(string) string) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, child := range val {
+			out[rename(k)] = renameValue(child, rename)
+		}
+		return out
+	case []interface{}:
+		for i, child := range val {
+			val[i] = renameValue(child, rename)
+		}
+		return val
+	default:
+		return v
+	}
+}
@@ -0,0 +1,67 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// sampleEntry sets every field that carries a styled key
+func sampleEntry() LogEntry {
+	txIndex := uint64(4)
+	return LogEntry{
+		Index: 7, BlockNumber: 19_000_000, BlockHash: "0xbh", ParentHash: "0xph", L1InfoRoot: "0xroot",
+		Timestamp: 1_700_000_000, GasUsed: 21_000, GasPrice: NewBigInt(big.NewInt(30_000_000_000)),
+		TxHash: "0xtx", TxIndex: &txIndex, LogIndex: 2, Topics: []string{"0xt0", "0xt1"},
+		EventName: "Transfer", Enriched: true, RawLog: &RawLog{Address: "0xc0", Topics: []string{"0xt0"}},
+		CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+func TestKeyStyleRoundTrip(t *testing.T) {
+	entry := sampleEntry()
+	verbose, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		style       KeyStyle
+		has, hasNot string
+	}{
+		{KeyStyleDefault, `"blockNumber":`, `"bn":`},
+		{KeyStyleShort, `"bn":`, `"blockNumber":`},
+		{KeyStyleSnake, `"block_number":`, `"blockNumber":`},
+	} {
+		styled, err := ApplyKeyStyle(verbose, tc.style)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(styled, []byte(tc.has)) || bytes.Contains(styled, []byte(tc.hasNot)) {
+			t.Errorf("%q style: want %s and no %s in %s", tc.style, tc.has, tc.hasNot, styled)
+		}
+
+		restored, err := RestoreKeyStyle(styled, tc.style)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var back LogEntry
+		if err := json.Unmarshal(restored, &back); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(back, entry) {
+			t.Errorf("%q style round trip:\n got %+v\nwant %+v", tc.style, back, entry)
+		}
+	}
+
+	short, _ := ApplyKeyStyle(verbose, KeyStyleShort)
+	if len(short) >= len(verbose) {
+		t.Errorf("short keys gave %d bytes, verbose %d", len(short), len(verbose))
+	}
+	if _, err := ParseKeyStyle("tiny"); err == nil {
+		t.Error(`ParseKeyStyle("tiny") passed`)
+	}
+}
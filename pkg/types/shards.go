@@ -0,0 +1,55 @@
+package types
+
+import (
+	"sort"
+	"time"
+)
+
+// ShardManifest lists the per-batch databases of a sharded backfill, which keeps the
+// worker DBs instead of consolidating them into one file
+type ShardManifest struct {
+	CreatedAt time.Time   `json:"createdAt"`
+	Shards    []ShardInfo `json:"shards"` // sorted by StartIndex, index ranges never overlap
+}
+
+// ShardInfo describes one shard database
+type ShardInfo struct {
+	File       string `json:"file"` // relative to the manifest's directory
+	StartIndex uint64 `json:"startIndex"`
+	EndIndex   uint64 `json:"endIndex"` // inclusive
+	StartBlock uint64 `json:"startBlock"`
+	EndBlock   uint64 `json:"endBlock"`
+	LogCount   uint64 `json:"logCount"`
+}
+
+// Find returns the shard holding index
+func (m *ShardManifest) Find(index uint64) (ShardInfo, bool) {
+	i := sort.Search(len(m.Shards), func(i int) bool { return m.Shards[i].EndIndex >= index })
+	if i < len(m.Shards) && m.Shards[i].StartIndex <= index {
+		return m.Shards[i], true
+	}
+	return ShardInfo{}, false
+}
+
+// Overlapping returns the shards whose index range intersects [start, end], in index
+// order. An end of 0 is open-ended.
+func (m *ShardManifest) Overlapping(start, end uint64) []ShardInfo {
+	i := sort.Search(len(m.Shards), func(i int) bool { return m.Shards[i].EndIndex >= start })
+	var shards []ShardInfo
+	for ; i < len(m.Shards); i++ {
+		if end > 0 && m.Shards[i].StartIndex > end {
+			break
+		}
+		shards = append(shards, m.Shards[i])
+	}
+	return shards
+}
+
+// TotalCount sums the log counts of every shard
+func (m *ShardManifest) TotalCount() uint64 {
+	var total uint64
+	for _, s := range m.Shards {
+		total += s.LogCount
+	}
+	return total
+}
@@ -4,16 +4,70 @@ import "time"
 
 // LogEntry represents an indexed Ethereum log event
 type LogEntry struct {
-	Index       uint64    `json:"index"`
-	BlockNumber uint64    `json:"blockNumber"`
-	BlockHash   string    `json:"blockHash"`
-	ParentHash  string    `json:"parentHash"`
-	L1InfoRoot  string    `json:"l1InfoRoot"`
-	Timestamp   uint64    `json:"timestamp"`
-	GasUsed     uint64    `json:"gasUsed"`
-	TxHash      string    `json:"txHash"`
-	LogIndex    uint64    `json:"logIndex"`
-	CreatedAt   time.Time `json:"createdAt"`
+	Index       uint64            `json:"index"`
+	BlockNumber uint64            `json:"blockNumber"`
+	BlockHash   string            `json:"blockHash"`
+	Address     string            `json:"address,omitempty"` // emitting contract
+	ParentHash  string            `json:"parentHash"`
+	L1InfoRoot  string            `json:"l1InfoRoot"`
+	Timestamp   uint64            `json:"timestamp"`
+	GasUsed     uint64            `json:"gasUsed"`
+	GasPrice    *BigInt           `json:"gasPrice,omitempty"` // effective gas price in wei
+	TxHash      string            `json:"txHash"`
+	TxIndex     *uint64           `json:"txIndex,omitempty"` // transaction position in the block, nil on older entries
+	LogIndex    uint64            `json:"logIndex"`
+	Topics      []string          `json:"topics,omitempty"`
+	EventTopic  string            `json:"eventTopic,omitempty"` // topic0, the event the log matched
+	EventName   string            `json:"eventName,omitempty"`
+	From        string            `json:"from,omitempty"`        // token sender or owner, decoded with a -preset
+	To          string            `json:"to,omitempty"`          // token recipient, spender or operator, decoded with a -preset
+	Value       *BigInt           `json:"value,omitempty"`       // token amount, decoded with a -preset
+	TokenID     *BigInt           `json:"tokenId,omitempty"`     // ERC-721/1155 token id, decoded with a -preset
+	Enriched    bool              `json:"enriched"`              // false when block data could not be fetched
+	Pending     bool              `json:"pending,omitempty"`     // seen at the head, not yet past the confirmation depth
+	RawLog      *RawLog           `json:"rawLog,omitempty"`      // complete on-chain log, kept in archival mode
+	Annotations map[string]string `json:"annotations,omitempty"` // set by processing hooks
+	CreatedAt   time.Time         `json:"createdAt"`
+}
+
+// TxPosition returns the index of the entry's transaction in its block, falling back to
+// the raw log for entries stored before TxIndex was recorded
+func (e *LogEntry) TxPosition() (uint64, bool) {
+	if e.TxIndex != nil {
+		return *e.TxIndex, true
+	}
+	if e.RawLog != nil {
+		return uint64(e.RawLog.TxIndex), true
+	}
+	return 0, false
+}
+
+// Topic0 returns the event topic of the entry, falling back to its topics or raw log for
+// entries stored before EventTopic was recorded, or "" for an anonymous event
+func (e *LogEntry) Topic0() string {
+	switch {
+	case e.EventTopic != "":
+		return e.EventTopic
+	case len(e.Topics) > 0:
+		return e.Topics[0]
+	case e.RawLog != nil && len(e.RawLog.Topics) > 0:
+		return e.RawLog.Topics[0]
+	}
+	return ""
+}
+
+// RawLog mirrors every field of a go-ethereum types.Log so entries can be re-decoded
+// later without going back to the node
+type RawLog struct {
+	Address     string   `json:"address"`
+	Topics      []string `json:"topics"`
+	Data        string   `json:"data"` // 0x-prefixed hex
+	BlockNumber uint64   `json:"blockNumber"`
+	TxHash      string   `json:"txHash"`
+	TxIndex     uint     `json:"txIndex"`
+	BlockHash   string   `json:"blockHash"`
+	Index       uint     `json:"index"`
+	Removed     bool     `json:"removed"`
 }
 
 // CheckpointData represents the cursor state for resuming indexing
@@ -33,10 +87,12 @@ type RollbackInfo struct {
 
 // ApiResponse wraps API responses
 type ApiResponse struct {
-	Status  int         `json:"status"`
-	Message string      `json:"message,omitempty"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	Status     int         `json:"status"`
+	Message    string      `json:"message,omitempty"`
+	Data       interface{} `json:"data,omitempty"`
+	Count      *int        `json:"count,omitempty"`      // set on list responses
+	NextCursor *uint64     `json:"nextCursor,omitempty"` // index to resume from when more results exist
+	Error      string      `json:"error,omitempty"`
 }
 
 // HealthStatus represents the health check response
@@ -46,6 +102,27 @@ type HealthStatus struct {
 	LastBlockIndexed uint64 `json:"lastBlockIndexed"`
 	TotalIndexed     uint64 `json:"totalIndexed"`
 	HeadLag          uint64 `json:"headLag"`
+	HeadLagThreshold uint64 `json:"headLagThreshold"`
+}
+
+// ReadyStatus is the /v1/ready response: the outcome of the startup warmup and, once
+// that has succeeded, of the per-request readiness checks
+type ReadyStatus struct {
+	Status           string       `json:"status"`
+	Error            string       `json:"error,omitempty"`
+	TotalIndexed     uint64       `json:"totalIndexed"`
+	CheckpointBlock  uint64       `json:"checkpointBlock"`
+	WarmupSeconds    float64      `json:"warmupSeconds"`
+	HeadLag          uint64       `json:"headLag"`
+	HeadLagThreshold uint64       `json:"headLagThreshold"`
+	Checks           []ReadyCheck `json:"checks,omitempty"`
+}
+
+// ReadyCheck is one readiness check: storage, rpc or lag
+type ReadyCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
 }
 
 // IndexerStats represents current indexer statistics
@@ -60,6 +137,64 @@ type IndexerStats struct {
 	BackfillProgress float64       `json:"backfillProgress"`
 	RPCErrors        int64         `json:"rpcErrors"`
 	LastRollback     *RollbackInfo `json:"lastRollback,omitempty"`
+	HeadTimestamp    int64         `json:"headTimestamp"`   // unix seconds of the head block
+	HeadSkewSeconds  float64       `json:"headSkewSeconds"` // local time minus HeadTimestamp
+	HeadStale        bool          `json:"headStale"`       // HeadSkewSeconds above the max head skew
+}
+
+// IndexRange describes the coverage window of the index
+type IndexRange struct {
+	FirstBlock uint64 `json:"firstBlock"`
+	LastBlock  uint64 `json:"lastBlock"`
+	FirstIndex uint64 `json:"firstIndex"`
+	LastIndex  uint64 `json:"lastIndex"`
+	TotalCount uint64 `json:"totalCount"`
+}
+
+// BatchInfo is the per-batch analytics record the bulk indexer writes to its batch_info bucket
+type BatchInfo struct {
+	WorkerID         int     `json:"workerId"`
+	BatchID          int     `json:"batchId"`
+	StartBlock       uint64  `json:"startBlock"`
+	EndBlock         uint64  `json:"endBlock"`
+	StartIndex       uint64  `json:"startIndex"`
+	LogCount         uint64  `json:"logCount"`
+	ProcessingTimeMs int64   `json:"processingTimeMs"`
+	GasAnalyzed      uint64  `json:"gasAnalyzed"`
+	FeesWei          *BigInt `json:"feesWei,omitempty"`        // sum of gasUsed × gasPrice over the batch
+	Dropped          uint64  `json:"dropped,omitempty"`        // entries a processing hook dropped
+	DeadLettered     uint64  `json:"deadLettered,omitempty"`   // entries stored in the dead-letter bucket instead
+	VerifyFailures   uint64  `json:"verifyFailures,omitempty"` // logs that failed receipt verification
+}
+
+// ReindexResult summarizes a secondary-index rebuild
+type ReindexResult struct {
+	Scanned uint64   `json:"scanned"`
+	Skipped uint64   `json:"skipped"` // entries that could not be decoded
+	Buckets []string `json:"buckets"`
+}
+
+// RangeCount is the result of a count-only range query
+type RangeCount struct {
+	StartIndex uint64 `json:"startIndex"`
+	EndIndex   uint64 `json:"endIndex,omitempty"` // 0 means open-ended
+	Count      uint64 `json:"count"`
+}
+
+// DailyStat aggregates the logs whose block falls on one UTC day
+type DailyStat struct {
+	Day     string `json:"day"` // YYYY-MM-DD
+	Count   uint64 `json:"count"`
+	GasUsed uint64 `json:"gasUsed"`
+}
+
+// SnapshotInfo describes a database holding the index as of one block
+type SnapshotInfo struct {
+	Block     uint64    `json:"block"` // every log at or below this block, none above
+	LogCount  uint64    `json:"logCount"`
+	LastIndex uint64    `json:"lastIndex"`
+	CreatedAt time.Time `json:"createdAt"`
+	Path      string    `json:"path,omitempty"`
 }
 
 // LogsQueryRequest represents query parameters for log retrieval
@@ -71,3 +206,46 @@ type LogsQueryRequest struct {
 	Limit       int    `json:"limit,omitempty"`
 	Offset      int    `json:"offset,omitempty"`
 }
+
+// ScaleSignal is the autoscaling recommendation served at /v1/scale-signal, with the
+// numbers it was derived from
+type ScaleSignal struct {
+	Recommendation   string  `json:"recommendation"` // scale_up, steady or scale_down
+	Reason           string  `json:"reason"`
+	HeadLag          uint64  `json:"headLag"`
+	HeadLagThreshold uint64  `json:"headLagThreshold"`
+	ScaleDownLag     uint64  `json:"scaleDownLag"`
+	LagTrend         float64 `json:"lagTrend"`   // change in head lag over the window, blocks per minute; negative is catching up
+	Throughput       float64 `json:"throughput"` // logs processed per second over the window
+	BackfillProgress float64 `json:"backfillProgress"`
+	WindowSeconds    float64 `json:"windowSeconds"` // span of the samples the trend covers
+	Samples          int     `json:"samples"`
+}
+
+// DiscoveredContract is a child contract found through its factory's creation event.
+// Its logs are indexed alongside the configured contracts from then on.
+type DiscoveredContract struct {
+	Address      string    `json:"address"`
+	Factory      string    `json:"factory"`
+	BlockNumber  uint64    `json:"blockNumber"` // block of the creation event
+	TxHash       string    `json:"txHash"`
+	DiscoveredAt time.Time `json:"discoveredAt"`
+}
+
+// DeadLetter is a log that failed processing, kept with the failure instead of being
+// dropped or failing its batch. Entry is the log as built before the failing stage,
+// with RawLog set so it can be re-decoded.
+type DeadLetter struct {
+	Entry    *LogEntry `json:"entry"`
+	Stage    string    `json:"stage"` // hook, decode or store
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failedAt"`
+}
+
+// ReprocessResult reports the outcome of retrying dead letters
+type ReprocessResult struct {
+	Stored  []uint64      `json:"stored"`            // indices now in the logs bucket
+	Failed  []*DeadLetter `json:"failed,omitempty"`  // still dead-lettered, with the new error
+	Missing []uint64      `json:"missing,omitempty"` // no dead letter under the index
+}